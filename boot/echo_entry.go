@@ -10,11 +10,14 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rookie-ninja/rk-echo/middleware/auth"
+	"github.com/rookie-ninja/rk-echo/middleware/authz"
+	"github.com/rookie-ninja/rk-echo/middleware/bodylimit"
 	"github.com/rookie-ninja/rk-echo/middleware/cors"
 	"github.com/rookie-ninja/rk-echo/middleware/csrf"
 	"github.com/rookie-ninja/rk-echo/middleware/gzip"
@@ -25,12 +28,14 @@ import (
 	rkechoprom "github.com/rookie-ninja/rk-echo/middleware/prom"
 	"github.com/rookie-ninja/rk-echo/middleware/ratelimit"
 	"github.com/rookie-ninja/rk-echo/middleware/secure"
+	"github.com/rookie-ninja/rk-echo/middleware/session"
+	"github.com/rookie-ninja/rk-echo/middleware/shed"
+	"github.com/rookie-ninja/rk-echo/middleware/sign"
 	"github.com/rookie-ninja/rk-echo/middleware/timeout"
 	"github.com/rookie-ninja/rk-echo/middleware/tracing"
 	"github.com/rookie-ninja/rk-entry/v2/entry"
 	rkerror "github.com/rookie-ninja/rk-entry/v2/error"
 	"github.com/rookie-ninja/rk-entry/v2/middleware"
-	"github.com/rookie-ninja/rk-entry/v2/middleware/auth"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/cors"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/csrf"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
@@ -67,38 +72,40 @@ func init() {
 // BootEcho boot config which is for echo entry.
 type BootEcho struct {
 	Echo []struct {
-		Enabled       bool                          `yaml:"enabled" json:"enabled"`
-		Name          string                        `yaml:"name" json:"name"`
-		Port          uint64                        `yaml:"port" json:"port"`
-		Description   string                        `yaml:"description" json:"description"`
-		SW            rkentry.BootSW                `yaml:"sw" json:"sw"`
-		Docs          rkentry.BootDocs              `yaml:"docs" json:"docs"`
-		CommonService rkentry.BootCommonService     `yaml:"commonService" json:"commonService"`
-		Prom          rkentry.BootProm              `yaml:"prom" json:"prom"`
-		CertEntry     string                        `yaml:"certEntry" json:"certEntry"`
-		LoggerEntry   string                        `yaml:"loggerEntry" json:"loggerEntry"`
-		EventEntry    string                        `yaml:"eventEntry" json:"eventEntry"`
-		Static        rkentry.BootStaticFileHandler `yaml:"static" json:"static"`
-		PProf         rkentry.BootPProf             `yaml:"pprof" json:"pprof"`
+		Enabled       bool                             `yaml:"enabled" json:"enabled"`
+		Name          string                           `yaml:"name" json:"name"`
+		Port          uint64                           `yaml:"port" json:"port"`
+		Description   string                           `yaml:"description" json:"description"`
+		SW            rkentry.BootSW                   `yaml:"sw" json:"sw"`
+		Docs          rkentry.BootDocs                 `yaml:"docs" json:"docs"`
+		CommonService rkentry.BootCommonService        `yaml:"commonService" json:"commonService"`
+		Prom          rkentry.BootProm                 `yaml:"prom" json:"prom"`
+		CertEntry     string                           `yaml:"certEntry" json:"certEntry"`
+		LoggerEntry   string                           `yaml:"loggerEntry" json:"loggerEntry"`
+		EventEntry    string                           `yaml:"eventEntry" json:"eventEntry"`
+		Static        rkentry.BootStaticFileHandler    `yaml:"static" json:"static"`
+		PProf         rkentry.BootPProf                `yaml:"pprof" json:"pprof"`
+		TokenService  rkechojwt.TokenServiceBootConfig `yaml:"tokenService" json:"tokenService"`
 		Middleware    struct {
-			Ignore     []string                `yaml:"ignore" json:"ignore"`
-			ErrorModel string                  `yaml:"errorModel" json:"errorModel"`
-			Logging    rkmidlog.BootConfig     `yaml:"logging" json:"logging"`
-			Prom       rkmidprom.BootConfig    `yaml:"prom" json:"prom"`
-			Auth       rkmidauth.BootConfig    `yaml:"auth" json:"auth"`
-			Cors       rkmidcors.BootConfig    `yaml:"cors" json:"cors"`
-			Meta       rkmidmeta.BootConfig    `yaml:"meta" json:"meta"`
-			Jwt        rkmidjwt.BootConfig     `yaml:"jwt" json:"jwt"`
-			Secure     rkmidsec.BootConfig     `yaml:"secure" json:"secure"`
-			RateLimit  rkmidlimit.BootConfig   `yaml:"rateLimit" json:"rateLimit"`
-			Csrf       rkmidcsrf.BootConfig    `yaml:"csrf" yaml:"csrf"`
-			Timeout    rkmidtimeout.BootConfig `yaml:"timeout" json:"timeout"`
-			Trace      rkmidtrace.BootConfig   `yaml:"trace" json:"trace"`
-			Gzip       struct {
-				Enabled bool     `yaml:"enabled" json:"enabled"`
-				Ignore  []string `yaml:"ignore" json:"ignore"`
-				Level   string   `yaml:"level" json:"level"`
-			} `yaml:"gzip" json:"gzip"`
+			Ignore     []string                   `yaml:"ignore" json:"ignore"`
+			ErrorModel string                     `yaml:"errorModel" json:"errorModel"`
+			Logging    rkmidlog.BootConfig        `yaml:"logging" json:"logging"`
+			Prom       rkmidprom.BootConfig       `yaml:"prom" json:"prom"`
+			Auth       rkechoauth.BootConfig      `yaml:"auth" json:"auth"`
+			Cors       rkmidcors.BootConfig       `yaml:"cors" json:"cors"`
+			Meta       rkmidmeta.BootConfig       `yaml:"meta" json:"meta"`
+			Jwt        rkechojwt.BootConfig       `yaml:"jwt" json:"jwt"`
+			Secure     rkmidsec.BootConfig        `yaml:"secure" json:"secure"`
+			RateLimit  rkecholimit.BootConfig     `yaml:"rateLimit" json:"rateLimit"`
+			Csrf       rkmidcsrf.BootConfig       `yaml:"csrf" yaml:"csrf"`
+			Timeout    rkechotimeout.BootConfig   `yaml:"timeout" json:"timeout"`
+			Trace      rkmidtrace.BootConfig      `yaml:"trace" json:"trace"`
+			BodyLimit  rkechobodylimit.BootConfig `yaml:"bodyLimit" json:"bodyLimit"`
+			Gzip       rkechogzip.BootConfig      `yaml:"gzip" json:"gzip"`
+			Shed       rkechoshed.BootConfig      `yaml:"shed" json:"shed"`
+			Sign       rkechosign.BootConfig      `yaml:"sign" json:"sign"`
+			Authz      rkechoauthz.BootConfig     `yaml:"authz" json:"authz"`
+			Session    rkechosession.BootConfig   `yaml:"session" json:"session"`
 		} `yaml:"middleware" json:"middleware"`
 	} `yaml:"echo" json:"echo"`
 }
@@ -119,6 +126,7 @@ type EchoEntry struct {
 	StaticFileEntry    *rkentry.StaticFileHandlerEntry `json:"-" yaml:"-"`
 	CertEntry          *rkentry.CertEntry              `json:"-" yaml:"-"`
 	PProfEntry         *rkentry.PProfEntry             `json:"-" yaml:"-"`
+	TokenService       *rkechojwt.TokenService         `json:"-" yaml:"-"`
 	bootstrapLogOnce   sync.Once                       `json:"-" yaml:"-"`
 }
 
@@ -227,16 +235,60 @@ func RegisterEchoEntryYAML(raw []byte) map[string]rkentry.Entry {
 				rkmidtrace.ToOptions(&element.Middleware.Trace, element.Name, EchoEntryType)...))
 		}
 
+		// body limit middleware
+		if element.Middleware.BodyLimit.Enabled {
+			inters = append(inters, rkechobodylimit.Middleware(
+				rkechobodylimit.ToOptions(&element.Middleware.BodyLimit, element.Name, EchoEntryType,
+					promRegistry)...))
+		}
+
 		// cors middleware
 		if element.Middleware.Cors.Enabled {
 			inters = append(inters, rkechocors.Middleware(
 				rkmidcors.ToOptions(&element.Middleware.Cors, element.Name, EchoEntryType)...))
 		}
 
+		// token service, which shares signer and revocation list with jwt middleware
+		var tokenService *rkechojwt.TokenService
+		if element.TokenService.Enabled {
+			if !element.Middleware.Jwt.Enabled {
+				rkentry.ShutdownWithError(errors.New("jwt middleware is required by token service"))
+			}
+			if len(element.Middleware.Jwt.Jwks.Url) > 0 || len(element.Middleware.Jwt.Jwks.Path) > 0 {
+				rkentry.ShutdownWithError(errors.New("token service could not sign tokens with keys of jwks"))
+			}
+			// without key, rk-entry falls back to well known default key which makes tokens forgeable
+			jwtConfig := element.Middleware.Jwt
+			if len(jwtConfig.SignerEntry) < 1 && jwtConfig.Symmetric == nil && jwtConfig.Asymmetric == nil {
+				rkentry.ShutdownWithError(errors.New("token service requires signerEntry, symmetric or asymmetric key of jwt middleware"))
+			}
+			if jwtConfig.SkipVerify {
+				rkentry.ShutdownWithError(errors.New("token service could not sign tokens if skipVerify of jwt middleware is enabled"))
+			}
+
+			tokenService = rkechojwt.NewTokenService(rkechojwt.ToTokenServiceOptions(&element.TokenService)...)
+		}
+
 		// jwt middleware
 		if element.Middleware.Jwt.Enabled {
-			inters = append(inters, rkechojwt.Middleware(
-				rkmidjwt.ToOptions(&element.Middleware.Jwt, element.Name, EchoEntryType)...))
+			echoOpts := rkechojwt.ToOptions(&element.Middleware.Jwt, element.Name, EchoEntryType)
+			rkOpts := rkmidjwt.ToOptions(&element.Middleware.Jwt.BootConfig, element.Name, EchoEntryType)
+			if tokenService != nil {
+				echoOpts = append(echoOpts, rkechojwt.WithRevocationList(tokenService.GetRevocationList()))
+				rkOpts = append(rkOpts, rkmidjwt.WithPathToIgnore(
+					tokenService.LoginPath, tokenService.RefreshPath, tokenService.RevokePath))
+			}
+
+			inters = append(inters, rkechojwt.MiddlewareWithOption(echoOpts, rkOpts...))
+
+			// signer was registered with name of entry while creating middleware if signer entry is missing
+			if tokenService != nil {
+				signer := rkentry.GlobalAppCtx.GetSignerJwtEntry(element.Middleware.Jwt.SignerEntry)
+				if signer == nil {
+					signer = rkentry.GlobalAppCtx.GetSignerJwtEntry(element.Name)
+				}
+				tokenService.SetSigner(signer)
+			}
 		}
 
 		// secure middleware
@@ -245,6 +297,12 @@ func RegisterEchoEntryYAML(raw []byte) map[string]rkentry.Entry {
 				rkmidsec.ToOptions(&element.Middleware.Secure, element.Name, EchoEntryType)...))
 		}
 
+		// session middleware, placed before csrf middleware which stores token in session
+		if element.Middleware.Session.Enabled {
+			inters = append(inters, rkechosession.Middleware(
+				rkechosession.ToOptions(&element.Middleware.Session, element.Name, EchoEntryType)...))
+		}
+
 		// csrf middleware
 		if element.Middleware.Csrf.Enabled {
 			inters = append(inters, rkechocsrf.Middleware(
@@ -253,12 +311,8 @@ func RegisterEchoEntryYAML(raw []byte) map[string]rkentry.Entry {
 
 		// gzip middleware
 		if element.Middleware.Gzip.Enabled {
-			opts := []rkechogzip.Option{
-				rkechogzip.WithEntryNameAndType(element.Name, EchoEntryType),
-				rkechogzip.WithLevel(element.Middleware.Gzip.Level),
-			}
-
-			inters = append(inters, rkechogzip.Middleware(opts...))
+			inters = append(inters, rkechogzip.Middleware(
+				rkechogzip.ToOptions(&element.Middleware.Gzip, element.Name, EchoEntryType, promRegistry)...))
 		}
 
 		// meta middleware
@@ -269,20 +323,41 @@ func RegisterEchoEntryYAML(raw []byte) map[string]rkentry.Entry {
 
 		// auth middlewares
 		if element.Middleware.Auth.Enabled {
-			inters = append(inters, rkechoauth.Middleware(
-				rkmidauth.ToOptions(&element.Middleware.Auth, element.Name, EchoEntryType)...))
+			inters = append(inters, rkechoauth.MiddlewareWithOption(
+				rkechoauth.ToOptions(&element.Middleware.Auth, element.Name, EchoEntryType, promRegistry),
+				rkechoauth.ToRkOptions(&element.Middleware.Auth, element.Name, EchoEntryType)...))
+		}
+
+		// signature middleware, placed after body limit so that oversized body is rejected before read
+		if element.Middleware.Sign.Enabled {
+			inters = append(inters, rkechosign.Middleware(
+				rkechosign.ToOptions(&element.Middleware.Sign, element.Name, EchoEntryType)...))
+		}
+
+		// authorization middleware, placed after auth, jwt and sign middlewares which insert principal
+		if element.Middleware.Authz.Enabled {
+			inters = append(inters, rkechoauthz.Middleware(
+				rkechoauthz.ToOptions(&element.Middleware.Authz, element.Name, EchoEntryType)...))
+		}
+
+		// load shedding middleware, placed before timeout so that timed out requests decrease limit
+		if element.Middleware.Shed.Enabled {
+			inters = append(inters, rkechoshed.Middleware(
+				rkechoshed.ToOptions(&element.Middleware.Shed, element.Name, EchoEntryType, promRegistry)...))
 		}
 
 		// timeout middlewares
 		if element.Middleware.Timeout.Enabled {
-			inters = append(inters, rkechotimeout.Middleware(
-				rkmidtimeout.ToOptions(&element.Middleware.Timeout, element.Name, EchoEntryType)...))
+			inters = append(inters, rkechotimeout.MiddlewareWithOption(
+				rkechotimeout.ToOptions(&element.Middleware.Timeout, element.Name, EchoEntryType, promRegistry),
+				rkmidtimeout.ToOptions(&element.Middleware.Timeout.BootConfig, element.Name, EchoEntryType)...))
 		}
 
 		// rate limit middleware
 		if element.Middleware.RateLimit.Enabled {
-			inters = append(inters, rkecholimit.Middleware(
-				rkmidlimit.ToOptions(&element.Middleware.RateLimit, element.Name, EchoEntryType)...))
+			inters = append(inters, rkecholimit.MiddlewareWithOption(
+				rkecholimit.ToOptions(&element.Middleware.RateLimit, element.Name, EchoEntryType, promRegistry),
+				rkmidlimit.ToOptions(&element.Middleware.RateLimit.BootConfig, element.Name, EchoEntryType)...))
 		}
 
 		entry := RegisterEchoEntry(
@@ -297,7 +372,8 @@ func RegisterEchoEntryYAML(raw []byte) map[string]rkentry.Entry {
 			WithCommonServiceEntry(commonServiceEntry),
 			WithCertEntry(certEntry),
 			WithPProfEntry(pprofEntry),
-			WithStaticFileHandlerEntry(staticEntry))
+			WithStaticFileHandlerEntry(staticEntry),
+			WithTokenService(tokenService))
 
 		entry.AddMiddleware(inters...)
 
@@ -402,8 +478,8 @@ func (entry *EchoEntry) Bootstrap(ctx context.Context) {
 			return nil
 		})
 
-		// Register path into Router.
-		entry.Echo.GET(path.Join(entry.StaticFileEntry.Path, "*"), echo.WrapHandler(entry.StaticFileEntry.GetFileHandler()))
+		// Register path into Router, precompressed .br and .gz siblings will be served if exists.
+		entry.Echo.GET(path.Join(entry.StaticFileEntry.Path, "*"), rkechogzip.PrecompressedHandler(entry.StaticFileEntry.GetFileHandler()))
 		entry.StaticFileEntry.Bootstrap(ctx)
 	}
 
@@ -431,6 +507,11 @@ func (entry *EchoEntry) Bootstrap(ctx context.Context) {
 		entry.Echo.GET(path.Join(entry.PProfEntry.Path, "threadcreate"), echo.WrapHandler(http.HandlerFunc(pprof.Handler("threadcreate").ServeHTTP)))
 	}
 
+	// Is token service enabled?
+	if entry.IsTokenServiceEnabled() {
+		entry.TokenService.RegisterRoutes(entry.Echo)
+	}
+
 	// Start echo server
 	go entry.startServer(event, logger)
 
@@ -465,6 +546,15 @@ func (entry *EchoEntry) Bootstrap(ctx context.Context) {
 		if entry.IsPProfEnabled() {
 			entry.LoggerEntry.Info(fmt.Sprintf("PProfEntry: %s://localhost:%d%s", scheme, entry.Port, entry.PProfEntry.Path))
 		}
+		if entry.IsTokenServiceEnabled() {
+			handlers := []string{
+				fmt.Sprintf("%s://localhost:%d%s", scheme, entry.Port, entry.TokenService.LoginPath),
+				fmt.Sprintf("%s://localhost:%d%s", scheme, entry.Port, entry.TokenService.RefreshPath),
+				fmt.Sprintf("%s://localhost:%d%s", scheme, entry.Port, entry.TokenService.RevokePath),
+			}
+
+			entry.LoggerEntry.Info(fmt.Sprintf("TokenService: %s", strings.Join(handlers, ", ")))
+		}
 		entry.EventEntry.Finish(event)
 	})
 }
@@ -605,6 +695,11 @@ func (entry *EchoEntry) IsStaticFileHandlerEnabled() bool {
 	return entry.StaticFileEntry != nil
 }
 
+// IsTokenServiceEnabled Is token service enabled?
+func (entry *EchoEntry) IsTokenServiceEnabled() bool {
+	return entry.TokenService != nil
+}
+
 // ***************** Helper function *****************
 
 // Add basic fields into event.
@@ -801,6 +896,13 @@ func WithStaticFileHandlerEntry(staticEntry *rkentry.StaticFileHandlerEntry) Ech
 	}
 }
 
+// WithTokenService provide rkechojwt.TokenService.
+func WithTokenService(svc *rkechojwt.TokenService) EchoEntryOption {
+	return func(entry *EchoEntry) {
+		entry.TokenService = svc
+	}
+}
+
 // WithDocsEntry provide rkentry.DocsEntry.
 func WithDocsEntry(docs *rkentry.DocsEntry) EchoEntryOption {
 	return func(entry *EchoEntry) {
@@ -57,18 +57,89 @@ echo:
        enabled: true
      ratelimit:
        enabled: true
+       keyBy: ip
+       headersOnAllResponses: true
+       mode: wait
+       maxWaitMs: 100
+       store:
+         type: memory
      timeout:
        enabled: true
+       timeoutMs: 5000
+       streamingPaths: ["/events"]
+       enableDeadlineHeaders: true
+       responses:
+         - code: 503
+           retryAfterSec: 1
      cors:
        enabled: true
      jwt:
        enabled: true
+       jwks:
+         url: "http://localhost:8080/.well-known/jwks.json"
+         refreshIntervalMs: 60000
+       authorization:
+         - path: "/admin"
+           methods: ["POST"]
+           roles: ["admin"]
+           claims:
+             - name: "tenant"
+               values: ["rk"]
      secure:
        enabled: true
      csrf:
        enabled: true
      gzip:
        enabled: true
+       ignore: ["/ignore"]
+       paths:
+         - path: "/download"
+           level: bestSpeed
+     bodyLimit:
+       enabled: true
+       maxBytes: 1024
+       paths:
+         - path: "/upload"
+           maxBytes: 4096
+     shed:
+       enabled: true
+       algorithm: gradient
+       paths:
+         - path: "/report"
+           priority: low
+     sign:
+       enabled: true
+       ignore: ["/healthz"]
+       scheme: canonical
+       secrets:
+         - name: partner-a
+           secret: secret-a
+       maxSkewMs: 60000
+       replayProtection: true
+     authz:
+       enabled: true
+       dryRun: true
+       ignore: ["/healthz"]
+       policy:
+         roles:
+           - name: order-reader
+             permissions:
+               - methods: ["GET"]
+                 paths: ["/v1/tenants/:tenant/orders/*"]
+                 conditions:
+                   sameTenant: true
+         bindings:
+           - principals: ["partner-a"]
+             roles: ["order-reader"]
+     session:
+       enabled: true
+       ignore: ["/healthz"]
+       store: cookie
+       secrets: ["ut-secret"]
+       encryptionKey: ut-key
+       idleTimeoutMs: 600000
+       cookie:
+         sameSite: strict
  - name: greeter2
    port: 2008
    enabled: true
@@ -79,6 +150,11 @@ echo:
      enabled: true
    docs:
      enabled: true
+   tokenService:
+     enabled: true
+     accessTokenTtlMs: 60000
+     basic:
+       - "user:pass"
    middleware:
      logging:
        enabled: true
@@ -88,6 +164,25 @@ echo:
        enabled: true
        basic:
          - "user:pass"
+         - "admin:$2a$04$9l.78xeaXt4L.nru9h0oZuUaqSBBFouyBk/s259EXHQRmcfVqHGNS"
+       apiKeys:
+         lookup: "header:X-API-Key,query:api_key"
+         keys:
+           - id: "partner-a"
+             secret: "6b86b273ff34fce19d6b804eff5a3f5747ada4eaa22f1d49c01e52ddb7875b4b"
+             owner: "partner-a"
+             paths: ["/v1/orders"]
+             methods: ["GET"]
+             expiresAt: "2030-01-01T00:00:00Z"
+       introspection:
+         url: "http://localhost:8080/oauth2/introspect"
+         clientId: "ut-client"
+         clientSecret: "ut-secret"
+     jwt:
+       enabled: true
+       symmetric:
+         algorithm: HS256
+         token: "ut-token-service-key"
  - name: greeter3
    port: 2022
    enabled: false
@@ -269,11 +364,51 @@ func TestRegisterEchoEntryYAML(t *testing.T) {
 
 	greeter2 := entries["greeter2"].(*EchoEntry)
 	assert.NotNil(t, greeter2)
+	assert.False(t, greeter.IsTokenServiceEnabled())
+	assert.True(t, greeter2.IsTokenServiceEnabled())
 
 	greeter3 := entries["greeter3"]
 	assert.Nil(t, greeter3)
 }
 
+func TestRegisterEchoEntryYAML_TokenServiceWithoutKey(t *testing.T) {
+	// without key, default key of rk-entry would be used
+	assert.Panics(t, func() {
+		RegisterEchoEntryYAML([]byte(`
+echo:
+ - name: ut-token-service
+   port: 2009
+   enabled: true
+   tokenService:
+     enabled: true
+     basic: ["user:pass"]
+   middleware:
+     jwt:
+       enabled: true
+`))
+	})
+
+	// with skipVerify, signer is missing
+	assert.Panics(t, func() {
+		RegisterEchoEntryYAML([]byte(`
+echo:
+ - name: ut-token-service
+   port: 2009
+   enabled: true
+   tokenService:
+     enabled: true
+     basic: ["user:pass"]
+   middleware:
+     jwt:
+       enabled: true
+       skipVerify: true
+       symmetric:
+         algorithm: HS256
+         token: "ut-token-service-key"
+`))
+	})
+}
+
 func generateCerts() ([]byte, []byte) {
 	// Create certs and return as []byte
 	ca := &x509.Certificate{
@@ -0,0 +1,273 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/path"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultApiKeyLookup is default lookup of api key
+	DefaultApiKeyLookup = "header:" + rkmid.HeaderApiKey
+	// DefaultApiKeysReloadInterval is default interval of checking modification of api keys file
+	DefaultApiKeysReloadInterval = 5 * time.Second
+
+	// MetricsNameApiKeyRequests records requests authenticated by each api key
+	MetricsNameApiKeyRequests = "apiKeyRequests"
+
+	apiKeyAccepted  = "accepted"
+	apiKeyExpired   = "expired"
+	apiKeyForbidden = "forbidden"
+)
+
+var (
+	apiKeyLabelKeys    = []string{"entryName", "entryType", "keyId", "owner", "result"}
+	errApiKeyInvalid   = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Invalid api key")
+	errApiKeyExpired   = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Expired api key")
+	errApiKeyForbidden = rkmid.GetErrorBuilder().New(http.StatusForbidden, "Api key is not allowed to access this resource")
+)
+
+// ApiKey is api key with identity, raw key is never stored, only sha256 of it.
+//
+// Keys could be rotated by adding new key of the same owner and setting expiresAt of old one.
+type ApiKey struct {
+	// Id of key, recorded in metrics and event
+	Id string `yaml:"id" json:"id"`
+	// Secret is sha256 of key in hex
+	Secret string `yaml:"secret" json:"-"`
+	// Owner of key, inserted as auth principal
+	Owner string `yaml:"owner" json:"owner"`
+	// Paths are path prefixes key is allowed to access, matched by whole segments, all paths are allowed if empty
+	Paths []string `yaml:"paths" json:"paths"`
+	// Methods are http methods key is allowed to use, all methods are allowed if empty
+	Methods []string `yaml:"methods" json:"methods"`
+	// ExpiresAt is expiry of key in RFC3339 format, key never expires if empty
+	ExpiresAt string `yaml:"expiresAt" json:"expiresAt"`
+}
+
+// HashApiKey returns sha256 of key in hex which should be used as secret of ApiKey
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyEntry is parsed ApiKey
+type apiKeyEntry struct {
+	*ApiKey
+	secret    []byte
+	expiresAt time.Time
+}
+
+func newApiKeyEntry(key ApiKey) (*apiKeyEntry, error) {
+	if len(key.Id) < 1 {
+		return nil, errors.New("missing id of api key")
+	}
+
+	secret, err := hex.DecodeString(key.Secret)
+	if err != nil || len(secret) != sha256.Size {
+		return nil, fmt.Errorf("secret of api key %s should be sha256 in hex", key.Id)
+	}
+
+	res := &apiKeyEntry{
+		ApiKey: &key,
+		secret: secret,
+	}
+
+	if len(key.ExpiresAt) > 0 {
+		if res.expiresAt, err = time.Parse(time.RFC3339, key.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("invalid expiresAt of api key %s, %v", key.Id, err)
+		}
+	}
+
+	return res, nil
+}
+
+// principal is owner of key, or id if owner is missing
+func (e *apiKeyEntry) principal() string {
+	if len(e.Owner) > 0 {
+		return e.Owner
+	}
+
+	return e.Id
+}
+
+// isExpired returns true if key is expired
+func (e *apiKeyEntry) isExpired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// isAllowed returns true if key is allowed to access path with method
+func (e *apiKeyEntry) isAllowed(method, path string) bool {
+	pathAllowed := len(e.Paths) < 1
+	for i := range e.Paths {
+		if rkechopath.MatchPrefix(path, e.Paths[i]) {
+			pathAllowed = true
+			break
+		}
+	}
+
+	methodAllowed := len(e.Methods) < 1
+	for i := range e.Methods {
+		if strings.EqualFold(e.Methods[i], method) {
+			methodAllowed = true
+			break
+		}
+	}
+
+	return pathAllowed && methodAllowed
+}
+
+// parseApiKeys parses api keys file in YAML or JSON format, like:
+//
+//	keys:
+//	  - id: partner-a-2023
+//	    secret: <sha256 of key in hex>
+//	    owner: partner-a
+//	    paths: ["/v1/orders"]
+//	    methods: ["GET"]
+//	    expiresAt: "2024-01-01T00:00:00Z"
+func parseApiKeys(raw []byte) (map[string]*apiKeyEntry, error) {
+	file := struct {
+		Keys []ApiKey `yaml:"keys"`
+	}{}
+
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*apiKeyEntry)
+	for i := range file.Keys {
+		entry, err := newApiKeyEntry(file.Keys[i])
+		if err != nil {
+			return nil, err
+		}
+		res[string(entry.secret)] = entry
+	}
+
+	return res, nil
+}
+
+// apiKeyLookup is source and name of api key in request
+type apiKeyLookup struct {
+	source string
+	name   string
+}
+
+// parseApiKeyLookup parses lookup in format of <source>:<name>, multiple lookups are separated by comma.
+// Supported sources are header, query and cookie.
+func parseApiKeyLookup(lookup string) ([]*apiKeyLookup, error) {
+	res := make([]*apiKeyLookup, 0)
+
+	for _, e := range strings.Split(lookup, ",") {
+		tokens := strings.SplitN(strings.TrimSpace(e), ":", 2)
+		if len(tokens) != 2 || len(tokens[1]) < 1 {
+			return nil, fmt.Errorf("invalid api key lookup %s, expect <source>:<name>", e)
+		}
+
+		switch tokens[0] {
+		case "header", "query", "cookie":
+			res = append(res, &apiKeyLookup{source: tokens[0], name: tokens[1]})
+		default:
+			return nil, fmt.Errorf("invalid source of api key lookup %s, expect one of header, query and cookie", e)
+		}
+	}
+
+	return res, nil
+}
+
+// apiKeys are api keys with identities from options and file, file is reloaded on change
+type apiKeys struct {
+	lookups  []*apiKeyLookup
+	static   map[string]*apiKeyEntry
+	file     *fileWatcher
+	lock     sync.RWMutex
+	fromFile map[string]*apiKeyEntry
+}
+
+func newApiKeys() *apiKeys {
+	return &apiKeys{
+		static:   make(map[string]*apiKeyEntry),
+		fromFile: make(map[string]*apiKeyEntry),
+	}
+}
+
+// isEmpty returns true if neither api key nor api keys file provided
+func (k *apiKeys) isEmpty() bool {
+	return len(k.static) < 1 && k.file == nil
+}
+
+// reload api keys file if modified, old keys are kept if failed
+func (k *apiKeys) reload(force bool) error {
+	if k.file == nil {
+		return nil
+	}
+
+	return k.file.reload(force, func(raw []byte) error {
+		keys, err := parseApiKeys(raw)
+		if err != nil {
+			return err
+		}
+
+		k.lock.Lock()
+		k.fromFile = keys
+		k.lock.Unlock()
+		return nil
+	})
+}
+
+// extract returns api key from request with lookups in order
+func (k *apiKeys) extract(ctx echo.Context) (string, bool) {
+	for _, lookup := range k.lookups {
+		var key string
+
+		switch lookup.source {
+		case "header":
+			key = ctx.Request().Header.Get(lookup.name)
+		case "query":
+			key = ctx.QueryParam(lookup.name)
+		case "cookie":
+			if cookie, err := ctx.Cookie(lookup.name); err == nil {
+				key = cookie.Value
+			}
+		}
+
+		if len(key) > 0 {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// find returns entry of key, key is looked up with sha256 of it and compared in constant time
+func (k *apiKeys) find(key string) *apiKeyEntry {
+	sum := sha256.Sum256([]byte(key))
+
+	k.lock.RLock()
+	entry, ok := k.static[string(sum[:])]
+	if !ok {
+		entry, ok = k.fromFile[string(sum[:])]
+	}
+	k.lock.RUnlock()
+
+	if !ok || subtle.ConstantTimeCompare(entry.secret, sum[:]) != 1 {
+		return nil
+	}
+
+	return entry
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauth
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/auth"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewApiKeyEntry(t *testing.T) {
+	// happy case
+	entry, err := newApiKeyEntry(ApiKey{
+		Id:        "ut-key",
+		Secret:    HashApiKey("ut-secret"),
+		Owner:     "ut-owner",
+		Paths:     []string{"/v1/orders"},
+		Methods:   []string{"GET"},
+		ExpiresAt: "2030-01-01T00:00:00Z",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-owner", entry.principal())
+	assert.False(t, entry.isExpired(time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, entry.isExpired(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, entry.isAllowed(http.MethodGet, "/v1/orders/1"))
+	assert.False(t, entry.isAllowed(http.MethodPost, "/v1/orders/1"))
+	assert.False(t, entry.isAllowed(http.MethodGet, "/v1/users"))
+	assert.True(t, entry.isAllowed(http.MethodGet, "/v1/orders"))
+	assert.False(t, entry.isAllowed(http.MethodGet, "/v1/orders-admin"))
+	assert.False(t, entry.isAllowed(http.MethodGet, "/v1/ordersExport"))
+
+	// without owner, paths, methods and expiry
+	entry, err = newApiKeyEntry(ApiKey{Id: "ut-key", Secret: HashApiKey("ut-secret")})
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-key", entry.principal())
+	assert.False(t, entry.isExpired(time.Now()))
+	assert.True(t, entry.isAllowed(http.MethodDelete, "/any"))
+
+	// invalid keys
+	_, err = newApiKeyEntry(ApiKey{Secret: HashApiKey("ut-secret")})
+	assert.NotNil(t, err)
+	_, err = newApiKeyEntry(ApiKey{Id: "ut-key", Secret: "ut-secret"})
+	assert.NotNil(t, err)
+	_, err = newApiKeyEntry(ApiKey{Id: "ut-key", Secret: HashApiKey("ut-secret"), ExpiresAt: "2030-01-01"})
+	assert.NotNil(t, err)
+}
+
+func TestParseApiKeyLookup(t *testing.T) {
+	lookups, err := parseApiKeyLookup("header:X-API-Key, query:api_key,cookie:api_key")
+	assert.Nil(t, err)
+	assert.Len(t, lookups, 3)
+	assert.Equal(t, &apiKeyLookup{source: "query", name: "api_key"}, lookups[1])
+
+	_, err = parseApiKeyLookup("header")
+	assert.NotNil(t, err)
+	_, err = parseApiKeyLookup("form:api_key")
+	assert.NotNil(t, err)
+}
+
+func TestApiKeys_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(fmt.Sprintf("keys:\n  - id: ut-key\n    secret: %s\n", HashApiKey("ut-secret"))), os.ModePerm))
+
+	keys := newApiKeys()
+	keys.file = newFileWatcher(path, time.Hour)
+	assert.False(t, keys.isEmpty())
+	assert.Nil(t, keys.reload(true))
+	assert.NotNil(t, keys.find("ut-secret"))
+	assert.Nil(t, keys.find("ut-missing"))
+
+	// rotate key, in JSON format
+	assert.Nil(t, os.WriteFile(path, []byte(fmt.Sprintf(`{"keys": [{"id": "ut-key-2", "secret": "%s"}]}`, HashApiKey("ut-secret-2"))), os.ModePerm))
+	assert.Nil(t, keys.reload(false))
+	assert.NotNil(t, keys.find("ut-secret"))
+	assert.Nil(t, keys.reload(true))
+	assert.Nil(t, keys.find("ut-secret"))
+	assert.Equal(t, "ut-key-2", keys.find("ut-secret-2").Id)
+
+	// invalid file keeps old keys
+	assert.Nil(t, os.WriteFile(path, []byte("keys:\n  - id: ut-key\n    secret: invalid\n"), os.ModePerm))
+	assert.NotNil(t, keys.reload(true))
+	assert.NotNil(t, keys.find("ut-secret-2"))
+}
+
+func TestMiddlewareWithOption_ApiKey(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	inter := MiddlewareWithOption([]Option{
+		WithEntryNameAndType("ut-entry", "ut-type"),
+		WithRegisterer(reg),
+		WithApiKeyLookup("header:X-API-Key,query:api_key,cookie:api_key"),
+		WithApiKeys(ApiKey{
+			Id:      "ut-key",
+			Secret:  HashApiKey("ut-secret"),
+			Owner:   "ut-owner",
+			Paths:   []string{"/ut-path"},
+			Methods: []string{http.MethodGet},
+		}, ApiKey{
+			Id:        "ut-expired",
+			Secret:    HashApiKey("ut-expired-secret"),
+			ExpiresAt: time.Now().Add(-time.Minute).Format(time.RFC3339),
+		}),
+	})
+
+	serve := func(method, path string, setKey func(req *http.Request)) (*httptest.ResponseRecorder, string) {
+		req := httptest.NewRequest(method, path, nil)
+		setKey(req)
+		w := httptest.NewRecorder()
+		principal := ""
+		inter(func(ctx echo.Context) error {
+			principal = rkechoctx.GetAuthPrincipal(ctx)
+			return nil
+		})(echo.New().NewContext(req, w))
+		return w, principal
+	}
+
+	// case 1: key in header, query and cookie
+	w, principal := serve(http.MethodGet, "/ut-path", func(req *http.Request) {
+		req.Header.Set("X-API-Key", "ut-secret")
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ut-owner", principal)
+
+	w, _ = serve(http.MethodGet, "/ut-path?api_key=ut-secret", func(req *http.Request) {})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, _ = serve(http.MethodGet, "/ut-path", func(req *http.Request) {
+		req.AddCookie(&http.Cookie{Name: "api_key", Value: "ut-secret"})
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 2: path or method not allowed
+	w, _ = serve(http.MethodPost, "/ut-path", func(req *http.Request) {
+		req.Header.Set("X-API-Key", "ut-secret")
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w, _ = serve(http.MethodGet, "/ut-path-admin", func(req *http.Request) {
+		req.Header.Set("X-API-Key", "ut-secret")
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// case 3: expired key
+	w, _ = serve(http.MethodGet, "/ut-path", func(req *http.Request) {
+		req.Header.Set("X-API-Key", "ut-expired-secret")
+	})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// case 4: invalid and missing key
+	w, _ = serve(http.MethodGet, "/ut-path", func(req *http.Request) {
+		req.Header.Set("X-API-Key", "ut-invalid")
+	})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w, _ = serve(http.MethodGet, "/ut-path", func(req *http.Request) {})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "X-API-Key")
+
+	// per key usage counters
+	assert.Equal(t, float64(6), gatherValue(t, reg, "rk_auth_apiKeyRequests"))
+
+	// case 5: unknown key is validated by rk-entry
+	inter = MiddlewareWithOption([]Option{
+		WithRegisterer(prometheus.NewRegistry()),
+		WithApiKeys(ApiKey{Id: "ut-key", Secret: HashApiKey("ut-secret")}),
+	}, rkmidauth.WithApiKeyAuth("ut-legacy"))
+	w, _ = serve(http.MethodGet, "/ut-path", func(req *http.Request) {
+		req.Header.Set("X-API-Key", "ut-legacy")
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w, _ = serve(http.MethodGet, "/ut-path", func(req *http.Request) {
+		req.Header.Set("X-API-Key", "ut-invalid")
+	})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func gatherValue(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	mfs, err := reg.Gather()
+	assert.Nil(t, err)
+
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+
+		res := float64(0)
+		for _, m := range mf.GetMetric() {
+			if m.GetCounter() != nil {
+				res += m.GetCounter().GetValue()
+			}
+		}
+		return res
+	}
+
+	return 0
+}
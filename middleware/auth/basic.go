@@ -0,0 +1,118 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/credential"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHtpasswdReloadInterval is default interval of checking modification of htpasswd file
+	DefaultHtpasswdReloadInterval = 5 * time.Second
+)
+
+// parseHtpasswd parses htpasswd file content with user:hash per line, blank lines and comments are skipped
+func parseHtpasswd(raw []byte) (map[string]rkechocredential.Credential, error) {
+	res := make(map[string]rkechocredential.Credential)
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) < 1 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		tokens := strings.SplitN(text, ":", 2)
+		if len(tokens) != 2 || len(tokens[0]) < 1 {
+			return nil, fmt.Errorf("invalid htpasswd entry at line %d", line)
+		}
+
+		cred, err := rkechocredential.Parse(tokens[1], false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid htpasswd entry at line %d, %v", line, err)
+		}
+
+		res[tokens[0]] = cred
+	}
+
+	return res, scanner.Err()
+}
+
+// basicAccounts are accounts of basic auth from options and htpasswd file, htpasswd file is reloaded on change
+type basicAccounts struct {
+	static   map[string]rkechocredential.Credential
+	file     *fileWatcher
+	lock     sync.RWMutex
+	htpasswd map[string]rkechocredential.Credential
+	dummy    rkechocredential.Credential
+}
+
+func newBasicAccounts() *basicAccounts {
+	return &basicAccounts{
+		static:   make(map[string]rkechocredential.Credential),
+		htpasswd: make(map[string]rkechocredential.Credential),
+		dummy:    rkechocredential.PlainCredential(make([]byte, sha256.Size)),
+	}
+}
+
+// isEmpty returns true if neither account nor htpasswd file provided
+func (a *basicAccounts) isEmpty() bool {
+	return len(a.static) < 1 && a.file == nil
+}
+
+// reload htpasswd file if modified, old accounts are kept if failed.
+//
+// Dummy credential is regenerated with accounts loaded, it should be forced once all static accounts were added.
+func (a *basicAccounts) reload(force bool) error {
+	if a.file == nil {
+		if force {
+			a.lock.Lock()
+			a.dummy = rkechocredential.NewDummy(a.static)
+			a.lock.Unlock()
+		}
+		return nil
+	}
+
+	return a.file.reload(force, func(raw []byte) error {
+		accounts, err := parseHtpasswd(raw)
+		if err != nil {
+			return err
+		}
+
+		dummy := rkechocredential.NewDummy(a.static, accounts)
+
+		a.lock.Lock()
+		a.htpasswd = accounts
+		a.dummy = dummy
+		a.lock.Unlock()
+		return nil
+	})
+}
+
+// verify returns true if password matches, password is still compared with dummy credential if user does not exist.
+func (a *basicAccounts) verify(user, password string) bool {
+	a.lock.RLock()
+	cred, ok := a.static[user]
+	if !ok {
+		cred, ok = a.htpasswd[user]
+	}
+	dummy := a.dummy
+	a.lock.RUnlock()
+
+	if !ok {
+		dummy.Verify(password)
+		return false
+	}
+
+	return cred.Verify(password)
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/credential"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func bcryptHash(password string) string {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	return string(hash)
+}
+
+func argon2Hash(password string) string {
+	salt := []byte("ut-salt-16-bytes")
+	key := argon2.IDKey([]byte(password), salt, 1, 1024, 1, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	// happy case
+	accounts, err := parseHtpasswd([]byte(fmt.Sprintf("# comment\n\nbcrypt:%s\nargon2:%s\n",
+		bcryptHash("ut-pass"), argon2Hash("ut-pass"))))
+	assert.Nil(t, err)
+	assert.Len(t, accounts, 2)
+	assert.True(t, accounts["bcrypt"].Verify("ut-pass"))
+	assert.True(t, accounts["argon2"].Verify("ut-pass"))
+
+	// plaintext is not allowed
+	_, err = parseHtpasswd([]byte("user:pass"))
+	assert.NotNil(t, err)
+
+	// invalid line
+	_, err = parseHtpasswd([]byte("user"))
+	assert.NotNil(t, err)
+	_, err = parseHtpasswd([]byte(":" + bcryptHash("ut-pass")))
+	assert.NotNil(t, err)
+}
+
+func TestBasicAccounts_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	assert.Nil(t, os.WriteFile(path, []byte("user:"+bcryptHash("ut-pass")), os.ModePerm))
+
+	accounts := newBasicAccounts()
+	accounts.file = newFileWatcher(path, time.Hour)
+	assert.False(t, accounts.isEmpty())
+
+	assert.Nil(t, accounts.reload(true))
+	assert.True(t, accounts.verify("user", "ut-pass"))
+	assert.False(t, accounts.verify("user", "ut-wrong"))
+	assert.False(t, accounts.verify("missing", "ut-pass"))
+
+	// modified file is not reloaded until reload interval passed
+	assert.Nil(t, os.WriteFile(path, []byte("# reloaded\nuser:"+bcryptHash("ut-new-pass")), os.ModePerm))
+	assert.Nil(t, accounts.reload(false))
+	assert.True(t, accounts.verify("user", "ut-pass"))
+
+	// reload after interval passed
+	assert.Nil(t, accounts.reload(true))
+	assert.True(t, accounts.verify("user", "ut-new-pass"))
+	assert.False(t, accounts.verify("user", "ut-pass"))
+
+	// invalid file keeps old accounts
+	assert.Nil(t, os.WriteFile(path, []byte("user:plaintext-is-not-allowed"), os.ModePerm))
+	assert.NotNil(t, accounts.reload(true))
+	assert.True(t, accounts.verify("user", "ut-new-pass"))
+
+	// missing file keeps old accounts
+	assert.Nil(t, os.Remove(path))
+	assert.NotNil(t, accounts.reload(true))
+	assert.True(t, accounts.verify("user", "ut-new-pass"))
+}
+
+func TestBasicAccounts_Dummy(t *testing.T) {
+	parse := func(password string) rkechocredential.Credential {
+		cred, err := rkechocredential.Parse(password, true)
+		assert.Nil(t, err)
+		return cred
+	}
+
+	// dummy follows accounts of static and htpasswd file
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	assert.Nil(t, os.WriteFile(path, []byte("user:"+bcryptHash("ut-pass")), os.ModePerm))
+	accounts := newBasicAccounts()
+	accounts.static["admin"] = parse("ut-pass")
+	assert.Nil(t, accounts.reload(true))
+	assert.IsType(t, rkechocredential.PlainCredential{}, accounts.dummy)
+	accounts.file = newFileWatcher(path, time.Hour)
+	assert.Nil(t, accounts.reload(true))
+	cost, err := bcrypt.Cost(accounts.dummy.(rkechocredential.BcryptCredential))
+	assert.Nil(t, err)
+	assert.Equal(t, bcrypt.MinCost, cost)
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/lru"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultIntrospectionTimeout is default timeout of request to introspection endpoint
+	DefaultIntrospectionTimeout = 5 * time.Second
+	// DefaultIntrospectionCacheSize is default max number of introspection results kept in memory
+	DefaultIntrospectionCacheSize = 10000
+	// IntrospectionNegativeTTL is how long inactive result is cached, so that garbage tokens
+	// won't be forwarded to introspection endpoint on every request
+	IntrospectionNegativeTTL = 10 * time.Second
+	// max size of introspection response
+	maxIntrospectionBytes = 1 << 20
+	// interval of removing expired results from cache
+	introspectionSweepInterval = time.Minute
+)
+
+// introspector calls OAuth2 introspection endpoint defined in RFC 7662 with client credentials,
+// active results are cached until exp and inactive results are cached for IntrospectionNegativeTTL.
+// Least recently used result will be evicted once DefaultIntrospectionCacheSize reached.
+type introspector struct {
+	url          string
+	clientId     string
+	clientSecret string
+	client       *http.Client
+	lock         sync.Mutex
+	cache        *rkecholru.Map[*introspectionCacheItem]
+	lastSweep    time.Time
+}
+
+// introspectionCacheItem is cached result of introspection
+type introspectionCacheItem struct {
+	res       *rkechoctx.TokenIntrospection
+	expiresAt time.Time
+}
+
+func newIntrospector(url, clientId, clientSecret string, client *http.Client) *introspector {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultIntrospectionTimeout}
+	}
+
+	return &introspector{
+		url:          url,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		client:       client,
+		cache:        rkecholru.New[*introspectionCacheItem](DefaultIntrospectionCacheSize),
+		lastSweep:    time.Now(),
+	}
+}
+
+// introspect returns introspection of token, error will be returned only if endpoint failed.
+// Token is not active if it is expired or not yet valid even though endpoint says it is active.
+func (i *introspector) introspect(ctx context.Context, token string) (*rkechoctx.TokenIntrospection, error) {
+	key := hashToken(token)
+	now := time.Now()
+
+	if res := i.getCached(key, now); res != nil {
+		return res, nil
+	}
+
+	res, err := i.fetch(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.ExpiresAt > 0 && res.ExpiresAt <= now.Unix() {
+		res.Active = false
+	}
+	if res.NotBefore > 0 && res.NotBefore > now.Unix() {
+		res.Active = false
+	}
+
+	// cache active result until exp, result without exp is never cached
+	if res.Active && res.ExpiresAt > 0 {
+		i.putCached(key, res, time.Unix(res.ExpiresAt, 0), now)
+	}
+
+	// cache inactive result for a short while, token not yet valid is cached until nbf at most
+	if !res.Active {
+		expiresAt := now.Add(IntrospectionNegativeTTL)
+		if res.NotBefore > now.Unix() && time.Unix(res.NotBefore, 0).Before(expiresAt) {
+			expiresAt = time.Unix(res.NotBefore, 0)
+		}
+		i.putCached(key, res, expiresAt, now)
+	}
+
+	return res, nil
+}
+
+func (i *introspector) getCached(key string, now time.Time) *rkechoctx.TokenIntrospection {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if item, ok := i.cache.Get(key); ok && now.Before(item.expiresAt) {
+		return item.res
+	}
+
+	return nil
+}
+
+func (i *introspector) putCached(key string, res *rkechoctx.TokenIntrospection, expiresAt, now time.Time) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if now.Sub(i.lastSweep) > introspectionSweepInterval {
+		i.cache.RemoveIf(func(item *introspectionCacheItem) bool {
+			return !now.Before(item.expiresAt)
+		})
+		i.lastSweep = now
+	}
+
+	i.cache.Set(key, &introspectionCacheItem{
+		res:       res,
+		expiresAt: expiresAt,
+	})
+}
+
+// fetch calls introspection endpoint with client credentials as basic auth
+func (i *introspector) fetch(ctx context.Context, token string) (*rkechoctx.TokenIntrospection, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if len(i.clientId) > 0 {
+		req.SetBasicAuth(url.QueryEscape(i.clientId), url.QueryEscape(i.clientSecret))
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from introspection endpoint", resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxIntrospectionBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &rkechoctx.TokenIntrospection{}
+	if err := json.Unmarshal(raw, res); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &res.Claims); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// hashToken avoid keeping raw tokens in memory
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
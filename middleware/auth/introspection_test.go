@@ -0,0 +1,186 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauth
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/lru"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// introspectionServer mocks OAuth2 introspection endpoint, tokens are mapped to responses
+type introspectionServer struct {
+	*httptest.Server
+	calls  int32
+	tokens map[string]map[string]interface{}
+}
+
+func newIntrospectionServer(tokens map[string]map[string]interface{}) *introspectionServer {
+	s := &introspectionServer{tokens: tokens}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.calls, 1)
+
+		if id, secret, ok := r.BasicAuth(); !ok || id != "ut-client" || secret != "ut-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		res, ok := s.tokens[r.PostFormValue("token")]
+		if !ok {
+			res = map[string]interface{}{"active": false}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}))
+
+	return s
+}
+
+func (s *introspectionServer) getCalls() int {
+	return int(atomic.LoadInt32(&s.calls))
+}
+
+func TestIntrospector_Introspect(t *testing.T) {
+	server := newIntrospectionServer(map[string]map[string]interface{}{
+		"ut-active": {
+			"active":    true,
+			"sub":       "ut-subject",
+			"scope":     "read write",
+			"client_id": "ut-client",
+			"aud":       "ut-aud",
+			"exp":       time.Now().Add(time.Hour).Unix(),
+			"tenant":    "ut-tenant",
+		},
+		"ut-no-exp": {
+			"active": true,
+			"sub":    "ut-subject",
+		},
+		"ut-expired": {
+			"active": true,
+			"exp":    time.Now().Add(-time.Minute).Unix(),
+		},
+		"ut-not-before": {
+			"active": true,
+			"nbf":    time.Now().Add(time.Hour).Unix(),
+		},
+	})
+	defer server.Close()
+
+	i := newIntrospector(server.URL, "ut-client", "ut-secret", nil)
+	ctx := context.Background()
+
+	// case 1: active token, cached until exp
+	res, err := i.introspect(ctx, "ut-active")
+	assert.Nil(t, err)
+	assert.True(t, res.Active)
+	assert.Equal(t, "ut-subject", res.Subject)
+	assert.Equal(t, "read write", res.Scope)
+	assert.Equal(t, []string{"ut-aud"}, []string(res.Audience))
+	assert.Equal(t, "ut-tenant", res.Claims["tenant"])
+
+	res, err = i.introspect(ctx, "ut-active")
+	assert.Nil(t, err)
+	assert.True(t, res.Active)
+	assert.Equal(t, 1, server.getCalls())
+
+	// case 2: active token without exp is never cached
+	i.introspect(ctx, "ut-no-exp")
+	res, _ = i.introspect(ctx, "ut-no-exp")
+	assert.True(t, res.Active)
+	assert.Equal(t, 3, server.getCalls())
+
+	// case 3: inactive token, cached for negative ttl
+	res, err = i.introspect(ctx, "ut-unknown")
+	assert.Nil(t, err)
+	assert.False(t, res.Active)
+	calls := server.getCalls()
+	res, err = i.introspect(ctx, "ut-unknown")
+	assert.Nil(t, err)
+	assert.False(t, res.Active)
+	assert.Equal(t, calls, server.getCalls())
+
+	// case 4: expired or not yet valid token
+	res, _ = i.introspect(ctx, "ut-expired")
+	assert.False(t, res.Active)
+	res, _ = i.introspect(ctx, "ut-not-before")
+	assert.False(t, res.Active)
+
+	// case 5: cached result expired
+	item, _ := i.cache.Get(hashToken("ut-active"))
+	item.expiresAt = time.Now().Add(-time.Second)
+	calls = server.getCalls()
+	i.introspect(ctx, "ut-active")
+	assert.Equal(t, calls+1, server.getCalls())
+
+	// case 6: invalid client credentials
+	i = newIntrospector(server.URL, "ut-client", "ut-wrong", nil)
+	_, err = i.introspect(ctx, "ut-active")
+	assert.NotNil(t, err)
+
+	// case 7: endpoint unavailable
+	i = newIntrospector("http://127.0.0.1:0", "ut-client", "ut-secret", nil)
+	_, err = i.introspect(ctx, "ut-active")
+	assert.NotNil(t, err)
+}
+
+func TestIntrospector_Sweep(t *testing.T) {
+	server := newIntrospectionServer(map[string]map[string]interface{}{
+		"ut-active": {
+			"active": true,
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		},
+	})
+	defer server.Close()
+
+	i := newIntrospector(server.URL, "ut-client", "ut-secret", nil)
+	i.cache.Set("ut-expired", &introspectionCacheItem{
+		res:       &rkechoctx.TokenIntrospection{Active: true},
+		expiresAt: time.Now().Add(-time.Second),
+	})
+	i.lastSweep = time.Now().Add(-time.Hour)
+
+	_, err := i.introspect(context.Background(), "ut-active")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, i.cache.Len())
+	assert.True(t, i.cache.Contains(hashToken("ut-active")))
+}
+
+func TestIntrospector_CacheBounded(t *testing.T) {
+	server := newIntrospectionServer(map[string]map[string]interface{}{})
+	defer server.Close()
+
+	i := newIntrospector(server.URL, "ut-client", "ut-secret", nil)
+	i.cache = rkecholru.New[*introspectionCacheItem](2)
+	ctx := context.Background()
+
+	// garbage tokens are cached, least recently used one is evicted
+	for _, token := range []string{"ut-garbage-1", "ut-garbage-2", "ut-garbage-3"} {
+		res, err := i.introspect(ctx, token)
+		assert.Nil(t, err)
+		assert.False(t, res.Active)
+	}
+	assert.Equal(t, 2, i.cache.Len())
+	assert.False(t, i.cache.Contains(hashToken("ut-garbage-1")))
+	assert.Equal(t, 3, server.getCalls())
+
+	i.introspect(ctx, "ut-garbage-3")
+	assert.Equal(t, 3, server.getCalls())
+
+	// inactive result expired after negative ttl
+	item, _ := i.cache.Get(hashToken("ut-garbage-3"))
+	assert.WithinDuration(t, time.Now().Add(IntrospectionNegativeTTL), item.expiresAt, time.Second)
+	item.expiresAt = time.Now().Add(-time.Second)
+	i.introspect(ctx, "ut-garbage-3")
+	assert.Equal(t, 4, server.getCalls())
+}
@@ -7,9 +7,25 @@
 package rkechoauth
 
 import (
+	"fmt"
 	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
 	"github.com/rookie-ninja/rk-entry/v2/middleware"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/auth"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	authTypeBasic  = "Basic"
+	authTypeBearer = "Bearer"
+)
+
+var (
+	errBasicInvalid        = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Invalid credential")
+	errTokenInactive       = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Invalid or expired token")
+	errIntrospectionFailed = rkmid.GetErrorBuilder().New(http.StatusServiceUnavailable, "Failed to introspect token")
 )
 
 // Middleware validate bellow authorization.
@@ -18,12 +34,49 @@ import (
 // 2: Bearer Token: Commonly known as token authentication. It is an HTTP authentication scheme that involves security tokens called bearer tokens.
 // 3: API key: An API key is a token that a client provides when making API calls. With API key auth, you send a key-value pair to the API in the request headers.
 func Middleware(opts ...rkmidauth.Option) echo.MiddlewareFunc {
+	return MiddlewareWithOption(nil, opts...)
+}
+
+// MiddlewareWithOption is the same as Middleware with options of echo side.
+//
+// Basic auth accounts provided by WithBasicAuth and WithHtpasswdFile take precedence over the ones of rk-entry.
+// Opaque bearer tokens are validated by OAuth2 introspection endpoint if WithIntrospection provided,
+// introspection of active token is inserted into context and could be retrieved by rkechoctx.GetTokenIntrospection.
+//
+// Authenticated principal could be retrieved by rkechoctx.GetAuthPrincipal.
+func MiddlewareWithOption(echoOpts []Option, opts ...rkmidauth.Option) echo.MiddlewareFunc {
 	set := rkmidauth.NewOptionSet(opts...)
+	echoSet := newOptionSet(echoOpts...)
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(ctx echo.Context) error {
 			ctx.Set(rkmid.EntryNameKey.String(), set.GetEntryName())
 
+			// case 0: auth of echo side
+			if echoSet.isEnabled() && !echoSet.ShouldIgnore(ctx.Request().URL.Path) {
+				// case 0.1: bearer token validated by introspection endpoint
+				if token, ok := bearerToken(ctx.Request()); ok && echoSet.introspector != nil {
+					return introspect(ctx, echoSet, token, next)
+				}
+
+				// case 0.2: api key with identity, unknown key is validated by rk-entry if configured
+				if key, ok := echoSet.apiKeys.extract(ctx); ok && !echoSet.apiKeys.isEmpty() {
+					if entry := findApiKey(ctx, echoSet, key); entry != nil || set.ShouldIgnore(ctx.Request().URL.Path) {
+						return apiKeyAuth(ctx, echoSet, entry, next)
+					}
+				}
+
+				// case 0.3: basic auth validated with hashed or plaintext accounts
+				if user, password, ok := ctx.Request().BasicAuth(); ok && !echoSet.basic.isEmpty() {
+					return basicAuth(ctx, echoSet, user, password, next)
+				}
+
+				// case 0.4: no auth of rk-entry configured, one of auth of echo side is required
+				if set.ShouldIgnore(ctx.Request().URL.Path) {
+					return missingAuth(ctx, echoSet)
+				}
+			}
+
 			// case 1: return to user if error occur
 			beforeCtx := set.BeforeCtx(ctx.Request())
 			set.Before(beforeCtx)
@@ -39,3 +92,118 @@ func Middleware(opts ...rkmidauth.Option) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// introspect validates token with introspection endpoint and insert result into context if token is active
+func introspect(ctx echo.Context, set *optionSet, token string, next echo.HandlerFunc) error {
+	res, err := set.introspector.introspect(ctx.Request().Context(), token)
+	if err != nil {
+		rkechoctx.GetLogger(ctx).Warn("Failed to introspect token, " + err.Error())
+		rkechoctx.GetEvent(ctx).SetCounter("introspectionFailed", 1)
+		return ctx.JSON(errIntrospectionFailed.Code(), errIntrospectionFailed)
+	}
+
+	if !res.Active {
+		rkechoctx.GetEvent(ctx).SetCounter("tokenInactive", 1)
+		ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, authTypeBearer+` error="invalid_token"`)
+		return ctx.JSON(errTokenInactive.Code(), errTokenInactive)
+	}
+
+	ctx.Set(rkechoctx.TokenIntrospectionKey, res)
+	if len(res.Username) > 0 {
+		setPrincipal(ctx, res.Username)
+	} else {
+		setPrincipal(ctx, res.Subject)
+	}
+
+	return next(ctx)
+}
+
+// basicAuth validates user and password with accounts of echo side
+func basicAuth(ctx echo.Context, set *optionSet, user, password string, next echo.HandlerFunc) error {
+	if err := set.basic.reload(false); err != nil {
+		rkechoctx.GetLogger(ctx).Warn("Failed to reload htpasswd file, " + err.Error())
+	}
+
+	if !set.basic.verify(user, password) {
+		ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, fmt.Sprintf(`%s realm="%s"`, authTypeBasic, set.basicRealm))
+		return ctx.JSON(errBasicInvalid.Code(), errBasicInvalid)
+	}
+
+	setPrincipal(ctx, user)
+	return next(ctx)
+}
+
+// findApiKey returns entry of api key, nil will be returned if not found
+func findApiKey(ctx echo.Context, set *optionSet, key string) *apiKeyEntry {
+	if err := set.apiKeys.reload(false); err != nil {
+		rkechoctx.GetLogger(ctx).Warn("Failed to reload api keys file, " + err.Error())
+	}
+
+	return set.apiKeys.find(key)
+}
+
+// apiKeyAuth validates expiry and permission of api key
+func apiKeyAuth(ctx echo.Context, set *optionSet, entry *apiKeyEntry, next echo.HandlerFunc) error {
+	if entry == nil {
+		return ctx.JSON(errApiKeyInvalid.Code(), errApiKeyInvalid)
+	}
+
+	rkechoctx.GetEvent(ctx).AddPair("apiKeyId", entry.Id)
+
+	if entry.isExpired(time.Now()) {
+		set.incApiKey(entry, apiKeyExpired)
+		return ctx.JSON(errApiKeyExpired.Code(), errApiKeyExpired)
+	}
+
+	if !entry.isAllowed(ctx.Request().Method, ctx.Request().URL.Path) {
+		set.incApiKey(entry, apiKeyForbidden)
+		return ctx.JSON(errApiKeyForbidden.Code(), errApiKeyForbidden)
+	}
+
+	set.incApiKey(entry, apiKeyAccepted)
+	setPrincipal(ctx, entry.principal())
+	return next(ctx)
+}
+
+// missingAuth returns 401 with auth schemes of echo side
+func missingAuth(ctx echo.Context, set *optionSet) error {
+	schemes := make([]string, 0)
+
+	if !set.basic.isEmpty() {
+		ctx.Response().Header().Add(echo.HeaderWWWAuthenticate, fmt.Sprintf(`%s realm="%s"`, authTypeBasic, set.basicRealm))
+		schemes = append(schemes, "Basic Auth")
+	}
+	if !set.apiKeys.isEmpty() {
+		for i := range set.apiKeys.lookups {
+			schemes = append(schemes, set.apiKeys.lookups[i].name)
+		}
+	}
+	if set.introspector != nil {
+		ctx.Response().Header().Add(echo.HeaderWWWAuthenticate, authTypeBearer)
+		schemes = append(schemes, authTypeBearer)
+	}
+
+	errResp := rkmid.GetErrorBuilder().New(http.StatusUnauthorized,
+		fmt.Sprintf("Missing authorization, provide one of bellow auth header:[%s]", strings.Join(schemes, ",")))
+	return ctx.JSON(errResp.Code(), errResp)
+}
+
+// setPrincipal inserts authenticated principal into context and event
+func setPrincipal(ctx echo.Context, principal string) {
+	if len(principal) < 1 {
+		return
+	}
+
+	ctx.Set(rkechoctx.AuthPrincipalKey, principal)
+	rkechoctx.GetEvent(ctx).AddPair("authPrincipal", principal)
+}
+
+// bearerToken returns token of Authorization header with Bearer scheme
+func bearerToken(req *http.Request) (string, bool) {
+	tokens := strings.SplitN(req.Header.Get(rkmid.HeaderAuthorization), " ", 2)
+	if len(tokens) != 2 || !strings.EqualFold(tokens[0], authTypeBearer) || len(tokens[1]) < 1 {
+		return "", false
+	}
+
+	return tokens[1], true
+}
@@ -8,13 +8,17 @@ package rkechoauth
 import (
 	"bytes"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
 	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/auth"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 var userFunc = func(context echo.Context) error {
@@ -52,3 +56,205 @@ func TestMiddleware(t *testing.T) {
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
+
+func TestMiddlewareWithOption_Introspection(t *testing.T) {
+	server := newIntrospectionServer(map[string]map[string]interface{}{
+		"ut-active": {
+			"active": true,
+			"sub":    "ut-subject",
+			"scope":  "read write",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		},
+	})
+	defer server.Close()
+
+	handler := func(ctx echo.Context) error {
+		assert.Equal(t, "ut-subject", rkechoctx.GetIntrospectedSubject(ctx))
+		assert.Equal(t, []string{"read", "write"}, rkechoctx.GetIntrospectedScopes(ctx))
+		return ctx.String(http.StatusOK, "")
+	}
+
+	serve := func(inter echo.MiddlewareFunc, path, authHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if len(authHeader) > 0 {
+			req.Header.Set(rkmid.HeaderAuthorization, authHeader)
+		}
+		w := httptest.NewRecorder()
+		inter(handler)(echo.New().NewContext(req, w))
+		return w
+	}
+
+	inter := MiddlewareWithOption([]Option{
+		WithIntrospection(server.URL, "ut-client", "ut-secret"),
+		WithPathToIgnore("/ut-ignore"),
+	})
+
+	// case 1: active token
+	w := serve(inter, "/ut-path", "Bearer ut-active")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 2: inactive token
+	w = serve(inter, "/ut-path", "Bearer ut-inactive")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get(echo.HeaderWWWAuthenticate), "invalid_token")
+
+	// case 3: missing token
+	w = serve(inter, "/ut-path", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get(echo.HeaderWWWAuthenticate))
+
+	// case 4: ignored path
+	req := httptest.NewRequest(http.MethodGet, "/ut-ignore", nil)
+	w = httptest.NewRecorder()
+	inter(userFunc)(echo.New().NewContext(req, w))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 5: basic auth still works along with introspection
+	inter = MiddlewareWithOption([]Option{
+		WithIntrospection(server.URL, "ut-client", "ut-secret"),
+	}, rkmidauth.WithBasicAuth("", "user:pass"))
+	req = httptest.NewRequest(http.MethodGet, "/ut-path", nil)
+	req.SetBasicAuth("user", "pass")
+	w = httptest.NewRecorder()
+	inter(userFunc)(echo.New().NewContext(req, w))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(inter, "/ut-path", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// case 6: introspection endpoint failed
+	inter = MiddlewareWithOption([]Option{
+		WithIntrospection(server.URL, "ut-client", "ut-wrong"),
+	})
+	w = serve(inter, "/ut-path", "Bearer ut-active")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{}
+
+	// with disabled
+	assert.Empty(t, ToOptions(config, "", "", nil))
+
+	// with enabled
+	config.Enabled = true
+	config.Ignore = []string{"/ut-ignore"}
+	config.Introspection.Url = "http://localhost:8080/introspect"
+	config.Introspection.ClientId = "ut-client"
+	config.Introspection.ClientSecret = "ut-secret"
+	config.Introspection.TimeoutMs = 1000
+	config.Basic = []string{"user:pass"}
+	config.Htpasswd.Path = "/ut-missing/.htpasswd"
+	config.Htpasswd.ReloadIntervalMs = 1000
+
+	// with missing htpasswd file
+	assert.Panics(t, func() {
+		newOptionSet(ToOptions(config, "ut-entry", "ut-type", prometheus.NewRegistry())...)
+	})
+	config.Htpasswd.Path = ""
+	config.ApiKeys.Lookup = "query:api_key"
+	config.ApiKeys.Path = "/ut-missing/keys.yaml"
+
+	// with missing api keys file
+	assert.Panics(t, func() {
+		newOptionSet(ToOptions(config, "ut-entry", "ut-type", prometheus.NewRegistry())...)
+	})
+	config.ApiKeys.Path = ""
+	config.ApiKeys.Keys = []ApiKey{{Id: "ut-key", Secret: HashApiKey("ut-secret")}}
+
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type", prometheus.NewRegistry())...)
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "ut-type", set.GetEntryType())
+	assert.True(t, set.ShouldIgnore("/ut-ignore"))
+	assert.NotNil(t, set.introspector)
+	assert.Equal(t, "ut-client", set.introspector.clientId)
+	assert.Equal(t, time.Second, set.introspector.client.Timeout)
+	assert.True(t, set.basic.verify("user", "pass"))
+	assert.Equal(t, "ut-entry", set.basicRealm)
+	assert.NotNil(t, set.apiKeys.find("ut-secret"))
+	assert.Equal(t, "query", set.apiKeys.lookups[0].source)
+	assert.NotNil(t, set.metricsSet)
+}
+
+func TestMiddlewareWithOption_BasicAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	assert.Nil(t, os.WriteFile(path, []byte("file-user:"+bcryptHash("file-pass")), os.ModePerm))
+
+	inter := MiddlewareWithOption([]Option{
+		WithBasicAuth("ut-realm", "plain-user:plain-pass", "argon2-user:"+argon2Hash("argon2-pass")),
+		WithHtpasswdFile(path, time.Hour),
+	})
+
+	serve := func(user, password string) (*httptest.ResponseRecorder, string) {
+		req := httptest.NewRequest(http.MethodGet, "/ut-path", nil)
+		if len(user) > 0 {
+			req.SetBasicAuth(user, password)
+		}
+		w := httptest.NewRecorder()
+		principal := ""
+		inter(func(ctx echo.Context) error {
+			principal = rkechoctx.GetAuthPrincipal(ctx)
+			return nil
+		})(echo.New().NewContext(req, w))
+		return w, principal
+	}
+
+	// case 1: plaintext, argon2 and htpasswd accounts
+	for user, password := range map[string]string{
+		"plain-user":  "plain-pass",
+		"argon2-user": "argon2-pass",
+		"file-user":   "file-pass",
+	} {
+		w, principal := serve(user, password)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, user, principal)
+	}
+
+	// case 2: invalid password
+	w, principal := serve("file-user", "plain-pass")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="ut-realm"`, w.Header().Get(echo.HeaderWWWAuthenticate))
+	assert.Empty(t, principal)
+
+	// case 3: missing auth
+	w, _ = serve("", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="ut-realm"`, w.Header().Get(echo.HeaderWWWAuthenticate))
+
+	// case 4: api key of rk-entry still works
+	inter = MiddlewareWithOption([]Option{
+		WithBasicAuth("ut-realm", "plain-user:plain-pass"),
+	}, rkmidauth.WithApiKeyAuth("ut-api-key"))
+	req := httptest.NewRequest(http.MethodGet, "/ut-path", nil)
+	req.Header.Set(rkmid.HeaderApiKey, "ut-api-key")
+	w = httptest.NewRecorder()
+	inter(userFunc)(echo.New().NewContext(req, w))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 5: invalid credential in options
+	assert.Panics(t, func() {
+		newOptionSet(WithBasicAuth("", "invalid"))
+	})
+	assert.Panics(t, func() {
+		newOptionSet(WithBasicAuth("", "user:$2y$10$invalid"))
+	})
+	assert.Panics(t, func() {
+		newOptionSet(WithHtpasswdFile(filepath.Join(t.TempDir(), "missing"), 0))
+	})
+}
+
+func TestToRkOptions(t *testing.T) {
+	config := &BootConfig{}
+	config.Enabled = true
+	config.Basic = []string{"user:pass"}
+	config.ApiKey = []string{"ut-api-key"}
+
+	// basic auth is handled by echo side only
+	set := rkmidauth.NewOptionSet(ToRkOptions(config, "", "")...)
+	req := httptest.NewRequest(http.MethodGet, "/ut-path", nil)
+	req.SetBasicAuth("user", "pass")
+	beforeCtx := set.BeforeCtx(req)
+	set.Before(beforeCtx)
+	assert.NotNil(t, beforeCtx.Output.ErrResp)
+	assert.Equal(t, []string{"user:pass"}, config.Basic)
+}
@@ -0,0 +1,319 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/credential"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/auth"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/prom"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ***************** OptionSet Implementation *****************
+
+// optionSet which is used for middleware implementation
+type optionSet struct {
+	entryName    string
+	entryType    string
+	pathToIgnore []string
+	// basic auth accounts with plaintext, bcrypt or argon2 hashed password
+	basicRealm string
+	basic      *basicAccounts
+	// api keys with identities
+	apiKeys    *apiKeys
+	registerer prometheus.Registerer
+	metricsSet *rkmidprom.MetricsSet
+	// OAuth2 token introspection defined in RFC 7662
+	introspectionUrl    string
+	clientId            string
+	clientSecret        string
+	introspectionClient *http.Client
+	introspector        *introspector
+}
+
+// Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:    "fake-entry",
+		entryType:    "",
+		pathToIgnore: []string{},
+		basic:        newBasicAccounts(),
+		apiKeys:      newApiKeys(),
+		registerer:   prometheus.DefaultRegisterer,
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	if len(set.apiKeys.lookups) < 1 {
+		set.apiKeys.lookups, _ = parseApiKeyLookup(DefaultApiKeyLookup)
+	}
+
+	if err := set.apiKeys.reload(true); err != nil {
+		rkentry.ShutdownWithError(fmt.Errorf("failed to load api keys file %s, %v", set.apiKeys.file.path, err))
+	}
+
+	if !set.apiKeys.isEmpty() {
+		set.metricsSet = rkmidprom.NewMetricsSet("rk", "auth", set.registerer)
+		set.metricsSet.RegisterCounter(MetricsNameApiKeyRequests, apiKeyLabelKeys...)
+	}
+
+	if err := set.basic.reload(true); err != nil {
+		rkentry.ShutdownWithError(fmt.Errorf("failed to load htpasswd file %s, %v", set.basic.file.path, err))
+	}
+
+	if len(set.introspectionUrl) > 0 {
+		set.introspector = newIntrospector(set.introspectionUrl, set.clientId, set.clientSecret, set.introspectionClient)
+	}
+
+	return set
+}
+
+// GetEntryName returns entry name
+func (set *optionSet) GetEntryName() string {
+	return set.entryName
+}
+
+// GetEntryType returns entry type
+func (set *optionSet) GetEntryType() string {
+	return set.entryType
+}
+
+// isEnabled returns true if any auth of echo side provided
+func (set *optionSet) isEnabled() bool {
+	return set.introspector != nil || !set.basic.isEmpty() || !set.apiKeys.isEmpty()
+}
+
+// Increase counter of requests authenticated by api key
+func (set *optionSet) incApiKey(entry *apiKeyEntry, result string) {
+	if set.metricsSet == nil {
+		return
+	}
+
+	if counter := set.metricsSet.GetCounterWithValues(MetricsNameApiKeyRequests,
+		set.entryName, set.entryType, entry.Id, entry.Owner, result); counter != nil {
+		counter.Inc()
+	}
+}
+
+// ShouldIgnore determine whether auth should be ignored based on path
+func (set *optionSet) ShouldIgnore(path string) bool {
+	for i := range set.pathToIgnore {
+		if strings.HasPrefix(path, set.pathToIgnore[i]) {
+			return true
+		}
+	}
+
+	return rkmid.ShouldIgnoreGlobal(path)
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML, extends BootConfig of rk-entry.
+type BootConfig struct {
+	rkmidauth.BootConfig `yaml:",inline" mapstructure:",squash"`
+	Htpasswd             struct {
+		Path             string `yaml:"path" json:"path"`
+		ReloadIntervalMs int    `yaml:"reloadIntervalMs" json:"reloadIntervalMs"`
+	} `yaml:"htpasswd" json:"htpasswd"`
+	ApiKeys struct {
+		Lookup           string   `yaml:"lookup" json:"lookup"`
+		Path             string   `yaml:"path" json:"path"`
+		ReloadIntervalMs int      `yaml:"reloadIntervalMs" json:"reloadIntervalMs"`
+		Keys             []ApiKey `yaml:"keys" json:"keys"`
+	} `yaml:"apiKeys" json:"apiKeys"`
+	Introspection struct {
+		Url          string `yaml:"url" json:"url"`
+		ClientId     string `yaml:"clientId" json:"clientId"`
+		ClientSecret string `yaml:"clientSecret" json:"-"`
+		TimeoutMs    int    `yaml:"timeoutMs" json:"timeoutMs"`
+	} `yaml:"introspection" json:"introspection"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string, reg prometheus.Registerer) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithRegisterer(reg),
+			WithPathToIgnore(config.Ignore...),
+			WithBasicAuth(entryName, config.Basic...),
+			WithApiKeys(config.ApiKeys.Keys...))
+
+		if len(config.ApiKeys.Lookup) > 0 {
+			opts = append(opts, WithApiKeyLookup(config.ApiKeys.Lookup))
+		}
+
+		if len(config.ApiKeys.Path) > 0 {
+			opts = append(opts, WithApiKeysFile(config.ApiKeys.Path,
+				time.Duration(config.ApiKeys.ReloadIntervalMs)*time.Millisecond))
+		}
+
+		if len(config.Htpasswd.Path) > 0 {
+			opts = append(opts, WithHtpasswdFile(config.Htpasswd.Path,
+				time.Duration(config.Htpasswd.ReloadIntervalMs)*time.Millisecond))
+		}
+
+		introspection := config.Introspection
+		if len(introspection.Url) > 0 {
+			opts = append(opts, WithIntrospection(introspection.Url, introspection.ClientId, introspection.ClientSecret))
+
+			if introspection.TimeoutMs > 0 {
+				opts = append(opts, WithIntrospectionHttpClient(&http.Client{
+					Timeout: time.Duration(introspection.TimeoutMs) * time.Millisecond,
+				}))
+			}
+		}
+	}
+
+	return opts
+}
+
+// ToRkOptions convert BootConfig into option list of rk-entry, basic auth is excluded since it is handled by Option of echo side
+func ToRkOptions(config *BootConfig, entryName, entryType string) []rkmidauth.Option {
+	rkConfig := config.BootConfig
+	rkConfig.Basic = nil
+
+	return rkmidauth.ToOptions(&rkConfig, entryName, entryType)
+}
+
+// ***************** Option *****************
+
+// Option if for middleware options while creating middleware
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithRegisterer provide prometheus.Registerer.
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(set *optionSet) {
+		if registerer != nil {
+			set.registerer = registerer
+		}
+	}
+}
+
+// WithPathToIgnore provide paths prefix that will ignore token introspection.
+func WithPathToIgnore(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.pathToIgnore = append(set.pathToIgnore, paths[i])
+			}
+		}
+	}
+}
+
+// WithBasicAuth provide basic auth accounts in format of user:password.
+//
+// Password could be plaintext or hashed with bcrypt or argon2 in PHC string format, passwords are compared in constant time.
+func WithBasicAuth(realm string, cred ...string) Option {
+	return func(set *optionSet) {
+		set.basicRealm = realm
+
+		for i := range cred {
+			tokens := strings.SplitN(cred[i], ":", 2)
+			if len(tokens) != 2 || len(tokens[0]) < 1 {
+				rkentry.ShutdownWithError(errors.New("invalid basic auth credential, expect user:password"))
+			}
+
+			c, err := rkechocredential.Parse(tokens[1], true)
+			if err != nil {
+				rkentry.ShutdownWithError(fmt.Errorf("invalid basic auth credential of user %s, %v", tokens[0], err))
+			}
+
+			set.basic.static[tokens[0]] = c
+		}
+	}
+}
+
+// WithHtpasswdFile provide htpasswd file with bcrypt or argon2 hashed passwords,
+// file will be reloaded if modified once reload interval passed.
+// Default reload interval will be used if zero or negative value provided.
+func WithHtpasswdFile(path string, reloadInterval time.Duration) Option {
+	return func(set *optionSet) {
+		if reloadInterval <= 0 {
+			reloadInterval = DefaultHtpasswdReloadInterval
+		}
+		set.basic.file = newFileWatcher(path, reloadInterval)
+	}
+}
+
+// WithApiKeys provide api keys with identities, secret of key is sha256 of it in hex, see HashApiKey.
+func WithApiKeys(keys ...ApiKey) Option {
+	return func(set *optionSet) {
+		for i := range keys {
+			entry, err := newApiKeyEntry(keys[i])
+			if err != nil {
+				rkentry.ShutdownWithError(err)
+			}
+
+			set.apiKeys.static[string(entry.secret)] = entry
+		}
+	}
+}
+
+// WithApiKeyLookup provide lookup of api key in format of <source>:<name>, multiple lookups are separated by comma.
+//
+// Supported sources are header, query and cookie, like header:X-API-Key,query:api_key,cookie:api_key.
+func WithApiKeyLookup(lookup string) Option {
+	return func(set *optionSet) {
+		lookups, err := parseApiKeyLookup(lookup)
+		if err != nil {
+			rkentry.ShutdownWithError(err)
+		}
+
+		set.apiKeys.lookups = lookups
+	}
+}
+
+// WithApiKeysFile provide api keys file in YAML or JSON format,
+// file will be reloaded if modified once reload interval passed.
+// Default reload interval will be used if zero or negative value provided.
+func WithApiKeysFile(path string, reloadInterval time.Duration) Option {
+	return func(set *optionSet) {
+		if reloadInterval <= 0 {
+			reloadInterval = DefaultApiKeysReloadInterval
+		}
+		set.apiKeys.file = newFileWatcher(path, reloadInterval)
+	}
+}
+
+// WithIntrospection provide OAuth2 introspection endpoint and client credentials.
+//
+// Bearer tokens in Authorization header will be validated by introspection endpoint defined in RFC 7662,
+// client credentials are sent as basic auth. Active results are cached until exp and inactive results are cached
+// for IntrospectionNegativeTTL, at most DefaultIntrospectionCacheSize results are kept in memory.
+func WithIntrospection(url, clientId, clientSecret string) Option {
+	return func(set *optionSet) {
+		set.introspectionUrl = url
+		set.clientId = clientId
+		set.clientSecret = clientSecret
+	}
+}
+
+// WithIntrospectionHttpClient provide http.Client used to call introspection endpoint.
+func WithIntrospectionHttpClient(client *http.Client) Option {
+	return func(set *optionSet) {
+		set.introspectionClient = client
+	}
+}
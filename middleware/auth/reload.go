@@ -0,0 +1,64 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauth
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// fileWatcher reloads file if it was modified, modification is checked at most once per interval
+type fileWatcher struct {
+	path      string
+	interval  time.Duration
+	lock      sync.Mutex
+	lastCheck time.Time
+	modTime   time.Time
+	size      int64
+}
+
+func newFileWatcher(path string, interval time.Duration) *fileWatcher {
+	return &fileWatcher{
+		path:     path,
+		interval: interval,
+	}
+}
+
+// reload calls parse with content of file if file was modified,
+// modification is checked immediately if force is true.
+// File is treated as not loaded if parse returns error, so that it will be parsed again in next check.
+func (w *fileWatcher) reload(force bool, parse func(raw []byte) error) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	now := time.Now()
+	if !force && now.Sub(w.lastCheck) < w.interval {
+		return nil
+	}
+	w.lastCheck = now
+
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return nil
+	}
+
+	raw, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+
+	if err := parse(raw); err != nil {
+		return err
+	}
+
+	w.modTime, w.size = info.ModTime(), info.Size()
+	return nil
+}
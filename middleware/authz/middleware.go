@@ -0,0 +1,51 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkechoauthz is a middleware for echo framework which authorizes requests with role based policy
+package rkechoauthz
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"net/http"
+)
+
+// Middleware Add policy based authorization interceptors, should be placed after jwt and auth middlewares.
+//
+// Roles are granted to principal by bindings of policy or role claim, request is allowed if any permission of roles
+// matches method and route template with all conditions met, otherwise, it will be rejected with 403.
+// Decision is recorded into event, denied requests are not rejected in dry run mode.
+func Middleware(opts ...Option) echo.MiddlewareFunc {
+	set := newOptionSet(opts...)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(rkmid.EntryNameKey.String(), set.GetEntryName())
+
+			if set.ShouldIgnore(ctx.Request().URL.Path) {
+				return next(ctx)
+			}
+
+			event := rkechoctx.GetEvent(ctx)
+			role, allowed := set.getPolicy(ctx).evaluate(set.attributes(ctx), set.tenantClaim)
+			if allowed {
+				event.AddPair("authzDecision", "allow")
+				event.AddPair("authzRole", role)
+				return next(ctx)
+			}
+
+			event.AddPair("authzDecision", "deny")
+			if set.dryRun {
+				event.AddPair("authzDryRun", "true")
+				return next(ctx)
+			}
+
+			event.SetCounter("authzDenied", 1)
+			resp := rkmid.GetErrorBuilder().New(http.StatusForbidden, "Permission denied")
+			return ctx.JSON(resp.Code(), resp)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauthz
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newAuthzEcho(opts ...Option) *echo.Echo {
+	e := echo.New()
+	// mock principal and claims inserted by auth and jwt middlewares
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if principal := ctx.Request().Header.Get("X-Ut-Principal"); len(principal) > 0 {
+				ctx.Set(rkechoctx.AuthPrincipalKey, principal)
+			}
+			if roles := ctx.Request().Header.Get("X-Ut-Roles"); len(roles) > 0 {
+				ctx.Set(rkmid.JwtTokenKey.String(), &jwt.Token{Claims: jwt.MapClaims{"roles": roles, "tenant": "ut-tenant"}})
+			}
+			return next(ctx)
+		}
+	})
+	e.Use(Middleware(opts...))
+
+	handler := func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "")
+	}
+	e.GET("/v1/tenants/:tenant/orders/:id", handler)
+	e.DELETE("/v1/tenants/:tenant/orders/:id", handler)
+	e.GET("/healthz", handler)
+
+	return e
+}
+
+func serve(e *echo.Echo, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
+
+func newUtPolicy() *Policy {
+	policy := &Policy{
+		Roles: []Role{{
+			Name: "order-reader",
+			Permissions: []Permission{{
+				Methods: []string{http.MethodGet},
+				Paths:   []string{"/v1/tenants/:tenant/orders/:id"},
+			}},
+		}, {
+			Name:        "admin",
+			Permissions: []Permission{{Paths: []string{"/v1/*"}}},
+		}},
+		Bindings: []Binding{{Principals: []string{"ut-reader"}, Roles: []string{"order-reader"}}},
+	}
+	policy.Roles[0].Permissions[0].Conditions.SameTenant = true
+
+	return policy
+}
+
+func TestMiddleware(t *testing.T) {
+	e := newAuthzEcho(WithPolicy(newUtPolicy()), WithPathToIgnore("/healthz"))
+
+	// case 1: role bound to principal, tenant claim is missing
+	w := serve(e, http.MethodGet, "/v1/tenants/ut-tenant/orders/1", map[string]string{"X-Ut-Principal": "ut-reader"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Permission denied")
+
+	// case 2: role bound to principal with tenant claim
+	w = serve(e, http.MethodGet, "/v1/tenants/ut-tenant/orders/1", map[string]string{
+		"X-Ut-Principal": "ut-reader",
+		"X-Ut-Roles":     "ut-none",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(e, http.MethodGet, "/v1/tenants/ut-other/orders/1", map[string]string{
+		"X-Ut-Principal": "ut-reader",
+		"X-Ut-Roles":     "ut-none",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serve(e, http.MethodDelete, "/v1/tenants/ut-tenant/orders/1", map[string]string{
+		"X-Ut-Principal": "ut-reader",
+		"X-Ut-Roles":     "ut-none",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// case 3: role granted by role claim
+	w = serve(e, http.MethodDelete, "/v1/tenants/ut-other/orders/1", map[string]string{"X-Ut-Roles": "admin"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 4: anonymous
+	w = serve(e, http.MethodGet, "/v1/tenants/ut-tenant/orders/1", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// case 5: ignored path
+	w = serve(e, http.MethodGet, "/healthz", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 6: dry run
+	e = newAuthzEcho(WithPolicy(newUtPolicy()), WithDryRun(true))
+	w = serve(e, http.MethodGet, "/v1/tenants/ut-tenant/orders/1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 7: deny all without policy
+	e = newAuthzEcho()
+	w = serve(e, http.MethodGet, "/v1/tenants/ut-tenant/orders/1", map[string]string{"X-Ut-Roles": "admin"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestMiddleware_SpoofedIp(t *testing.T) {
+	policy := &Policy{
+		Roles: []Role{{
+			Name:        "internal",
+			Permissions: []Permission{{Paths: []string{"/v1/*"}}},
+		}},
+		Bindings: []Binding{{Principals: []string{AnyPrincipal}, Roles: []string{"internal"}}},
+	}
+	policy.Roles[0].Permissions[0].Conditions.Ips = []string{"10.0.0.0/8"}
+	headers := map[string]string{
+		"X-Ut-Principal":         "ut-user",
+		echo.HeaderXForwardedFor: "10.0.0.1",
+		echo.HeaderXRealIP:       "10.0.0.1",
+	}
+
+	// remote address of httptest is 192.0.2.1, headers sent by client are not trusted
+	e := newAuthzEcho(WithPolicy(policy))
+	w := serve(e, http.MethodGet, "/v1/tenants/ut-tenant/orders/1", headers)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// headers sent by untrusted proxy
+	e = newAuthzEcho(WithPolicy(policy), WithTrustedProxies("192.0.2.2"))
+	w = serve(e, http.MethodGet, "/v1/tenants/ut-tenant/orders/1", headers)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// headers sent by trusted proxy
+	e = newAuthzEcho(WithPolicy(policy), WithTrustedProxies("192.0.2.0/24"))
+	w = serve(e, http.MethodGet, "/v1/tenants/ut-tenant/orders/1", headers)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMiddleware_HotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("roles: []\n"), os.ModePerm))
+
+	e := newAuthzEcho(WithPolicyFile(path, time.Millisecond))
+	w := serve(e, http.MethodGet, "/v1/tenants/ut-tenant/orders/1", map[string]string{"X-Ut-Roles": "admin"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.Nil(t, os.WriteFile(path, []byte(`roles: [{name: admin, permissions: [{paths: ["*"]}]}]`), os.ModePerm))
+	time.Sleep(2 * time.Millisecond)
+	w = serve(e, http.MethodGet, "/v1/tenants/ut-tenant/orders/1", map[string]string{"X-Ut-Roles": "admin"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// invalid policy keeps old one
+	assert.Nil(t, os.WriteFile(path, []byte(`roles: {`), os.ModePerm))
+	time.Sleep(2 * time.Millisecond)
+	w = serve(e, http.MethodGet, "/v1/tenants/ut-tenant/orders/1", map[string]string{"X-Ut-Roles": "admin"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
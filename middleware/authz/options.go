@@ -0,0 +1,327 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauthz
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ***************** OptionSet Implementation *****************
+
+// optionSet which is used for middleware implementation
+type optionSet struct {
+	entryName    string
+	entryType    string
+	pathToIgnore []string
+	dryRun       bool
+	roleClaim    string
+	tenantClaim  string
+	tenantParam  string
+	tenantHeader string
+	ipExtractor  echo.IPExtractor
+	file         *policyFile
+	lock         sync.RWMutex
+	policy       *compiledPolicy
+}
+
+// Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:    "fake-entry",
+		entryType:    "",
+		pathToIgnore: []string{},
+		roleClaim:    DefaultRoleClaim,
+		tenantClaim:  DefaultTenantClaim,
+		tenantParam:  DefaultTenantParam,
+		tenantHeader: DefaultTenantHeader,
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	if set.file != nil {
+		compiled, err := set.file.reload(true)
+		if err != nil {
+			rkentry.ShutdownWithError(fmt.Errorf("failed to load policy file %s, %v", set.file.path, err))
+		}
+		set.policy = compiled
+	}
+
+	// deny all if policy is missing
+	if set.policy == nil {
+		set.policy, _ = compilePolicy(&Policy{})
+	}
+
+	return set
+}
+
+// GetEntryName returns entry name
+func (set *optionSet) GetEntryName() string {
+	return set.entryName
+}
+
+// GetEntryType returns entry type
+func (set *optionSet) GetEntryType() string {
+	return set.entryType
+}
+
+// ShouldIgnore determine whether authorization should be ignored based on path
+func (set *optionSet) ShouldIgnore(path string) bool {
+	for i := range set.pathToIgnore {
+		if strings.HasPrefix(path, set.pathToIgnore[i]) {
+			return true
+		}
+	}
+
+	return rkmid.ShouldIgnoreGlobal(path)
+}
+
+// getPolicy returns current policy, policy file is reloaded if modified and old policy is kept if failed
+func (set *optionSet) getPolicy(ctx echo.Context) *compiledPolicy {
+	if set.file != nil {
+		compiled, err := set.file.reload(false)
+		if err != nil {
+			rkechoctx.GetLogger(ctx).Warn("Failed to reload policy file, " + err.Error())
+		}
+
+		if compiled != nil {
+			set.lock.Lock()
+			set.policy = compiled
+			set.lock.Unlock()
+		}
+	}
+
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	return set.policy
+}
+
+// attributes returns attributes of request and principal produced by jwt and auth middlewares
+func (set *optionSet) attributes(ctx echo.Context) *attributes {
+	res := &attributes{
+		principal: rkechoctx.GetAuthPrincipal(ctx),
+		method:    ctx.Request().Method,
+		route:     ctx.Path(),
+		path:      ctx.Request().URL.Path,
+		ip:        net.ParseIP(set.getClientIp(ctx)),
+		tenant:    requestTenant(ctx, set.tenantParam, set.tenantHeader),
+		claims:    jwt.MapClaims{},
+		roles:     []string{},
+	}
+
+	if claims, ok := rkechoctx.GetJwtClaims[jwt.MapClaims](ctx); ok {
+		res.claims = claims
+	} else if introspection := rkechoctx.GetTokenIntrospection(ctx); introspection != nil && introspection.Claims != nil {
+		res.claims = introspection.Claims
+	}
+
+	switch roles := res.claims[set.roleClaim].(type) {
+	case string:
+		res.roles = append(res.roles, strings.Fields(roles)...)
+	case []interface{}:
+		for i := range roles {
+			if role, ok := roles[i].(string); ok {
+				res.roles = append(res.roles, role)
+			}
+		}
+	}
+
+	return res
+}
+
+// getClientIp returns IP of client with trusted proxies.
+//
+// Headers sent by client are never trusted, IPExtractor of echo will be used if trusted proxies were not provided,
+// remote address will be used if neither exists.
+func (set *optionSet) getClientIp(ctx echo.Context) string {
+	if set.ipExtractor != nil {
+		return set.ipExtractor(ctx.Request())
+	}
+
+	if e := ctx.Echo(); e != nil && e.IPExtractor != nil {
+		return e.IPExtractor(ctx.Request())
+	}
+
+	return echo.ExtractIPDirect()(ctx.Request())
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML
+type BootConfig struct {
+	Enabled          bool     `yaml:"enabled" json:"enabled"`
+	Ignore           []string `yaml:"ignore" json:"ignore"`
+	DryRun           bool     `yaml:"dryRun" json:"dryRun"`
+	Path             string   `yaml:"path" json:"path"`
+	ReloadIntervalMs int      `yaml:"reloadIntervalMs" json:"reloadIntervalMs"`
+	RoleClaim        string   `yaml:"roleClaim" json:"roleClaim"`
+	TrustedProxies   []string `yaml:"trustedProxies" json:"trustedProxies"`
+	Tenant           struct {
+		Claim  string `yaml:"claim" json:"claim"`
+		Param  string `yaml:"param" json:"param"`
+		Header string `yaml:"header" json:"header"`
+	} `yaml:"tenant" json:"tenant"`
+	Policy Policy `yaml:"policy" json:"policy"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		inline := len(config.Policy.Roles) > 0 || len(config.Policy.Bindings) > 0
+		if inline && len(config.Path) > 0 {
+			rkentry.ShutdownWithError(errors.New("only one of path and policy of authz could be provided"))
+		}
+
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithDryRun(config.DryRun),
+			WithRoleClaim(config.RoleClaim),
+			WithTenant(config.Tenant.Claim, config.Tenant.Param, config.Tenant.Header),
+			WithPathToIgnore(config.Ignore...))
+
+		if len(config.TrustedProxies) > 0 {
+			opts = append(opts, WithTrustedProxies(config.TrustedProxies...))
+		}
+
+		if inline {
+			policy := config.Policy
+			opts = append(opts, WithPolicy(&policy))
+		}
+
+		if len(config.Path) > 0 {
+			opts = append(opts, WithPolicyFile(config.Path, time.Duration(config.ReloadIntervalMs)*time.Millisecond))
+		}
+	}
+
+	return opts
+}
+
+// ***************** Option *****************
+
+// Option if for middleware options while creating middleware
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithPathToIgnore provide paths prefix that will ignore authorization.
+func WithPathToIgnore(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.pathToIgnore = append(set.pathToIgnore, paths[i])
+			}
+		}
+	}
+}
+
+// WithPolicy provide Policy.
+func WithPolicy(policy *Policy) Option {
+	return func(set *optionSet) {
+		if policy == nil {
+			return
+		}
+
+		compiled, err := compilePolicy(policy)
+		if err != nil {
+			rkentry.ShutdownWithError(err)
+		}
+		set.policy = compiled
+	}
+}
+
+// WithPolicyFile provide policy file in YAML or JSON format,
+// file will be reloaded if modified once reload interval passed.
+// Default reload interval will be used if zero or negative value provided.
+func WithPolicyFile(path string, reloadInterval time.Duration) Option {
+	return func(set *optionSet) {
+		if reloadInterval <= 0 {
+			reloadInterval = DefaultReloadInterval
+		}
+
+		set.file = &policyFile{
+			path:     path,
+			interval: reloadInterval,
+		}
+	}
+}
+
+// WithDryRun provide dry run mode, decisions are recorded into event only and denied requests are not rejected.
+func WithDryRun(dryRun bool) Option {
+	return func(set *optionSet) {
+		set.dryRun = dryRun
+	}
+}
+
+// WithTrustedProxies provide IP ranges or IPs of trusted proxies,
+// client IP of ips condition will be extracted from X-Forwarded-For header sent by them.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(set *optionSet) {
+		trustOpts := []echo.TrustOption{
+			echo.TrustLoopback(false),
+			echo.TrustLinkLocal(false),
+			echo.TrustPrivateNet(false),
+		}
+
+		for i := range proxies {
+			proxy := strings.TrimSpace(proxies[i])
+			if len(proxy) < 1 {
+				continue
+			}
+
+			ipNet, err := parseIpNet(proxy)
+			if err != nil {
+				rkentry.ShutdownWithError(fmt.Errorf("invalid trusted proxy of authz, %s", proxies[i]))
+			}
+			trustOpts = append(trustOpts, echo.TrustIPRange(ipNet))
+		}
+
+		set.ipExtractor = echo.ExtractIPFromXFFHeader(trustOpts...)
+	}
+}
+
+// WithRoleClaim provide claim of roles granted to principal, default claim will be used if empty.
+func WithRoleClaim(claim string) Option {
+	return func(set *optionSet) {
+		if len(claim) > 0 {
+			set.roleClaim = claim
+		}
+	}
+}
+
+// WithTenant provide claim of tenant principal belongs to, path param and header of tenant request accesses.
+// Default values will be used if empty.
+func WithTenant(claim, param, header string) Option {
+	return func(set *optionSet) {
+		if len(claim) > 0 {
+			set.tenantClaim = claim
+		}
+		if len(param) > 0 {
+			set.tenantParam = param
+		}
+		if len(header) > 0 {
+			set.tenantHeader = header
+		}
+	}
+}
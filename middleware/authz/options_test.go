@@ -0,0 +1,91 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauthz
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewOptionSet(t *testing.T) {
+	// without options
+	set := newOptionSet()
+	assert.Equal(t, DefaultRoleClaim, set.roleClaim)
+	assert.Equal(t, DefaultTenantClaim, set.tenantClaim)
+	assert.Equal(t, DefaultTenantParam, set.tenantParam)
+	assert.Equal(t, DefaultTenantHeader, set.tenantHeader)
+	assert.False(t, set.dryRun)
+	assert.NotNil(t, set.policy)
+
+	// with options
+	set = newOptionSet(
+		WithEntryNameAndType("ut-entry", "ut-type"),
+		WithDryRun(true),
+		WithRoleClaim("groups"),
+		WithTenant("org", "org", "X-Org"),
+		WithPathToIgnore("", "/ut-ignore"))
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "ut-type", set.GetEntryType())
+	assert.True(t, set.dryRun)
+	assert.Equal(t, "groups", set.roleClaim)
+	assert.Equal(t, "org", set.tenantClaim)
+	assert.Equal(t, "org", set.tenantParam)
+	assert.Equal(t, "X-Org", set.tenantHeader)
+	assert.True(t, set.ShouldIgnore("/ut-ignore"))
+	assert.False(t, set.ShouldIgnore("/ut-path"))
+
+	assert.Nil(t, set.ipExtractor)
+
+	// with trusted proxies
+	set = newOptionSet(WithTrustedProxies("", "10.0.0.1", "192.168.0.0/16"))
+	assert.NotNil(t, set.ipExtractor)
+	assert.Panics(t, func() {
+		newOptionSet(WithTrustedProxies("ut-proxy"))
+	})
+
+	// with invalid policy and missing file
+	assert.Panics(t, func() {
+		newOptionSet(WithPolicy(&Policy{Roles: []Role{{}}}))
+	})
+	assert.Panics(t, func() {
+		newOptionSet(WithPolicyFile(filepath.Join(t.TempDir(), "missing.yaml"), 0))
+	})
+}
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{
+		Enabled: false,
+	}
+
+	// with disabled
+	assert.Empty(t, ToOptions(config, "", ""))
+
+	// with inline policy
+	config.Enabled = true
+	config.DryRun = true
+	config.Policy.Roles = []Role{{Name: "ut-role", Permissions: []Permission{{Paths: []string{"*"}}}}}
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type")...)
+	assert.True(t, set.dryRun)
+	assert.Contains(t, set.policy.roles, "ut-role")
+
+	// with both inline policy and file
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("roles: [{name: ut-file-role, permissions: [{paths: ['*']}]}]"), os.ModePerm))
+	config.Path = path
+	assert.Panics(t, func() {
+		ToOptions(config, "", "")
+	})
+
+	// with file
+	config.Policy.Roles = nil
+	config.ReloadIntervalMs = 1000
+	set = newOptionSet(ToOptions(config, "ut-entry", "ut-type")...)
+	assert.Contains(t, set.policy.roles, "ut-file-role")
+	assert.Equal(t, time.Second, set.file.interval)
+}
@@ -0,0 +1,336 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauthz
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/jwt"
+	"gopkg.in/yaml.v2"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRoleClaim is default claim of roles granted to principal by identity provider
+	DefaultRoleClaim = "roles"
+	// DefaultTenantClaim is default claim of tenant which principal belongs to
+	DefaultTenantClaim = "tenant"
+	// DefaultTenantParam is default path param of tenant which request accesses
+	DefaultTenantParam = "tenant"
+	// DefaultTenantHeader is default header of tenant which request accesses, used if path param is missing
+	DefaultTenantHeader = "X-Tenant-Id"
+	// DefaultReloadInterval is default interval of checking modification of policy file
+	DefaultReloadInterval = 5 * time.Second
+
+	// AnyPrincipal matches any authenticated principal in binding
+	AnyPrincipal = "*"
+)
+
+// Policy binds principals to roles which are permissions on method and route template.
+//
+// Example in YAML:
+//
+//	roles:
+//	  - name: order-reader
+//	    permissions:
+//	      - methods: ["GET"]
+//	        paths: ["/v1/tenants/:tenant/orders/*"]
+//	        conditions:
+//	          sameTenant: true
+//	          ips: ["10.0.0.0/8"]
+//	          claims:
+//	            - name: "scope"
+//	              values: ["orders:read"]
+//	bindings:
+//	  - principals: ["partner-a"]
+//	    roles: ["order-reader"]
+type Policy struct {
+	Roles    []Role    `yaml:"roles" json:"roles"`
+	Bindings []Binding `yaml:"bindings" json:"bindings"`
+}
+
+// Role is named list of permissions
+type Role struct {
+	Name        string       `yaml:"name" json:"name"`
+	Permissions []Permission `yaml:"permissions" json:"permissions"`
+}
+
+// Permission allows methods on paths if all conditions are met.
+//
+// Path is route template, like /v1/users/:id, or prefix ends with *, like /v1/*, empty methods mean all methods.
+type Permission struct {
+	Methods    []string   `yaml:"methods" json:"methods"`
+	Paths      []string   `yaml:"paths" json:"paths"`
+	Conditions Conditions `yaml:"conditions" json:"conditions"`
+}
+
+// Conditions of permission on attributes of request and principal
+type Conditions struct {
+	// Claims should match one of values, nested claim could be referenced with dot
+	Claims []struct {
+		Name   string   `yaml:"name" json:"name"`
+		Values []string `yaml:"values" json:"values"`
+	} `yaml:"claims" json:"claims"`
+	// SameTenant requires tenant claim of principal equals to tenant in path param or header
+	SameTenant bool `yaml:"sameTenant" json:"sameTenant"`
+	// Ips are IPs or CIDRs which client IP should belong to
+	Ips []string `yaml:"ips" json:"ips"`
+}
+
+// Binding grants roles to principals, roles could be granted by role claim either
+type Binding struct {
+	Principals []string `yaml:"principals" json:"principals"`
+	Roles      []string `yaml:"roles" json:"roles"`
+}
+
+// attributes of request evaluated by policy
+type attributes struct {
+	principal string
+	method    string
+	route     string
+	path      string
+	ip        net.IP
+	tenant    string
+	claims    jwt.MapClaims
+	roles     []string
+}
+
+// permission is compiled Permission
+type permission struct {
+	methods    []string
+	paths      []string
+	matchers   []rkechojwt.ClaimsMatcher
+	nets       []*net.IPNet
+	sameTenant bool
+}
+
+// match returns true if permission allows request
+func (p *permission) match(attrs *attributes, tenantClaim string) bool {
+	if !matchMethod(p.methods, attrs.method) || !matchPath(p.paths, attrs.route, attrs.path) {
+		return false
+	}
+
+	for i := range p.matchers {
+		if p.matchers[i](attrs.claims) != nil {
+			return false
+		}
+	}
+
+	if len(p.nets) > 0 {
+		allowed := false
+		for i := range p.nets {
+			if attrs.ip != nil && p.nets[i].Contains(attrs.ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if p.sameTenant {
+		tenant, _ := attrs.claims[tenantClaim].(string)
+		if len(tenant) < 1 || tenant != attrs.tenant {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compiledPolicy is Policy ready for evaluation
+type compiledPolicy struct {
+	roles    map[string][]*permission
+	bindings map[string][]string
+}
+
+// compilePolicy validates policy and compiles conditions
+func compilePolicy(policy *Policy) (*compiledPolicy, error) {
+	res := &compiledPolicy{
+		roles:    make(map[string][]*permission),
+		bindings: make(map[string][]string),
+	}
+
+	for _, role := range policy.Roles {
+		if len(role.Name) < 1 {
+			return nil, errors.New("missing name of role")
+		}
+
+		for _, p := range role.Permissions {
+			if len(p.Paths) < 1 {
+				return nil, fmt.Errorf("missing paths of permission in role %s", role.Name)
+			}
+
+			compiled := &permission{
+				methods:    p.Methods,
+				paths:      p.Paths,
+				sameTenant: p.Conditions.SameTenant,
+			}
+
+			for _, claim := range p.Conditions.Claims {
+				compiled.matchers = append(compiled.matchers, rkechojwt.Claim(claim.Name, claim.Values...))
+			}
+
+			for _, ip := range p.Conditions.Ips {
+				ipNet, err := parseIpNet(ip)
+				if err != nil {
+					return nil, fmt.Errorf("invalid ip condition in role %s, %v", role.Name, err)
+				}
+				compiled.nets = append(compiled.nets, ipNet)
+			}
+
+			res.roles[role.Name] = append(res.roles[role.Name], compiled)
+		}
+	}
+
+	for _, binding := range policy.Bindings {
+		for _, principal := range binding.Principals {
+			res.bindings[principal] = append(res.bindings[principal], binding.Roles...)
+		}
+	}
+
+	return res, nil
+}
+
+// evaluate returns role which allows request, false will be returned if denied
+func (p *compiledPolicy) evaluate(attrs *attributes, tenantClaim string) (string, bool) {
+	roles := append([]string{}, attrs.roles...)
+	if len(attrs.principal) > 0 {
+		roles = append(roles, p.bindings[attrs.principal]...)
+		roles = append(roles, p.bindings[AnyPrincipal]...)
+	}
+
+	for _, role := range roles {
+		for _, perm := range p.roles[role] {
+			if perm.match(attrs, tenantClaim) {
+				return role, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// parseIpNet parses IP or CIDR
+func parseIpNet(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip %s", value)
+		}
+
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(value)
+	return ipNet, err
+}
+
+// matchMethod returns true if methods are empty, contain * or method
+func matchMethod(methods []string, method string) bool {
+	if len(methods) < 1 {
+		return true
+	}
+
+	for i := range methods {
+		if methods[i] == "*" || strings.EqualFold(methods[i], method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPath returns true if route template equals to path, or route template or URL path has prefix of path ends with *
+func matchPath(paths []string, route, urlPath string) bool {
+	for _, path := range paths {
+		if strings.HasSuffix(path, "*") {
+			prefix := strings.TrimSuffix(path, "*")
+			if strings.HasPrefix(route, prefix) || strings.HasPrefix(urlPath, prefix) {
+				return true
+			}
+			continue
+		}
+
+		if path == route {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestTenant returns tenant of request from path param, then header
+func requestTenant(ctx echo.Context, param, header string) string {
+	if tenant := ctx.Param(param); len(tenant) > 0 {
+		return tenant
+	}
+
+	return ctx.Request().Header.Get(header)
+}
+
+// ***************** Policy file *****************
+
+// policyFile reloads policy file if it was modified, modification is checked at most once per interval
+type policyFile struct {
+	path      string
+	interval  time.Duration
+	lock      sync.Mutex
+	lastCheck time.Time
+	modTime   time.Time
+	size      int64
+}
+
+// reload returns compiled policy if file was modified, nil will be returned if not modified.
+// Modification is checked immediately if force is true.
+func (f *policyFile) reload(force bool) (*compiledPolicy, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	now := time.Now()
+	if !force && now.Sub(f.lastCheck) < f.interval {
+		return nil, nil
+	}
+	f.lastCheck = now
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil, nil
+	}
+
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{}
+	if err := yaml.Unmarshal(raw, policy); err != nil {
+		return nil, err
+	}
+
+	compiled, err := compilePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	f.modTime, f.size = info.ModTime(), info.Size()
+	return compiled, nil
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoauthz
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const utPolicy = `
+roles:
+  - name: admin
+    permissions:
+      - paths: ["*"]
+  - name: order-reader
+    permissions:
+      - methods: ["GET"]
+        paths: ["/v1/tenants/:tenant/orders/:id", "/v1/public/*"]
+        conditions:
+          sameTenant: true
+          ips: ["10.0.0.0/8", "127.0.0.1"]
+          claims:
+            - name: "scope"
+              values: ["orders:read"]
+bindings:
+  - principals: ["ut-admin"]
+    roles: ["admin"]
+  - principals: ["*"]
+    roles: ["order-reader"]
+`
+
+func newUtAttributes() *attributes {
+	return &attributes{
+		principal: "ut-user",
+		method:    http.MethodGet,
+		route:     "/v1/tenants/:tenant/orders/:id",
+		path:      "/v1/tenants/ut-tenant/orders/1",
+		ip:        net.ParseIP("10.0.0.1"),
+		tenant:    "ut-tenant",
+		claims:    jwt.MapClaims{"tenant": "ut-tenant", "scope": "orders:read"},
+		roles:     []string{},
+	}
+}
+
+func TestCompiledPolicy_Evaluate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(utPolicy), os.ModePerm))
+	policy, err := (&policyFile{path: path}).reload(true)
+	assert.Nil(t, err)
+
+	// case 1: allowed by binding of any principal
+	role, allowed := policy.evaluate(newUtAttributes(), DefaultTenantClaim)
+	assert.True(t, allowed)
+	assert.Equal(t, "order-reader", role)
+
+	// case 2: allowed by binding of principal and role claim
+	attrs := newUtAttributes()
+	attrs.principal = "ut-admin"
+	attrs.method = http.MethodDelete
+	role, allowed = policy.evaluate(attrs, DefaultTenantClaim)
+	assert.True(t, allowed)
+	assert.Equal(t, "admin", role)
+
+	attrs.principal = ""
+	attrs.roles = []string{"admin"}
+	_, allowed = policy.evaluate(attrs, DefaultTenantClaim)
+	assert.True(t, allowed)
+
+	// case 3: anonymous is not bound to any principal
+	attrs = newUtAttributes()
+	attrs.principal = ""
+	_, allowed = policy.evaluate(attrs, DefaultTenantClaim)
+	assert.False(t, allowed)
+
+	// case 4: method and path
+	attrs = newUtAttributes()
+	attrs.method = http.MethodPost
+	_, allowed = policy.evaluate(attrs, DefaultTenantClaim)
+	assert.False(t, allowed)
+
+	attrs = newUtAttributes()
+	attrs.route, attrs.path = "/v1/users/:id", "/v1/users/1"
+	_, allowed = policy.evaluate(attrs, DefaultTenantClaim)
+	assert.False(t, allowed)
+
+	// case 5: tenant
+	attrs = newUtAttributes()
+	attrs.tenant = "ut-other"
+	_, allowed = policy.evaluate(attrs, DefaultTenantClaim)
+	assert.False(t, allowed)
+
+	// case 6: ip
+	attrs = newUtAttributes()
+	attrs.ip = net.ParseIP("192.168.0.1")
+	_, allowed = policy.evaluate(attrs, DefaultTenantClaim)
+	assert.False(t, allowed)
+
+	attrs.ip = net.ParseIP("127.0.0.1")
+	_, allowed = policy.evaluate(attrs, DefaultTenantClaim)
+	assert.True(t, allowed)
+
+	// case 7: claims
+	attrs = newUtAttributes()
+	attrs.claims["scope"] = "orders:write"
+	_, allowed = policy.evaluate(attrs, DefaultTenantClaim)
+	assert.False(t, allowed)
+}
+
+func TestCompilePolicy(t *testing.T) {
+	// missing name of role
+	_, err := compilePolicy(&Policy{Roles: []Role{{}}})
+	assert.NotNil(t, err)
+
+	// missing paths
+	_, err = compilePolicy(&Policy{Roles: []Role{{Name: "ut-role", Permissions: []Permission{{}}}}})
+	assert.NotNil(t, err)
+
+	// invalid ip
+	policy := &Policy{Roles: []Role{{Name: "ut-role", Permissions: []Permission{{Paths: []string{"*"}}}}}}
+	policy.Roles[0].Permissions[0].Conditions.Ips = []string{"ut-ip"}
+	_, err = compilePolicy(policy)
+	assert.NotNil(t, err)
+}
+
+func TestMatchPath(t *testing.T) {
+	assert.True(t, matchPath([]string{"/v1/users/:id"}, "/v1/users/:id", "/v1/users/1"))
+	assert.True(t, matchPath([]string{"/v1/*"}, "", "/v1/users/1"))
+	assert.True(t, matchPath([]string{"*"}, "/v1/users/:id", "/v1/users/1"))
+	assert.False(t, matchPath([]string{"/v1/users/:id"}, "", "/v1/users/1"))
+	assert.False(t, matchPath([]string{"/v2/*"}, "/v1/users/:id", "/v1/users/1"))
+}
+
+func TestParseIpNet(t *testing.T) {
+	ipNet, err := parseIpNet("127.0.0.1")
+	assert.Nil(t, err)
+	assert.True(t, ipNet.Contains(net.ParseIP("127.0.0.1")))
+	assert.False(t, ipNet.Contains(net.ParseIP("127.0.0.2")))
+
+	ipNet, err = parseIpNet("::1")
+	assert.Nil(t, err)
+	assert.True(t, ipNet.Contains(net.ParseIP("::1")))
+
+	ipNet, err = parseIpNet("10.0.0.0/8")
+	assert.Nil(t, err)
+	assert.True(t, ipNet.Contains(net.ParseIP("10.1.2.3")))
+
+	_, err = parseIpNet("10.0.0.0/99")
+	assert.NotNil(t, err)
+}
+
+func TestPolicyFile_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(utPolicy), os.ModePerm))
+
+	file := &policyFile{path: path, interval: time.Hour}
+	policy, err := file.reload(true)
+	assert.Nil(t, err)
+	assert.NotNil(t, policy)
+
+	// not modified
+	policy, err = file.reload(true)
+	assert.Nil(t, err)
+	assert.Nil(t, policy)
+
+	// modified but reload interval not passed, then in JSON format
+	assert.Nil(t, os.WriteFile(path, []byte(`{"roles": [{"name": "ut-role", "permissions": [{"paths": ["*"]}]}]}`), os.ModePerm))
+	policy, _ = file.reload(false)
+	assert.Nil(t, policy)
+	policy, err = file.reload(true)
+	assert.Nil(t, err)
+	assert.Contains(t, policy.roles, "ut-role")
+
+	// invalid policy
+	assert.Nil(t, os.WriteFile(path, []byte(`{"roles": [{"permissions": []}]}`), os.ModePerm))
+	_, err = file.reload(true)
+	assert.NotNil(t, err)
+	assert.Nil(t, os.WriteFile(path, []byte(`roles: {`), os.ModePerm))
+	_, err = file.reload(true)
+	assert.NotNil(t, err)
+
+	// missing file
+	assert.Nil(t, os.Remove(path))
+	_, err = file.reload(true)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkechobodylimit is a middleware for echo framework which limits size of request body
+package rkechobodylimit
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"net/http"
+)
+
+// Middleware Add body limit interceptors.
+//
+// Requests with Content-Length larger than limit will be rejected before calling handler,
+// otherwise, request body will be wrapped with a counting reader and 413 will be returned
+// once handler read more bytes than limit.
+func Middleware(opts ...Option) echo.MiddlewareFunc {
+	set := newOptionSet(opts...)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(rkmid.EntryNameKey.String(), set.GetEntryName())
+
+			req := ctx.Request()
+			if req.URL == nil || set.ShouldIgnore(req.URL.Path) {
+				return next(ctx)
+			}
+
+			limit := set.getLimit(req.URL.Path)
+			if limit < 0 || req.Body == nil || req.Body == http.NoBody {
+				return next(ctx)
+			}
+
+			// case 1: Content-Length declared by client is too large
+			if req.ContentLength > limit {
+				return reject(ctx, set, limit)
+			}
+
+			// case 2: wrap request body with counting reader
+			r := newReader(req.Body, limit)
+			req.Body = r
+
+			err := next(ctx)
+
+			// response was written by handler already, just record it
+			if r.Exceeded() && ctx.Response().Committed {
+				set.incRejected(req.Method, ctx.Path())
+				rkechoctx.GetEvent(ctx).SetCounter("bodyLimit", 1)
+				return err
+			}
+
+			if r.Exceeded() {
+				return reject(ctx, set, limit)
+			}
+
+			return err
+		}
+	}
+}
+
+// write 413 to client with error builder
+func reject(ctx echo.Context, set *optionSet, limit int64) error {
+	set.incRejected(ctx.Request().Method, ctx.Path())
+	rkechoctx.GetEvent(ctx).SetCounter("bodyLimit", 1)
+
+	resp := rkmid.GetErrorBuilder().New(http.StatusRequestEntityTooLarge,
+		fmt.Sprintf("Request body exceeds limit of %d bytes", limit))
+
+	return ctx.JSON(resp.Code(), resp)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechobodylimit
+
+import (
+	"bytes"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var userHandler = func(ctx echo.Context) error {
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(ctx.Request().Body); err != nil {
+		return err
+	}
+
+	return ctx.String(http.StatusOK, buf.String())
+}
+
+func TestMiddleware(t *testing.T) {
+	defer assertNotPanic(t)
+
+	reg := prometheus.NewRegistry()
+	inter := Middleware(
+		WithRegisterer(reg),
+		WithMaxBytes(8),
+		WithMaxBytesByPath("/ut-large", 64),
+		WithMaxBytesByPath("/ut-unlimited", -1),
+		WithPathToIgnore("/ut-ignore"))
+
+	// case 1: happy case
+	ctx, w := newCtx("/ut-path", strings.NewReader("ut-body"), true)
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ut-body", w.Body.String())
+
+	// case 2: rejected by Content-Length
+	ctx, w = newCtx("/ut-path", strings.NewReader("ut-body-too-large"), true)
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// case 3: rejected while reading body without Content-Length
+	ctx, w = newCtx("/ut-path", strings.NewReader("ut-body-too-large"), false)
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// case 4: limit by path
+	ctx, w = newCtx("/ut-large", strings.NewReader("ut-body-too-large"), false)
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 5: unlimited path
+	ctx, w = newCtx("/ut-unlimited", strings.NewReader(strings.Repeat("a", 1024)), true)
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 6: ignored path
+	ctx, w = newCtx("/ut-ignore", strings.NewReader("ut-body-too-large"), true)
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// validate metrics
+	mfs, err := reg.Gather()
+	assert.Nil(t, err)
+	assert.Len(t, mfs, 1)
+	assert.Equal(t, "rk_bodyLimit_rejected", mfs[0].GetName())
+	assert.Equal(t, float64(2), mfs[0].GetMetric()[0].GetCounter().GetValue())
+}
+
+func TestMiddleware_RoutePath(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	e := echo.New()
+	e.Use(Middleware(WithRegisterer(reg), WithMaxBytes(4)))
+	e.POST("/ut-users/:id", userHandler)
+
+	for _, path := range []string{"/ut-users/1", "/ut-users/2"} {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader("ut-body")))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	// rejected requests are labeled with route path
+	mfs, err := reg.Gather()
+	assert.Nil(t, err)
+	assert.Len(t, mfs, 1)
+	assert.Len(t, mfs[0].GetMetric(), 1)
+	assert.Equal(t, float64(2), mfs[0].GetMetric()[0].GetCounter().GetValue())
+	for _, label := range mfs[0].GetMetric()[0].GetLabel() {
+		if label.GetName() == "path" {
+			assert.Equal(t, "/ut-users/:id", label.GetValue())
+		}
+	}
+}
+
+func TestMiddleware_Committed(t *testing.T) {
+	defer assertNotPanic(t)
+
+	inter := Middleware(
+		WithRegisterer(prometheus.NewRegistry()),
+		WithMaxBytes(4))
+
+	// handler ignores error and writes response
+	ctx, w := newCtx("/ut-path", strings.NewReader("ut-body"), false)
+	assert.Nil(t, inter(func(ctx echo.Context) error {
+		_, err := io.ReadAll(ctx.Request().Body)
+		assert.ErrorIs(t, err, ErrBodyTooLarge)
+		return ctx.String(http.StatusBadRequest, "")
+	})(ctx))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestReader(t *testing.T) {
+	// read exactly limit
+	r := newReader(io.NopCloser(strings.NewReader("ut-body")), 7)
+	b, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-body", string(b))
+	assert.False(t, r.Exceeded())
+
+	// read more than limit
+	r = newReader(io.NopCloser(strings.NewReader("ut-body")), 6)
+	b, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.Equal(t, "ut-bod", string(b))
+	assert.True(t, r.Exceeded())
+}
+
+func newCtx(path string, body io.Reader, withLength bool) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodPost, path, body)
+	if !withLength {
+		req.ContentLength = -1
+	}
+	resp := httptest.NewRecorder()
+	return echo.New().NewContext(req, resp), resp
+}
+
+func assertNotPanic(t *testing.T) {
+	if r := recover(); r != nil {
+		// Expect panic to be called with non nil error
+		assert.True(t, false)
+	} else {
+		// This should never be called in case of a bug
+		assert.True(t, true)
+	}
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
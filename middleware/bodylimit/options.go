@@ -0,0 +1,189 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechobodylimit
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/prom"
+	"strings"
+)
+
+const (
+	global = "rk-global"
+	// DefaultMaxBytes default limit of request body, 4MB
+	DefaultMaxBytes int64 = 4 << 20
+	// MetricsNameRejected records requests rejected because of body size
+	MetricsNameRejected = "rejected"
+)
+
+var labelKeys = []string{"entryName", "entryType", "method", "path"}
+
+// ***************** OptionSet Implementation *****************
+
+// optionSet which is used for middleware implementation
+type optionSet struct {
+	entryName    string
+	entryType    string
+	pathToIgnore []string
+	limits       map[string]int64
+	registerer   prometheus.Registerer
+	metricsSet   *rkmidprom.MetricsSet
+}
+
+// Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:    "fake-entry",
+		entryType:    "",
+		pathToIgnore: []string{},
+		limits: map[string]int64{
+			global: DefaultMaxBytes,
+		},
+		registerer: prometheus.DefaultRegisterer,
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	set.metricsSet = rkmidprom.NewMetricsSet("rk", "bodyLimit", set.registerer)
+	set.metricsSet.RegisterCounter(MetricsNameRejected, labelKeys...)
+
+	return set
+}
+
+// GetEntryName returns entry name
+func (set *optionSet) GetEntryName() string {
+	return set.entryName
+}
+
+// GetEntryType returns entry type
+func (set *optionSet) GetEntryType() string {
+	return set.entryType
+}
+
+// ShouldIgnore determine whether body limit should be ignored based on path
+func (set *optionSet) ShouldIgnore(path string) bool {
+	for i := range set.pathToIgnore {
+		if strings.HasPrefix(path, set.pathToIgnore[i]) {
+			return true
+		}
+	}
+
+	return rkmid.ShouldIgnoreGlobal(path)
+}
+
+// Get limit with path.
+// Global one will be returned if not found.
+func (set *optionSet) getLimit(path string) int64 {
+	if v, ok := set.limits[path]; ok {
+		return v
+	}
+
+	return set.limits[global]
+}
+
+// Increase rejected counter labeled with route path, metrics will be ignored if it was not registered successfully
+func (set *optionSet) incRejected(method, path string) {
+	if counter := set.metricsSet.GetCounterWithValues(MetricsNameRejected,
+		set.entryName, set.entryType, method, path); counter != nil {
+		counter.Inc()
+	}
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML
+type BootConfig struct {
+	Enabled  bool     `yaml:"enabled" json:"enabled"`
+	Ignore   []string `yaml:"ignore" json:"ignore"`
+	MaxBytes int64    `yaml:"maxBytes" json:"maxBytes"`
+	Paths    []struct {
+		Path     string `yaml:"path" json:"path"`
+		MaxBytes int64  `yaml:"maxBytes" json:"maxBytes"`
+	} `yaml:"paths" json:"paths"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string, reg prometheus.Registerer) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithRegisterer(reg),
+			WithMaxBytes(config.MaxBytes))
+
+		for i := range config.Paths {
+			e := config.Paths[i]
+			opts = append(opts, WithMaxBytesByPath(e.Path, e.MaxBytes))
+		}
+
+		opts = append(opts, WithPathToIgnore(config.Ignore...))
+	}
+
+	return opts
+}
+
+// ***************** Option *****************
+
+// Option if for middleware options while creating middleware
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithMaxBytes provide global limit of request body in bytes.
+// Zero value will be ignored and negative value means no limit.
+func WithMaxBytes(maxBytes int64) Option {
+	return func(set *optionSet) {
+		if maxBytes != 0 {
+			set.limits[global] = maxBytes
+		}
+	}
+}
+
+// WithMaxBytesByPath provide limit of request body in bytes by path.
+// Zero value will be ignored and negative value means no limit.
+func WithMaxBytesByPath(path string, maxBytes int64) Option {
+	return func(set *optionSet) {
+		if maxBytes == 0 {
+			return
+		}
+
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		set.limits[path] = maxBytes
+	}
+}
+
+// WithRegisterer provide prometheus.Registerer.
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(set *optionSet) {
+		if registerer != nil {
+			set.registerer = registerer
+		}
+	}
+}
+
+// WithPathToIgnore provide paths prefix that will ignore.
+func WithPathToIgnore(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.pathToIgnore = append(set.pathToIgnore, paths[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechobodylimit
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewOptionSet(t *testing.T) {
+	// without options
+	set := newOptionSet(WithRegisterer(prometheus.NewRegistry()))
+	assert.NotEmpty(t, set.GetEntryName())
+	assert.Equal(t, DefaultMaxBytes, set.getLimit("/ut-path"))
+	assert.False(t, set.ShouldIgnore("/ut-path"))
+
+	// with options
+	set = newOptionSet(
+		WithRegisterer(prometheus.NewRegistry()),
+		WithEntryNameAndType("ut-entry", "ut-type"),
+		WithMaxBytes(10),
+		WithMaxBytesByPath("ut-path", 20),
+		WithMaxBytesByPath("/ut-zero", 0),
+		WithPathToIgnore("/ut-ignore"))
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "ut-type", set.GetEntryType())
+	assert.Equal(t, int64(10), set.getLimit("/"))
+	assert.Equal(t, int64(20), set.getLimit("/ut-path"))
+	assert.Equal(t, int64(10), set.getLimit("/ut-zero"))
+	assert.True(t, set.ShouldIgnore("/ut-ignore"))
+}
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{
+		Enabled:  false,
+		MaxBytes: 10,
+	}
+
+	// with disabled
+	assert.Empty(t, ToOptions(config, "", "", nil))
+
+	// with enabled
+	config.Enabled = true
+	config.Paths = append(config.Paths, struct {
+		Path     string `yaml:"path" json:"path"`
+		MaxBytes int64  `yaml:"maxBytes" json:"maxBytes"`
+	}{Path: "/ut-path", MaxBytes: 20})
+
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type", prometheus.NewRegistry())...)
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, int64(10), set.getLimit("/"))
+	assert.Equal(t, int64(20), set.getLimit("/ut-path"))
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechobodylimit
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrBodyTooLarge returned by reader once request body exceeds limit
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// reader counts bytes read from request body and stops once limit exceeded
+type reader struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+	mu       sync.Mutex
+}
+
+// newReader wraps original body with limit
+func newReader(body io.ReadCloser, limit int64) *reader {
+	return &reader{ReadCloser: body, limit: limit}
+}
+
+// Read reads from original body, ErrBodyTooLarge will be returned once exceeded
+func (r *reader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+
+	// read one more byte than remaining so that we can tell whether body is too large
+	if remain := r.limit - r.read + 1; int64(len(p)) > remain {
+		p = p[:remain]
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+
+	if r.read > r.limit {
+		r.exceeded = true
+		return n - int(r.read-r.limit), ErrBodyTooLarge
+	}
+
+	return n, err
+}
+
+// Exceeded returns true if limit exceeded
+func (r *reader) Exceeded() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.exceeded
+}
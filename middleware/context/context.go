@@ -8,6 +8,7 @@ package rkechoctx
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 	rkcursor "github.com/rookie-ninja/rk-entry/v2/cursor"
@@ -19,8 +20,73 @@ import (
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	// HeaderXRequestTimeout remaining deadline of request, value is either a duration like 1500ms or seconds
+	HeaderXRequestTimeout = "X-Request-Timeout"
+	// HeaderRequestTimeout is the same as HeaderXRequestTimeout
+	HeaderRequestTimeout = "Request-Timeout"
+	// HeaderGrpcTimeout remaining deadline of request in format of gRPC over HTTP2, like 100m
+	HeaderGrpcTimeout = "grpc-timeout"
+	// TokenIntrospectionKey is key of TokenIntrospection inserted by auth middleware
+	TokenIntrospectionKey = "rkTokenIntrospection"
+	// AuthPrincipalKey is key of authenticated principal inserted by auth middleware
+	AuthPrincipalKey = "rkAuthPrincipal"
+	// SignatureKeyIdKey is key of secret name which signed request inserted by sign middleware
+	SignatureKeyIdKey = "rkSignatureKeyId"
+	// SessionKey is key of Session inserted by session middleware
+	SessionKey = "rkSession"
+	// SessionCsrfTokenKey is key of csrf token stored in Session by csrf middleware
+	SessionCsrfTokenKey = "_csrf"
+)
+
+// Session is server side session of client inserted by session middleware.
+//
+// Values should be serializable with JSON, numbers are decoded as float64 in later requests.
+type Session interface {
+	// Id returns id of session
+	Id() string
+	// IsNew returns true if session was created by current request
+	IsNew() bool
+	// CreatedAt returns creation time of session, absolute expiry is based on it
+	CreatedAt() time.Time
+	// Get returns value of key
+	Get(key string) (interface{}, bool)
+	// GetString returns value of key as string, empty string will be returned if missing or not a string
+	GetString(key string) string
+	// Set stores value of key
+	Set(key string, value interface{})
+	// Delete removes value of key
+	Delete(key string)
+	// RenewId rotates id of session and keeps values, should be called on privilege change, like login
+	RenewId()
+	// Destroy removes session from store and clears cookie, like logout
+	Destroy()
+}
+
+// TokenIntrospection is response of active token from OAuth2 introspection endpoint defined in RFC 7662
+type TokenIntrospection struct {
+	Active    bool             `json:"active"`
+	Scope     string           `json:"scope,omitempty"`
+	ClientId  string           `json:"client_id,omitempty"`
+	Username  string           `json:"username,omitempty"`
+	TokenType string           `json:"token_type,omitempty"`
+	ExpiresAt int64            `json:"exp,omitempty"`
+	IssuedAt  int64            `json:"iat,omitempty"`
+	NotBefore int64            `json:"nbf,omitempty"`
+	Subject   string           `json:"sub,omitempty"`
+	Audience  jwt.ClaimStrings `json:"aud,omitempty"`
+	Issuer    string           `json:"iss,omitempty"`
+	Id        string           `json:"jti,omitempty"`
+	// Claims contains all members of response including extensions
+	Claims jwt.MapClaims `json:"-"`
+}
+
 var (
 	noopTracerProvider = trace.NewNoopTracerProvider()
 	noopEvent          = rkquery.NewEventFactory().CreateEventNoop()
@@ -217,6 +283,69 @@ func InjectSpanToHttpRequest(ctx echo.Context, req *http.Request) {
 	}
 }
 
+// InjectDeadlineToHttpRequest inject remaining deadline of request context to http request as header.
+//
+// HeaderXRequestTimeout will be used if header was not provided, value of HeaderGrpcTimeout will be
+// encoded in format of gRPC. Nothing will be injected if request context has no deadline.
+func InjectDeadlineToHttpRequest(ctx echo.Context, req *http.Request, headers ...string) {
+	if ctx == nil || ctx.Request() == nil || req == nil {
+		return
+	}
+
+	deadline, ok := ctx.Request().Context().Deadline()
+	if !ok {
+		return
+	}
+
+	if len(headers) < 1 {
+		headers = []string{HeaderXRequestTimeout}
+	}
+
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+
+	remaining := time.Until(deadline)
+	for i := range headers {
+		if http.CanonicalHeaderKey(headers[i]) == http.CanonicalHeaderKey(HeaderGrpcTimeout) {
+			req.Header.Set(headers[i], encodeGrpcTimeout(remaining))
+			continue
+		}
+
+		if remaining < 0 {
+			remaining = 0
+		}
+		req.Header.Set(headers[i], remaining.Truncate(time.Millisecond).String())
+	}
+}
+
+// encodeGrpcTimeout encodes duration with the smallest unit which fits into 8 digits, rounded up
+func encodeGrpcTimeout(t time.Duration) string {
+	if t <= 0 {
+		return "0n"
+	}
+
+	const maxValue = 100000000 - 1
+	units := []struct {
+		unit time.Duration
+		sign string
+	}{
+		{time.Nanosecond, "n"},
+		{time.Microsecond, "u"},
+		{time.Millisecond, "m"},
+		{time.Second, "S"},
+		{time.Minute, "M"},
+	}
+
+	for i := range units {
+		if d := (t + units[i].unit - 1) / units[i].unit; d <= maxValue {
+			return strconv.FormatInt(int64(d), 10) + units[i].sign
+		}
+	}
+
+	return strconv.FormatInt(int64((t+time.Hour-1)/time.Hour), 10) + "H"
+}
+
 // NewTraceSpan start a new span
 func NewTraceSpan(ctx echo.Context, name string) trace.Span {
 	tracer := GetTracer(ctx)
@@ -253,6 +382,171 @@ func GetJwtToken(ctx echo.Context) *jwt.Token {
 	return nil
 }
 
+// GetJwtClaims return claims of jwt.Token as type T if exists.
+//
+// Claims are returned directly if they were parsed into T by claims factory of jwt middleware,
+// otherwise, claims are converted into T with JSON.
+//
+// Example:
+//
+//	claims, ok := rkechoctx.GetJwtClaims[*MyClaims](ctx)
+func GetJwtClaims[T jwt.Claims](ctx echo.Context) (T, bool) {
+	var res T
+
+	token := GetJwtToken(ctx)
+	if token == nil || token.Claims == nil {
+		return res, false
+	}
+
+	if claims, ok := token.Claims.(T); ok {
+		return claims, true
+	}
+
+	// convert with JSON
+	raw, err := json.Marshal(token.Claims)
+	if err != nil {
+		return res, false
+	}
+
+	typ := reflect.TypeOf(&res).Elem()
+	switch typ.Kind() {
+	case reflect.Ptr:
+		v := reflect.New(typ.Elem())
+		if err := json.Unmarshal(raw, v.Interface()); err != nil {
+			return res, false
+		}
+		res = v.Interface().(T)
+	case reflect.Map, reflect.Struct:
+		if err := json.Unmarshal(raw, &res); err != nil {
+			return res, false
+		}
+	default:
+		return res, false
+	}
+
+	return res, true
+}
+
+// GetJwtSubject return subject of jwt.Token if exists
+func GetJwtSubject(ctx echo.Context) string {
+	if claims, ok := GetJwtClaims[jwt.MapClaims](ctx); ok {
+		if sub, ok := claims["sub"].(string); ok {
+			return sub
+		}
+	}
+
+	return ""
+}
+
+// GetJwtScopes return scopes of jwt.Token if exists, scopes are read from scope and scp claims
+func GetJwtScopes(ctx echo.Context) []string {
+	res := make([]string, 0)
+
+	claims, ok := GetJwtClaims[jwt.MapClaims](ctx)
+	if !ok {
+		return res
+	}
+
+	for _, key := range []string{"scope", "scp"} {
+		switch v := claims[key].(type) {
+		case string:
+			res = append(res, strings.Fields(v)...)
+		case []interface{}:
+			for i := range v {
+				if scope, ok := v[i].(string); ok {
+					res = append(res, scope)
+				}
+			}
+		}
+	}
+
+	return res
+}
+
+// GetJwtExpiry return expiry of jwt.Token, false will be returned if token or exp claim is missing
+func GetJwtExpiry(ctx echo.Context) (time.Time, bool) {
+	claims, ok := GetJwtClaims[jwt.MapClaims](ctx)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	switch exp := claims["exp"].(type) {
+	case float64:
+		return time.Unix(int64(exp), 0), true
+	case json.Number:
+		if v, err := exp.Int64(); err == nil {
+			return time.Unix(v, 0), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// GetTokenIntrospection return TokenIntrospection of OAuth2 access token if exists
+func GetTokenIntrospection(ctx echo.Context) *TokenIntrospection {
+	if ctx == nil {
+		return nil
+	}
+
+	if raw := ctx.Get(TokenIntrospectionKey); raw != nil {
+		if res, ok := raw.(*TokenIntrospection); ok {
+			return res
+		}
+	}
+
+	return nil
+}
+
+// GetIntrospectedSubject return subject of introspected OAuth2 access token if exists
+func GetIntrospectedSubject(ctx echo.Context) string {
+	if res := GetTokenIntrospection(ctx); res != nil {
+		return res.Subject
+	}
+
+	return ""
+}
+
+// GetIntrospectedScopes return scopes of introspected OAuth2 access token if exists
+func GetIntrospectedScopes(ctx echo.Context) []string {
+	if res := GetTokenIntrospection(ctx); res != nil {
+		return strings.Fields(res.Scope)
+	}
+
+	return []string{}
+}
+
+// GetAuthPrincipal return authenticated principal of request, like username of basic auth.
+//
+// Subject of jwt.Token will be returned if principal was not inserted by auth middleware.
+func GetAuthPrincipal(ctx echo.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	if raw := ctx.Get(AuthPrincipalKey); raw != nil {
+		if res, ok := raw.(string); ok {
+			return res
+		}
+	}
+
+	return GetJwtSubject(ctx)
+}
+
+// GetSignatureKeyId return name of secret which signed request if verified by sign middleware
+func GetSignatureKeyId(ctx echo.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	if raw := ctx.Get(SignatureKeyIdKey); raw != nil {
+		if res, ok := raw.(string); ok {
+			return res
+		}
+	}
+
+	return ""
+}
+
 // GetCsrfToken return csrf token if exists
 func GetCsrfToken(ctx echo.Context) string {
 	if ctx == nil {
@@ -267,3 +561,18 @@ func GetCsrfToken(ctx echo.Context) string {
 
 	return ""
 }
+
+// GetSession return Session inserted by session middleware if exists
+func GetSession(ctx echo.Context) Session {
+	if ctx == nil {
+		return nil
+	}
+
+	if raw := ctx.Get(SessionKey); raw != nil {
+		if res, ok := raw.(Session); ok {
+			return res
+		}
+	}
+
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func newCtx() echo.Context {
@@ -227,6 +228,43 @@ func TestInjectSpanToHttpRequest(t *testing.T) {
 	})
 }
 
+func TestInjectDeadlineToHttpRequest(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// With nil context and request
+	InjectDeadlineToHttpRequest(nil, nil)
+
+	// Without deadline
+	ctx := newCtx()
+	req := &http.Request{}
+	InjectDeadlineToHttpRequest(ctx, req)
+	assert.Empty(t, req.Header)
+
+	// With deadline
+	deadlineCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ctx.SetRequest(ctx.Request().WithContext(deadlineCtx))
+
+	InjectDeadlineToHttpRequest(ctx, req)
+	remaining, err := time.ParseDuration(req.Header.Get(HeaderXRequestTimeout))
+	assert.Nil(t, err)
+	assert.True(t, remaining > 59*time.Second && remaining <= time.Minute)
+
+	InjectDeadlineToHttpRequest(ctx, req, HeaderGrpcTimeout, HeaderRequestTimeout)
+	assert.Regexp(t, "^[0-9]{1,8}[num]$", req.Header.Get(HeaderGrpcTimeout))
+	assert.NotEmpty(t, req.Header.Get(HeaderRequestTimeout))
+}
+
+func TestEncodeGrpcTimeout(t *testing.T) {
+	assert.Equal(t, "0n", encodeGrpcTimeout(-time.Second))
+	assert.Equal(t, "100n", encodeGrpcTimeout(100*time.Nanosecond))
+	assert.Equal(t, "1500000u", encodeGrpcTimeout(1500*time.Millisecond))
+	assert.Equal(t, "1000000m", encodeGrpcTimeout(1000*time.Second))
+	assert.Equal(t, "1000000S", encodeGrpcTimeout(1000000*time.Second))
+	assert.Equal(t, "3000000M", encodeGrpcTimeout(50000*time.Hour))
+	assert.Equal(t, "2000000H", encodeGrpcTimeout(2000000*time.Hour))
+}
+
 func TestNewTraceSpan(t *testing.T) {
 	ctx := newCtx()
 	ctx.SetRequest(ctx.Request().WithContext(context.TODO()))
@@ -264,6 +302,137 @@ func TestGetJwtToken(t *testing.T) {
 	assert.NotNil(t, GetJwtToken(ctx))
 }
 
+type utClaims struct {
+	jwt.RegisteredClaims
+	Tenant string `json:"tenant"`
+}
+
+func TestGetJwtClaims(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// without token
+	_, ok := GetJwtClaims[jwt.MapClaims](nil)
+	assert.False(t, ok)
+	_, ok = GetJwtClaims[*utClaims](newCtx())
+	assert.False(t, ok)
+
+	// claims of the same type
+	ctx := newCtx()
+	ctx.Set(rkmid.JwtTokenKey.String(), &jwt.Token{Claims: &utClaims{Tenant: "ut-tenant"}})
+	claims, ok := GetJwtClaims[*utClaims](ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "ut-tenant", claims.Tenant)
+
+	// claims converted from map
+	ctx.Set(rkmid.JwtTokenKey.String(), &jwt.Token{Claims: jwt.MapClaims{"sub": "ut-subject", "tenant": "ut-tenant"}})
+	claims, ok = GetJwtClaims[*utClaims](ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "ut-subject", claims.Subject)
+	assert.Equal(t, "ut-tenant", claims.Tenant)
+
+	registered, ok := GetJwtClaims[jwt.RegisteredClaims](ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "ut-subject", registered.Subject)
+
+	// claims converted into map
+	ctx.Set(rkmid.JwtTokenKey.String(), &jwt.Token{Claims: &utClaims{Tenant: "ut-tenant"}})
+	m, ok := GetJwtClaims[jwt.MapClaims](ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "ut-tenant", m["tenant"])
+}
+
+func TestGetJwtSubjectScopesAndExpiry(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// without token
+	ctx := newCtx()
+	assert.Empty(t, GetJwtSubject(ctx))
+	assert.Empty(t, GetJwtScopes(ctx))
+	_, ok := GetJwtExpiry(ctx)
+	assert.False(t, ok)
+
+	// with map claims
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	ctx.Set(rkmid.JwtTokenKey.String(), &jwt.Token{Claims: jwt.MapClaims{
+		"sub":   "ut-subject",
+		"scope": "ut-read ut-write",
+		"scp":   []interface{}{"ut-admin"},
+		"exp":   float64(exp.Unix()),
+	}})
+	assert.Equal(t, "ut-subject", GetJwtSubject(ctx))
+	assert.Equal(t, []string{"ut-read", "ut-write", "ut-admin"}, GetJwtScopes(ctx))
+	expiry, ok := GetJwtExpiry(ctx)
+	assert.True(t, ok)
+	assert.True(t, exp.Equal(expiry))
+
+	// with struct claims
+	ctx.Set(rkmid.JwtTokenKey.String(), &jwt.Token{Claims: &jwt.RegisteredClaims{
+		Subject:   "ut-registered",
+		ExpiresAt: jwt.NewNumericDate(exp),
+	}})
+	assert.Equal(t, "ut-registered", GetJwtSubject(ctx))
+	expiry, ok = GetJwtExpiry(ctx)
+	assert.True(t, ok)
+	assert.True(t, exp.Equal(expiry))
+}
+
+func TestGetTokenIntrospection(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// with nil
+	assert.Nil(t, GetTokenIntrospection(nil))
+
+	// With failure
+	ctx := newCtx()
+	assert.Nil(t, GetTokenIntrospection(ctx))
+	assert.Empty(t, GetIntrospectedSubject(ctx))
+	assert.Empty(t, GetIntrospectedScopes(ctx))
+
+	// With success
+	ctx.Set(TokenIntrospectionKey, &TokenIntrospection{
+		Active:  true,
+		Subject: "ut-subject",
+		Scope:   "read write",
+	})
+	assert.NotNil(t, GetTokenIntrospection(ctx))
+	assert.Equal(t, "ut-subject", GetIntrospectedSubject(ctx))
+	assert.Equal(t, []string{"read", "write"}, GetIntrospectedScopes(ctx))
+}
+
+func TestGetAuthPrincipal(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// with nil
+	assert.Empty(t, GetAuthPrincipal(nil))
+
+	// With failure
+	ctx := newCtx()
+	assert.Empty(t, GetAuthPrincipal(ctx))
+
+	// With subject of jwt
+	ctx.Set(rkmid.JwtTokenKey.String(), &jwt.Token{Claims: jwt.MapClaims{"sub": "ut-subject"}})
+	assert.Equal(t, "ut-subject", GetAuthPrincipal(ctx))
+
+	// With success
+	ctx.Set(AuthPrincipalKey, "ut-user")
+	assert.Equal(t, "ut-user", GetAuthPrincipal(ctx))
+}
+
+func TestGetSignatureKeyId(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// with nil
+	assert.Empty(t, GetSignatureKeyId(nil))
+
+	// With failure
+	ctx := newCtx()
+	assert.Empty(t, GetSignatureKeyId(ctx))
+
+	// With success
+	ctx.Set(SignatureKeyIdKey, "ut-key")
+	assert.Equal(t, "ut-key", GetSignatureKeyId(ctx))
+}
+
 func TestGetCsrfToken(t *testing.T) {
 	defer assertNotPanic(t)
 
@@ -7,7 +7,10 @@
 package rkechocsrf
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
 	"github.com/rookie-ninja/rk-entry/v2/middleware"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/csrf"
 	"net/http"
@@ -15,6 +18,10 @@ import (
 
 // Middleware Add csrf interceptors.
 //
+// Token is stored in session instead of cookie if session middleware is placed before and session exists,
+// cookie of token is still set for clients reading it. Token of cookie is used until session created, like login,
+// and it is stored in session once session is persisted, so that clients could keep on using it.
+//
 // Mainly copied from bellow.
 // https://github.com/labstack/echo/blob/master/middleware/csrf.go
 func Middleware(opts ...rkmidcsrf.Option) echo.MiddlewareFunc {
@@ -25,6 +32,10 @@ func Middleware(opts ...rkmidcsrf.Option) echo.MiddlewareFunc {
 			ctx.Set(rkmid.EntryNameKey.String(), set.GetEntryName())
 
 			beforeCtx := set.BeforeCtx(ctx.Request())
+			// anonymous session is not persisted for csrf token, otherwise each request without cookie creates one
+			if session := rkechoctx.GetSession(ctx); session != nil && !session.IsNew() && !set.ShouldIgnore(ctx.Request().URL.Path) {
+				beforeCtx.Input.Token = sessionToken(session)
+			}
 			set.Before(beforeCtx)
 
 			if beforeCtx.Output.ErrResp != nil {
@@ -46,3 +57,21 @@ func Middleware(opts ...rkmidcsrf.Option) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// sessionToken returns csrf token stored in session, new token will be generated and stored if missing.
+//
+// Token from cookie is never trusted, otherwise attacker could fix token of victim by setting cookie.
+func sessionToken(session rkechoctx.Session) string {
+	if token := session.GetString(rkechoctx.SessionCsrfTokenKey); len(token) > 0 {
+		return token
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	session.Set(rkechoctx.SessionCsrfTokenKey, token)
+	return token
+}
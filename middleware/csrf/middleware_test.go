@@ -7,7 +7,10 @@ package rkechocsrf
 
 import (
 	"bytes"
+	"context"
 	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-echo/middleware/session"
 	"github.com/rookie-ninja/rk-entry/v2/middleware"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/csrf"
 	"github.com/stretchr/testify/assert"
@@ -15,6 +18,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 var userHandler = func(ctx echo.Context) error {
@@ -47,6 +51,87 @@ func TestMiddleware(t *testing.T) {
 	assert.NotNil(t, w.Header().Get("Set-Cookie"))
 }
 
+type countStore struct {
+	rkechosession.Store
+	saved int
+}
+
+func (s *countStore) Save(ctx context.Context, id string, data *rkechosession.Data, ttl time.Duration) error {
+	s.saved++
+	return s.Store.Save(ctx, id, data, ttl)
+}
+
+func TestMiddleware_WithSession(t *testing.T) {
+	store := &countStore{Store: rkechosession.NewMemoryStore(0)}
+	e := echo.New()
+	e.Use(rkechosession.Middleware(rkechosession.WithSecrets("ut-secret"), rkechosession.WithStore(store)))
+	e.Use(Middleware())
+	e.GET("/ut-path", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, rkechoctx.GetCsrfToken(ctx))
+	})
+	e.POST("/ut-path", userHandler)
+	e.POST("/ut-login", func(ctx echo.Context) error {
+		rkechoctx.GetSession(ctx).Set("ut-key", "ut-value")
+		return ctx.String(http.StatusOK, "")
+	})
+
+	serve := func(method, path string, cookies []*http.Cookie, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(rkmid.HeaderXCSRFToken, token)
+		for i := range cookies {
+			req.AddCookie(cookies[i])
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	getCookie := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, v := range w.Result().Cookies() {
+			if v.Name == name {
+				return v
+			}
+		}
+		return nil
+	}
+
+	// request without cookie does not create session
+	w := serve(http.MethodGet, "/ut-path", nil, "")
+	token := w.Body.String()
+	assert.NotEmpty(t, token)
+	assert.Nil(t, getCookie(w, rkechosession.DefaultCookieName))
+	assert.Zero(t, store.saved)
+	assert.Equal(t, token, getCookie(w, "_csrf").Value)
+
+	// token of cookie is used before session created
+	w = serve(http.MethodPost, "/ut-login", []*http.Cookie{{Name: "_csrf", Value: token}}, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	sessionCookie := getCookie(w, rkechosession.DefaultCookieName)
+	assert.NotNil(t, sessionCookie)
+	w = serve(http.MethodPost, "/ut-path", []*http.Cookie{{Name: "_csrf", Value: token}}, "ut-token")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// token issued before login is stored in session, POST right after login is allowed
+	w = serve(http.MethodPost, "/ut-path", []*http.Cookie{sessionCookie, {Name: "_csrf", Value: token}}, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// token is read from existing session
+	w = serve(http.MethodGet, "/ut-path", []*http.Cookie{sessionCookie}, "")
+	sessionToken := w.Body.String()
+	assert.Equal(t, token, sessionToken)
+	if v := getCookie(w, rkechosession.DefaultCookieName); v != nil {
+		sessionCookie = v
+	}
+
+	// token of session is used
+	w = serve(http.MethodPost, "/ut-path", []*http.Cookie{sessionCookie}, sessionToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// token of csrf cookie is not trusted once session exists
+	w = serve(http.MethodPost, "/ut-path", []*http.Cookie{sessionCookie, {Name: "_csrf", Value: "ut-token"}}, "ut-token")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
 func newCtx() (echo.Context, *httptest.ResponseRecorder) {
 	var buf bytes.Buffer
 	req := httptest.NewRequest(http.MethodGet, "/ut-path", &buf)
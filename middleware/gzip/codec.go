@@ -0,0 +1,248 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechogzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+const (
+	// gzipEncoding encoding type of gzip
+	gzipEncoding = "gzip"
+	// brEncoding encoding type of brotli
+	brEncoding = "br"
+	// zstdEncoding encoding type of zstd
+	zstdEncoding = "zstd"
+	// identityEncoding means no encoding
+	identityEncoding = "identity"
+
+	// maxZstdWindow is max window of zstd decoder, window is allocated up front with size declared by frame header
+	maxZstdWindow = 8 << 20
+)
+
+// supportedEncodings list of encodings supported by middleware
+var supportedEncodings = []string{gzipEncoding, brEncoding, zstdEncoding}
+
+// isSupportedEncoding returns true if encoding is one of supportedEncodings
+func isSupportedEncoding(encoding string) bool {
+	for i := range supportedEncodings {
+		if supportedEncodings[i] == encoding {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encoder is implemented by gzip.Writer, brotli.Writer and zstd.Encoder
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// decoder is implemented by gzip.Reader, brotli.Reader and zstd.Decoder
+type decoder interface {
+	io.Reader
+	Reset(io.Reader) error
+}
+
+// ***************** Compress Pool *****************
+
+// sync.Pool is the delegate of this pool
+type compressPool struct {
+	encoding string
+	level    string
+	delegate *sync.Pool
+}
+
+// Create a new compress pool with encoding and level
+func newCompressPool(encoding, level string) *compressPool {
+	pool := &compressPool{
+		encoding: encoding,
+		level:    level,
+		delegate: &sync.Pool{},
+	}
+
+	switch encoding {
+	case brEncoding:
+		levelInt := toBrotliLevel(level)
+		pool.delegate.New = func() interface{} {
+			return brotli.NewWriterLevel(ioutil.Discard, levelInt)
+		}
+	case zstdEncoding:
+		levelZstd := toZstdLevel(level)
+		pool.delegate.New = func() interface{} {
+			// Ok to ignore error since options are valid
+			writer, _ := zstd.NewWriter(ioutil.Discard,
+				zstd.WithEncoderLevel(levelZstd),
+				zstd.WithEncoderConcurrency(1))
+			return writer
+		}
+	default:
+		levelInt := toGzipLevel(level)
+		pool.delegate.New = func() interface{} {
+			// Ok to ignore error because of level was validated
+			writer, _ := gzip.NewWriterLevel(ioutil.Discard, levelInt)
+			return writer
+		}
+	}
+
+	return pool
+}
+
+// Get item encoder from pool
+func (p *compressPool) Get() encoder {
+	if res, ok := p.delegate.Get().(encoder); ok {
+		return res
+	}
+
+	return nil
+}
+
+// Put item encoder back to pool, values with other types will be ignored
+func (p *compressPool) Put(x interface{}) {
+	if res, ok := x.(encoder); ok {
+		p.delegate.Put(res)
+	}
+}
+
+// ***************** Decompress Pool *****************
+
+// sync.Pool is the delegate of this pool
+type decompressPool struct {
+	encoding string
+	delegate *sync.Pool
+}
+
+// Create a new decompress pool with encoding, memory of zstd decoder is bounded by maxBytes if positive
+func newDecompressPool(encoding string, maxBytes int64) *decompressPool {
+	pool := &decompressPool{
+		encoding: encoding,
+		delegate: &sync.Pool{},
+	}
+
+	switch encoding {
+	case brEncoding:
+		pool.delegate.New = func() interface{} {
+			return brotli.NewReader(nil)
+		}
+	case zstdEncoding:
+		opts := []zstd.DOption{zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(zstdWindow(maxBytes))}
+		if maxBytes > 0 {
+			opts = append(opts, zstd.WithDecoderMaxMemory(uint64(maxBytes)))
+		}
+
+		pool.delegate.New = func() interface{} {
+			// Ok to ignore error since options are valid
+			reader, _ := zstd.NewReader(nil, opts...)
+			return reader
+		}
+	default:
+		pool.delegate.New = func() interface{} {
+			// In order to create a gzip.Reader, we need to pass a bytes with format gzip.
+			// Create a gzip.Writer is the easiest way to achieve this goal.
+			writer, _ := gzip.NewWriterLevel(ioutil.Discard, gzip.DefaultCompression)
+			b := new(bytes.Buffer)
+			writer.Reset(b)
+			writer.Flush()
+			writer.Close()
+
+			// Create a reader, ignoring error since we created a empty writer
+			reader, _ := gzip.NewReader(bytes.NewReader(b.Bytes()))
+			return reader
+		}
+	}
+
+	return pool
+}
+
+// zstdWindow returns max window of zstd decoder which is not larger than maxBytes if positive
+func zstdWindow(maxBytes int64) uint64 {
+	switch {
+	case maxBytes <= 0 || maxBytes >= maxZstdWindow:
+		return maxZstdWindow
+	case maxBytes < zstd.MinWindowSize:
+		return zstd.MinWindowSize
+	default:
+		return uint64(maxBytes)
+	}
+}
+
+// Get item decoder from pool
+func (p *decompressPool) Get() decoder {
+	if res, ok := p.delegate.Get().(decoder); ok {
+		return res
+	}
+
+	return nil
+}
+
+// Put item decoder back to pool, values with other types will be ignored
+func (p *decompressPool) Put(x interface{}) {
+	switch v := x.(type) {
+	case *zstd.Decoder:
+		// release reference of previous reader, zstd.Decoder could not be used after Close()
+		v.Reset(nil)
+		p.delegate.Put(v)
+	case *gzip.Reader:
+		v.Close()
+		p.delegate.Put(v)
+	case decoder:
+		p.delegate.Put(v)
+	}
+}
+
+// ***************** Level *****************
+
+// Convert level to gzip level
+func toGzipLevel(level string) int {
+	switch strings.ToLower(level) {
+	case strings.ToLower(NoCompression):
+		return gzip.NoCompression
+	case strings.ToLower(BestSpeed):
+		return gzip.BestSpeed
+	case strings.ToLower(BestCompression):
+		return gzip.BestCompression
+	case strings.ToLower(HuffmanOnly):
+		return gzip.HuffmanOnly
+	default:
+		return gzip.DefaultCompression
+	}
+}
+
+// Convert level to brotli level, brotli does not support noCompression and huffmanOnly,
+// so bestSpeed will be used instead.
+func toBrotliLevel(level string) int {
+	switch strings.ToLower(level) {
+	case strings.ToLower(NoCompression), strings.ToLower(BestSpeed), strings.ToLower(HuffmanOnly):
+		return brotli.BestSpeed
+	case strings.ToLower(BestCompression):
+		return brotli.BestCompression
+	default:
+		return brotli.DefaultCompression
+	}
+}
+
+// Convert level to zstd level, zstd does not support noCompression and huffmanOnly,
+// so bestSpeed will be used instead.
+func toZstdLevel(level string) zstd.EncoderLevel {
+	switch strings.ToLower(level) {
+	case strings.ToLower(NoCompression), strings.ToLower(BestSpeed), strings.ToLower(HuffmanOnly):
+		return zstd.SpeedFastest
+	case strings.ToLower(BestCompression):
+		return zstd.SpeedBestCompression
+	default:
+		return zstd.SpeedDefault
+	}
+}
@@ -4,10 +4,11 @@
 // license that can be found in the LICENSE file.
 
 // Package rkechogzip is a middleware for echo framework which compress/decompress data for RPC
+//
+// Encodings of gzip, br and zstd are supported.
 package rkechogzip
 
 import (
-	"bytes"
 	"github.com/labstack/echo/v4"
 	"github.com/rookie-ninja/rk-entry/v2/middleware"
 	"io"
@@ -18,6 +19,12 @@ import (
 
 // Middleware Add gzip compress and decompress interceptors.
 //
+// Response encoding will be negotiated with Accept-Encoding header and server preference,
+// request body encoded with any of gzip, br and zstd will be decompressed.
+//
+// Response will not be compressed if it is smaller than minLength, Content-Type is not compressible
+// or Content-Encoding was already set by handler.
+//
 // Mainly copied from bellow.
 // https://github.com/labstack/echo/blob/master/middleware/decompress.go
 // https://github.com/labstack/echo/blob/master/middleware/compress.go
@@ -33,14 +40,16 @@ func Middleware(opts ...Option) echo.MiddlewareFunc {
 			}
 
 			// deal with request decompression
-			switch ctx.Request().Header.Get(echo.HeaderContentEncoding) {
-			case gzipEncoding:
-				gzipReader := set.decompressPool.Get()
-
-				// make gzipReader to read from original request body
-				if err := gzipReader.Reset(ctx.Request().Body); err != nil {
+			var reader *decompressReader
+			encoding := strings.ToLower(strings.TrimSpace(ctx.Request().Header.Get(echo.HeaderContentEncoding)))
+			if pool, ok := set.decompressPool[encoding]; ok {
+				dec := pool.Get()
+				body := newCountingReader(ctx.Request().Body)
+
+				// make decoder to read from original request body
+				if err := dec.Reset(body); err != nil {
 					// return reader back to sync.Pool
-					set.decompressPool.Put(gzipReader)
+					pool.Put(dec)
 
 					// body is empty, keep on going
 					if err == io.EOF {
@@ -50,62 +59,70 @@ func Middleware(opts ...Option) echo.MiddlewareFunc {
 					return rkmid.GetErrorBuilder().New(http.StatusInternalServerError, "Failed to read request body", err)
 				}
 
-				// create a buffer and copy decompressed data into it via gzipReader
-				var buf bytes.Buffer
-				if _, err := io.Copy(&buf, gzipReader); err != nil {
-					return rkmid.GetErrorBuilder().New(http.StatusInternalServerError, "Failed to copy request body", err)
-				}
-
-				// close both gzipReader and original reader in request body
-				gzipReader.Close()
-				ctx.Request().Body.Close()
-				set.decompressPool.Put(gzipReader)
+				// handler reads from decoder directly, decoder will be returned to pool while closing
+				reader = newDecompressReader(dec, pool, body, ctx.Request().Body, set)
+				defer reader.Close()
 
-				// assign decompressed buffer to request
-				ctx.Request().Body = ioutil.NopCloser(&buf)
+				ctx.Request().Body = reader
+				ctx.Request().ContentLength = -1
 			}
 
 			// deal with response compression
 			ctx.Response().Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
-			// gzip is one of expected encoding type from request
-			if strings.Contains(ctx.Request().Header.Get(echo.HeaderAcceptEncoding), gzipEncoding) {
-				// set to response header
-				ctx.Response().Header().Set(echo.HeaderContentEncoding, gzipEncoding)
+			// select one of expected encoding type from request with server preference
+			if encoding := negotiateEncoding(ctx.Request().Header.Get(echo.HeaderAcceptEncoding), set.Encodings); len(encoding) > 0 {
+				// create encoder
+				pool := set.getCompressPool(ctx.Request().URL.Path, encoding)
+				enc := pool.Get()
 
-				// create gzip writer
-				gzipWriter := set.compressPool.Get()
-
-				// reset writer of gzip writer to original writer from response
+				// reset writer of encoder to original writer from response, compressed bytes will be counted
 				originalWriter := ctx.Response().Writer
-				gzipWriter.Reset(originalWriter)
+				compressed := &countingWriter{Writer: originalWriter}
+				enc.Reset(compressed)
+
+				// Content-Encoding will be set by writer once decided to compress
+				writer := newGzipResponseWriter(enc, originalWriter, encoding, set)
 
 				// defer func
 				defer func() {
+					// send buffered response which is smaller than minLength
+					writer.finish()
+
 					if ctx.Response().Size == 0 {
-						// remove encoding header if response is empty
-						if ctx.Response().Header().Get(echo.HeaderContentEncoding) == gzipEncoding {
-							ctx.Response().Header().Del(echo.HeaderContentEncoding)
-						}
 						// we have to reset response to it's pristine state when
 						// nothing is written to body or error is returned.
 						ctx.Response().Writer = originalWriter
+					}
 
+					if !writer.compressing {
 						// reset to empty
-						gzipWriter.Reset(ioutil.Discard)
+						enc.Reset(ioutil.Discard)
 					}
 
-					// close gzipWriter
-					gzipWriter.Close()
+					// close encoder
+					enc.Close()
+
+					if writer.compressing {
+						set.observe(encoding, ctx.Path(), writer.bytesIn, compressed.n)
+					}
 
-					// put gzipWriter back to pool
-					set.compressPool.Put(gzipWriter)
+					// put encoder back to pool
+					pool.Put(enc)
 				}()
 
 				// assign new writer to response
-				ctx.Response().Writer = newGzipResponseWriter(gzipWriter, originalWriter)
+				ctx.Response().Writer = writer
+			}
+
+			err := next(ctx)
+
+			// decompressed request body exceeds limit
+			if reader != nil && reader.Exceeded() && !ctx.Response().Committed {
+				resp := rkmid.GetErrorBuilder().New(http.StatusRequestEntityTooLarge, "Decompressed request body exceeds limit")
+				return ctx.JSON(resp.Code(), resp)
 			}
 
-			return next(ctx)
+			return err
 		}
 	}
 }
@@ -9,10 +9,13 @@ import (
 	"bytes"
 	"compress/gzip"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -85,3 +88,189 @@ func TestMiddleware(t *testing.T) {
 
 	assert.Nil(t, f(ctx))
 }
+
+func TestMiddleware_DecompressLimit(t *testing.T) {
+	// gzip bomb, 1MB of zeros compressed into about 1KB
+	var bomb bytes.Buffer
+	zw := gzip.NewWriter(&bomb)
+	zw.Write(make([]byte, 1<<20))
+	zw.Close()
+
+	serve := func(opts ...Option) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/ut-path", bytes.NewReader(bomb.Bytes()))
+		req.Header.Set(echo.HeaderContentEncoding, gzipEncoding)
+		resp := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, resp)
+
+		f := Middleware(opts...)(func(ctx echo.Context) error {
+			if _, err := io.ReadAll(ctx.Request().Body); err != nil {
+				return err
+			}
+			return ctx.String(http.StatusOK, "")
+		})
+		f(ctx)
+
+		return resp
+	}
+
+	// within limits
+	resp := serve(WithMaxDecompressedBytes(2<<20), WithMaxCompressionRatio(0))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// exceeds size limit
+	resp = serve(WithMaxDecompressedBytes(64<<10), WithMaxCompressionRatio(0))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Decompressed request body exceeds limit")
+
+	// exceeds ratio limit
+	resp = serve(WithMaxDecompressedBytes(0), WithMaxCompressionRatio(100))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Decompressed request body exceeds limit")
+}
+
+func TestMiddleware_ZstdWindow(t *testing.T) {
+	// zstd frame declares 1GB window with one raw block of single byte
+	frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0xa0, 0x09, 0x00, 0x00, 'a'}
+
+	req := httptest.NewRequest(http.MethodPost, "/ut-path", bytes.NewReader(frame))
+	req.Header.Set(echo.HeaderContentEncoding, zstdEncoding)
+	resp := httptest.NewRecorder()
+	ctx := echo.New().NewContext(req, resp)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	Middleware(WithMaxDecompressedBytes(1 << 20))(func(ctx echo.Context) error {
+		if _, err := io.ReadAll(ctx.Request().Body); err != nil {
+			return err
+		}
+		return ctx.String(http.StatusOK, "")
+	})(ctx)
+	runtime.ReadMemStats(&after)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(64<<20))
+}
+
+func TestMiddleware_MinLength(t *testing.T) {
+	defer assertNotPanic(t)
+
+	handler := Middleware(WithMinLength(16))
+
+	// smaller than minLength
+	ctx, recorder := newCtx(true)
+	f := handler(func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "ut-string")
+	})
+	assert.Nil(t, f(ctx))
+	assert.Empty(t, recorder.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, "ut-string", recorder.Body.String())
+
+	// larger than minLength with multiple writes
+	ctx, recorder = newCtx(true)
+	f = handler(func(ctx echo.Context) error {
+		ctx.Response().Header().Set(echo.HeaderContentType, echo.MIMETextPlain)
+		ctx.Response().WriteHeader(http.StatusOK)
+		ctx.Response().Write([]byte("ut-string-"))
+		ctx.Response().Write([]byte("ut-string"))
+		return nil
+	})
+	assert.Nil(t, f(ctx))
+	assert.Equal(t, gzipEncoding, recorder.Header().Get(echo.HeaderContentEncoding))
+	zr, err := gzip.NewReader(recorder.Body)
+	assert.Nil(t, err)
+	res, _ := io.ReadAll(zr)
+	assert.Equal(t, "ut-string-ut-string", string(res))
+
+	// flush before minLength reached
+	ctx, recorder = newCtx(true)
+	f = handler(func(ctx echo.Context) error {
+		ctx.Response().Header().Set(echo.HeaderContentType, echo.MIMETextPlain)
+		ctx.Response().WriteHeader(http.StatusOK)
+		ctx.Response().Write([]byte("ut"))
+		ctx.Response().Flush()
+		assert.True(t, recorder.Flushed)
+		return nil
+	})
+	assert.Nil(t, f(ctx))
+	assert.Equal(t, gzipEncoding, recorder.Header().Get(echo.HeaderContentEncoding))
+
+	// status without body
+	ctx, recorder = newCtx(true)
+	f = handler(func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusNoContent)
+	})
+	assert.Nil(t, f(ctx))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Empty(t, recorder.Header().Get(echo.HeaderContentEncoding))
+}
+
+func TestMiddleware_ContentType(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// excluded by default
+	ctx, recorder := newCtx(true)
+	f := Middleware()(func(ctx echo.Context) error {
+		return ctx.Blob(http.StatusOK, "image/png", []byte("ut-image"))
+	})
+	assert.Nil(t, f(ctx))
+	assert.Empty(t, recorder.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, "ut-image", recorder.Body.String())
+
+	// not in allowlist
+	ctx, recorder = newCtx(true)
+	f = Middleware(WithContentTypes("text/html"))(func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, "ut-string")
+	})
+	assert.Nil(t, f(ctx))
+	assert.Empty(t, recorder.Header().Get(echo.HeaderContentEncoding))
+
+	// in allowlist with wildcard
+	ctx, recorder = newCtx(true)
+	f = Middleware(WithContentTypes("text/*"))(func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "ut-string")
+	})
+	assert.Nil(t, f(ctx))
+	assert.Equal(t, gzipEncoding, recorder.Header().Get(echo.HeaderContentEncoding))
+
+	// Content-Encoding set by handler
+	ctx, recorder = newCtx(true)
+	f = Middleware()(func(ctx echo.Context) error {
+		ctx.Response().Header().Set(echo.HeaderContentEncoding, brEncoding)
+		return ctx.String(http.StatusOK, "ut-string")
+	})
+	assert.Nil(t, f(ctx))
+	assert.Equal(t, brEncoding, recorder.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, "ut-string", recorder.Body.String())
+}
+
+func TestMiddleware_Metrics(t *testing.T) {
+	defer assertNotPanic(t)
+
+	registry := prometheus.NewRegistry()
+	handler := Middleware(WithEntryNameAndType("ut-entry", "ut-type"), WithRegisterer(registry))
+
+	ctx, _ := newCtx(true)
+	ctx.SetPath("/ut-path")
+	f := handler(func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, strings.Repeat("ut-string", 100))
+	})
+	assert.Nil(t, f(ctx))
+
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+
+	names := make([]string, 0)
+	for _, family := range families {
+		names = append(names, family.GetName())
+		assert.Equal(t, uint64(1), family.GetMetric()[0].GetHistogram().GetSampleCount())
+	}
+	assert.ElementsMatch(t, []string{"rk_gzip_bytesIn", "rk_gzip_bytesOut", "rk_gzip_compressionRatio"}, names)
+
+	// with ignored path
+	ctx, recorder := newCtx(true)
+	f = Middleware(WithPathToIgnore("/ut-path"))(func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "ut-string")
+	})
+	assert.Nil(t, f(ctx))
+	assert.Empty(t, recorder.Header().Get(echo.HeaderContentEncoding))
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechogzip
+
+import (
+	"strconv"
+	"strings"
+)
+
+// acceptEncoding is one element parsed from Accept-Encoding header
+type acceptEncoding struct {
+	coding string
+	q      float64
+}
+
+// parseAcceptEncoding parse Accept-Encoding header based on RFC 7231 section 5.3.4.
+//
+// Elements with invalid q-value will be ignored.
+func parseAcceptEncoding(header string) []acceptEncoding {
+	res := make([]acceptEncoding, 0)
+
+	for _, element := range strings.Split(header, ",") {
+		element = strings.TrimSpace(element)
+		if len(element) < 1 {
+			continue
+		}
+
+		parts := strings.Split(element, ";")
+		item := acceptEncoding{
+			coding: strings.ToLower(strings.TrimSpace(parts[0])),
+			q:      1,
+		}
+
+		valid := true
+		for _, param := range parts[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 || strings.ToLower(strings.TrimSpace(kv[0])) != "q" {
+				continue
+			}
+
+			q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			if err != nil || q < 0 || q > 1 {
+				valid = false
+				break
+			}
+			item.q = q
+		}
+
+		// x-gzip should be treated as gzip, see RFC 7230 section 4.2.3
+		if item.coding == "x-gzip" {
+			item.coding = gzipEncoding
+		}
+
+		if valid && len(item.coding) > 0 {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
+
+// negotiateEncoding select encoding from Accept-Encoding header with server preference.
+//
+// 1: Encodings with q=0 are not acceptable.
+// 2: Wildcard matches any encoding which is not listed explicitly.
+// 3: Encoding with highest q-value wins, server preference breaks ties.
+//
+// Empty string will be returned if none of preferred encodings is acceptable.
+func negotiateEncoding(header string, preferred []string) string {
+	if len(strings.TrimSpace(header)) < 1 {
+		return ""
+	}
+
+	accepted := parseAcceptEncoding(header)
+
+	explicit := make(map[string]float64)
+	wildcard := -1.0
+	for _, v := range accepted {
+		if v.coding == "*" {
+			wildcard = v.q
+			continue
+		}
+
+		// same coding listed multiple times, keep the highest one
+		if q, ok := explicit[v.coding]; !ok || v.q > q {
+			explicit[v.coding] = v.q
+		}
+	}
+
+	res, bestQ := "", 0.0
+	for _, encoding := range preferred {
+		q, ok := explicit[encoding]
+		if !ok {
+			q = wildcard
+		}
+
+		if q > bestQ {
+			res, bestQ = encoding, q
+		}
+	}
+
+	return res
+}
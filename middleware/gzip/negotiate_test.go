@@ -0,0 +1,55 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechogzip
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseAcceptEncoding(t *testing.T) {
+	// empty header
+	assert.Empty(t, parseAcceptEncoding(""))
+
+	// with q-values
+	res := parseAcceptEncoding("gzip;q=0.5, BR , zstd;q=0, x-gzip;q=0.8, invalid;q=2, ,")
+	assert.Equal(t, []acceptEncoding{
+		{coding: gzipEncoding, q: 0.5},
+		{coding: brEncoding, q: 1},
+		{coding: zstdEncoding, q: 0},
+		{coding: gzipEncoding, q: 0.8},
+	}, res)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	preferred := []string{gzipEncoding, brEncoding, zstdEncoding}
+
+	// empty header
+	assert.Empty(t, negotiateEncoding("", preferred))
+
+	// identity only
+	assert.Empty(t, negotiateEncoding("identity", preferred))
+
+	// q=0 is not acceptable
+	assert.Empty(t, negotiateEncoding("gzip;q=0", preferred))
+	assert.Equal(t, brEncoding, negotiateEncoding("gzip;q=0, br", preferred))
+
+	// server preference breaks ties
+	assert.Equal(t, gzipEncoding, negotiateEncoding("br, gzip, zstd", preferred))
+	assert.Equal(t, zstdEncoding, negotiateEncoding("br, gzip, zstd", []string{zstdEncoding, gzipEncoding}))
+
+	// highest q-value wins
+	assert.Equal(t, zstdEncoding, negotiateEncoding("gzip;q=0.5, br;q=0.6, zstd", preferred))
+
+	// wildcard
+	assert.Equal(t, gzipEncoding, negotiateEncoding("*", preferred))
+	assert.Equal(t, brEncoding, negotiateEncoding("gzip;q=0, *", preferred))
+	assert.Empty(t, negotiateEncoding("*;q=0", preferred))
+	assert.Equal(t, gzipEncoding, negotiateEncoding("gzip, *;q=0", preferred))
+
+	// duplicate coding keeps the highest q-value
+	assert.Equal(t, gzipEncoding, negotiateEncoding("gzip;q=0, x-gzip", preferred))
+}
@@ -7,22 +7,19 @@ package rkechogzip
 
 import (
 	"bufio"
-	"bytes"
-	"compress/gzip"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/prom"
 	"github.com/rs/xid"
 	"io"
-	"io/ioutil"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
-	"sync"
 )
 
 const (
-	// GzipEncoding encoding type of gzip
-	gzipEncoding = "gzip"
 	// NoCompression copied from gzip.NoCompression
 	NoCompression = "noCompression"
 	// BestSpeed copied from gzip.BestSpeed
@@ -33,6 +30,21 @@ const (
 	DefaultCompression = "defaultCompression"
 	// HuffmanOnly copied from gzip.HuffmanOnly
 	HuffmanOnly = "huffmanOnly"
+
+	global = "rk-global"
+	// MetricsNameBytesIn records size of response body before compression
+	MetricsNameBytesIn = "bytesIn"
+	// MetricsNameBytesOut records size of response body after compression
+	MetricsNameBytesOut = "bytesOut"
+	// MetricsNameCompressionRatio records ratio between bytesIn and bytesOut
+	MetricsNameCompressionRatio = "compressionRatio"
+)
+
+var (
+	labelKeys = []string{"entryName", "entryType", "encoding", "path"}
+	// bytesBuckets from 64B to 16MB
+	bytesBuckets = prometheus.ExponentialBuckets(64, 4, 10)
+	ratioBuckets = []float64{1, 1.5, 2, 3, 4, 6, 8, 12, 16, 32}
 )
 
 // Interceptor would distinguish auth set based on.
@@ -41,6 +53,24 @@ var (
 	defaultSkipper = func(echo.Context) bool {
 		return false
 	}
+	// defaultExcludedContentTypes are already compressed, compressing them again wastes CPU
+	defaultExcludedContentTypes = []string{
+		"image/png",
+		"image/jpeg",
+		"image/gif",
+		"image/webp",
+		"image/avif",
+		"video/*",
+		"audio/*",
+		"font/woff",
+		"font/woff2",
+		"application/zip",
+		"application/gzip",
+		"application/x-gzip",
+		"application/zstd",
+		"application/x-7z-compressed",
+		"application/x-rar-compressed",
+	}
 )
 
 // Create new optionSet with rpc type nad options.
@@ -50,15 +80,38 @@ func newOptionSet(opts ...Option) *optionSet {
 		EntryType:      "",
 		Skipper:        defaultSkipper,
 		Level:          DefaultCompression,
-		decompressPool: newDecompressPool(),
+		Encodings:      []string{gzipEncoding, brEncoding, zstdEncoding},
+		compressPool:   make(map[string]*compressPool),
+		decompressPool: make(map[string]*decompressPool),
+		contentTypes:   make([]string, 0),
+		levels:         make(map[string]string),
+		pathPool:       make(map[string]map[string]*compressPool),
+		registerer:     prometheus.DefaultRegisterer,
 	}
+	set.excludedContentTypes = append(set.excludedContentTypes, defaultExcludedContentTypes...)
 
 	for i := range opts {
 		opts[i](set)
 	}
 
-	// create a new compressPool
-	set.compressPool = newCompressPool(set.Level)
+	// create compress and decompress pools for each supported encoding
+	for _, encoding := range supportedEncodings {
+		set.compressPool[encoding] = newCompressPool(encoding, set.Level)
+		set.decompressPool[encoding] = newDecompressPool(encoding, set.maxDecompressedBytes)
+	}
+
+	// create compress pools for paths with specific level
+	for path, level := range set.levels {
+		set.pathPool[path] = make(map[string]*compressPool)
+		for _, encoding := range supportedEncodings {
+			set.pathPool[path][encoding] = newCompressPool(encoding, level)
+		}
+	}
+
+	set.metricsSet = rkmidprom.NewMetricsSet("rk", "gzip", set.registerer)
+	set.metricsSet.RegisterHistogram(MetricsNameBytesIn, bytesBuckets, labelKeys...)
+	set.metricsSet.RegisterHistogram(MetricsNameBytesOut, bytesBuckets, labelKeys...)
+	set.metricsSet.RegisterHistogram(MetricsNameCompressionRatio, ratioBuckets, labelKeys...)
 
 	if _, ok := optionsMap[set.EntryName]; !ok {
 		optionsMap[set.EntryName] = set
@@ -69,13 +122,23 @@ func newOptionSet(opts ...Option) *optionSet {
 
 // Options which is used while initializing extension interceptor
 type optionSet struct {
-	EntryName      string
-	EntryType      string
-	Skipper        Skipper
-	Level          string
-	ignorePrefix   []string
-	decompressPool *decompressPool
-	compressPool   *compressPool
+	EntryName            string
+	EntryType            string
+	Skipper              Skipper
+	Level                string
+	Encodings            []string
+	ignorePrefix         []string
+	maxDecompressedBytes int64
+	maxCompressionRatio  int64
+	minLength            int
+	contentTypes         []string
+	excludedContentTypes []string
+	levels               map[string]string
+	decompressPool       map[string]*decompressPool
+	compressPool         map[string]*compressPool
+	pathPool             map[string]map[string]*compressPool
+	registerer           prometheus.Registerer
+	metricsSet           *rkmidprom.MetricsSet
 }
 
 // ShouldIgnore determine whether auth should be ignored based on path
@@ -93,6 +156,123 @@ func (set *optionSet) ShouldIgnore(ctx echo.Context) bool {
 	return false
 }
 
+// getCompressPool returns compress pool of encoding with level configured for path.
+// Pool with global level will be returned if not found.
+func (set *optionSet) getCompressPool(path, encoding string) *compressPool {
+	if pools, ok := set.pathPool[path]; ok {
+		return pools[encoding]
+	}
+
+	return set.compressPool[encoding]
+}
+
+// observe records bytes and ratio of compressed response,
+// metrics will be ignored if it was not registered successfully
+func (set *optionSet) observe(encoding, path string, bytesIn, bytesOut int64) {
+	if bytesIn < 1 || bytesOut < 1 {
+		return
+	}
+
+	values := []string{set.EntryName, set.EntryType, encoding, path}
+	if observer := set.metricsSet.GetHistogramWithValues(MetricsNameBytesIn, values...); observer != nil {
+		observer.Observe(float64(bytesIn))
+	}
+	if observer := set.metricsSet.GetHistogramWithValues(MetricsNameBytesOut, values...); observer != nil {
+		observer.Observe(float64(bytesOut))
+	}
+	if observer := set.metricsSet.GetHistogramWithValues(MetricsNameCompressionRatio, values...); observer != nil {
+		observer.Observe(float64(bytesIn) / float64(bytesOut))
+	}
+}
+
+// isCompressible returns true if response with header should be compressed.
+//
+// 1: Response with Content-Encoding set by handler will be kept as it is.
+// 2: Content-Type should match one of contentTypes if provided.
+// 3: Content-Type should not match any of excludedContentTypes.
+func (set *optionSet) isCompressible(header http.Header) bool {
+	if len(header.Get(echo.HeaderContentEncoding)) > 0 {
+		return false
+	}
+
+	contentType := header.Get(echo.HeaderContentType)
+	if len(set.contentTypes) > 0 && !matchContentType(contentType, set.contentTypes) {
+		return false
+	}
+
+	return !matchContentType(contentType, set.excludedContentTypes)
+}
+
+// matchContentType returns true if media type of contentType matches any of patterns.
+// Pattern could be either full media type like text/html or wildcard like image/*.
+func matchContentType(contentType string, patterns []string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if len(mediaType) < 1 {
+		return false
+	}
+
+	for i := range patterns {
+		pattern := strings.ToLower(strings.TrimSpace(patterns[i]))
+		if pattern == mediaType || pattern == "*/*" {
+			return true
+		}
+
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML
+type BootConfig struct {
+	Enabled              bool     `yaml:"enabled" json:"enabled"`
+	Ignore               []string `yaml:"ignore" json:"ignore"`
+	Level                string   `yaml:"level" json:"level"`
+	Encodings            []string `yaml:"encodings" json:"encodings"`
+	MaxDecompressedBytes int64    `yaml:"maxDecompressedBytes" json:"maxDecompressedBytes"`
+	MaxCompressionRatio  int64    `yaml:"maxCompressionRatio" json:"maxCompressionRatio"`
+	MinLength            int      `yaml:"minLength" json:"minLength"`
+	ContentTypes         []string `yaml:"contentTypes" json:"contentTypes"`
+	ExcludedContentTypes []string `yaml:"excludedContentTypes" json:"excludedContentTypes"`
+	Paths                []struct {
+		Path  string `yaml:"path" json:"path"`
+		Level string `yaml:"level" json:"level"`
+	} `yaml:"paths" json:"paths"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string, reg prometheus.Registerer) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithRegisterer(reg),
+			WithLevel(config.Level),
+			WithEncodings(config.Encodings...),
+			WithMaxDecompressedBytes(config.MaxDecompressedBytes),
+			WithMaxCompressionRatio(config.MaxCompressionRatio),
+			WithMinLength(config.MinLength),
+			WithContentTypes(config.ContentTypes...),
+			WithExcludedContentTypes(config.ExcludedContentTypes...))
+
+		for i := range config.Paths {
+			e := config.Paths[i]
+			opts = append(opts, WithLevelByPath(e.Path, e.Level))
+		}
+
+		opts = append(opts, WithPathToIgnore(config.Ignore...))
+	}
+
+	return opts
+}
+
+// ***************** Option *****************
+
 // Option if for middleware options while creating middleware
 type Option func(*optionSet)
 
@@ -111,119 +291,106 @@ func WithLevel(level string) Option {
 	}
 }
 
-// WithSkipper provide skipper.
-func WithSkipper(skip Skipper) Option {
+// WithLevelByPath provide level of compressing by path, empty level will be ignored.
+func WithLevelByPath(path, level string) Option {
 	return func(opt *optionSet) {
-		opt.Skipper = skip
+		if len(level) < 1 {
+			return
+		}
+
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		opt.levels[path] = level
 	}
 }
 
-// WithPathToIgnore provide path prefix to ignore middleware
-func WithPathToIgnore(prefix ...string) Option {
+// WithRegisterer provide prometheus.Registerer.
+func WithRegisterer(registerer prometheus.Registerer) Option {
 	return func(opt *optionSet) {
-		opt.ignorePrefix = append(opt.ignorePrefix, prefix...)
+		if registerer != nil {
+			opt.registerer = registerer
+		}
 	}
 }
 
-// sync.Pool is the delegate of this pool
-type compressPool struct {
-	delegate *sync.Pool
-}
-
-// Create a new compress pool
-func newCompressPool(level string) *compressPool {
-	levelLowerCase := strings.ToLower(level)
-
-	levelInt := gzip.DefaultCompression
-
-	switch levelLowerCase {
-	case strings.ToLower(NoCompression):
-		levelInt = gzip.NoCompression
-	case strings.ToLower(BestSpeed):
-		levelInt = gzip.BestSpeed
-	case strings.ToLower(BestCompression):
-		levelInt = gzip.BestCompression
-	case strings.ToLower(DefaultCompression):
-		levelInt = gzip.DefaultCompression
-	case strings.ToLower(HuffmanOnly):
-		levelInt = gzip.HuffmanOnly
-	default:
-		levelInt = gzip.DefaultCompression
-	}
+// WithEncodings provide encodings in order of server preference for response compression.
+// Supported encodings are gzip, br and zstd, unsupported ones will be ignored.
+func WithEncodings(encodings ...string) Option {
+	return func(opt *optionSet) {
+		res := make([]string, 0)
+		for i := range encodings {
+			encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+			if isSupportedEncoding(encoding) {
+				res = append(res, encoding)
+			}
+		}
 
-	return &compressPool{
-		delegate: &sync.Pool{
-			New: func() interface{} {
-				// Ok to ignore error because of above switch statement
-				writer, _ := gzip.NewWriterLevel(ioutil.Discard, levelInt)
-				return writer
-			},
-		},
+		if len(res) > 0 {
+			opt.Encodings = res
+		}
 	}
 }
 
-// Get item gzip.Writer from pool
-func (p *compressPool) Get() *gzip.Writer {
-	// assert no error
-	raw := p.delegate.Get()
-
-	switch raw.(type) {
-	case *gzip.Writer:
-		return raw.(*gzip.Writer)
+// WithSkipper provide skipper.
+func WithSkipper(skip Skipper) Option {
+	return func(opt *optionSet) {
+		opt.Skipper = skip
 	}
-
-	return nil
 }
 
-// Put item gzip.Writer back to pool
-func (p *compressPool) Put(x interface{}) {
-	p.delegate.Put(x)
+// WithMaxDecompressedBytes provide limit of decompressed request body in bytes.
+// 413 will be returned to client once exceeded, zero or negative value means no limit.
+func WithMaxDecompressedBytes(maxBytes int64) Option {
+	return func(opt *optionSet) {
+		opt.maxDecompressedBytes = maxBytes
+	}
 }
 
-// sync.Pool is the delegate of this pool
-type decompressPool struct {
-	delegate *sync.Pool
+// WithMaxCompressionRatio provide limit of ratio between decompressed and compressed request body.
+// 413 will be returned to client once exceeded, zero or negative value means no limit.
+func WithMaxCompressionRatio(ratio int64) Option {
+	return func(opt *optionSet) {
+		opt.maxCompressionRatio = ratio
+	}
 }
 
-// Create a new decompress pool
-func newDecompressPool() *decompressPool {
-	pool := &sync.Pool{
-		New: func() interface{} {
-			// In order to create a gzip.Reader, we need to pass a bytes with format gzip.
-			// Create a gzip.Writer is the easiest way to achieve this goal.
-			writer, _ := gzip.NewWriterLevel(ioutil.Discard, gzip.DefaultCompression)
-			b := new(bytes.Buffer)
-			writer.Reset(b)
-			writer.Flush()
-			writer.Close()
-
-			// Create a reader, ignoring error since we created a empty writer
-			reader, _ := gzip.NewReader(bytes.NewReader(b.Bytes()))
-			return reader
-		},
+// WithMinLength provide minimum length of response body in bytes to compress.
+// Response will be buffered until length reached, smaller ones will be sent without compression.
+func WithMinLength(minLength int) Option {
+	return func(opt *optionSet) {
+		opt.minLength = minLength
 	}
+}
 
-	return &decompressPool{
-		delegate: pool,
+// WithContentTypes provide allowlist of response Content-Type to compress, like text/html or text/*.
+// All Content-Types except excluded ones will be compressed if not provided.
+func WithContentTypes(contentTypes ...string) Option {
+	return func(opt *optionSet) {
+		opt.contentTypes = append(opt.contentTypes, contentTypes...)
 	}
 }
 
-// Get item gzip.Reader from pool
-func (p *decompressPool) Get() *gzip.Reader {
-	// assert no error
-	raw := p.delegate.Get()
-
-	switch raw.(type) {
-	case *gzip.Reader:
-		return raw.(*gzip.Reader)
+// WithExcludedContentTypes provide denylist of response Content-Type which should not be compressed.
+// Default list of already compressed types, like image/png or application/zip, will be replaced.
+func WithExcludedContentTypes(contentTypes ...string) Option {
+	return func(opt *optionSet) {
+		if len(contentTypes) > 0 {
+			opt.excludedContentTypes = append(make([]string, 0), contentTypes...)
+		}
 	}
-
-	return nil
 }
 
-// Put item gzip.Reader back to pool
-func (p *decompressPool) Put(x interface{}) {
-	p.delegate.Put(x)
+// WithPathToIgnore provide path prefix to ignore middleware
+func WithPathToIgnore(prefix ...string) Option {
+	return func(opt *optionSet) {
+		for i := range prefix {
+			if len(prefix[i]) > 0 {
+				opt.ignorePrefix = append(opt.ignorePrefix, prefix[i])
+			}
+		}
+	}
 }
 
 // Skipper default skipper will always return false
@@ -235,39 +402,91 @@ type Skipper func(echo.Context) bool
 //
 // rk-echo support multi-entries of echo framework. In order to match rk-echo architecture,
 // we need to modify some of logic in middleware.
+//
+// Decision of compression is deferred until status code is written, or until minLength bytes
+// were written if minLength is provided. Response will be sent without compression if Content-Type
+// is not compressible, Content-Encoding was set by handler or response is smaller than minLength.
 type gzipResponseWriter struct {
 	io.Writer
 	http.ResponseWriter
+	encoding    string
+	set         *optionSet
+	code        int
+	buf         []byte
+	decided     bool
+	compressing bool
+	bytesIn     int64
 }
 
-func newGzipResponseWriter(w io.Writer, rw http.ResponseWriter) *gzipResponseWriter {
+func newGzipResponseWriter(w io.Writer, rw http.ResponseWriter, encoding string, set *optionSet) *gzipResponseWriter {
 	return &gzipResponseWriter{
 		Writer:         w,
 		ResponseWriter: rw,
+		encoding:       encoding,
+		set:            set,
 	}
 }
 
 // WriteHeader writes header into http.ResponseWriter
 func (w *gzipResponseWriter) WriteHeader(code int) {
-	if code == http.StatusNoContent {
-		w.ResponseWriter.Header().Del(echo.HeaderContentEncoding)
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.code = code
+
+	switch {
+	case !bodyAllowedForStatus(code), !w.set.isCompressible(w.Header()), w.smallerThanMinLength():
+		w.decide(false)
+	case w.set.minLength <= 0:
+		w.decide(true)
 	}
-	w.Header().Del(echo.HeaderContentLength)
-	w.ResponseWriter.WriteHeader(code)
 }
 
 // Write writes bytes into gzipWriter.
 func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		if w.compressing {
+			n, err := w.Writer.Write(b)
+			w.bytesIn += int64(n)
+			return n, err
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
 	if w.Header().Get(echo.HeaderContentType) == "" {
-		w.Header().Set(echo.HeaderContentType, http.DetectContentType(b))
+		w.Header().Set(echo.HeaderContentType, http.DetectContentType(append(w.buf, b...)))
+	}
+
+	if w.code == 0 {
+		w.WriteHeader(http.StatusOK)
+		if w.decided {
+			return w.Write(b)
+		}
 	}
 
-	return w.Writer.Write(b)
+	// buffer until minLength reached
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.set.minLength {
+		if err := w.decide(w.set.isCompressible(w.Header())); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
 }
 
 // Flush flushes contents in http.ResponseWriter.
 func (w *gzipResponseWriter) Flush() {
-	w.Writer.(*gzip.Writer).Flush()
+	// caller expects data to be sent, stop buffering
+	if !w.decided && w.code != 0 {
+		w.decide(w.set.isCompressible(w.Header()))
+	}
+
+	if flusher, ok := w.Writer.(interface{ Flush() error }); ok && w.compressing {
+		flusher.Flush()
+	}
 	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
 		flusher.Flush()
 	}
@@ -285,3 +504,69 @@ func (w *gzipResponseWriter) Push(target string, opts *http.PushOptions) error {
 	}
 	return http.ErrNotSupported
 }
+
+// finish sends buffered response without compression since minLength was not reached
+func (w *gzipResponseWriter) finish() error {
+	if w.decided || w.code == 0 {
+		return nil
+	}
+
+	return w.decide(false)
+}
+
+// decide writes status code with headers and sends buffered bytes
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.decided = true
+	w.compressing = compress
+
+	if compress {
+		w.Header().Set(echo.HeaderContentEncoding, w.encoding)
+		w.Header().Del(echo.HeaderContentLength)
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+
+	if len(w.buf) < 1 {
+		return nil
+	}
+
+	buf := w.buf
+	w.buf = nil
+	_, err := w.Write(buf)
+	return err
+}
+
+// smallerThanMinLength returns true if Content-Length set by handler is smaller than minLength
+func (w *gzipResponseWriter) smallerThanMinLength() bool {
+	if w.set.minLength <= 0 {
+		return false
+	}
+
+	length, err := strconv.Atoi(w.Header().Get(echo.HeaderContentLength))
+	return err == nil && length < w.set.minLength
+}
+
+// countingWriter counts bytes written into delegate writer
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+// Write writes into delegate writer and count bytes
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+// bodyAllowedForStatus reports whether a given response status code permits a body
+func bodyAllowedForStatus(code int) bool {
+	switch {
+	case code >= 100 && code <= 199:
+		return false
+	case code == http.StatusNoContent:
+		return false
+	case code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	httptest "github.com/stretchr/testify/http"
 	"io/ioutil"
@@ -33,47 +34,90 @@ func TestNewOptionSet(t *testing.T) {
 			return true
 		}))
 	assert.Equal(t, NoCompression, set.Level)
+
+	// with encodings
+	set = newOptionSet(WithEncodings("ZSTD", "invalid", "br"))
+	assert.Equal(t, []string{zstdEncoding, brEncoding}, set.Encodings)
+	assert.Len(t, set.compressPool, len(supportedEncodings))
+
+	// with min length and content types
+	set = newOptionSet(WithMinLength(1024), WithContentTypes("text/*"), WithExcludedContentTypes("text/csv"))
+	assert.Equal(t, 1024, set.minLength)
+	assert.Equal(t, []string{"text/*"}, set.contentTypes)
+	assert.Equal(t, []string{"text/csv"}, set.excludedContentTypes)
+	assert.Len(t, set.decompressPool, len(supportedEncodings))
+
+	// with invalid encodings only
+	set = newOptionSet(WithEncodings("invalid"))
+	assert.Equal(t, []string{gzipEncoding, brEncoding, zstdEncoding}, set.Encodings)
 }
 
 func TestNewCompressPool(t *testing.T) {
 	// with DefaultCompression
-	pool := newCompressPool(DefaultCompression)
+	pool := newCompressPool(gzipEncoding, DefaultCompression)
 	assert.NotNil(t, pool.delegate.Get())
 
 	// with NoCompression
-	pool = newCompressPool(NoCompression)
+	pool = newCompressPool(gzipEncoding, NoCompression)
 	assert.NotNil(t, pool.delegate.Get())
 
 	// with DefaultCompression
-	pool = newCompressPool(BestSpeed)
+	pool = newCompressPool(gzipEncoding, BestSpeed)
 	assert.NotNil(t, pool.delegate.Get())
 
 	// with DefaultCompression
-	pool = newCompressPool(BestCompression)
+	pool = newCompressPool(gzipEncoding, BestCompression)
 	assert.NotNil(t, pool.delegate.Get())
 
 	// with DefaultCompression
-	pool = newCompressPool(DefaultCompression)
+	pool = newCompressPool(gzipEncoding, DefaultCompression)
 	assert.NotNil(t, pool.delegate.Get())
 
 	// with DefaultCompression
-	pool = newCompressPool(HuffmanOnly)
+	pool = newCompressPool(gzipEncoding, HuffmanOnly)
 	assert.NotNil(t, pool.delegate.Get())
 
 	// with DefaultCompression
-	pool = newCompressPool("invalid")
+	pool = newCompressPool(gzipEncoding, "invalid")
 	assert.NotNil(t, pool.delegate.Get())
 }
 
+func TestNewCompressPool_Encodings(t *testing.T) {
+	levels := []string{NoCompression, BestSpeed, BestCompression, DefaultCompression, HuffmanOnly, "invalid"}
+
+	for _, encoding := range supportedEncodings {
+		for _, level := range levels {
+			pool := newCompressPool(encoding, level)
+			enc := pool.Get()
+			assert.NotNil(t, enc)
+
+			// encode and decode
+			var buf bytes.Buffer
+			enc.Reset(&buf)
+			enc.Write([]byte("ut-message"))
+			assert.Nil(t, enc.Close())
+			pool.Put(enc)
+
+			decompress := newDecompressPool(encoding, 0)
+			dec := decompress.Get()
+			assert.Nil(t, dec.Reset(&buf))
+			res, err := ioutil.ReadAll(dec)
+			assert.Nil(t, err)
+			assert.Equal(t, "ut-message", string(res))
+			decompress.Put(dec)
+		}
+	}
+}
+
 func TestCompressPool_Get(t *testing.T) {
-	pool := newCompressPool(DefaultCompression)
+	pool := newCompressPool(gzipEncoding, DefaultCompression)
 	assert.NotNil(t, pool.Get())
 }
 
 func TestCompressPool_Put(t *testing.T) {
 	defer assertNotPanic(t)
 
-	pool := newCompressPool(DefaultCompression)
+	pool := newCompressPool(gzipEncoding, DefaultCompression)
 	// put different types of value
 	pool.Put(nil)
 	pool.Put("string")
@@ -81,14 +125,14 @@ func TestCompressPool_Put(t *testing.T) {
 }
 
 func TestDecompressPool_Get(t *testing.T) {
-	pool := newDecompressPool()
+	pool := newDecompressPool(gzipEncoding, 0)
 	assert.NotNil(t, pool.Get())
 }
 
 func TestDecompressPool_Put(t *testing.T) {
 	defer assertNotPanic(t)
 
-	pool := newDecompressPool()
+	pool := newDecompressPool(gzipEncoding, 0)
 	// put different types of value
 	pool.Put(nil)
 	pool.Put("string")
@@ -101,7 +145,7 @@ func TestGzipResponseWriter(t *testing.T) {
 	// WriteHeader() write header with http.StatusNoContent
 	rw := httptest.TestResponseWriter{}
 	w := new(bytes.Buffer)
-	gzipRW := newGzipResponseWriter(w, &rw)
+	gzipRW := newGzipResponseWriter(w, &rw, gzipEncoding, newOptionSet())
 	gzipRW.WriteHeader(http.StatusNoContent)
 	assert.Empty(t, rw.Header().Get(echo.HeaderContentEncoding))
 	assert.Empty(t, rw.Header().Get(echo.HeaderContentLength))
@@ -110,14 +154,14 @@ func TestGzipResponseWriter(t *testing.T) {
 	// WriteHeader() write header with other status code
 	rw = httptest.TestResponseWriter{}
 	w = new(bytes.Buffer)
-	gzipRW = newGzipResponseWriter(w, &rw)
+	gzipRW = newGzipResponseWriter(w, &rw, gzipEncoding, newOptionSet())
 	gzipRW.WriteHeader(http.StatusOK)
 	assert.Equal(t, http.StatusOK, rw.StatusCode)
 
 	// Write() without Content-Type
 	rw = httptest.TestResponseWriter{}
 	w = new(bytes.Buffer)
-	gzipRW = newGzipResponseWriter(w, &rw)
+	gzipRW = newGzipResponseWriter(w, &rw, gzipEncoding, newOptionSet())
 	gzipRW.Write([]byte("ut-message"))
 	assert.NotEmpty(t, rw.Header().Get(echo.HeaderContentType))
 	assert.NotEmpty(t, w.String())
@@ -125,7 +169,7 @@ func TestGzipResponseWriter(t *testing.T) {
 	// Write() with Content-Type
 	rw = httptest.TestResponseWriter{}
 	w = new(bytes.Buffer)
-	gzipRW = newGzipResponseWriter(w, &rw)
+	gzipRW = newGzipResponseWriter(w, &rw, gzipEncoding, newOptionSet())
 	rw.Header().Set(echo.HeaderContentType, "ut-type")
 	gzipRW.Write([]byte("ut-message"))
 	assert.NotEmpty(t, rw.Header().Get(echo.HeaderContentType))
@@ -134,10 +178,88 @@ func TestGzipResponseWriter(t *testing.T) {
 	// Flush() with type of gzip.Writer
 	rw = httptest.TestResponseWriter{}
 	gw, _ := gzip.NewWriterLevel(ioutil.Discard, gzip.DefaultCompression)
-	gzipRW = newGzipResponseWriter(gw, &rw)
+	gzipRW = newGzipResponseWriter(gw, &rw, gzipEncoding, newOptionSet())
 	gzipRW.Flush()
 }
 
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{
+		Enabled:   false,
+		Ignore:    []string{"", "/ut-ignore"},
+		Level:     BestSpeed,
+		MinLength: 1024,
+		Paths: []struct {
+			Path  string `yaml:"path" json:"path"`
+			Level string `yaml:"level" json:"level"`
+		}{
+			{Path: "ut-path", Level: BestCompression},
+			{Path: "/ut-empty", Level: ""},
+		},
+	}
+
+	// with disabled
+	assert.Empty(t, ToOptions(config, "", "", nil))
+
+	// with enabled
+	config.Enabled = true
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type", prometheus.NewRegistry())...)
+	assert.Equal(t, "ut-entry", set.EntryName)
+	assert.Equal(t, BestSpeed, set.Level)
+	assert.Equal(t, 1024, set.minLength)
+	assert.Equal(t, []string{"/ut-ignore"}, set.ignorePrefix)
+	assert.Equal(t, map[string]string{"/ut-path": BestCompression}, set.levels)
+}
+
+func TestOptionSet_GetCompressPool(t *testing.T) {
+	set := newOptionSet(WithLevel(BestSpeed), WithLevelByPath("/ut-path", BestCompression))
+
+	// with path
+	assert.Equal(t, BestCompression, set.getCompressPool("/ut-path", brEncoding).level)
+	assert.Equal(t, brEncoding, set.getCompressPool("/ut-path", brEncoding).encoding)
+
+	// fallback to global
+	assert.Equal(t, BestSpeed, set.getCompressPool("/ut-other", gzipEncoding).level)
+}
+
+func TestMatchContentType(t *testing.T) {
+	// empty content type
+	assert.False(t, matchContentType("", []string{"*/*"}))
+
+	// exact match with parameters
+	assert.True(t, matchContentType("Text/HTML; charset=UTF-8", []string{"text/html"}))
+
+	// wildcard
+	assert.True(t, matchContentType("image/png", []string{"image/*"}))
+	assert.True(t, matchContentType("image/png", []string{"*/*"}))
+	assert.False(t, matchContentType("text/plain", []string{"image/*", "text/html"}))
+}
+
+func TestOptionSet_IsCompressible(t *testing.T) {
+	header := http.Header{}
+
+	// default excluded content types
+	set := newOptionSet()
+	header.Set(echo.HeaderContentType, "application/zip")
+	assert.False(t, set.isCompressible(header))
+	header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	assert.True(t, set.isCompressible(header))
+
+	// with Content-Encoding
+	header.Set(echo.HeaderContentEncoding, gzipEncoding)
+	assert.False(t, set.isCompressible(header))
+	header.Del(echo.HeaderContentEncoding)
+
+	// with allowlist
+	set = newOptionSet(WithContentTypes("text/*"))
+	assert.False(t, set.isCompressible(header))
+
+	// replace excluded content types
+	set = newOptionSet(WithExcludedContentTypes("application/json"))
+	assert.False(t, set.isCompressible(header))
+	header.Set(echo.HeaderContentType, "application/zip")
+	assert.True(t, set.isCompressible(header))
+}
+
 func assertNotPanic(t *testing.T) {
 	if r := recover(); r != nil {
 		// Expect panic to be called with non nil error
@@ -147,3 +269,31 @@ func assertNotPanic(t *testing.T) {
 		assert.True(t, true)
 	}
 }
+
+func TestDecompressReader(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("ut-string"))
+	zw.Close()
+
+	set := newOptionSet()
+	body := newCountingReader(&buf)
+	pool := set.decompressPool[gzipEncoding]
+	gzipReader := pool.Get()
+	assert.Nil(t, gzipReader.Reset(body))
+
+	reader := newDecompressReader(gzipReader, pool, body, ioutil.NopCloser(nil), set)
+	res, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-string", string(res))
+	assert.False(t, reader.Exceeded())
+	assert.True(t, body.n > 0)
+
+	// close twice
+	assert.Nil(t, reader.Close())
+	assert.Nil(t, reader.Close())
+
+	// read after close
+	_, err = reader.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechogzip
+
+import (
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"sync"
+)
+
+// ErrDecompressedTooLarge returned while reading decompressed request body which exceeds limit
+var ErrDecompressedTooLarge = errors.New("decompressed request body too large")
+
+// countingReader counts bytes read from original request body
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func newCountingReader(r io.Reader) *countingReader {
+	return &countingReader{Reader: r}
+}
+
+// Read reads from delegate reader and count bytes
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// decompressReader streams decompressed request body to handler.
+//
+// Decompressed size and compression ratio will be checked while reading,
+// ErrDecompressedTooLarge will be returned once exceeded.
+type decompressReader struct {
+	decoder    decoder
+	pool       *decompressPool
+	compressed *countingReader
+	original   io.Closer
+	set        *optionSet
+	n          int64
+	exceeded   bool
+	closeOnce  sync.Once
+	mu         sync.Mutex
+}
+
+func newDecompressReader(dec decoder, pool *decompressPool, compressed *countingReader, original io.Closer, set *optionSet) *decompressReader {
+	return &decompressReader{
+		decoder:    dec,
+		pool:       pool,
+		compressed: compressed,
+		original:   original,
+		set:        set,
+	}
+}
+
+// Read reads decompressed bytes from decoder
+func (r *decompressReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.exceeded {
+		return 0, ErrDecompressedTooLarge
+	}
+
+	if r.decoder == nil {
+		return 0, io.ErrClosedPipe
+	}
+
+	n, err := r.decoder.Read(p)
+	r.n += int64(n)
+
+	// case 1: window of zstd frame exceeds memory limit of decoder
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		r.exceeded = true
+		return n, ErrDecompressedTooLarge
+	}
+
+	// case 2: decompressed size exceeds limit
+	if r.set.maxDecompressedBytes > 0 && r.n > r.set.maxDecompressedBytes {
+		r.exceeded = true
+		return n, ErrDecompressedTooLarge
+	}
+
+	// case 3: compression ratio exceeds limit
+	if r.set.maxCompressionRatio > 0 && r.compressed.n > 0 && r.n/r.compressed.n > r.set.maxCompressionRatio {
+		r.exceeded = true
+		return n, ErrDecompressedTooLarge
+	}
+
+	return n, err
+}
+
+// Close closes original request body, decoder will be returned to pool
+func (r *decompressReader) Close() error {
+	var err error
+
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		err = r.original.Close()
+		r.pool.Put(r.decoder)
+		r.decoder = nil
+	})
+
+	return err
+}
+
+// Exceeded returns true if decompressed size or compression ratio exceeds limit
+func (r *decompressReader) Exceeded() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.exceeded
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechogzip
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// precompressedExtensions file extension of precompressed siblings for each encoding
+var precompressedExtensions = map[string]string{
+	gzipEncoding: ".gz",
+	brEncoding:   ".br",
+	zstdEncoding: ".zst",
+}
+
+// PrecompressedHandler wraps static file handler, like StaticFileHandlerEntry.GetFileHandler(),
+// in order to serve precompressed siblings of static files directly.
+//
+// If client accepts one of encodings, handler will look for sibling file with extension of
+// .br, .gz or .zst and serve it with Content-Encoding. Original file will be served if none of
+// siblings exists.
+//
+// Encodings are in order of server preference, default is br and gzip.
+func PrecompressedHandler(handler http.HandlerFunc, encodings ...string) echo.HandlerFunc {
+	preferred := make([]string, 0)
+	for i := range encodings {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if _, ok := precompressedExtensions[encoding]; ok {
+			preferred = append(preferred, encoding)
+		}
+	}
+
+	if len(preferred) < 1 {
+		preferred = []string{brEncoding, gzipEncoding}
+	}
+
+	return func(ctx echo.Context) error {
+		req := ctx.Request()
+		ctx.Response().Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+
+		// directory listing and range requests will be served with original file
+		if strings.HasSuffix(req.URL.Path, "/") || len(req.Header.Get("Range")) > 0 {
+			handler(ctx.Response(), req)
+			return nil
+		}
+
+		candidates := append(make([]string, 0), preferred...)
+		for {
+			encoding := negotiateEncoding(req.Header.Get(echo.HeaderAcceptEncoding), candidates)
+			if len(encoding) < 1 {
+				break
+			}
+
+			// try to serve sibling file
+			sibling := req.Clone(req.Context())
+			sibling.URL.Path = req.URL.Path + precompressedExtensions[encoding]
+			sibling.URL.RawPath = ""
+
+			writer := &precompressedWriter{
+				ResponseWriter: ctx.Response(),
+				encoding:       encoding,
+				name:           path.Base(req.URL.Path),
+			}
+			handler(writer, sibling)
+
+			if !writer.missing {
+				return nil
+			}
+
+			// sibling file does not exist, try next one
+			candidates = removeEncoding(candidates, encoding)
+		}
+
+		handler(ctx.Response(), req)
+		return nil
+	}
+}
+
+// removeEncoding returns a copy of encodings without target
+func removeEncoding(encodings []string, target string) []string {
+	res := make([]string, 0)
+	for i := range encodings {
+		if encodings[i] != target {
+			res = append(res, encodings[i])
+		}
+	}
+
+	return res
+}
+
+// precompressedWriter set Content-Encoding for precompressed file,
+// response will be dropped if file handler failed to open sibling file.
+type precompressedWriter struct {
+	http.ResponseWriter
+	encoding    string
+	name        string
+	missing     bool
+	wroteHeader bool
+}
+
+// WriteHeader writes header into http.ResponseWriter
+func (w *precompressedWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	// file handler returns 500 if failed to open file
+	if code >= http.StatusInternalServerError {
+		w.missing = true
+		return
+	}
+
+	w.Header().Set(echo.HeaderContentEncoding, w.encoding)
+	if len(w.Header().Get(echo.HeaderContentDisposition)) > 0 {
+		w.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%s", w.name))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes bytes into http.ResponseWriter, bytes will be dropped if sibling file is missing
+func (w *precompressedWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.missing {
+		return len(b), nil
+	}
+
+	return w.ResponseWriter.Write(b)
+}
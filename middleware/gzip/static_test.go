@@ -0,0 +1,84 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechogzip
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+)
+
+// fileHandler behaves like StaticFileHandlerEntry.GetFileHandler() which returns 500 if file is missing
+func fileHandler(files map[string]string) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		content, ok := files[request.URL.Path]
+		if !ok {
+			writer.WriteHeader(http.StatusInternalServerError)
+			writer.Write([]byte("failed to open file"))
+			return
+		}
+
+		writer.Header().Set(echo.HeaderContentDisposition, "attachment; filename="+path.Base(request.URL.Path))
+		writer.Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
+		writer.WriteHeader(http.StatusOK)
+		writer.Write([]byte(content))
+	}
+}
+
+func serveStatic(handler echo.HandlerFunc, target, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, acceptEncoding)
+	recorder := httptest.NewRecorder()
+	handler(echo.New().NewContext(req, recorder))
+	return recorder
+}
+
+func TestPrecompressedHandler(t *testing.T) {
+	defer assertNotPanic(t)
+
+	handler := PrecompressedHandler(fileHandler(map[string]string{
+		"/static/app.js":    "ut-js",
+		"/static/app.js.gz": "ut-js-gz",
+		"/static/app.js.br": "ut-js-br",
+		"/static/app.css":   "ut-css",
+	}))
+
+	// client accepts br
+	recorder := serveStatic(handler, "/static/app.js", "gzip, br")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, brEncoding, recorder.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, "attachment; filename=app.js", recorder.Header().Get(echo.HeaderContentDisposition))
+	assert.Equal(t, echo.HeaderAcceptEncoding, recorder.Header().Get(echo.HeaderVary))
+	assert.Equal(t, "ut-js-br", recorder.Body.String())
+
+	// client accepts gzip only
+	recorder = serveStatic(handler, "/static/app.js", "gzip, br;q=0")
+	assert.Equal(t, gzipEncoding, recorder.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, "ut-js-gz", recorder.Body.String())
+
+	// client accepts nothing
+	recorder = serveStatic(handler, "/static/app.js", "")
+	assert.Empty(t, recorder.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, "ut-js", recorder.Body.String())
+
+	// sibling is missing
+	recorder = serveStatic(handler, "/static/app.css", "gzip, br")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, "ut-css", recorder.Body.String())
+
+	// with server preference
+	handler = PrecompressedHandler(fileHandler(map[string]string{
+		"/static/app.js":    "ut-js",
+		"/static/app.js.gz": "ut-js-gz",
+		"/static/app.js.br": "ut-js-br",
+	}), "invalid", gzipEncoding)
+	recorder = serveStatic(handler, "/static/app.js", "gzip, br")
+	assert.Equal(t, "ut-js-gz", recorder.Body.String())
+}
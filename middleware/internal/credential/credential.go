@@ -0,0 +1,174 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkechocredential parses passwords of accounts shared by auth and jwt middlewares,
+// password could be plaintext or hashed with bcrypt or argon2 in PHC string format.
+package rkechocredential
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"regexp"
+	"strings"
+)
+
+// Credential is password of account
+type Credential interface {
+	// Verify returns true if password matches
+	Verify(password string) bool
+}
+
+// PlainCredential keeps sha256 of plaintext password so that comparison takes constant time
+type PlainCredential []byte
+
+// Verify compares sha256 of password in constant time
+func (c PlainCredential) Verify(password string) bool {
+	sum := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(c, sum[:]) == 1
+}
+
+// BcryptCredential is password hashed with bcrypt, like $2y$10$...
+type BcryptCredential []byte
+
+// Verify compares password with bcrypt hash
+func (c BcryptCredential) Verify(password string) bool {
+	return bcrypt.CompareHashAndPassword(c, []byte(password)) == nil
+}
+
+// Argon2Credential is password hashed with argon2 in PHC string format, like $argon2id$v=19$m=65536,t=3,p=4$salt$hash
+type Argon2Credential struct {
+	variant string
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// Verify derives key of password with the same parameters and compares it in constant time
+func (c *Argon2Credential) Verify(password string) bool {
+	var key []byte
+	if c.variant == "argon2i" {
+		key = argon2.Key([]byte(password), c.salt, c.time, c.memory, c.threads, uint32(len(c.key)))
+	} else {
+		key = argon2.IDKey([]byte(password), c.salt, c.time, c.memory, c.threads, uint32(len(c.key)))
+	}
+
+	return subtle.ConstantTimeCompare(c.key, key) == 1
+}
+
+// bcryptPrefix is prefix of bcrypt hash with version and cost, like $2y$10$
+var bcryptPrefix = regexp.MustCompile(`^\$2[aby]\$\d{2}\$`)
+
+// isBcrypt returns true if password starts with full prefix of bcrypt hash
+func isBcrypt(password string) bool {
+	return bcryptPrefix.MatchString(password)
+}
+
+// isArgon2 returns true if password starts with prefix of argon2i or argon2id hash in PHC string format
+func isArgon2(password string) bool {
+	return strings.HasPrefix(password, "$argon2id$") || strings.HasPrefix(password, "$argon2i$")
+}
+
+// Parse parses hashed or plaintext password, password is treated as plaintext
+// unless it starts with full prefix of bcrypt or argon2 hash, like $2y$10$ or $argon2id$.
+func Parse(password string, allowPlain bool) (Credential, error) {
+	switch {
+	case isBcrypt(password):
+		if _, err := bcrypt.Cost([]byte(password)); err != nil {
+			return nil, err
+		}
+		return BcryptCredential(password), nil
+	case isArgon2(password):
+		return parseArgon2(password)
+	case allowPlain:
+		sum := sha256.Sum256([]byte(password))
+		return PlainCredential(sum[:]), nil
+	}
+
+	return nil, errors.New("unsupported password hash, only bcrypt and argon2 are supported")
+}
+
+// parseArgon2 parses argon2 hash in PHC string format
+func parseArgon2(hash string) (Credential, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || (parts[1] != "argon2id" && parts[1] != "argon2i") {
+		return nil, errors.New("invalid argon2 hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errors.New("unsupported argon2 version")
+	}
+
+	res := &Argon2Credential{variant: parts[1]}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &res.memory, &res.time, &res.threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters, %v", err)
+	}
+
+	var err error
+	if res.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2 salt, %v", err)
+	}
+	if res.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(res.key) < 1 {
+		return nil, errors.New("invalid argon2 key")
+	}
+
+	return res, nil
+}
+
+// NewDummy returns Credential of random password hashed with the same algorithm and cost as accounts,
+// so that verifying unknown user takes about the same time as existing one and usernames could not be probed.
+//
+// bcrypt with the highest cost is preferred, then argon2 with the highest memory and time, plaintext is the last.
+func NewDummy(accounts ...map[string]Credential) Credential {
+	var bcryptCost int
+	var argon *Argon2Credential
+	for i := range accounts {
+		for _, cred := range accounts[i] {
+			switch v := cred.(type) {
+			case BcryptCredential:
+				if cost, err := bcrypt.Cost(v); err == nil && cost > bcryptCost {
+					bcryptCost = cost
+				}
+			case *Argon2Credential:
+				if argon == nil || uint64(v.memory)*uint64(v.time) > uint64(argon.memory)*uint64(argon.time) {
+					argon = v
+				}
+			}
+		}
+	}
+
+	password := make([]byte, 16)
+	rand.Read(password)
+
+	switch {
+	case bcryptCost > 0:
+		if hash, err := bcrypt.GenerateFromPassword(password, bcryptCost); err == nil {
+			return BcryptCredential(hash)
+		}
+	case argon != nil:
+		salt, key := make([]byte, len(argon.salt)), make([]byte, len(argon.key))
+		rand.Read(salt)
+		rand.Read(key)
+		return &Argon2Credential{
+			variant: argon.variant,
+			memory:  argon.memory,
+			time:    argon.time,
+			threads: argon.threads,
+			salt:    salt,
+			key:     key,
+		}
+	}
+
+	sum := sha256.Sum256(password)
+	return PlainCredential(sum[:])
+}
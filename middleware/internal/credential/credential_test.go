@@ -0,0 +1,117 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechocredential
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func bcryptHash(password string) string {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	return string(hash)
+}
+
+func argon2Hash(password string) string {
+	salt := []byte("ut-salt-16-bytes")
+	key := argon2.IDKey([]byte(password), salt, 1, 1024, 1, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestParse(t *testing.T) {
+	// plaintext
+	cred, err := Parse("ut-pass", true)
+	assert.Nil(t, err)
+	assert.True(t, cred.Verify("ut-pass"))
+	assert.False(t, cred.Verify("ut-wrong"))
+
+	_, err = Parse("ut-pass", false)
+	assert.NotNil(t, err)
+
+	// plaintext looks like prefix of hash
+	for _, password := range []string{"$2secret", "$2y$secret", "$argon2secret"} {
+		cred, err = Parse(password, true)
+		assert.Nil(t, err, password)
+		assert.IsType(t, PlainCredential{}, cred, password)
+		assert.True(t, cred.Verify(password), password)
+	}
+
+	// bcrypt
+	cred, err = Parse(bcryptHash("ut-pass"), false)
+	assert.Nil(t, err)
+	assert.True(t, cred.Verify("ut-pass"))
+	assert.False(t, cred.Verify("ut-wrong"))
+
+	_, err = Parse("$2y$invalid", false)
+	assert.NotNil(t, err)
+
+	_, err = Parse("$2y$10$invalid", false)
+	assert.NotNil(t, err)
+
+	// argon2id
+	cred, err = Parse(argon2Hash("ut-pass"), false)
+	assert.Nil(t, err)
+	assert.True(t, cred.Verify("ut-pass"))
+	assert.False(t, cred.Verify("ut-wrong"))
+
+	// argon2i
+	salt := []byte("ut-salt-16-bytes")
+	key := argon2.Key([]byte("ut-pass"), salt, 1, 1024, 1, 32)
+	cred, err = Parse(fmt.Sprintf("$argon2i$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), false)
+	assert.Nil(t, err)
+	assert.True(t, cred.Verify("ut-pass"))
+
+	// invalid argon2
+	for _, hash := range []string{
+		"$argon2id$v=19$m=1024,t=1,p=1$salt",
+		"$argon2d$v=19$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$",
+	} {
+		_, err = Parse(hash, false)
+		assert.NotNil(t, err, hash)
+	}
+}
+
+func TestNewDummy(t *testing.T) {
+	parse := func(password string) Credential {
+		cred, err := Parse(password, true)
+		assert.Nil(t, err)
+		return cred
+	}
+	costOf := func(cred Credential) int {
+		cost, err := bcrypt.Cost(cred.(BcryptCredential))
+		assert.Nil(t, err)
+		return cost
+	}
+
+	// without hashed password
+	dummy := NewDummy(map[string]Credential{"user": parse("ut-pass")})
+	assert.IsType(t, PlainCredential{}, dummy)
+	assert.False(t, dummy.Verify("ut-pass"))
+
+	// with bcrypt, the highest cost is used
+	hash, _ := bcrypt.GenerateFromPassword([]byte("ut-pass"), bcrypt.MinCost+1)
+	dummy = NewDummy(
+		map[string]Credential{"user": parse(bcryptHash("ut-pass")), "admin": parse(argon2Hash("ut-pass"))},
+		map[string]Credential{"other": parse(string(hash))})
+	assert.Equal(t, bcrypt.MinCost+1, costOf(dummy))
+
+	// with argon2, the same parameters are used
+	dummy = NewDummy(map[string]Credential{"user": parse(argon2Hash("ut-pass"))})
+	assert.IsType(t, &Argon2Credential{}, dummy)
+	assert.Equal(t, uint32(1024), dummy.(*Argon2Credential).memory)
+	assert.Equal(t, uint32(1), dummy.(*Argon2Credential).time)
+	assert.False(t, dummy.Verify("ut-pass"))
+}
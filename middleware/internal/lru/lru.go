@@ -0,0 +1,105 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkecholru is a bounded LRU map shared by middlewares which keep state of clients in memory
+package rkecholru
+
+import "container/list"
+
+// Map is a bounded LRU map, it is not safe for concurrent use.
+type Map[V any] struct {
+	maxKeys int
+	ll      *list.List
+	items   map[string]*list.Element
+	// OnAdd is called once key is added
+	OnAdd func()
+	// OnRemove is called once key is removed, evicted is true if key was removed because map is full
+	OnRemove func(evicted bool)
+}
+
+type entry[V any] struct {
+	key   string
+	value V
+}
+
+// New creates Map which keeps maxKeys keys at most
+func New[V any](maxKeys int) *Map[V] {
+	return &Map[V]{
+		maxKeys: maxKeys,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// Get returns value of key and marks it as most recently used
+func (m *Map[V]) Get(key string) (V, bool) {
+	if elem, ok := m.items[key]; ok {
+		m.ll.MoveToFront(elem)
+		return elem.Value.(*entry[V]).value, true
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Set stores value of key and marks it as most recently used, least recently used key will be evicted if map is full
+func (m *Map[V]) Set(key string, value V) {
+	if elem, ok := m.items[key]; ok {
+		m.ll.MoveToFront(elem)
+		elem.Value.(*entry[V]).value = value
+		return
+	}
+
+	m.items[key] = m.ll.PushFront(&entry[V]{key: key, value: value})
+	if m.OnAdd != nil {
+		m.OnAdd()
+	}
+
+	for m.ll.Len() > m.maxKeys {
+		m.remove(m.ll.Back(), true)
+	}
+}
+
+// Contains returns true if key exists, it does not change order of keys
+func (m *Map[V]) Contains(key string) bool {
+	_, ok := m.items[key]
+	return ok
+}
+
+// Delete removes key, nothing happens if key not exists
+func (m *Map[V]) Delete(key string) {
+	if elem, ok := m.items[key]; ok {
+		m.remove(elem, false)
+	}
+}
+
+// RemoveIf removes keys whose value matches fn
+func (m *Map[V]) RemoveIf(fn func(value V) bool) {
+	for elem := m.ll.Front(); elem != nil; {
+		next := elem.Next()
+		if fn(elem.Value.(*entry[V]).value) {
+			m.remove(elem, false)
+		}
+		elem = next
+	}
+}
+
+// Len returns number of keys
+func (m *Map[V]) Len() int {
+	return m.ll.Len()
+}
+
+// MaxKeys returns max number of keys
+func (m *Map[V]) MaxKeys() int {
+	return m.maxKeys
+}
+
+func (m *Map[V]) remove(elem *list.Element, evicted bool) {
+	m.ll.Remove(elem)
+	delete(m.items, elem.Value.(*entry[V]).key)
+	if m.OnRemove != nil {
+		m.OnRemove(evicted)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkecholru
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	added, evicted, removed := 0, 0, 0
+	m := New[int](2)
+	m.OnAdd = func() { added++ }
+	m.OnRemove = func(e bool) {
+		if e {
+			evicted++
+		} else {
+			removed++
+		}
+	}
+
+	// missing
+	_, ok := m.Get("a")
+	assert.False(t, ok)
+
+	m.Set("a", 1)
+	m.Set("b", 2)
+	v, ok := m.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 2, m.Len())
+	assert.Equal(t, 2, m.MaxKeys())
+
+	// b is the least recently used one
+	m.Set("c", 3)
+	assert.Equal(t, 2, m.Len())
+	assert.Equal(t, 3, added)
+	assert.Equal(t, 1, evicted)
+	assert.False(t, m.Contains("b"))
+	assert.True(t, m.Contains("a"))
+
+	// update existing key
+	m.Set("c", 30)
+	v, _ = m.Get("c")
+	assert.Equal(t, 30, v)
+	assert.Equal(t, 3, added)
+
+	// a is the least recently used one now
+	m.Set("d", 4)
+	assert.False(t, m.Contains("a"))
+	assert.Equal(t, 2, evicted)
+
+	// delete
+	m.Delete("c")
+	m.Delete("missing")
+	assert.False(t, m.Contains("c"))
+	assert.Equal(t, 1, removed)
+
+	// remove if
+	m.Set("e", 5)
+	m.RemoveIf(func(value int) bool {
+		return value > 4
+	})
+	assert.Equal(t, 1, m.Len())
+	assert.True(t, m.Contains("d"))
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, 2, evicted)
+}
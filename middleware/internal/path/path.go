@@ -0,0 +1,16 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkechopath matches URL paths configured in middlewares
+package rkechopath
+
+import "strings"
+
+// MatchPrefix returns true if path equals to prefix or under it by whole segments,
+// so that /v1/orders matches /v1/orders/1 but not /v1/orders-admin.
+func MatchPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
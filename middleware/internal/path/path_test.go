@@ -0,0 +1,20 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechopath
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMatchPrefix(t *testing.T) {
+	assert.True(t, MatchPrefix("/v1/orders", "/v1/orders"))
+	assert.True(t, MatchPrefix("/v1/orders/1", "/v1/orders"))
+	assert.True(t, MatchPrefix("/v1/orders/1", "/v1/orders/"))
+	assert.True(t, MatchPrefix("/v1/orders", "/"))
+	assert.False(t, MatchPrefix("/v1/orders-admin", "/v1/orders"))
+	assert.False(t, MatchPrefix("/v1", "/v1/orders"))
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechojwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/path"
+	"github.com/rookie-ninja/rk-entry/v2/error"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ClaimScope is space-delimited scopes defined in RFC 8693
+	ClaimScope = "scope"
+	// ClaimScp is scopes as array or space-delimited string, used by some identity providers
+	ClaimScp = "scp"
+	// ClaimRoles is roles as array or string
+	ClaimRoles = "roles"
+)
+
+var (
+	errClaimsMissing = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Missing or malformed jwt")
+	errJwtInvalid    = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Invalid or expired jwt")
+	errJwtRevoked    = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Revoked jwt")
+)
+
+// ClaimsFactory returns new instance of custom claims type, which should be a pointer, like &MyClaims{}
+type ClaimsFactory func() jwt.Claims
+
+// ClaimsMatcher checks claims of jwt token, error will be returned as message of 403 if claims do not match
+type ClaimsMatcher func(claims jwt.MapClaims) error
+
+// RequireClaims returns route level middleware which checks claims of jwt token inserted by Middleware.
+//
+// All matchers should pass, otherwise request will be rejected with 403.
+//
+// Example:
+//
+//	e.POST("/v1/users", handler, rkechojwt.RequireClaims(rkechojwt.Scopes("users:write"), rkechojwt.Roles("admin")))
+func RequireClaims(matchers ...ClaimsMatcher) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			token := rkechoctx.GetJwtToken(ctx)
+			if token == nil {
+				return ctx.JSON(errClaimsMissing.Code(), errClaimsMissing)
+			}
+
+			if errResp := matchClaims(token, matchers); errResp != nil {
+				rkechoctx.GetEvent(ctx).SetCounter("jwtForbidden", 1)
+				return ctx.JSON(errResp.Code(), errResp)
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// matchClaims returns 403 if any of matchers failed
+func matchClaims(token *jwt.Token, matchers []ClaimsMatcher) rkerror.ErrorInterface {
+	if len(matchers) < 1 {
+		return nil
+	}
+
+	claims := toMapClaims(token.Claims)
+	for i := range matchers {
+		if err := matchers[i](claims); err != nil {
+			return rkmid.GetErrorBuilder().New(http.StatusForbidden, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// claimsRule is required claims of path and methods
+type claimsRule struct {
+	path     string
+	methods  []string
+	matchers []ClaimsMatcher
+}
+
+// match returns true if rule is applied to request, path matches either route template or prefix of URL path
+// by whole segments, so that /v1/admin is applied to /v1/admin/users but not /v1/administrators.
+func (rule *claimsRule) match(ctx echo.Context) bool {
+	if ctx.Path() != rule.path && !rkechopath.MatchPrefix(ctx.Request().URL.Path, rule.path) {
+		return false
+	}
+
+	if len(rule.methods) < 1 {
+		return true
+	}
+
+	for i := range rule.methods {
+		if strings.EqualFold(rule.methods[i], ctx.Request().Method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Scopes requires all of scopes, scopes are read from scope and scp claims
+func Scopes(scopes ...string) ClaimsMatcher {
+	return func(claims jwt.MapClaims) error {
+		granted := append(claimStrings(claims, ClaimScope), claimStrings(claims, ClaimScp)...)
+		for i := range scopes {
+			if !containsString(granted, scopes[i]) {
+				return fmt.Errorf("missing scope %s", scopes[i])
+			}
+		}
+
+		return nil
+	}
+}
+
+// Roles requires any of roles in roles claim
+func Roles(roles ...string) ClaimsMatcher {
+	return Claim(ClaimRoles, roles...)
+}
+
+// Audience requires any of audiences in aud claim
+func Audience(audiences ...string) ClaimsMatcher {
+	return Claim("aud", audiences...)
+}
+
+// Issuer requires iss claim to be one of issuers
+func Issuer(issuers ...string) ClaimsMatcher {
+	return Claim("iss", issuers...)
+}
+
+// Claim requires claim to be one of values, or contain any of values if claim is array.
+//
+// Nested claim could be referenced with dot, like realm_access.roles.
+// Claim is only required to exist if values are empty.
+func Claim(name string, values ...string) ClaimsMatcher {
+	return func(claims jwt.MapClaims) error {
+		actual, ok := lookupClaim(claims, name)
+		if !ok {
+			return fmt.Errorf("missing claim %s", name)
+		}
+
+		if len(values) < 1 {
+			return nil
+		}
+
+		granted := toStrings(actual, false)
+		for i := range values {
+			if containsString(granted, values[i]) {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("claim %s does not match", name)
+	}
+}
+
+// lookupClaim returns value of claim, nested claim is separated by dot
+func lookupClaim(claims jwt.MapClaims, name string) (interface{}, bool) {
+	if v, ok := claims[name]; ok {
+		return v, true
+	}
+
+	var current interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(name, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// claimStrings returns values of claim, string value is split by space
+func claimStrings(claims jwt.MapClaims, name string) []string {
+	if v, ok := lookupClaim(claims, name); ok {
+		return toStrings(v, true)
+	}
+
+	return []string{}
+}
+
+// toStrings converts value of claim into string slice
+func toStrings(v interface{}, split bool) []string {
+	res := make([]string, 0)
+
+	switch value := v.(type) {
+	case string:
+		if split {
+			return strings.Fields(value)
+		}
+		res = append(res, value)
+	case []string:
+		res = append(res, value...)
+	case []interface{}:
+		for i := range value {
+			res = append(res, fmt.Sprint(value[i]))
+		}
+	case nil:
+	default:
+		res = append(res, fmt.Sprint(value))
+	}
+
+	return res
+}
+
+// toMapClaims converts claims into jwt.MapClaims, claims of struct are converted with JSON
+func toMapClaims(claims jwt.Claims) jwt.MapClaims {
+	switch v := claims.(type) {
+	case jwt.MapClaims:
+		return v
+	case nil:
+		return jwt.MapClaims{}
+	}
+
+	res := jwt.MapClaims{}
+	if raw, err := json.Marshal(claims); err == nil {
+		json.Unmarshal(raw, &res)
+	}
+
+	return res
+}
+
+func containsString(list []string, target string) bool {
+	for i := range list {
+		if list[i] == target {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechojwt
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var utClaims = jwt.MapClaims{
+	"sub":   "ut-subject",
+	"iss":   "ut-issuer",
+	"aud":   []interface{}{"ut-aud", "ut-aud-2"},
+	"scope": "users:read users:write",
+	"roles": []interface{}{"admin"},
+	"realm_access": map[string]interface{}{
+		"roles": []interface{}{"ut-realm-role"},
+	},
+	"level": float64(3),
+}
+
+func TestClaimsMatcher(t *testing.T) {
+	// scopes
+	assert.Nil(t, Scopes("users:read", "users:write")(utClaims))
+	assert.NotNil(t, Scopes("users:read", "users:delete")(utClaims))
+	assert.Nil(t, Scopes("ut-scp")(jwt.MapClaims{"scp": []interface{}{"ut-scp"}}))
+
+	// roles
+	assert.Nil(t, Roles("viewer", "admin")(utClaims))
+	assert.NotNil(t, Roles("viewer")(utClaims))
+	assert.NotNil(t, Roles("admin")(jwt.MapClaims{}))
+
+	// audience and issuer
+	assert.Nil(t, Audience("ut-aud-2")(utClaims))
+	assert.NotNil(t, Audience("ut-other")(utClaims))
+	assert.Nil(t, Issuer("ut-other", "ut-issuer")(utClaims))
+	assert.NotNil(t, Issuer("ut-other")(utClaims))
+
+	// claims
+	assert.Nil(t, Claim("realm_access.roles", "ut-realm-role")(utClaims))
+	assert.NotNil(t, Claim("realm_access.missing")(utClaims))
+	assert.NotNil(t, Claim("sub.missing")(utClaims))
+	assert.Nil(t, Claim("level", "3")(utClaims))
+	assert.Nil(t, Claim("sub")(utClaims))
+	assert.NotNil(t, Claim("sub", "ut-other")(utClaims))
+}
+
+func TestMatchClaims(t *testing.T) {
+	// struct claims are converted into map
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:   "ut-issuer",
+		Audience: jwt.ClaimStrings{"ut-aud"},
+	})
+	assert.Nil(t, matchClaims(token, []ClaimsMatcher{Issuer("ut-issuer"), Audience("ut-aud")}))
+
+	errResp := matchClaims(token, []ClaimsMatcher{Issuer("ut-other")})
+	assert.NotNil(t, errResp)
+	assert.Equal(t, http.StatusForbidden, errResp.Code())
+}
+
+func TestRequireClaims(t *testing.T) {
+	defer assertNotPanic(t)
+
+	inter := RequireClaims(Scopes("users:write"), Roles("admin"))
+
+	// case 1: missing token
+	ctx, w := newCtx()
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// case 2: claims match
+	ctx, w = newCtx()
+	ctx.Set(rkmid.JwtTokenKey.String(), jwt.NewWithClaims(jwt.SigningMethodHS256, utClaims))
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 3: claims do not match
+	ctx, w = newCtx()
+	ctx.Set(rkmid.JwtTokenKey.String(), jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"roles": "admin"}))
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "missing scope users:write")
+}
+
+func TestMiddlewareWithOption_RequiredClaims(t *testing.T) {
+	defer assertNotPanic(t)
+
+	beforeCtx := rkmidjwt.NewBeforeCtx()
+	beforeCtx.Output.JwtToken = jwt.NewWithClaims(jwt.SigningMethodHS256, utClaims)
+	inter := MiddlewareWithOption([]Option{
+		WithRequiredClaims("/ut-path", []string{http.MethodPost}, Roles("admin")),
+		WithRequiredClaims("ut-path/:id", nil, Scopes("users:delete")),
+		WithRequiredClaims("/ut-empty", nil),
+		WithRequiredClaims("/ut-admin", nil, Roles("ut-missing")),
+	}, rkmidjwt.WithMockOptionSet(rkmidjwt.NewOptionSetMock(beforeCtx)))
+
+	newPathCtx := func(method, path, route string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, w)
+		ctx.SetPath(route)
+		return ctx, w
+	}
+
+	// case 1: rule of method matches
+	ctx, w := newPathCtx(http.MethodPost, "/ut-path", "/ut-path")
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 2: rule of route template does not match
+	ctx, w = newPathCtx(http.MethodGet, "/ut-path/1", "/ut-path/:id")
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// case 3: other paths
+	ctx, w = newPathCtx(http.MethodGet, "/ut-other", "/ut-other")
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 4: prefix of URL path matches by whole segments
+	ctx, w = newPathCtx(http.MethodGet, "/ut-admin/users", "/ut-admin/users")
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	ctx, w = newPathCtx(http.MethodGet, "/ut-administrators", "/ut-administrators")
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
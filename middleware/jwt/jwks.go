@@ -0,0 +1,464 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechojwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"io"
+	"io/fs"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJwksRefreshInterval default interval of refreshing JWKS from URL
+	DefaultJwksRefreshInterval = time.Hour
+	// DefaultJwksMinRefetchInterval default min interval of refetching JWKS because of unknown kid
+	DefaultJwksMinRefetchInterval = 10 * time.Second
+	// maxJwksBytes max size of JWKS document
+	maxJwksBytes = 1 << 20
+)
+
+var (
+	errJwksUnknownKid = errors.New("unknown kid of jwt")
+
+	// algorithms of each key type in JWKS
+	jwksAlgorithms = map[string][]string{
+		"RSA": {
+			jwt.SigningMethodRS256.Name, jwt.SigningMethodRS384.Name, jwt.SigningMethodRS512.Name,
+			jwt.SigningMethodPS256.Name, jwt.SigningMethodPS384.Name, jwt.SigningMethodPS512.Name,
+		},
+		"EC": {
+			jwt.SigningMethodES256.Name, jwt.SigningMethodES384.Name, jwt.SigningMethodES512.Name,
+		},
+		"OKP": {
+			jwt.SigningMethodEdDSA.Alg(),
+		},
+	}
+)
+
+// jwk is a single key of JWKS defined in RFC 7517, only public keys of RSA, EC and Ed25519 are supported
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwksKey is parsed public key with algorithms it could verify
+type jwksKey struct {
+	key        interface{}
+	algorithms []string
+}
+
+// jwksSigner implements rkentry.SignerJwt which verifies jwt with keys published as JWKS.
+//
+// Keys are cached by kid. Keys fetched from URL will be refreshed in background once refresh interval passed,
+// and refetched immediately if kid of token is unknown, which is rate limited by min refetch interval.
+// Signing is not supported since private keys are owned by identity provider.
+type jwksSigner struct {
+	entryName          string
+	url                string
+	client             *http.Client
+	refreshInterval    time.Duration
+	minRefetchInterval time.Duration
+	keys               map[string]*jwksKey
+	fetchedAt          time.Time
+	attemptedAt        time.Time
+	refreshing         bool
+	mu                 sync.Mutex
+	// fetchMu makes sure only one fetch is in progress
+	fetchMu sync.Mutex
+}
+
+// newJwksSignerFromUrl creates jwksSigner which fetches keys from URL lazily
+func newJwksSignerFromUrl(entryName, url string, client *http.Client, refreshInterval, minRefetchInterval time.Duration) *jwksSigner {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &jwksSigner{
+		entryName:          entryName,
+		url:                url,
+		client:             client,
+		refreshInterval:    refreshInterval,
+		minRefetchInterval: minRefetchInterval,
+		keys:               make(map[string]*jwksKey),
+	}
+}
+
+// newJwksSignerFromFS creates jwksSigner with keys read from file system, like embed.FS
+func newJwksSignerFromFS(entryName string, fsys fs.FS, path string) *jwksSigner {
+	raw, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		rkentry.ShutdownWithError(err)
+	}
+
+	return newJwksSignerFromBytes(entryName, raw)
+}
+
+// newJwksSignerFromFile creates jwksSigner with keys read from local file
+func newJwksSignerFromFile(entryName string, path string) *jwksSigner {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		rkentry.ShutdownWithError(err)
+	}
+
+	return newJwksSignerFromBytes(entryName, raw)
+}
+
+func newJwksSignerFromBytes(entryName string, raw []byte) *jwksSigner {
+	keys, err := parseJwks(raw)
+	if err != nil {
+		rkentry.ShutdownWithError(err)
+	}
+
+	return &jwksSigner{
+		entryName: entryName,
+		keys:      keys,
+		fetchedAt: time.Now(),
+	}
+}
+
+// Bootstrap fetches keys from URL, failure is tolerated since keys will be fetched again while verifying
+func (s *jwksSigner) Bootstrap(ctx context.Context) {
+	if len(s.url) > 0 {
+		s.fetch(ctx)
+	}
+}
+
+// Interrupt noop
+func (s *jwksSigner) Interrupt(ctx context.Context) {}
+
+// GetName returns name of entry
+func (s *jwksSigner) GetName() string {
+	return s.entryName
+}
+
+// GetType returns type of entry
+func (s *jwksSigner) GetType() string {
+	return rkentry.SignerJwtEntryType
+}
+
+// GetDescription returns description of entry
+func (s *jwksSigner) GetDescription() string {
+	return "JWKS jwt signer"
+}
+
+// String returns entry as string
+func (s *jwksSigner) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kids := make([]string, 0)
+	for kid := range s.keys {
+		kids = append(kids, kid)
+	}
+
+	m := map[string]interface{}{
+		"name":                s.entryName,
+		"url":                 s.url,
+		"kids":                kids,
+		"supportedAlgorithms": strings.Join(s.Algorithms(), ","),
+	}
+
+	bytes, _ := json.Marshal(m)
+	return string(bytes)
+}
+
+// SignJwt is not supported
+func (s *jwksSigner) SignJwt(jwt.Claims) (string, error) {
+	return "", errors.New("signing jwt with JWKS is not supported")
+}
+
+// VerifyJwt verifies jwt with key of kid in JWKS
+func (s *jwksSigner) VerifyJwt(raw string) (*jwt.Token, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods(s.Algorithms()))
+	token, err := parser.Parse(raw, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		key, err := s.getKey(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range key.algorithms {
+			if key.algorithms[i] == t.Method.Alg() {
+				return key.key, nil
+			}
+		}
+
+		return nil, fmt.Errorf("unexpected jwt signing algorithm=%v", t.Header["alg"])
+	})
+
+	// return error
+	if err != nil {
+		return nil, err
+	}
+
+	// invalid token
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return token, nil
+}
+
+// PubKey returns nil since there are multiple keys
+func (s *jwksSigner) PubKey() []byte {
+	return nil
+}
+
+// Algorithms supported algorithms
+func (s *jwksSigner) Algorithms() []string {
+	res := make([]string, 0)
+	for _, kty := range []string{"RSA", "EC", "OKP"} {
+		res = append(res, jwksAlgorithms[kty]...)
+	}
+
+	return res
+}
+
+// getKey returns key of kid, keys will be fetched again if kid is unknown or refresh interval passed.
+// The only key will be returned if kid is empty.
+func (s *jwksSigner) getKey(kid string) (*jwksKey, error) {
+	s.mu.Lock()
+	key := s.lookup(kid)
+	stale := len(s.url) > 0 && time.Since(s.fetchedAt) > s.refreshInterval
+	unknownAllowed := len(s.url) > 0 && time.Since(s.attemptedAt) >= s.minRefetchInterval
+	s.mu.Unlock()
+
+	switch {
+	case key != nil && stale:
+		// refresh in background and keep using cached key
+		s.refreshAsync()
+	case key == nil && unknownAllowed:
+		s.fetch(context.Background())
+
+		s.mu.Lock()
+		key = s.lookup(kid)
+		s.mu.Unlock()
+	}
+
+	if key == nil {
+		return nil, errJwksUnknownKid
+	}
+
+	return key, nil
+}
+
+// lookup returns key of kid, caller should hold lock
+func (s *jwksSigner) lookup(kid string) *jwksKey {
+	if len(kid) < 1 && len(s.keys) == 1 {
+		for _, v := range s.keys {
+			return v
+		}
+	}
+
+	return s.keys[kid]
+}
+
+// refreshAsync fetches keys in background if there is no refresh in progress
+func (s *jwksSigner) refreshAsync() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.refreshing {
+		return
+	}
+	s.refreshing = true
+
+	go func() {
+		s.fetch(context.Background())
+
+		s.mu.Lock()
+		s.refreshing = false
+		s.mu.Unlock()
+	}()
+}
+
+// fetch keys from URL, cached keys will be kept if failed
+func (s *jwksSigner) fetch(ctx context.Context) {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+
+	// keys were fetched by another caller while waiting for lock
+	s.mu.Lock()
+	if time.Since(s.attemptedAt) < s.minRefetchInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.attemptedAt = time.Now()
+	s.mu.Unlock()
+
+	keys, err := s.download(ctx)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+}
+
+// download and parse JWKS from URL
+func (s *jwksSigner) download(ctx context.Context) (map[string]*jwksKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS, status=%d", resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxJwksBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJwks(raw)
+}
+
+// parseJwks parses JWKS document, keys not used for signature or not supported will be skipped
+func parseJwks(raw []byte) (map[string]*jwksKey, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*jwksKey)
+	for i := range set.Keys {
+		k := set.Keys[i]
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+
+		algorithms := jwksAlgorithms[k.Kty]
+		if len(k.Alg) > 0 {
+			algorithms = []string{k.Alg}
+		}
+
+		res[k.Kid] = &jwksKey{
+			key:        key,
+			algorithms: algorithms,
+		}
+	}
+
+	if len(res) < 1 {
+		return nil, errors.New("no valid key found in JWKS")
+	}
+
+	return res, nil
+}
+
+// publicKey parses public key of jwk
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid point of EC key")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid size of Ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// decodeBigInt decodes base64url encoded big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) < 1 {
+		return nil, errors.New("empty integer")
+	}
+
+	return new(big.Int).SetBytes(raw), nil
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechojwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// jwksServer is a local identity provider which publishes JWKS
+type jwksServer struct {
+	*httptest.Server
+	keys  []map[string]string
+	calls int32
+	mu    sync.Mutex
+}
+
+func newJwksServer() *jwksServer {
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(s.document())
+	}))
+
+	return s
+}
+
+func (s *jwksServer) setKeys(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *jwksServer) document() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	raw, _ := json.Marshal(map[string]interface{}{"keys": s.keys})
+	return raw
+}
+
+func (s *jwksServer) getCalls() int {
+	return int(atomic.LoadInt32(&s.calls))
+}
+
+func rsaJwk(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "RSA",
+		"use": "sig",
+		"n":   encodeBigInt(key.N),
+		"e":   encodeBigInt(big.NewInt(int64(key.E))),
+	}
+}
+
+func ecJwk(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "EC",
+		"alg": "ES256",
+		"crv": "P-256",
+		"x":   encodeBigInt(key.X),
+		"y":   encodeBigInt(key.Y),
+	}
+}
+
+func edJwk(kid string, key ed25519.PrivateKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "OKP",
+		"crv": "Ed25519",
+		"x":   base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+	}
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	token := jwt.NewWithClaims(method, jwt.RegisteredClaims{
+		Subject:   "ut-subject",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	if len(kid) > 0 {
+		token.Header["kid"] = kid
+	}
+
+	raw, err := token.SignedString(key)
+	assert.Nil(t, err)
+	return raw
+}
+
+func TestJwksSigner_Url(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	server := newJwksServer()
+	defer server.Close()
+	server.setKeys(rsaJwk("ut-rsa", rsaKey), ecJwk("ut-ec", ecKey), edJwk("ut-ed", edKey))
+
+	signer := newJwksSignerFromUrl("ut-entry", server.URL, nil, time.Hour, time.Hour)
+
+	// keys are fetched lazily
+	token, err := signer.VerifyJwt(signToken(t, jwt.SigningMethodRS256, "ut-rsa", rsaKey))
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-subject", token.Claims.(jwt.MapClaims)["sub"])
+
+	_, err = signer.VerifyJwt(signToken(t, jwt.SigningMethodES256, "ut-ec", ecKey))
+	assert.Nil(t, err)
+
+	_, err = signer.VerifyJwt(signToken(t, jwt.SigningMethodEdDSA, "ut-ed", edKey))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, server.getCalls())
+
+	// algorithm does not match key
+	_, err = signer.VerifyJwt(signToken(t, jwt.SigningMethodPS256, "ut-ec", rsaKey))
+	assert.NotNil(t, err)
+
+	// symmetric algorithm is not allowed
+	_, err = signer.VerifyJwt(signToken(t, jwt.SigningMethodHS256, "ut-rsa", []byte("ut-key")))
+	assert.NotNil(t, err)
+
+	// signed by another key
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, err = signer.VerifyJwt(signToken(t, jwt.SigningMethodRS256, "ut-rsa", otherKey))
+	assert.NotNil(t, err)
+
+	// signing is not supported
+	_, err = signer.SignJwt(jwt.MapClaims{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "ut-entry", signer.GetName())
+	assert.Contains(t, signer.String(), "ut-rsa")
+}
+
+func TestJwksSigner_UnknownKid(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	server := newJwksServer()
+	defer server.Close()
+	server.setKeys(rsaJwk("ut-old", oldKey))
+
+	signer := newJwksSignerFromUrl("ut-entry", server.URL, nil, time.Hour, 50*time.Millisecond)
+
+	_, err := signer.VerifyJwt(signToken(t, jwt.SigningMethodRS256, "ut-old", oldKey))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, server.getCalls())
+
+	// key rotated, refetch is rate limited
+	server.setKeys(rsaJwk("ut-old", oldKey), rsaJwk("ut-new", newKey))
+	_, err = signer.VerifyJwt(signToken(t, jwt.SigningMethodRS256, "ut-new", newKey))
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, server.getCalls())
+
+	// refetch on unknown kid
+	time.Sleep(60 * time.Millisecond)
+	_, err = signer.VerifyJwt(signToken(t, jwt.SigningMethodRS256, "ut-new", newKey))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, server.getCalls())
+
+	// unknown kid does not hit server again within min refetch interval
+	for i := 0; i < 10; i++ {
+		_, err = signer.VerifyJwt(signToken(t, jwt.SigningMethodRS256, "ut-unknown", newKey))
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, 2, server.getCalls())
+}
+
+func TestJwksSigner_Refresh(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	server := newJwksServer()
+	defer server.Close()
+	server.setKeys(rsaJwk("ut-kid", key))
+
+	signer := newJwksSignerFromUrl("ut-entry", server.URL, nil, 10*time.Millisecond, time.Millisecond)
+	raw := signToken(t, jwt.SigningMethodRS256, "ut-kid", key)
+
+	_, err := signer.VerifyJwt(raw)
+	assert.Nil(t, err)
+
+	// cached key is used while refreshing in background
+	time.Sleep(20 * time.Millisecond)
+	_, err = signer.VerifyJwt(raw)
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool {
+		return server.getCalls() == 2
+	}, time.Second, 5*time.Millisecond)
+
+	// cached keys are kept if server failed
+	server.Close()
+	time.Sleep(20 * time.Millisecond)
+	_, err = signer.VerifyJwt(raw)
+	assert.Nil(t, err)
+}
+
+func TestJwksSigner_File(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	raw, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			rsaJwk("ut-kid", key),
+			// keys for encryption are skipped
+			{"kid": "ut-enc", "kty": "RSA", "use": "enc"},
+		},
+	})
+
+	// from local file
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.Nil(t, os.WriteFile(path, raw, 0644))
+	signer := newJwksSignerFromFile("ut-entry", path)
+	assert.Len(t, signer.keys, 1)
+
+	// the only key is used if kid is missing
+	_, err := signer.VerifyJwt(signToken(t, jwt.SigningMethodRS256, "", key))
+	assert.Nil(t, err)
+
+	// from fs.FS
+	signer = newJwksSignerFromFS("ut-entry", fstest.MapFS{"jwks.json": {Data: raw}}, "jwks.json")
+	_, err = signer.VerifyJwt(signToken(t, jwt.SigningMethodRS256, "ut-kid", key))
+	assert.Nil(t, err)
+
+	// missing file and invalid document
+	assert.Panics(t, func() {
+		newJwksSignerFromFile("ut-entry", filepath.Join(t.TempDir(), "ut-missing.json"))
+	})
+	assert.Panics(t, func() {
+		newJwksSignerFromFS("ut-entry", fstest.MapFS{"jwks.json": {Data: []byte(`{"keys":[]}`)}}, "jwks.json")
+	})
+}
+
+func TestParseJwks(t *testing.T) {
+	// invalid json
+	_, err := parseJwks([]byte("ut-invalid"))
+	assert.NotNil(t, err)
+
+	// unsupported keys are skipped
+	_, err = parseJwks([]byte(`{"keys":[
+		{"kid":"a","kty":"oct","k":"dXQta2V5"},
+		{"kid":"b","kty":"EC","crv":"P-256","x":"AQ","y":"AQ"},
+		{"kid":"c","kty":"OKP","crv":"X25519","x":"AQ"},
+		{"kid":"d","kty":"RSA","n":"","e":"AQAB"}
+	]}`))
+	assert.NotNil(t, err)
+}
@@ -8,6 +8,7 @@ package rkechojwt
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
 	"github.com/rookie-ninja/rk-entry/v2/middleware"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
 )
@@ -17,7 +18,17 @@ import (
 // Mainly copied from bellow.
 // https://github.com/labstack/echo/blob/master/middleware/jwt.go
 func Middleware(opts ...rkmidjwt.Option) echo.MiddlewareFunc {
-	set := rkmidjwt.NewOptionSet(opts...)
+	return MiddlewareWithOption(nil, opts...)
+}
+
+// MiddlewareWithOption Add jwt interceptors with options of rk-echo.
+//
+// Token will be verified with keys of JWKS if JWKS source provided, signer of rk-entry options will be overridden.
+// Claims of token are parsed into custom type if claims factory provided, and checked with required claims
+// of path and methods after verified. Tokens revoked in RevocationList are rejected.
+func MiddlewareWithOption(echoOpts []Option, opts ...rkmidjwt.Option) echo.MiddlewareFunc {
+	echoSet := newOptionSet(echoOpts...)
+	set := rkmidjwt.NewOptionSet(append(append([]rkmidjwt.Option{}, opts...), echoSet.rkOptions()...)...)
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(ctx echo.Context) error {
@@ -32,9 +43,26 @@ func Middleware(opts ...rkmidjwt.Option) echo.MiddlewareFunc {
 					beforeCtx.Output.ErrResp)
 			}
 
+			// case 2: failed to parse claims into custom type
+			if errResp := echoSet.parseClaims(beforeCtx.Output.JwtToken); errResp != nil {
+				return ctx.JSON(errResp.Code(), errResp)
+			}
+
+			// case 3: token was revoked
+			if errResp := echoSet.checkRevoked(ctx, beforeCtx.Output.JwtToken); errResp != nil {
+				rkechoctx.GetEvent(ctx).SetCounter("jwtRevoked", 1)
+				return ctx.JSON(errResp.Code(), errResp)
+			}
+
 			// insert into context
 			ctx.Set(rkmid.JwtTokenKey.String(), beforeCtx.Output.JwtToken)
 
+			// case 4: claims do not match required ones
+			if errResp := echoSet.authorize(ctx, beforeCtx.Output.JwtToken); errResp != nil {
+				rkechoctx.GetEvent(ctx).SetCounter("jwtForbidden", 1)
+				return ctx.JSON(errResp.Code(), errResp)
+			}
+
 			return next(ctx)
 		}
 	}
@@ -7,7 +7,12 @@ package rkechojwt
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
 	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
 	"github.com/stretchr/testify/assert"
@@ -15,6 +20,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 var userHandler = func(ctx echo.Context) error {
@@ -41,6 +47,72 @@ func TestMiddleware(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestMiddlewareWithOption_Jwks(t *testing.T) {
+	defer assertNotPanic(t)
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := newJwksServer()
+	defer server.Close()
+	server.setKeys(rsaJwk("ut-kid", key))
+
+	inter := MiddlewareWithOption(
+		[]Option{WithJwksUrl(server.URL, time.Hour)},
+		rkmidjwt.WithEntryNameAndType("ut-entry", "ut-type"))
+
+	// case 1: verified by JWKS
+	ctx, w := newCtx()
+	ctx.Request().Header.Set(rkmid.HeaderAuthorization,
+		"Bearer "+signToken(t, jwt.SigningMethodRS256, "ut-kid", key))
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotNil(t, ctx.Get(rkmid.JwtTokenKey.String()))
+
+	// case 2: signed by default symmetric key of rk-entry
+	ctx, w = newCtx()
+	ctx.Request().Header.Set(rkmid.HeaderAuthorization,
+		"Bearer "+signToken(t, jwt.SigningMethodHS256, "ut-kid", []byte("rk jwt key")))
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+type utCustomClaims struct {
+	jwt.RegisteredClaims
+	Tenant string `json:"tenant"`
+}
+
+func TestMiddlewareWithOption_ClaimsFactory(t *testing.T) {
+	defer assertNotPanic(t)
+
+	key := []byte("ut-key")
+	inter := MiddlewareWithOption([]Option{
+		WithClaimsFactory(func() jwt.Claims { return &utCustomClaims{} }),
+	}, rkmidjwt.WithSigner(rkentry.RegisterSymmetricJwtSigner("ut-entry", jwt.SigningMethodHS256.Name, key)))
+
+	sign := func(claims jwt.Claims) string {
+		raw, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		return raw
+	}
+
+	// case 1: parsed into custom claims
+	ctx, w := newCtx()
+	ctx.Request().Header.Set(rkmid.HeaderAuthorization, "Bearer "+sign(&utCustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "ut-subject"},
+		Tenant:           "ut-tenant",
+	}))
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+	claims, ok := rkechoctx.GetJwtClaims[*utCustomClaims](ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "ut-tenant", claims.Tenant)
+	assert.Equal(t, "ut-subject", claims.Subject)
+
+	// case 2: claims do not fit custom type
+	ctx, w = newCtx()
+	ctx.Request().Header.Set(rkmid.HeaderAuthorization, "Bearer "+sign(jwt.MapClaims{"tenant": 1}))
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
 func newCtx() (echo.Context, *httptest.ResponseRecorder) {
 	var buf bytes.Buffer
 	req := httptest.NewRequest(http.MethodGet, "/ut-path", &buf)
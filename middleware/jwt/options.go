@@ -0,0 +1,316 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechojwt
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/error"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ***************** OptionSet Implementation *****************
+
+// optionSet which is used for middleware implementation
+type optionSet struct {
+	entryName string
+	entryType string
+	// source of JWKS, one of URL, local file and fs.FS
+	jwksUrl                string
+	jwksPath               string
+	jwksFS                 fs.FS
+	jwksClient             *http.Client
+	jwksRefreshInterval    time.Duration
+	jwksMinRefetchInterval time.Duration
+	jwks                   *jwksSigner
+	rules                  []*claimsRule
+	claimsFactory          ClaimsFactory
+	revocationList         RevocationList
+}
+
+// Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:              "fake-entry",
+		entryType:              "",
+		jwksRefreshInterval:    DefaultJwksRefreshInterval,
+		jwksMinRefetchInterval: DefaultJwksMinRefetchInterval,
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	switch {
+	case len(set.jwksUrl) > 0:
+		set.jwks = newJwksSignerFromUrl(set.entryName, set.jwksUrl, set.jwksClient,
+			set.jwksRefreshInterval, set.jwksMinRefetchInterval)
+	case set.jwksFS != nil:
+		set.jwks = newJwksSignerFromFS(set.entryName, set.jwksFS, set.jwksPath)
+	case len(set.jwksPath) > 0:
+		set.jwks = newJwksSignerFromFile(set.entryName, set.jwksPath)
+	}
+
+	return set
+}
+
+// GetEntryName returns entry name
+func (set *optionSet) GetEntryName() string {
+	return set.entryName
+}
+
+// GetEntryType returns entry type
+func (set *optionSet) GetEntryType() string {
+	return set.entryType
+}
+
+// authorize checks claims of token with all rules matching request, 403 will be returned if any of them failed
+func (set *optionSet) authorize(ctx echo.Context, token *jwt.Token) rkerror.ErrorInterface {
+	if token == nil {
+		return nil
+	}
+
+	for i := range set.rules {
+		if set.rules[i].match(ctx) {
+			if errResp := matchClaims(token, set.rules[i].matchers); errResp != nil {
+				return errResp
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseClaims parses claims of verified token into type provided by claims factory
+func (set *optionSet) parseClaims(token *jwt.Token) rkerror.ErrorInterface {
+	if set.claimsFactory == nil || token == nil || len(token.Raw) < 1 {
+		return nil
+	}
+
+	claims := set.claimsFactory()
+	// signature was verified already, validate claims of custom type only
+	if _, _, err := jwt.NewParser().ParseUnverified(token.Raw, claims); err != nil {
+		return errJwtInvalid
+	}
+	if err := claims.Valid(); err != nil {
+		return errJwtInvalid
+	}
+
+	token.Claims = claims
+	return nil
+}
+
+// checkRevoked returns 401 if jti of token was revoked, tokens without jti are never revoked
+func (set *optionSet) checkRevoked(ctx echo.Context, token *jwt.Token) rkerror.ErrorInterface {
+	if set.revocationList == nil || token == nil {
+		return nil
+	}
+
+	jti, _ := toMapClaims(token.Claims)["jti"].(string)
+	if len(jti) < 1 {
+		return nil
+	}
+
+	revoked, err := set.revocationList.IsRevoked(ctx.Request().Context(), jti)
+	if err != nil {
+		return rkmid.GetErrorBuilder().New(http.StatusServiceUnavailable, "Failed to check revocation of jwt")
+	}
+
+	if revoked {
+		return errJwtRevoked
+	}
+
+	return nil
+}
+
+// rkOptions returns options of rk-entry which should be appended to user provided ones
+func (set *optionSet) rkOptions() []rkmidjwt.Option {
+	opts := make([]rkmidjwt.Option, 0)
+
+	if set.jwks != nil {
+		opts = append(opts, rkmidjwt.WithSigner(set.jwks))
+	}
+
+	return opts
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML, extends BootConfig of rk-entry.
+type BootConfig struct {
+	rkmidjwt.BootConfig `yaml:",inline" mapstructure:",squash"`
+	Jwks                struct {
+		Url                  string `yaml:"url" json:"url"`
+		Path                 string `yaml:"path" json:"path"`
+		RefreshIntervalMs    int    `yaml:"refreshIntervalMs" json:"refreshIntervalMs"`
+		MinRefetchIntervalMs int    `yaml:"minRefetchIntervalMs" json:"minRefetchIntervalMs"`
+	} `yaml:"jwks" json:"jwks"`
+	Authorization []struct {
+		Path     string   `yaml:"path" json:"path"`
+		Methods  []string `yaml:"methods" json:"methods"`
+		Scopes   []string `yaml:"scopes" json:"scopes"`
+		Roles    []string `yaml:"roles" json:"roles"`
+		Audience []string `yaml:"audience" json:"audience"`
+		Issuer   []string `yaml:"issuer" json:"issuer"`
+		Claims   []struct {
+			Name   string   `yaml:"name" json:"name"`
+			Values []string `yaml:"values" json:"values"`
+		} `yaml:"claims" json:"claims"`
+	} `yaml:"authorization" json:"authorization"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		opts = append(opts, WithEntryNameAndType(entryName, entryType))
+
+		jwks := config.Jwks
+		if len(jwks.Url) > 0 && len(jwks.Path) > 0 {
+			rkentry.ShutdownWithError(errors.New("only one of url and path of jwks could be provided"))
+		}
+
+		if len(jwks.Url) > 0 {
+			opts = append(opts,
+				WithJwksUrl(jwks.Url, time.Duration(jwks.RefreshIntervalMs)*time.Millisecond),
+				WithJwksMinRefetchInterval(time.Duration(jwks.MinRefetchIntervalMs)*time.Millisecond))
+		}
+
+		if len(jwks.Path) > 0 {
+			opts = append(opts, WithJwksFile(jwks.Path))
+		}
+
+		for i := range config.Authorization {
+			e := config.Authorization[i]
+
+			matchers := make([]ClaimsMatcher, 0)
+			if len(e.Scopes) > 0 {
+				matchers = append(matchers, Scopes(e.Scopes...))
+			}
+			if len(e.Roles) > 0 {
+				matchers = append(matchers, Roles(e.Roles...))
+			}
+			if len(e.Audience) > 0 {
+				matchers = append(matchers, Audience(e.Audience...))
+			}
+			if len(e.Issuer) > 0 {
+				matchers = append(matchers, Issuer(e.Issuer...))
+			}
+			for j := range e.Claims {
+				matchers = append(matchers, Claim(e.Claims[j].Name, e.Claims[j].Values...))
+			}
+
+			opts = append(opts, WithRequiredClaims(e.Path, e.Methods, matchers...))
+		}
+	}
+
+	return opts
+}
+
+// ***************** Option *****************
+
+// Option if for middleware options while creating middleware
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+// Entry name and type of rk-entry option set will be used if not provided.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithJwksUrl provide URL of JWKS, keys will be refreshed once refresh interval passed.
+// Default refresh interval will be used if zero or negative value provided.
+func WithJwksUrl(url string, refreshInterval time.Duration) Option {
+	return func(set *optionSet) {
+		set.jwksUrl = url
+		if refreshInterval > 0 {
+			set.jwksRefreshInterval = refreshInterval
+		}
+	}
+}
+
+// WithJwksMinRefetchInterval provide min interval of refetching JWKS from URL because of unknown kid.
+// Zero or negative value will be ignored.
+func WithJwksMinRefetchInterval(interval time.Duration) Option {
+	return func(set *optionSet) {
+		if interval > 0 {
+			set.jwksMinRefetchInterval = interval
+		}
+	}
+}
+
+// WithJwksHttpClient provide http.Client used to fetch JWKS from URL.
+func WithJwksHttpClient(client *http.Client) Option {
+	return func(set *optionSet) {
+		set.jwksClient = client
+	}
+}
+
+// WithJwksFile provide path of local JWKS file.
+func WithJwksFile(path string) Option {
+	return func(set *optionSet) {
+		set.jwksPath = path
+	}
+}
+
+// WithJwksFS provide JWKS file in fs.FS, like embed.FS.
+func WithJwksFS(fsys fs.FS, path string) Option {
+	return func(set *optionSet) {
+		set.jwksFS = fsys
+		set.jwksPath = path
+	}
+}
+
+// WithRequiredClaims provide claims required by path and methods, all methods are applied if methods are empty.
+//
+// Path matches either route template, like /v1/users/:id, or prefix of URL path.
+// All rules matching request should pass, otherwise request will be rejected with 403.
+func WithRequiredClaims(path string, methods []string, matchers ...ClaimsMatcher) Option {
+	return func(set *optionSet) {
+		if len(matchers) < 1 {
+			return
+		}
+
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		set.rules = append(set.rules, &claimsRule{
+			path:     path,
+			methods:  methods,
+			matchers: matchers,
+		})
+	}
+}
+
+// WithClaimsFactory provide factory of custom claims type, verified token will be parsed into claims it returns.
+//
+// Example:
+//
+//	rkechojwt.WithClaimsFactory(func() jwt.Claims { return &MyClaims{} })
+func WithClaimsFactory(factory ClaimsFactory) Option {
+	return func(set *optionSet) {
+		set.claimsFactory = factory
+	}
+}
+
+// WithRevocationList provide RevocationList, tokens with revoked jti will be rejected with 401.
+func WithRevocationList(list RevocationList) Option {
+	return func(set *optionSet) {
+		set.revocationList = list
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechojwt
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewOptionSet(t *testing.T) {
+	// without options
+	set := newOptionSet()
+	assert.NotEmpty(t, set.GetEntryName())
+	assert.Nil(t, set.jwks)
+	assert.Empty(t, set.rkOptions())
+
+	// with options
+	client := &http.Client{}
+	set = newOptionSet(
+		WithEntryNameAndType("ut-entry", "ut-type"),
+		WithJwksUrl("http://localhost/jwks", time.Minute),
+		WithJwksMinRefetchInterval(time.Second),
+		WithJwksHttpClient(client))
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "ut-type", set.GetEntryType())
+	assert.NotNil(t, set.jwks)
+	assert.Equal(t, time.Minute, set.jwks.refreshInterval)
+	assert.Equal(t, time.Second, set.jwks.minRefetchInterval)
+	assert.Equal(t, client, set.jwks.client)
+	assert.Len(t, set.rkOptions(), 1)
+
+	// invalid values are ignored
+	set = newOptionSet(
+		WithJwksUrl("http://localhost/jwks", 0),
+		WithJwksMinRefetchInterval(-1))
+	assert.Equal(t, DefaultJwksRefreshInterval, set.jwks.refreshInterval)
+	assert.Equal(t, DefaultJwksMinRefetchInterval, set.jwks.minRefetchInterval)
+}
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{}
+
+	// with disabled
+	assert.Empty(t, ToOptions(config, "", ""))
+
+	// with enabled
+	config.Enabled = true
+	config.Jwks.Url = "http://localhost/jwks"
+	config.Jwks.RefreshIntervalMs = 1000
+	config.Jwks.MinRefetchIntervalMs = 100
+
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type")...)
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "http://localhost/jwks", set.jwks.url)
+	assert.Equal(t, time.Second, set.jwks.refreshInterval)
+	assert.Equal(t, 100*time.Millisecond, set.jwks.minRefetchInterval)
+
+	// authorization
+	config.Authorization = append(config.Authorization, struct {
+		Path     string   `yaml:"path" json:"path"`
+		Methods  []string `yaml:"methods" json:"methods"`
+		Scopes   []string `yaml:"scopes" json:"scopes"`
+		Roles    []string `yaml:"roles" json:"roles"`
+		Audience []string `yaml:"audience" json:"audience"`
+		Issuer   []string `yaml:"issuer" json:"issuer"`
+		Claims   []struct {
+			Name   string   `yaml:"name" json:"name"`
+			Values []string `yaml:"values" json:"values"`
+		} `yaml:"claims" json:"claims"`
+	}{
+		Path:     "/ut-path",
+		Methods:  []string{http.MethodGet},
+		Scopes:   []string{"ut-scope"},
+		Roles:    []string{"ut-role"},
+		Audience: []string{"ut-aud"},
+		Issuer:   []string{"ut-iss"},
+	})
+	config.Authorization[0].Claims = append(config.Authorization[0].Claims, struct {
+		Name   string   `yaml:"name" json:"name"`
+		Values []string `yaml:"values" json:"values"`
+	}{Name: "tenant", Values: []string{"ut-tenant"}})
+
+	set = newOptionSet(ToOptions(config, "ut-entry", "ut-type")...)
+	assert.Len(t, set.rules, 1)
+	assert.Equal(t, "/ut-path", set.rules[0].path)
+	assert.Len(t, set.rules[0].matchers, 5)
+
+	// both url and path
+	config.Jwks.Path = "jwks.json"
+	assert.Panics(t, func() {
+		ToOptions(config, "ut-entry", "ut-type")
+	})
+}
@@ -0,0 +1,459 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechojwt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/credential"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLoginPath default path of login endpoint
+	DefaultLoginPath = "/token/login"
+	// DefaultRefreshPath default path of refresh endpoint
+	DefaultRefreshPath = "/token/refresh"
+	// DefaultRevokePath default path of revoke endpoint
+	DefaultRevokePath = "/token/revoke"
+	// DefaultAccessTokenTtl default lifetime of access token
+	DefaultAccessTokenTtl = 15 * time.Minute
+	// DefaultRefreshTokenTtl default lifetime of refresh token
+	DefaultRefreshTokenTtl = 7 * 24 * time.Hour
+)
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator validates username and password of login request, returns subject and extra claims of access token.
+type Authenticator func(ctx echo.Context, username, password string) (subject string, claims jwt.MapClaims, err error)
+
+// TokenResponse is response of login and refresh endpoints, fields follow RFC 6749
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// TokenService issues access tokens signed by rkentry.SignerJwt and opaque refresh tokens.
+//
+// Refresh tokens are rotated on each refresh, a rotated token used again revokes all tokens of the same login.
+// Access tokens carry jti claim, so that they could be revoked before expired with RevocationList which is
+// consulted by jwt middleware.
+type TokenService struct {
+	signer          rkentry.SignerJwt
+	authenticator   Authenticator
+	refreshStore    RefreshStore
+	revocationList  RevocationList
+	accessTokenTtl  time.Duration
+	refreshTokenTtl time.Duration
+	issuer          string
+	audience        []string
+	LoginPath       string
+	RefreshPath     string
+	RevokePath      string
+}
+
+// NewTokenService creates TokenService with options, in-memory RefreshStore and RevocationList are used by default.
+func NewTokenService(opts ...TokenServiceOption) *TokenService {
+	svc := &TokenService{
+		accessTokenTtl:  DefaultAccessTokenTtl,
+		refreshTokenTtl: DefaultRefreshTokenTtl,
+		LoginPath:       DefaultLoginPath,
+		RefreshPath:     DefaultRefreshPath,
+		RevokePath:      DefaultRevokePath,
+	}
+
+	for i := range opts {
+		opts[i](svc)
+	}
+
+	if svc.refreshStore == nil {
+		svc.refreshStore = NewMemoryRefreshStore()
+	}
+
+	if svc.revocationList == nil {
+		svc.revocationList = NewMemoryRevocationList()
+	}
+
+	return svc
+}
+
+// SetAuthenticator sets Authenticator of login endpoint, it should be called before server started.
+func (svc *TokenService) SetAuthenticator(authenticator Authenticator) {
+	svc.authenticator = authenticator
+}
+
+// SetSigner sets rkentry.SignerJwt of token service, it should be called before server started.
+func (svc *TokenService) SetSigner(signer rkentry.SignerJwt) {
+	svc.signer = signer
+}
+
+// GetRevocationList returns RevocationList which should be provided to jwt middleware
+func (svc *TokenService) GetRevocationList() RevocationList {
+	return svc.revocationList
+}
+
+// RegisterRoutes registers login, refresh and revoke endpoints into echo.Echo
+func (svc *TokenService) RegisterRoutes(e *echo.Echo) {
+	e.POST(svc.LoginPath, svc.Login)
+	e.POST(svc.RefreshPath, svc.Refresh)
+	e.POST(svc.RevokePath, svc.Revoke)
+}
+
+// Login validates username and password with Authenticator and issues access and refresh tokens.
+//
+// Request body is JSON or form with username and password fields.
+func (svc *TokenService) Login(ctx echo.Context) error {
+	req := struct {
+		Username string `json:"username" form:"username"`
+		Password string `json:"password" form:"password"`
+	}{}
+	if err := ctx.Bind(&req); err != nil || len(req.Username) < 1 {
+		return svc.reject(ctx, http.StatusBadRequest, "Missing username or password")
+	}
+
+	if svc.authenticator == nil {
+		return svc.reject(ctx, http.StatusNotImplemented, "Authenticator of token service is missing")
+	}
+
+	subject, claims, err := svc.authenticator(ctx, req.Username, req.Password)
+	if err != nil {
+		rkechoctx.GetEvent(ctx).SetCounter("loginFailed", 1)
+		return svc.reject(ctx, http.StatusUnauthorized, "Invalid username or password")
+	}
+
+	resp, err := svc.Issue(ctx, subject, claims)
+	if err != nil {
+		return svc.reject(ctx, http.StatusInternalServerError, "Failed to issue token")
+	}
+
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// Refresh rotates refresh token and issues new access token.
+//
+// Request body is JSON or form with refresh_token field.
+func (svc *TokenService) Refresh(ctx echo.Context) error {
+	req := struct {
+		RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	}{}
+	if err := ctx.Bind(&req); err != nil || len(req.RefreshToken) < 1 {
+		return svc.reject(ctx, http.StatusBadRequest, "Missing refresh token")
+	}
+
+	old, err := svc.refreshStore.Use(ctx.Request().Context(), hashToken(req.RefreshToken))
+	switch {
+	case errors.Is(err, ErrRefreshTokenReused):
+		// token may be stolen, revoke whole family
+		rkechoctx.GetEvent(ctx).SetCounter("refreshTokenReused", 1)
+		svc.refreshStore.RevokeFamily(ctx.Request().Context(), old.Family)
+		return svc.reject(ctx, http.StatusUnauthorized, "Invalid or expired refresh token")
+	case errors.Is(err, ErrRefreshTokenNotFound):
+		return svc.reject(ctx, http.StatusUnauthorized, "Invalid or expired refresh token")
+	case err != nil:
+		return svc.reject(ctx, http.StatusInternalServerError, "Failed to refresh token")
+	}
+
+	resp, err := svc.issue(ctx, old.Subject, old.Claims, old.Family)
+	if err != nil {
+		return svc.reject(ctx, http.StatusInternalServerError, "Failed to issue token")
+	}
+
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// Revoke revokes refresh token with all tokens rotated from the same login, or access token until it expires.
+//
+// Request body is JSON or form with token field, response is always 200 as defined in RFC 7009.
+func (svc *TokenService) Revoke(ctx echo.Context) error {
+	req := struct {
+		Token string `json:"token" form:"token"`
+	}{}
+	if err := ctx.Bind(&req); err != nil || len(req.Token) < 1 {
+		return svc.reject(ctx, http.StatusBadRequest, "Missing token")
+	}
+
+	// case 1: access token
+	if strings.Count(req.Token, ".") == 2 {
+		if svc.signer == nil {
+			return ctx.NoContent(http.StatusOK)
+		}
+
+		token, err := svc.signer.VerifyJwt(req.Token)
+		if err != nil {
+			return ctx.NoContent(http.StatusOK)
+		}
+
+		claims := toMapClaims(token.Claims)
+		jti, _ := claims["jti"].(string)
+		expiresAt := time.Now().Add(svc.accessTokenTtl)
+		if exp, ok := claims["exp"].(float64); ok {
+			expiresAt = time.Unix(int64(exp), 0)
+		}
+
+		if len(jti) > 0 {
+			if err := svc.revocationList.Revoke(ctx.Request().Context(), jti, expiresAt); err != nil {
+				return svc.reject(ctx, http.StatusInternalServerError, "Failed to revoke token")
+			}
+		}
+
+		return ctx.NoContent(http.StatusOK)
+	}
+
+	// case 2: refresh token
+	if old, err := svc.refreshStore.Use(ctx.Request().Context(), hashToken(req.Token)); old != nil {
+		if err := svc.refreshStore.RevokeFamily(ctx.Request().Context(), old.Family); err != nil {
+			return svc.reject(ctx, http.StatusInternalServerError, "Failed to revoke token")
+		}
+	} else if err != nil && !errors.Is(err, ErrRefreshTokenNotFound) {
+		return svc.reject(ctx, http.StatusInternalServerError, "Failed to revoke token")
+	}
+
+	return ctx.NoContent(http.StatusOK)
+}
+
+// Issue issues access and refresh tokens of subject, it could be used by user defined login endpoint.
+func (svc *TokenService) Issue(ctx echo.Context, subject string, claims jwt.MapClaims) (*TokenResponse, error) {
+	return svc.issue(ctx, subject, claims, randomToken())
+}
+
+func (svc *TokenService) issue(ctx echo.Context, subject string, claims jwt.MapClaims, family string) (*TokenResponse, error) {
+	if svc.signer == nil {
+		return nil, errors.New("signer of token service is missing")
+	}
+
+	now := time.Now()
+
+	accessClaims := jwt.MapClaims{}
+	for k, v := range claims {
+		accessClaims[k] = v
+	}
+	accessClaims["sub"] = subject
+	accessClaims["iat"] = now.Unix()
+	accessClaims["exp"] = now.Add(svc.accessTokenTtl).Unix()
+	accessClaims["jti"] = randomToken()
+	if len(svc.issuer) > 0 {
+		accessClaims["iss"] = svc.issuer
+	}
+	if len(svc.audience) > 0 {
+		accessClaims["aud"] = svc.audience
+	}
+
+	accessToken, err := svc.signer.SignJwt(accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := randomToken()
+	err = svc.refreshStore.Save(ctx.Request().Context(), &RefreshToken{
+		Id:        hashToken(refreshToken),
+		Family:    family,
+		Subject:   subject,
+		Claims:    claims,
+		ExpiresAt: now.Add(svc.refreshTokenTtl),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(svc.accessTokenTtl.Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// reject writes error response with error model
+func (svc *TokenService) reject(ctx echo.Context, code int, msg string) error {
+	resp := rkmid.GetErrorBuilder().New(code, msg)
+	return ctx.JSON(resp.Code(), resp)
+}
+
+// NewBasicAuthenticator creates Authenticator with credentials in form of user:password, username is used as subject.
+//
+// Password could be plaintext or hashed with bcrypt or argon2 in PHC string format, the same as basic auth of
+// auth middleware, passwords are compared in constant time and unknown user takes about the same time as existing one.
+func NewBasicAuthenticator(credentials ...string) Authenticator {
+	users := make(map[string]rkechocredential.Credential)
+	for i := range credentials {
+		user, pass, ok := strings.Cut(credentials[i], ":")
+		if !ok || len(user) < 1 {
+			rkentry.ShutdownWithError(errors.New("invalid credential of token service, expect user:password"))
+		}
+
+		cred, err := rkechocredential.Parse(pass, true)
+		if err != nil {
+			rkentry.ShutdownWithError(fmt.Errorf("invalid credential of token service user %s, %v", user, err))
+		}
+
+		users[user] = cred
+	}
+	dummy := rkechocredential.NewDummy(users)
+
+	return func(ctx echo.Context, username, password string) (string, jwt.MapClaims, error) {
+		cred, ok := users[username]
+		if !ok {
+			dummy.Verify(password)
+			return "", nil, errInvalidCredentials
+		}
+
+		if !cred.Verify(password) {
+			return "", nil, errInvalidCredentials
+		}
+
+		return username, jwt.MapClaims{}, nil
+	}
+}
+
+// randomToken returns 32 random bytes encoded with base64url
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashToken returns SHA-256 hash of refresh token, which is used as id in RefreshStore
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ***************** BootConfig *****************
+
+// TokenServiceBootConfig for YAML
+type TokenServiceBootConfig struct {
+	Enabled           bool     `yaml:"enabled" json:"enabled"`
+	LoginPath         string   `yaml:"loginPath" json:"loginPath"`
+	RefreshPath       string   `yaml:"refreshPath" json:"refreshPath"`
+	RevokePath        string   `yaml:"revokePath" json:"revokePath"`
+	AccessTokenTtlMs  int      `yaml:"accessTokenTtlMs" json:"accessTokenTtlMs"`
+	RefreshTokenTtlMs int      `yaml:"refreshTokenTtlMs" json:"refreshTokenTtlMs"`
+	Issuer            string   `yaml:"issuer" json:"issuer"`
+	Audience          []string `yaml:"audience" json:"audience"`
+	Basic             []string `yaml:"basic" json:"basic"`
+}
+
+// ToTokenServiceOptions convert TokenServiceBootConfig into TokenServiceOption list.
+//
+// Signer is not included, since it is registered while creating jwt middleware.
+func ToTokenServiceOptions(config *TokenServiceBootConfig) []TokenServiceOption {
+	opts := make([]TokenServiceOption, 0)
+
+	if config.Enabled {
+		opts = append(opts,
+			WithTokenPaths(config.LoginPath, config.RefreshPath, config.RevokePath),
+			WithAccessTokenTtl(time.Duration(config.AccessTokenTtlMs)*time.Millisecond),
+			WithRefreshTokenTtl(time.Duration(config.RefreshTokenTtlMs)*time.Millisecond),
+			WithTokenIssuer(config.Issuer),
+			WithTokenAudience(config.Audience...))
+
+		if len(config.Basic) > 0 {
+			opts = append(opts, WithAuthenticator(NewBasicAuthenticator(config.Basic...)))
+		}
+	}
+
+	return opts
+}
+
+// ***************** TokenServiceOption *****************
+
+// TokenServiceOption is option of TokenService
+type TokenServiceOption func(*TokenService)
+
+// WithTokenSigner provide rkentry.SignerJwt which signs access tokens and verifies them while revoking.
+func WithTokenSigner(signer rkentry.SignerJwt) TokenServiceOption {
+	return func(svc *TokenService) {
+		svc.signer = signer
+	}
+}
+
+// WithAuthenticator provide Authenticator of login endpoint.
+func WithAuthenticator(authenticator Authenticator) TokenServiceOption {
+	return func(svc *TokenService) {
+		svc.authenticator = authenticator
+	}
+}
+
+// WithRefreshStore provide RefreshStore.
+func WithRefreshStore(store RefreshStore) TokenServiceOption {
+	return func(svc *TokenService) {
+		if store != nil {
+			svc.refreshStore = store
+		}
+	}
+}
+
+// WithTokenRevocationList provide RevocationList, it should be shared with jwt middleware.
+func WithTokenRevocationList(list RevocationList) TokenServiceOption {
+	return func(svc *TokenService) {
+		if list != nil {
+			svc.revocationList = list
+		}
+	}
+}
+
+// WithAccessTokenTtl provide lifetime of access token, zero or negative value will be ignored.
+func WithAccessTokenTtl(ttl time.Duration) TokenServiceOption {
+	return func(svc *TokenService) {
+		if ttl > 0 {
+			svc.accessTokenTtl = ttl
+		}
+	}
+}
+
+// WithRefreshTokenTtl provide lifetime of refresh token, zero or negative value will be ignored.
+func WithRefreshTokenTtl(ttl time.Duration) TokenServiceOption {
+	return func(svc *TokenService) {
+		if ttl > 0 {
+			svc.refreshTokenTtl = ttl
+		}
+	}
+}
+
+// WithTokenIssuer provide iss claim of access token.
+func WithTokenIssuer(issuer string) TokenServiceOption {
+	return func(svc *TokenService) {
+		svc.issuer = issuer
+	}
+}
+
+// WithTokenAudience provide aud claim of access token.
+func WithTokenAudience(audience ...string) TokenServiceOption {
+	return func(svc *TokenService) {
+		svc.audience = append(svc.audience, audience...)
+	}
+}
+
+// WithTokenPaths provide paths of login, refresh and revoke endpoints, empty path will be ignored.
+func WithTokenPaths(login, refresh, revoke string) TokenServiceOption {
+	return func(svc *TokenService) {
+		if len(login) > 0 {
+			svc.LoginPath = login
+		}
+		if len(refresh) > 0 {
+			svc.RefreshPath = refresh
+		}
+		if len(revoke) > 0 {
+			svc.RevokePath = revoke
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechojwt
+
+import (
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/jwt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTokenServiceEcho(t *testing.T) (*echo.Echo, *TokenService) {
+	signer := rkentry.RegisterSymmetricJwtSigner("ut-token-service", jwt.SigningMethodHS256.Name, []byte("ut-key"))
+
+	svc := NewTokenService(
+		WithTokenSigner(signer),
+		WithAuthenticator(NewBasicAuthenticator("ut-user:ut-pass")),
+		WithAccessTokenTtl(time.Minute),
+		WithRefreshTokenTtl(time.Hour),
+		WithTokenIssuer("ut-issuer"),
+		WithTokenAudience("ut-aud"))
+
+	e := echo.New()
+	e.Use(MiddlewareWithOption(
+		[]Option{WithRevocationList(svc.GetRevocationList())},
+		rkmidjwt.WithSigner(signer),
+		rkmidjwt.WithPathToIgnore(svc.LoginPath, svc.RefreshPath, svc.RevokePath)))
+	svc.RegisterRoutes(e)
+	e.GET("/ut-path", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "")
+	})
+
+	return e, svc
+}
+
+func postJson(e *echo.Echo, path string, body interface{}) *httptest.ResponseRecorder {
+	raw, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(raw)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
+
+func getWithToken(e *echo.Echo, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/ut-path", nil)
+	req.Header.Set(rkmid.HeaderAuthorization, "Bearer "+token)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
+
+func decodeTokenResponse(t *testing.T, w *httptest.ResponseRecorder) *TokenResponse {
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp := &TokenResponse{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), resp))
+	return resp
+}
+
+func TestTokenService_Login(t *testing.T) {
+	e, _ := newTokenServiceEcho(t)
+
+	// case 1: happy case
+	resp := decodeTokenResponse(t, postJson(e, DefaultLoginPath, map[string]string{
+		"username": "ut-user", "password": "ut-pass",
+	}))
+	assert.Equal(t, "Bearer", resp.TokenType)
+	assert.Equal(t, int64(60), resp.ExpiresIn)
+	assert.NotEmpty(t, resp.RefreshToken)
+	assert.Equal(t, http.StatusOK, getWithToken(e, resp.AccessToken).Code)
+
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(resp.AccessToken, claims)
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-user", claims["sub"])
+	assert.Equal(t, "ut-issuer", claims["iss"])
+	assert.NotEmpty(t, claims["jti"])
+
+	// case 2: invalid password and user
+	w := postJson(e, DefaultLoginPath, map[string]string{"username": "ut-user", "password": "ut-wrong"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = postJson(e, DefaultLoginPath, map[string]string{"username": "ut-missing", "password": ""})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// case 3: missing username
+	w = postJson(e, DefaultLoginPath, map[string]string{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// case 4: missing authenticator
+	svc := NewTokenService()
+	e = echo.New()
+	svc.RegisterRoutes(e)
+	w = postJson(e, DefaultLoginPath, map[string]string{"username": "ut-user", "password": "ut-pass"})
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+func TestTokenService_Refresh(t *testing.T) {
+	e, _ := newTokenServiceEcho(t)
+
+	login := decodeTokenResponse(t, postJson(e, DefaultLoginPath, map[string]string{
+		"username": "ut-user", "password": "ut-pass",
+	}))
+
+	// case 1: rotate refresh token
+	refreshed := decodeTokenResponse(t, postJson(e, DefaultRefreshPath, map[string]string{
+		"refresh_token": login.RefreshToken,
+	}))
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+	assert.Equal(t, http.StatusOK, getWithToken(e, refreshed.AccessToken).Code)
+
+	// case 2: reuse of rotated token revokes whole family
+	w := postJson(e, DefaultRefreshPath, map[string]string{"refresh_token": login.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = postJson(e, DefaultRefreshPath, map[string]string{"refresh_token": refreshed.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// case 3: missing and unknown token
+	w = postJson(e, DefaultRefreshPath, map[string]string{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = postJson(e, DefaultRefreshPath, map[string]string{"refresh_token": "ut-unknown"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTokenService_Revoke(t *testing.T) {
+	e, _ := newTokenServiceEcho(t)
+
+	login := decodeTokenResponse(t, postJson(e, DefaultLoginPath, map[string]string{
+		"username": "ut-user", "password": "ut-pass",
+	}))
+
+	// case 1: revoke access token
+	w := postJson(e, DefaultRevokePath, map[string]string{"token": login.AccessToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(e, login.AccessToken).Code)
+
+	// case 2: revoke refresh token
+	w = postJson(e, DefaultRevokePath, map[string]string{"token": login.RefreshToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postJson(e, DefaultRefreshPath, map[string]string{"refresh_token": login.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// case 3: unknown token
+	w = postJson(e, DefaultRevokePath, map[string]string{"token": "ut-unknown"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postJson(e, DefaultRevokePath, map[string]string{"token": "ut.unknown.token"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 4: missing token
+	w = postJson(e, DefaultRevokePath, map[string]string{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestToTokenServiceOptions(t *testing.T) {
+	config := &TokenServiceBootConfig{
+		Enabled: false,
+	}
+
+	// with disabled
+	assert.Empty(t, ToTokenServiceOptions(config))
+
+	// with enabled
+	config.Enabled = true
+	config.LoginPath = "/ut-login"
+	config.AccessTokenTtlMs = 1000
+	config.RefreshTokenTtlMs = 2000
+	config.Issuer = "ut-issuer"
+	config.Audience = []string{"ut-aud"}
+	config.Basic = []string{"ut-user:ut-pass"}
+
+	svc := NewTokenService(ToTokenServiceOptions(config)...)
+	assert.Equal(t, "/ut-login", svc.LoginPath)
+	assert.Equal(t, DefaultRefreshPath, svc.RefreshPath)
+	assert.Equal(t, time.Second, svc.accessTokenTtl)
+	assert.Equal(t, 2*time.Second, svc.refreshTokenTtl)
+	assert.Equal(t, "ut-issuer", svc.issuer)
+	assert.Equal(t, []string{"ut-aud"}, svc.audience)
+	assert.NotNil(t, svc.authenticator)
+	assert.NotNil(t, svc.refreshStore)
+	assert.NotNil(t, svc.GetRevocationList())
+}
+
+func TestNewBasicAuthenticator(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("ut-admin-pass"), bcrypt.MinCost)
+	authenticator := NewBasicAuthenticator("ut-user:ut-pass", "ut-admin:"+string(hash))
+
+	// plaintext
+	subject, _, err := authenticator(nil, "ut-user", "ut-pass")
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-user", subject)
+
+	// bcrypt
+	subject, _, err = authenticator(nil, "ut-admin", "ut-admin-pass")
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-admin", subject)
+
+	// wrong password or unknown user
+	_, _, err = authenticator(nil, "ut-admin", "ut-wrong")
+	assert.Equal(t, errInvalidCredentials, err)
+	_, _, err = authenticator(nil, "ut-missing", "ut-admin-pass")
+	assert.Equal(t, errInvalidCredentials, err)
+
+	// invalid credential
+	assert.Panics(t, func() {
+		NewBasicAuthenticator("ut-invalid")
+	})
+	assert.Panics(t, func() {
+		NewBasicAuthenticator("ut-user:$2y$10$invalid")
+	})
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechojwt
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-jwt/jwt/v4"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRefreshTokenNotFound is returned if refresh token does not exist or expired
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	// ErrRefreshTokenReused is returned if refresh token was used already, which means it may be stolen
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// RefreshToken is a record of refresh token kept in RefreshStore.
+//
+// Tokens rotated from the same login share the same family, so that all of them could be revoked
+// once reuse of any rotated token detected.
+type RefreshToken struct {
+	// Id is SHA-256 hash of refresh token, raw token is never kept
+	Id        string
+	Family    string
+	Subject   string
+	Claims    jwt.MapClaims
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// RefreshStore keeps refresh tokens, it is shared by all instances if it is distributed.
+type RefreshStore interface {
+	// Save saves refresh token
+	Save(ctx context.Context, token *RefreshToken) error
+
+	// Use marks refresh token as used and returns it.
+	// ErrRefreshTokenNotFound will be returned if token does not exist or expired,
+	// ErrRefreshTokenReused will be returned with token if token was used already.
+	Use(ctx context.Context, id string) (*RefreshToken, error)
+
+	// RevokeFamily removes all refresh tokens of family
+	RevokeFamily(ctx context.Context, family string) error
+}
+
+// RevocationList keeps id of revoked access tokens, which is jti claim, until they expire.
+type RevocationList interface {
+	// Revoke adds jti into list until expiresAt
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+
+	// IsRevoked returns true if jti was revoked
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// ***************** Memory RefreshStore *****************
+
+// memoryRefreshStore is a RefreshStore keeps refresh tokens in memory of current instance
+type memoryRefreshStore struct {
+	tokens    map[string]*RefreshToken
+	families  map[string]map[string]struct{}
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// NewMemoryRefreshStore creates RefreshStore which keeps refresh tokens in memory of current instance
+func NewMemoryRefreshStore() RefreshStore {
+	return &memoryRefreshStore{
+		tokens:    make(map[string]*RefreshToken),
+		families:  make(map[string]map[string]struct{}),
+		lastSweep: time.Now(),
+	}
+}
+
+// Save saves refresh token
+func (s *memoryRefreshStore) Save(ctx context.Context, token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(time.Now())
+
+	copied := *token
+	s.tokens[token.Id] = &copied
+	if _, ok := s.families[token.Family]; !ok {
+		s.families[token.Family] = make(map[string]struct{})
+	}
+	s.families[token.Family][token.Id] = struct{}{}
+
+	return nil
+}
+
+// Use marks refresh token as used and returns it
+func (s *memoryRefreshStore) Use(ctx context.Context, id string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok || !time.Now().Before(token.ExpiresAt) {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	copied := *token
+	if token.Used {
+		return &copied, ErrRefreshTokenReused
+	}
+	token.Used = true
+
+	return &copied, nil
+}
+
+// RevokeFamily removes all refresh tokens of family
+func (s *memoryRefreshStore) RevokeFamily(ctx context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.families[family] {
+		delete(s.tokens, id)
+	}
+	delete(s.families, family)
+
+	return nil
+}
+
+// sweep removes expired tokens once per minute
+func (s *memoryRefreshStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for id, token := range s.tokens {
+		if !now.Before(token.ExpiresAt) {
+			delete(s.tokens, id)
+			delete(s.families[token.Family], id)
+			if len(s.families[token.Family]) < 1 {
+				delete(s.families, token.Family)
+			}
+		}
+	}
+}
+
+// ***************** Memory RevocationList *****************
+
+// memoryRevocationList is a RevocationList keeps jti in memory of current instance
+type memoryRevocationList struct {
+	revoked   map[string]time.Time
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// NewMemoryRevocationList creates RevocationList which keeps jti in memory of current instance
+func NewMemoryRevocationList() RevocationList {
+	return &memoryRevocationList{
+		revoked:   make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// Revoke adds jti into list until expiresAt
+func (l *memoryRevocationList) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= time.Minute {
+		l.lastSweep = now
+		for k, v := range l.revoked {
+			if !now.Before(v) {
+				delete(l.revoked, k)
+			}
+		}
+	}
+
+	l.revoked[jti] = expiresAt
+	return nil
+}
+
+// IsRevoked returns true if jti was revoked and not expired yet
+func (l *memoryRevocationList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	expiresAt, ok := l.revoked[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
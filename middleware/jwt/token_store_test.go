@@ -0,0 +1,80 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechojwt
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryRefreshStore(t *testing.T) {
+	store := NewMemoryRefreshStore()
+	ctx := context.Background()
+
+	assert.Nil(t, store.Save(ctx, &RefreshToken{
+		Id: "ut-id", Family: "ut-family", Subject: "ut-subject", ExpiresAt: time.Now().Add(time.Hour),
+	}))
+	assert.Nil(t, store.Save(ctx, &RefreshToken{
+		Id: "ut-id-2", Family: "ut-family", Subject: "ut-subject", ExpiresAt: time.Now().Add(time.Hour),
+	}))
+	assert.Nil(t, store.Save(ctx, &RefreshToken{
+		Id: "ut-expired", Family: "ut-other", ExpiresAt: time.Now().Add(-time.Second),
+	}))
+
+	// use once
+	token, err := store.Use(ctx, "ut-id")
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-subject", token.Subject)
+
+	// reused
+	token, err = store.Use(ctx, "ut-id")
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	assert.Equal(t, "ut-family", token.Family)
+
+	// missing and expired
+	_, err = store.Use(ctx, "ut-missing")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+	_, err = store.Use(ctx, "ut-expired")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	// revoke family
+	assert.Nil(t, store.RevokeFamily(ctx, "ut-family"))
+	_, err = store.Use(ctx, "ut-id-2")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	// sweep expired tokens
+	s := store.(*memoryRefreshStore)
+	s.lastSweep = time.Now().Add(-time.Hour)
+	assert.Nil(t, store.Save(ctx, &RefreshToken{Id: "ut-new", Family: "ut-new", ExpiresAt: time.Now().Add(time.Hour)}))
+	assert.Len(t, s.tokens, 1)
+	assert.Len(t, s.families, 1)
+}
+
+func TestMemoryRevocationList(t *testing.T) {
+	list := NewMemoryRevocationList()
+	ctx := context.Background()
+
+	revoked, err := list.IsRevoked(ctx, "ut-jti")
+	assert.Nil(t, err)
+	assert.False(t, revoked)
+
+	assert.Nil(t, list.Revoke(ctx, "ut-jti", time.Now().Add(time.Hour)))
+	revoked, _ = list.IsRevoked(ctx, "ut-jti")
+	assert.True(t, revoked)
+
+	// expired
+	assert.Nil(t, list.Revoke(ctx, "ut-expired", time.Now().Add(-time.Second)))
+	revoked, _ = list.IsRevoked(ctx, "ut-expired")
+	assert.False(t, revoked)
+
+	// sweep expired jti
+	l := list.(*memoryRevocationList)
+	l.lastSweep = time.Now().Add(-time.Hour)
+	assert.Nil(t, list.Revoke(ctx, "ut-new", time.Now().Add(time.Hour)))
+	assert.Len(t, l.revoked, 2)
+}
@@ -8,20 +8,80 @@ package rkecholimit
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/lru"
 	"github.com/rookie-ninja/rk-entry/v2/middleware"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/ratelimit"
+	"strconv"
+	"sync"
+	"time"
 )
 
 // Middleware Add rate limit interceptors.
 func Middleware(opts ...rkmidlimit.Option) echo.MiddlewareFunc {
+	return MiddlewareWithOption(nil, opts...)
+}
+
+// MiddlewareWithOption Add rate limit interceptors with options of rk-echo.
+//
+// If key strategy was provided, each client gets its own limiters created with the same rk-entry options,
+// limiters are kept in a bounded LRU storage. Limiters provided by WithGlobalLimiter and WithLimiterByPath
+// are shared by all clients.
+//
+// If Store was provided, limiters of rk-entry will be bypassed and state of limiters will be kept in Store.
+// Stores kept in memory for token bucket, headers of every response and wait mode are bounded by max keys as well.
+func MiddlewareWithOption(echoOpts []Option, opts ...rkmidlimit.Option) echo.MiddlewareFunc {
 	set := rkmidlimit.NewOptionSet(opts...)
+	echoSet := newOptionSet(append([]Option{
+		WithEntryNameAndType(set.GetEntryName(), set.GetEntryType()),
+	}, echoOpts...)...)
+
+	var cache *rkecholru.Map[rkmidlimit.OptionSetInterface]
+	cacheMu := sync.Mutex{}
+	if echoSet.keyed() && echoSet.store == nil {
+		cache = rkecholru.New[rkmidlimit.OptionSetInterface](echoSet.maxKeys)
+		observeKeys(echoSet, cache)
+	}
+
+	// getLimiters returns limiters of key, least recently used one will be evicted if cache is full
+	getLimiters := func(key string) rkmidlimit.OptionSetInterface {
+		cacheMu.Lock()
+		defer cacheMu.Unlock()
+
+		if res, ok := cache.Get(key); ok {
+			return res
+		}
+
+		res := rkmidlimit.NewOptionSet(opts...)
+		cache.Set(key, res)
+		return res
+	}
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(ctx echo.Context) error {
 			ctx.Set(rkmid.EntryNameKey.String(), set.GetEntryName())
 
-			beforeCtx := set.BeforeCtx(ctx.Request())
-			set.Before(beforeCtx)
+			// state of limiters are kept in store
+			if echoSet.store != nil && !set.ShouldIgnore(ctx.Request().URL.Path) {
+				res, errResp := echoSet.wait(ctx)
+				if errResp != nil {
+					setHeaders(ctx, res, true)
+					return ctx.JSON(errResp.Code(), errResp)
+				}
+
+				if echoSet.headersOnAll {
+					setHeaders(ctx, res, false)
+				}
+
+				return next(ctx)
+			}
+
+			limiterSet := set
+			if cache != nil && !set.ShouldIgnore(ctx.Request().URL.Path) {
+				limiterSet = getLimiters(echoSet.getKey(ctx))
+			}
+
+			beforeCtx := limiterSet.BeforeCtx(ctx.Request())
+			limiterSet.Before(beforeCtx)
 
 			if beforeCtx.Output.ErrResp != nil {
 				return ctx.JSON(beforeCtx.Output.ErrResp.Code(), beforeCtx.Output.ErrResp)
@@ -31,3 +91,34 @@ func Middleware(opts ...rkmidlimit.Option) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// setHeaders sets RateLimit headers with state of limiter, Retry-After will be set if request was rejected
+func setHeaders(ctx echo.Context, res *Result, rejected bool) {
+	// state is missing if store is unavailable
+	if res == nil {
+		return
+	}
+
+	header := ctx.Response().Header()
+	header.Set(HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+	header.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+
+	// limiter with zero limit never resets
+	if res.Limit < 1 {
+		return
+	}
+
+	header.Set(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(res.ResetAfter)))
+	if rejected {
+		header.Set(echo.HeaderRetryAfter, strconv.Itoa(ceilSeconds(res.RetryAfter)))
+	}
+}
+
+// ceilSeconds rounds duration up to seconds, at least one second
+func ceilSeconds(d time.Duration) int {
+	if d <= time.Second {
+		return 1
+	}
+
+	return int((d + time.Second - 1) / time.Second)
+}
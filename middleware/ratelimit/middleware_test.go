@@ -7,7 +7,10 @@ package rkecholimit
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/ratelimit"
 	"github.com/stretchr/testify/assert"
@@ -15,6 +18,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 var userHandler = func(ctx echo.Context) error {
@@ -42,6 +46,200 @@ func TestMiddleware(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestMiddlewareWithOption(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	inter := MiddlewareWithOption(
+		[]Option{WithKeyBy(KeyByHeader, "X-Client-Id"), WithMaxKeys(1), WithRegisterer(registry)},
+		rkmidlimit.WithEntryNameAndType("ut-entry", "ut-type"),
+		rkmidlimit.WithReqPerSecByPath("/ut-path", 0),
+		rkmidlimit.WithPathToIgnore("/ut-ignore"))
+
+	// rejected by limiter of client
+	ctx, w := newCtx()
+	ctx.Request().Header.Set("X-Client-Id", "ut-a")
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, float64(1), gatherValue(t, registry, "rk_ratelimit_keys"))
+
+	// another client evicts the first one
+	ctx, w = newCtx()
+	ctx.Request().Header.Set("X-Client-Id", "ut-b")
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, float64(1), gatherValue(t, registry, "rk_ratelimit_keys"))
+	assert.Equal(t, float64(1), gatherValue(t, registry, "rk_ratelimit_keyEvicted"))
+
+	// ignored path does not create limiter
+	ctx, w = newCtx()
+	ctx.Request().URL.Path = "/ut-ignore"
+	ctx.Request().Header.Set("X-Client-Id", "ut-c")
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(1), gatherValue(t, registry, "rk_ratelimit_keyEvicted"))
+}
+
+func TestMiddlewareWithOption_WithTokenBucket(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	inter := MiddlewareWithOption(
+		[]Option{WithAlgorithm(TokenBucket), WithReqPerSec(1), WithKeyBy(KeyByHeader, "X-Client-Id"),
+			WithMaxKeys(1), WithRegisterer(registry)})
+
+	// bucket of client is created
+	ctx, w := newCtx()
+	ctx.Request().Header.Set("X-Client-Id", "ut-a")
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(1), gatherValue(t, registry, "rk_ratelimit_keys"))
+
+	// another client evicts the first one
+	ctx, w = newCtx()
+	ctx.Request().Header.Set("X-Client-Id", "ut-b")
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(1), gatherValue(t, registry, "rk_ratelimit_keys"))
+	assert.Equal(t, float64(1), gatherValue(t, registry, "rk_ratelimit_keyEvicted"))
+}
+
+type errStore struct{}
+
+func (s *errStore) Allow(context.Context, string, Rate) (*Result, error) {
+	return nil, errors.New("ut-error")
+}
+
+func TestMiddlewareWithOption_WithStore(t *testing.T) {
+	inter := MiddlewareWithOption(
+		[]Option{WithStore(NewMemoryStore()), WithReqPerSec(1), WithReqPerSecByPath("/ut-zero", 0),
+			WithKeyBy(KeyByHeader, "X-Client-Id"), WithRegisterer(prometheus.NewRegistry())},
+		rkmidlimit.WithPathToIgnore("/ut-ignore"))
+
+	// allowed
+	ctx, w := newCtx()
+	ctx.Request().Header.Set("X-Client-Id", "ut-a")
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// exceeded
+	ctx, w = newCtx()
+	ctx.Request().Header.Set("X-Client-Id", "ut-a")
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// other client
+	ctx, w = newCtx()
+	ctx.Request().Header.Set("X-Client-Id", "ut-b")
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// zero limit
+	ctx, w = newCtx()
+	ctx.Request().URL.Path = "/ut-zero"
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// ignored
+	ctx, w = newCtx()
+	ctx.Request().URL.Path = "/ut-ignore"
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMiddlewareWithOption_WithFailedStore(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	// fail open
+	inter := MiddlewareWithOption([]Option{WithStore(&errStore{}), WithRegisterer(registry)})
+	ctx, w := newCtx()
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(1), gatherValue(t, registry, "rk_ratelimit_storeError"))
+
+	// fail closed
+	inter = MiddlewareWithOption([]Option{
+		WithStore(&errStore{}), WithFailClosed(true), WithRegisterer(prometheus.NewRegistry())})
+	ctx, w = newCtx()
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestMiddlewareWithOption_WithHeaders(t *testing.T) {
+	for _, algorithm := range []string{TokenBucket, rkmidlimit.LeakyBucket} {
+		inter := MiddlewareWithOption([]Option{
+			WithAlgorithm(algorithm), WithHeadersOnAllResponses(true), WithReqPerSec(2), WithRegisterer(prometheus.NewRegistry())},
+			rkmidlimit.WithAlgorithm(algorithm))
+
+		// headers on allowed response
+		ctx, w := newCtx()
+		inter(userHandler)(ctx)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get(HeaderRateLimitLimit))
+		assert.Equal(t, "1", w.Header().Get(HeaderRateLimitRemaining))
+		assert.Equal(t, "1", w.Header().Get(HeaderRateLimitReset))
+		assert.Empty(t, w.Header().Get(echo.HeaderRetryAfter))
+
+		ctx, w = newCtx()
+		inter(userHandler)(ctx)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0", w.Header().Get(HeaderRateLimitRemaining))
+
+		// headers on rejected response
+		ctx, w = newCtx()
+		inter(userHandler)(ctx)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "2", w.Header().Get(HeaderRateLimitLimit))
+		assert.Equal(t, "0", w.Header().Get(HeaderRateLimitRemaining))
+		assert.Equal(t, "1", w.Header().Get(HeaderRateLimitReset))
+		assert.Equal(t, "1", w.Header().Get(echo.HeaderRetryAfter))
+	}
+
+	// headers on rejected response only
+	inter := MiddlewareWithOption([]Option{
+		WithAlgorithm(TokenBucket), WithReqPerSec(1), WithRegisterer(prometheus.NewRegistry())})
+	ctx, w := newCtx()
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(HeaderRateLimitLimit))
+
+	ctx, w = newCtx()
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", w.Header().Get(echo.HeaderRetryAfter))
+
+	// zero limit
+	inter = MiddlewareWithOption([]Option{
+		WithAlgorithm(TokenBucket), WithReqPerSec(0), WithRegisterer(prometheus.NewRegistry())})
+	ctx, w = newCtx()
+	inter(userHandler)(ctx)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get(HeaderRateLimitLimit))
+	assert.Empty(t, w.Header().Get(HeaderRateLimitReset))
+}
+
+func TestCeilSeconds(t *testing.T) {
+	assert.Equal(t, 1, ceilSeconds(0))
+	assert.Equal(t, 1, ceilSeconds(time.Second))
+	assert.Equal(t, 2, ceilSeconds(1001*time.Millisecond))
+}
+
+func gatherValue(t *testing.T, registry *prometheus.Registry, name string) float64 {
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetGauge() != nil {
+				return metric.GetGauge().GetValue()
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+
+	return 0
+}
+
 func newCtx() (echo.Context, *httptest.ResponseRecorder) {
 	var buf bytes.Buffer
 	req := httptest.NewRequest(http.MethodGet, "/ut-path", &buf)
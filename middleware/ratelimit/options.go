@@ -0,0 +1,714 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkecholimit
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/lru"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/error"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/prom"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/ratelimit"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// TokenBucket algorithm, limiters are kept in memory of echo middleware since rk-entry does not provide it
+	TokenBucket = "tokenBucket"
+
+	// HeaderRateLimitLimit is burst of limiter, defined in IETF draft of RateLimit header fields
+	HeaderRateLimitLimit = "RateLimit-Limit"
+	// HeaderRateLimitRemaining is number of requests allowed right now
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	// HeaderRateLimitReset is seconds until limiter is fully replenished
+	HeaderRateLimitReset = "RateLimit-Reset"
+
+	// ModeReject rejects requests exceeding limit immediately
+	ModeReject = "reject"
+	// ModeWait queues requests exceeding limit in order of arrival up to max wait before rejecting
+	ModeWait = "wait"
+	// DefaultMaxWait default max duration a request waits in queue
+	DefaultMaxWait = time.Second
+	// DefaultMaxQueue default max number of requests waiting in queue
+	DefaultMaxQueue = 1000
+
+	// KeyByIp limits each client IP separately, trusted proxies are respected
+	KeyByIp = "ip"
+	// KeyByHeader limits each value of header separately
+	KeyByHeader = "header"
+	// KeyByApiKey limits each API key separately
+	KeyByApiKey = "apiKey"
+	// KeyByJwtSubject limits each subject of JWT token separately
+	KeyByJwtSubject = "jwtSubject"
+
+	// DefaultApiKeyHeader header of API key
+	DefaultApiKeyHeader = "X-API-Key"
+	// DefaultMaxKeys max number of per-key limiters kept in memory
+	DefaultMaxKeys = 10000
+
+	// MetricsNameKeys records number of per-key limiters
+	MetricsNameKeys = "keys"
+	// MetricsNameKeyEvicted records per-key limiters evicted from LRU storage
+	MetricsNameKeyEvicted = "keyEvicted"
+	// MetricsNameStoreError records failed calls to Store
+	MetricsNameStoreError = "storeError"
+	// MetricsNameWaitDuration records seconds requests spent waiting in queue
+	MetricsNameWaitDuration = "waitDuration"
+
+	global = "rk-global"
+)
+
+var (
+	labelKeys = []string{"entryName", "entryType"}
+	// waitLabelKeys with result of waiting, allowed or rejected
+	waitLabelKeys = []string{"entryName", "entryType", "result"}
+	// waitBuckets from 1ms to about 16s
+	waitBuckets = prometheus.ExponentialBuckets(0.001, 2, 15)
+)
+
+// KeyFunc extracts key of client from request, requests with the same key share the same limiters.
+// Client IP will be used if empty string returned.
+type KeyFunc func(ctx echo.Context) string
+
+// ***************** OptionSet Implementation *****************
+
+// optionSet extends options of rk-entry rate limit middleware with features for echo framework.
+type optionSet struct {
+	// waiting is the number of requests waiting in queue, keep it as the first field for 64-bit alignment
+	waiting     int64
+	entryName   string
+	entryType   string
+	keyBy       string
+	keyHeader   string
+	keyFunc     KeyFunc
+	ipExtractor echo.IPExtractor
+	maxKeys     int
+	// reqPerSec and reqPerSecByPath are used by Store, ToOptions fills them from the same BootConfig as rk-entry
+	reqPerSec       int
+	reqPerSecByPath map[string]int
+	store           Store
+	failClosed      bool
+	algorithm       string
+	headersOnAll    bool
+	mode            string
+	maxWait         time.Duration
+	maxQueue        int64
+	registerer      prometheus.Registerer
+	metricsSet      *rkmidprom.MetricsSet
+	// queues are FIFO of requests waiting for the same key of Store in wait mode, empty queue is removed
+	queueLock sync.Mutex
+	queues    map[string]*list.List
+}
+
+// Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:       "fake-entry",
+		entryType:       "",
+		maxKeys:         DefaultMaxKeys,
+		reqPerSec:       rkmidlimit.DefaultLimit,
+		reqPerSecByPath: make(map[string]int),
+		algorithm:       rkmidlimit.LeakyBucket,
+		mode:            ModeReject,
+		maxWait:         DefaultMaxWait,
+		maxQueue:        DefaultMaxQueue,
+		queues:          make(map[string]*list.List),
+		registerer:      prometheus.DefaultRegisterer,
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	// state of limiters is required by token bucket, headers of every response and wait mode,
+	// limiter of rk-entry will be replaced by the store in memory which is bounded by max keys
+	if set.store == nil {
+		switch {
+		case set.algorithm == TokenBucket:
+			store := newTokenBucketStore(set.maxKeys)
+			observeKeys(set, store.buckets)
+			set.store = store
+		case set.algorithm == rkmidlimit.LeakyBucket && (set.headersOnAll || set.mode == ModeWait):
+			store := newMemoryStore(set.maxKeys)
+			observeKeys(set, store.tats)
+			set.store = store
+		}
+	}
+
+	set.metricsSet = rkmidprom.NewMetricsSet("rk", "ratelimit", set.registerer)
+	set.metricsSet.RegisterGauge(MetricsNameKeys, labelKeys...)
+	set.metricsSet.RegisterCounter(MetricsNameKeyEvicted, labelKeys...)
+	set.metricsSet.RegisterCounter(MetricsNameStoreError, labelKeys...)
+	set.metricsSet.RegisterHistogram(MetricsNameWaitDuration, waitBuckets, waitLabelKeys...)
+
+	return set
+}
+
+// keyed returns true if clients should be limited separately
+func (set *optionSet) keyed() bool {
+	return set.keyFunc != nil || len(set.keyBy) > 0
+}
+
+// getKey extracts key of client from request
+func (set *optionSet) getKey(ctx echo.Context) string {
+	key := ""
+
+	switch {
+	case set.keyFunc != nil:
+		key = set.keyFunc(ctx)
+	case set.keyBy == KeyByHeader:
+		key = ctx.Request().Header.Get(set.keyHeader)
+	case set.keyBy == KeyByApiKey:
+		header := set.keyHeader
+		if len(header) < 1 {
+			header = DefaultApiKeyHeader
+		}
+		key = ctx.Request().Header.Get(header)
+	case set.keyBy == KeyByJwtSubject:
+		key = rkechoctx.GetJwtSubject(ctx)
+	}
+
+	if len(key) > 0 {
+		return set.keyBy + ":" + key
+	}
+
+	// fallback to client IP
+	return KeyByIp + ":" + set.getClientIp(ctx)
+}
+
+// getClientIp returns IP of client with trusted proxies.
+//
+// IPExtractor of echo will be used if trusted proxies were not provided, remote address will be used if neither exists.
+func (set *optionSet) getClientIp(ctx echo.Context) string {
+	if set.ipExtractor != nil {
+		return set.ipExtractor(ctx.Request())
+	}
+
+	if e := ctx.Echo(); e != nil && e.IPExtractor != nil {
+		return e.IPExtractor(ctx.Request())
+	}
+
+	return echo.ExtractIPDirect()(ctx.Request())
+}
+
+// getReqPerSec returns limit of path and key of limiter, global one will be returned if not found
+func (set *optionSet) getReqPerSec(path string) (string, int) {
+	if v, ok := set.reqPerSecByPath[path]; ok {
+		return path, v
+	}
+
+	return global, set.reqPerSec
+}
+
+// getStoreKey returns key of request in Store and limit of it
+func (set *optionSet) getStoreKey(ctx echo.Context) (string, int) {
+	limiterKey, limit := set.getReqPerSec(ctx.Request().URL.Path)
+
+	clientKey := "*"
+	if set.keyed() {
+		clientKey = set.getKey(ctx)
+	}
+
+	return limiterKey + "|" + clientKey, limit
+}
+
+// allow consumes one request from Store, error response will be returned if rejected
+func (set *optionSet) allow(ctx echo.Context) (*Result, rkerror.ErrorInterface) {
+	key, limit := set.getStoreKey(ctx)
+	if limit < 1 {
+		return &Result{}, rkmid.GetErrorBuilder().New(http.StatusTooManyRequests, "slow down your request")
+	}
+
+	res, err := set.store.Allow(ctx.Request().Context(), key, Rate{
+		Limit:  limit,
+		Period: time.Second,
+	})
+	if err != nil {
+		if counter := set.metricsSet.GetCounterWithValues(MetricsNameStoreError, set.entryName, set.entryType); counter != nil {
+			counter.Inc()
+		}
+		rkechoctx.GetEvent(ctx).SetCounter("rateLimitStoreError", 1)
+
+		if set.failClosed {
+			return nil, rkmid.GetErrorBuilder().New(http.StatusServiceUnavailable, "rate limit store unavailable", err)
+		}
+		return nil, nil
+	}
+
+	if !res.Allowed {
+		return res, rkmid.GetErrorBuilder().New(http.StatusTooManyRequests, "slow down your request")
+	}
+
+	return res, nil
+}
+
+// wait consumes one request from Store, request waits in FIFO queue of its key until allowed if it is in wait mode.
+//
+// Only the head of queue polls Store once it would be allowed, the next one is signalled after head left,
+// so that requests are allowed in order of arrival and latecomers never overtake requests waiting longer.
+// Request will be rejected if it would wait longer than max wait, queue is full or request context is canceled.
+func (set *optionSet) wait(ctx echo.Context) (*Result, rkerror.ErrorInterface) {
+	if set.mode != ModeWait {
+		return set.allow(ctx)
+	}
+
+	key, _ := set.getStoreKey(ctx)
+	var res *Result
+	errResp := rkmid.GetErrorBuilder().New(http.StatusTooManyRequests, "slow down your request")
+
+	// requests arrived earlier are waiting, queue up behind them instead of competing with them
+	if !set.hasWaiters(key) {
+		res, errResp = set.allow(ctx)
+		if errResp == nil || res == nil || res.Limit < 1 || res.RetryAfter > set.maxWait {
+			return res, errResp
+		}
+	}
+
+	// queue is full
+	if atomic.AddInt64(&set.waiting, 1) > set.maxQueue {
+		atomic.AddInt64(&set.waiting, -1)
+		return res, errResp
+	}
+	defer atomic.AddInt64(&set.waiting, -1)
+
+	start := time.Now()
+	deadline := start.Add(set.maxWait)
+	defer func() {
+		set.observeWait(time.Since(start), errResp == nil)
+	}()
+
+	turn, elem := set.joinQueue(key)
+	defer set.leaveQueue(key, elem)
+
+	// wait for requests ahead in queue
+	timer := time.NewTimer(set.maxWait)
+	select {
+	case <-ctx.Request().Context().Done():
+		timer.Stop()
+		return res, errResp
+	case <-timer.C:
+		return res, errResp
+	case <-turn:
+		timer.Stop()
+	}
+
+	for {
+		// sleep until request would be allowed, request just became head of queue tries immediately
+		if res != nil {
+			if res.Limit < 1 || time.Now().Add(res.RetryAfter).After(deadline) {
+				return res, errResp
+			}
+
+			timer = time.NewTimer(res.RetryAfter)
+			select {
+			case <-ctx.Request().Context().Done():
+				timer.Stop()
+				return res, errResp
+			case <-timer.C:
+			}
+		}
+
+		res, errResp = set.allow(ctx)
+		if errResp == nil || res == nil {
+			return res, errResp
+		}
+	}
+}
+
+// hasWaiters returns true if any request is waiting in queue of key
+func (set *optionSet) hasWaiters(key string) bool {
+	set.queueLock.Lock()
+	defer set.queueLock.Unlock()
+
+	_, ok := set.queues[key]
+	return ok
+}
+
+// joinQueue appends request to the tail of queue of key, returned channel is closed once it becomes head of queue
+func (set *optionSet) joinQueue(key string) (<-chan struct{}, *list.Element) {
+	set.queueLock.Lock()
+	defer set.queueLock.Unlock()
+
+	queue, ok := set.queues[key]
+	if !ok {
+		queue = list.New()
+		set.queues[key] = queue
+	}
+
+	turn := make(chan struct{})
+	if queue.Len() < 1 {
+		close(turn)
+	}
+
+	return turn, queue.PushBack(turn)
+}
+
+// leaveQueue removes request from queue of key, the next one will be signalled if request was head of queue
+func (set *optionSet) leaveQueue(key string, elem *list.Element) {
+	set.queueLock.Lock()
+	defer set.queueLock.Unlock()
+
+	queue := set.queues[key]
+	head := queue.Front() == elem
+	queue.Remove(elem)
+
+	if queue.Len() < 1 {
+		delete(set.queues, key)
+		return
+	}
+
+	if head {
+		close(queue.Front().Value.(chan struct{}))
+	}
+}
+
+// Record seconds request spent waiting in queue, metrics will be ignored if it was not registered successfully
+func (set *optionSet) observeWait(elapsed time.Duration, allowed bool) {
+	result := "rejected"
+	if allowed {
+		result = "allowed"
+	}
+
+	if observer := set.metricsSet.GetHistogramWithValues(MetricsNameWaitDuration,
+		set.entryName, set.entryType, result); observer != nil {
+		observer.Observe(elapsed.Seconds())
+	}
+}
+
+// Increase gauge of per-key limiters, metrics will be ignored if it was not registered successfully
+func (set *optionSet) incKeys() {
+	if gauge := set.metricsSet.GetGaugeWithValues(MetricsNameKeys, set.entryName, set.entryType); gauge != nil {
+		gauge.Inc()
+	}
+}
+
+// Decrease gauge of per-key limiters, like replenished one removed from store
+func (set *optionSet) decKeys() {
+	if gauge := set.metricsSet.GetGaugeWithValues(MetricsNameKeys, set.entryName, set.entryType); gauge != nil {
+		gauge.Dec()
+	}
+}
+
+// Record evicted per-key limiter
+func (set *optionSet) evictKey() {
+	set.decKeys()
+
+	if counter := set.metricsSet.GetCounterWithValues(MetricsNameKeyEvicted, set.entryName, set.entryType); counter != nil {
+		counter.Inc()
+	}
+}
+
+// observeKeys records keys of store in memory with metrics of per-key limiters if clients are limited separately
+func observeKeys[V any](set *optionSet, keys *rkecholru.Map[V]) {
+	if !set.keyed() {
+		return
+	}
+
+	keys.OnAdd = set.incKeys
+	keys.OnRemove = func(evicted bool) {
+		if evicted {
+			set.evictKey()
+		} else {
+			set.decKeys()
+		}
+	}
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML, extends BootConfig of rk-entry.
+type BootConfig struct {
+	rkmidlimit.BootConfig `yaml:",inline" mapstructure:",squash"`
+	KeyBy                 string   `yaml:"keyBy" json:"keyBy"`
+	KeyHeader             string   `yaml:"keyHeader" json:"keyHeader"`
+	TrustedProxies        []string `yaml:"trustedProxies" json:"trustedProxies"`
+	MaxKeys               int      `yaml:"maxKeys" json:"maxKeys"`
+	HeadersOnAllResponses bool     `yaml:"headersOnAllResponses" json:"headersOnAllResponses"`
+	Mode                  string   `yaml:"mode" json:"mode"`
+	MaxWaitMs             int      `yaml:"maxWaitMs" json:"maxWaitMs"`
+	MaxQueue              int      `yaml:"maxQueue" json:"maxQueue"`
+	Store                 struct {
+		Type       string `yaml:"type" json:"type"`
+		FailClosed bool   `yaml:"failClosed" json:"failClosed"`
+		Redis      struct {
+			Addr      string `yaml:"addr" json:"addr"`
+			Username  string `yaml:"username" json:"username"`
+			Password  string `yaml:"password" json:"password"`
+			DB        int    `yaml:"db" json:"db"`
+			KeyPrefix string `yaml:"keyPrefix" json:"keyPrefix"`
+		} `yaml:"redis" json:"redis"`
+	} `yaml:"store" json:"store"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string, reg prometheus.Registerer) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithRegisterer(reg),
+			WithKeyBy(config.KeyBy, config.KeyHeader),
+			WithMaxKeys(config.MaxKeys))
+
+		if len(config.TrustedProxies) > 0 {
+			opts = append(opts, WithTrustedProxies(config.TrustedProxies...))
+		}
+
+		if len(config.Algorithm) > 0 {
+			opts = append(opts, WithAlgorithm(config.Algorithm))
+		}
+		opts = append(opts,
+			WithHeadersOnAllResponses(config.HeadersOnAllResponses),
+			WithMode(config.Mode),
+			WithMaxWait(time.Duration(config.MaxWaitMs)*time.Millisecond),
+			WithMaxQueue(config.MaxQueue))
+
+		if config.ReqPerSec != nil {
+			opts = append(opts, WithReqPerSec(*config.ReqPerSec))
+		}
+
+		for i := range config.Paths {
+			e := config.Paths[i]
+			opts = append(opts, WithReqPerSecByPath(e.Path, e.ReqPerSec))
+		}
+
+		switch config.Store.Type {
+		case "":
+		case StoreMemory:
+			opts = append(opts, WithStore(NewMemoryStore()))
+		case StoreRedis:
+			redisConfig := config.Store.Redis
+			client := redis.NewClient(&redis.Options{
+				Addr:     redisConfig.Addr,
+				Username: redisConfig.Username,
+				Password: redisConfig.Password,
+				DB:       redisConfig.DB,
+			})
+			opts = append(opts, WithStore(NewRedisStore(client, redisConfig.KeyPrefix)))
+		default:
+			rkentry.ShutdownWithError(fmt.Errorf("invalid store type of rate limit, %s", config.Store.Type))
+		}
+		opts = append(opts, WithFailClosed(config.Store.FailClosed))
+	}
+
+	return opts
+}
+
+// ***************** Option *****************
+
+// Option if for middleware options while creating middleware
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+// Entry name and type of rk-entry option set will be used if not provided.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithRegisterer provide prometheus.Registerer.
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(set *optionSet) {
+		if registerer != nil {
+			set.registerer = registerer
+		}
+	}
+}
+
+// WithKeyBy provide strategy of extracting key of client, one of ip, header, apiKey and jwtSubject.
+//
+// Header is required for header strategy, X-API-Key will be used for apiKey strategy if not provided.
+// Client IP will be used as key if key could not be extracted, like JWT token is missing.
+// Limits are shared by all clients if strategy is empty.
+func WithKeyBy(keyBy, header string) Option {
+	return func(set *optionSet) {
+		switch keyBy {
+		case "":
+			return
+		case KeyByIp, KeyByApiKey, KeyByJwtSubject:
+		case KeyByHeader:
+			if len(header) < 1 {
+				rkentry.ShutdownWithError(errors.New("header is required for header key strategy of rate limit"))
+			}
+		default:
+			rkentry.ShutdownWithError(fmt.Errorf("invalid key strategy of rate limit, %s", keyBy))
+		}
+
+		set.keyBy = keyBy
+		set.keyHeader = header
+	}
+}
+
+// WithKeyFunc provide custom KeyFunc, it overrides strategy provided by WithKeyBy.
+func WithKeyFunc(fn KeyFunc) Option {
+	return func(set *optionSet) {
+		if fn != nil {
+			set.keyFunc = fn
+		}
+	}
+}
+
+// WithTrustedProxies provide IP ranges or IPs of trusted proxies,
+// client IP will be extracted from X-Forwarded-For header sent by them.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(set *optionSet) {
+		trustOpts := []echo.TrustOption{
+			echo.TrustLoopback(false),
+			echo.TrustLinkLocal(false),
+			echo.TrustPrivateNet(false),
+		}
+
+		for i := range proxies {
+			proxy := strings.TrimSpace(proxies[i])
+			if len(proxy) < 1 {
+				continue
+			}
+
+			if !strings.Contains(proxy, "/") {
+				if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+					proxy += "/32"
+				} else {
+					proxy += "/128"
+				}
+			}
+
+			_, ipNet, err := net.ParseCIDR(proxy)
+			if err != nil {
+				rkentry.ShutdownWithError(fmt.Errorf("invalid trusted proxy of rate limit, %s", proxies[i]))
+			}
+			trustOpts = append(trustOpts, echo.TrustIPRange(ipNet))
+		}
+
+		set.ipExtractor = echo.ExtractIPFromXFFHeader(trustOpts...)
+	}
+}
+
+// WithMaxKeys provide max number of per-key limiters kept in memory, least recently used one will be evicted.
+// Zero or negative value will be ignored.
+func WithMaxKeys(maxKeys int) Option {
+	return func(set *optionSet) {
+		if maxKeys > 0 {
+			set.maxKeys = maxKeys
+		}
+	}
+}
+
+// WithReqPerSec provide global limit used by Store, limiters of rk-entry are not consulted once Store is used.
+// ToOptions fills it from the same BootConfig as rk-entry.
+// Negative value will be treated as zero which rejects all requests.
+func WithReqPerSec(reqPerSec int) Option {
+	return func(set *optionSet) {
+		if reqPerSec < 0 {
+			reqPerSec = 0
+		}
+		set.reqPerSec = reqPerSec
+	}
+}
+
+// WithReqPerSecByPath provide limit by path used by Store, limiters of rk-entry are not consulted once Store is used.
+// ToOptions fills it from the same BootConfig as rk-entry.
+// Negative value will be treated as zero which rejects all requests.
+func WithReqPerSecByPath(path string, reqPerSec int) Option {
+	return func(set *optionSet) {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		if reqPerSec < 0 {
+			reqPerSec = 0
+		}
+		set.reqPerSecByPath[path] = reqPerSec
+	}
+}
+
+// WithStore provide Store which keeps state of limiters, like the one shared by all instances.
+//
+// Limiters of rk-entry will be bypassed and limits provided by WithReqPerSec and WithReqPerSecByPath will be used.
+func WithStore(store Store) Option {
+	return func(set *optionSet) {
+		if store != nil {
+			set.store = store
+		}
+	}
+}
+
+// WithFailClosed reject requests with 503 if Store is unavailable, requests will be allowed by default.
+func WithFailClosed(failClosed bool) Option {
+	return func(set *optionSet) {
+		set.failClosed = failClosed
+	}
+}
+
+// WithAlgorithm provide algorithm of limiters, should be the same as algorithm provided to rk-entry.
+//
+// tokenBucket is implemented by echo middleware, limiters of rk-entry will be bypassed.
+func WithAlgorithm(algorithm string) Option {
+	return func(set *optionSet) {
+		if len(algorithm) > 0 {
+			set.algorithm = algorithm
+		}
+	}
+}
+
+// WithHeadersOnAllResponses set RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers on every response.
+// Headers are set on rejected responses only by default.
+//
+// Since state of limiter is required, leakyBucket of rk-entry, which delays requests, will be replaced by
+// GCRA in memory, which is a leaky bucket as a meter and rejects requests exceeding limit.
+func WithHeadersOnAllResponses(enabled bool) Option {
+	return func(set *optionSet) {
+		set.headersOnAll = enabled
+	}
+}
+
+// WithMode provide mode of rejecting requests exceeding limit, one of reject and wait.
+//
+// In wait mode, requests are queued in order of arrival up to max wait before rejecting. Like headers of every response,
+// leakyBucket of rk-entry will be replaced by GCRA in memory since state of limiter is required.
+func WithMode(mode string) Option {
+	return func(set *optionSet) {
+		switch mode {
+		case "":
+		case ModeReject, ModeWait:
+			set.mode = mode
+		default:
+			rkentry.ShutdownWithError(fmt.Errorf("invalid mode of rate limit, %s", mode))
+		}
+	}
+}
+
+// WithMaxWait provide max duration a request waits in queue in wait mode, zero or negative value will be ignored.
+func WithMaxWait(maxWait time.Duration) Option {
+	return func(set *optionSet) {
+		if maxWait > 0 {
+			set.maxWait = maxWait
+		}
+	}
+}
+
+// WithMaxQueue provide max number of requests waiting in queue in wait mode, zero or negative value will be ignored.
+func WithMaxQueue(maxQueue int) Option {
+	return func(set *optionSet) {
+		if maxQueue > 0 {
+			set.maxQueue = int64(maxQueue)
+		}
+	}
+}
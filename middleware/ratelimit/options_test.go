@@ -0,0 +1,305 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkecholimit
+
+import (
+	"context"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewOptionSet(t *testing.T) {
+	// without options
+	set := newOptionSet()
+	assert.False(t, set.keyed())
+	assert.Equal(t, DefaultMaxKeys, set.maxKeys)
+
+	// with options
+	set = newOptionSet(
+		WithKeyBy(KeyByHeader, "X-Client-Id"),
+		WithMaxKeys(0),
+		WithMaxKeys(10))
+	assert.True(t, set.keyed())
+	assert.Equal(t, 10, set.maxKeys)
+
+	// with key func
+	set = newOptionSet(WithKeyFunc(nil))
+	assert.False(t, set.keyed())
+	set = newOptionSet(WithKeyFunc(func(echo.Context) string { return "" }))
+	assert.True(t, set.keyed())
+}
+
+func TestWithKeyBy(t *testing.T) {
+	// header is missing
+	assert.Panics(t, func() {
+		newOptionSet(WithKeyBy(KeyByHeader, ""))
+	})
+
+	// invalid strategy
+	assert.Panics(t, func() {
+		newOptionSet(WithKeyBy("invalid", ""))
+	})
+}
+
+func TestOptionSet_GetKey(t *testing.T) {
+	// with ip
+	set := newOptionSet(WithKeyBy(KeyByIp, ""))
+	ctx, _ := newCtx()
+	ctx.Request().RemoteAddr = "1.1.1.1:8080"
+	assert.Equal(t, "ip:1.1.1.1", set.getKey(ctx))
+
+	// with header
+	set = newOptionSet(WithKeyBy(KeyByHeader, "X-Client-Id"))
+	ctx.Request().Header.Set("X-Client-Id", "ut-client")
+	assert.Equal(t, "header:ut-client", set.getKey(ctx))
+
+	// with api key
+	set = newOptionSet(WithKeyBy(KeyByApiKey, ""))
+	assert.Equal(t, "ip:1.1.1.1", set.getKey(ctx))
+	ctx.Request().Header.Set(DefaultApiKeyHeader, "ut-key")
+	assert.Equal(t, "apiKey:ut-key", set.getKey(ctx))
+
+	// with jwt subject
+	set = newOptionSet(WithKeyBy(KeyByJwtSubject, ""))
+	assert.Equal(t, "ip:1.1.1.1", set.getKey(ctx))
+	ctx.Set(rkmid.JwtTokenKey.String(), &jwt.Token{Claims: jwt.MapClaims{"sub": "ut-map"}})
+	assert.Equal(t, "jwtSubject:ut-map", set.getKey(ctx))
+	ctx.Set(rkmid.JwtTokenKey.String(), &jwt.Token{Claims: &jwt.RegisteredClaims{Subject: "ut-registered"}})
+	assert.Equal(t, "jwtSubject:ut-registered", set.getKey(ctx))
+	ctx.Set(rkmid.JwtTokenKey.String(), &jwt.Token{Claims: &jwt.StandardClaims{Subject: "ut-standard"}})
+	assert.Equal(t, "jwtSubject:ut-standard", set.getKey(ctx))
+
+	// with key func
+	set = newOptionSet(WithKeyFunc(func(echo.Context) string { return "ut-custom" }))
+	assert.Equal(t, ":ut-custom", set.getKey(ctx))
+}
+
+func TestOptionSet_GetClientIp(t *testing.T) {
+	ctx, _ := newCtx()
+	ctx.Request().RemoteAddr = "10.0.0.1:8080"
+	ctx.Request().Header.Set(echo.HeaderXForwardedFor, "2.2.2.2, 1.1.1.1")
+
+	// without trusted proxies, remote address is used
+	set := newOptionSet()
+	assert.Equal(t, "10.0.0.1", set.getClientIp(ctx))
+
+	// with IPExtractor of echo
+	ctx.Echo().IPExtractor = echo.ExtractIPFromXFFHeader()
+	assert.Equal(t, "1.1.1.1", set.getClientIp(ctx))
+	ctx.Echo().IPExtractor = nil
+
+	// with trusted proxies
+	set = newOptionSet(WithTrustedProxies("", "10.0.0.0/8"))
+	assert.Equal(t, "1.1.1.1", set.getClientIp(ctx))
+	set = newOptionSet(WithTrustedProxies("10.0.0.1", "1.1.1.1"))
+	assert.Equal(t, "2.2.2.2", set.getClientIp(ctx))
+	set = newOptionSet(WithTrustedProxies("192.168.0.0/16"))
+	assert.Equal(t, "10.0.0.1", set.getClientIp(ctx))
+
+	// with invalid proxy
+	assert.Panics(t, func() {
+		newOptionSet(WithTrustedProxies("invalid"))
+	})
+}
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{
+		BootConfig: rkmidlimit.BootConfig{
+			Enabled: false,
+		},
+		KeyBy:          KeyByHeader,
+		KeyHeader:      "X-Client-Id",
+		TrustedProxies: []string{"10.0.0.0/8"},
+		MaxKeys:        10,
+	}
+
+	// with disabled
+	assert.Empty(t, ToOptions(config, "", "", nil))
+
+	// with enabled
+	config.Enabled = true
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type", nil)...)
+	assert.Equal(t, "ut-entry", set.entryName)
+	assert.Equal(t, KeyByHeader, set.keyBy)
+	assert.Equal(t, "X-Client-Id", set.keyHeader)
+	assert.NotNil(t, set.ipExtractor)
+	assert.Equal(t, 10, set.maxKeys)
+	assert.Nil(t, set.store)
+	assert.False(t, set.failClosed)
+
+	// with token bucket
+	config.Algorithm = TokenBucket
+	set = newOptionSet(ToOptions(config, "ut-entry", "ut-type", nil)...)
+	assert.IsType(t, &tokenBucketStore{}, set.store)
+
+	// with headers on all responses
+	config.Algorithm = rkmidlimit.LeakyBucket
+	config.HeadersOnAllResponses = true
+	set = newOptionSet(ToOptions(config, "ut-entry", "ut-type", nil)...)
+	assert.True(t, set.headersOnAll)
+	assert.IsType(t, &memoryStore{}, set.store)
+
+	// with wait mode
+	config.HeadersOnAllResponses = false
+	config.Mode = ModeWait
+	config.MaxWaitMs = 100
+	config.MaxQueue = 10
+	set = newOptionSet(ToOptions(config, "ut-entry", "ut-type", nil)...)
+	assert.Equal(t, ModeWait, set.mode)
+	assert.Equal(t, 100*time.Millisecond, set.maxWait)
+	assert.Equal(t, int64(10), set.maxQueue)
+	assert.IsType(t, &memoryStore{}, set.store)
+}
+
+func TestToOptions_WithStore(t *testing.T) {
+	reqPerSec := 10
+	config := &BootConfig{}
+	config.Enabled = true
+	config.ReqPerSec = &reqPerSec
+	config.Paths = append(config.Paths, struct {
+		Path      string `yaml:"path" json:"path"`
+		ReqPerSec int    `yaml:"reqPerSec" json:"reqPerSec"`
+	}{Path: "ut-path", ReqPerSec: 5})
+
+	// with memory store
+	config.Store.Type = StoreMemory
+	config.Store.FailClosed = true
+	set := newOptionSet(ToOptions(config, "", "", nil)...)
+	assert.IsType(t, &memoryStore{}, set.store)
+	assert.True(t, set.failClosed)
+	key, limit := set.getReqPerSec("/ut-path")
+	assert.Equal(t, "/ut-path", key)
+	assert.Equal(t, 5, limit)
+	key, limit = set.getReqPerSec("/ut-other")
+	assert.Equal(t, global, key)
+	assert.Equal(t, 10, limit)
+
+	// with redis store
+	config.Store.Type = StoreRedis
+	config.Store.Redis.Addr = "localhost:6379"
+	config.Store.Redis.KeyPrefix = "ut-prefix:"
+	set = newOptionSet(ToOptions(config, "", "", nil)...)
+	assert.IsType(t, &redisStore{}, set.store)
+	assert.Equal(t, "ut-prefix:", set.store.(*redisStore).keyPrefix)
+
+	// with invalid store
+	config.Store.Type = "invalid"
+	assert.Panics(t, func() {
+		ToOptions(config, "", "", nil)
+	})
+}
+
+func TestOptionSet_Wait(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	set := newOptionSet(WithMode(ModeWait), WithReqPerSec(20), WithMaxWait(time.Second), WithMaxQueue(1),
+		WithRegisterer(registry))
+	assert.IsType(t, &memoryStore{}, set.store)
+
+	// exhaust burst
+	for i := 0; i < 20; i++ {
+		ctx, _ := newCtx()
+		_, errResp := set.wait(ctx)
+		assert.Nil(t, errResp)
+	}
+
+	// wait until allowed
+	ctx, _ := newCtx()
+	start := time.Now()
+	_, errResp := set.wait(ctx)
+	assert.Nil(t, errResp)
+	assert.True(t, time.Since(start) >= 40*time.Millisecond)
+
+	// queue is full
+	set.waiting = 1
+	ctx, _ = newCtx()
+	_, errResp = set.wait(ctx)
+	assert.Equal(t, http.StatusTooManyRequests, errResp.Code())
+	set.waiting = 0
+
+	// canceled request
+	ctx, _ = newCtx()
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx.SetRequest(ctx.Request().WithContext(cancelCtx))
+	_, errResp = set.wait(ctx)
+	assert.Equal(t, http.StatusTooManyRequests, errResp.Code())
+
+	// waiting time recorded
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+	count := uint64(0)
+	for _, family := range families {
+		if family.GetName() == "rk_ratelimit_waitDuration" {
+			for _, metric := range family.GetMetric() {
+				count += metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	assert.Equal(t, uint64(2), count)
+
+	// longer than max wait
+	set = newOptionSet(WithMode(ModeWait), WithReqPerSec(1), WithMaxWait(10*time.Millisecond),
+		WithRegisterer(prometheus.NewRegistry()))
+	ctx, _ = newCtx()
+	_, errResp = set.wait(ctx)
+	assert.Nil(t, errResp)
+	start = time.Now()
+	_, errResp = set.wait(ctx)
+	assert.Equal(t, http.StatusTooManyRequests, errResp.Code())
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	// invalid mode
+	assert.Panics(t, func() {
+		newOptionSet(WithMode("invalid"))
+	})
+}
+
+func TestOptionSet_WaitInOrder(t *testing.T) {
+	set := newOptionSet(WithMode(ModeWait), WithReqPerSec(20), WithMaxWait(time.Second),
+		WithRegisterer(prometheus.NewRegistry()))
+
+	// exhaust burst
+	for i := 0; i < 20; i++ {
+		ctx, _ := newCtx()
+		_, errResp := set.wait(ctx)
+		assert.Nil(t, errResp)
+	}
+
+	// requests are allowed in order of arrival
+	order := make([]int, 0)
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, _ := newCtx()
+			_, errResp := set.wait(ctx)
+			assert.Nil(t, errResp)
+
+			lock.Lock()
+			order = append(order, i)
+			lock.Unlock()
+		}(i)
+
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt64(&set.waiting) == int64(i+1)
+		}, time.Second, time.Millisecond)
+	}
+
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2}, order)
+	assert.Empty(t, set.queues)
+}
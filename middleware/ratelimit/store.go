@@ -0,0 +1,90 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkecholimit
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// StoreMemory keeps state of limiters in memory of current instance
+	StoreMemory = "memory"
+	// StoreRedis keeps state of limiters in server which speaks Redis protocol, shared by all instances
+	StoreRedis = "redis"
+)
+
+// Store keeps state of limiters, it is shared by all instances if it is distributed.
+//
+// Implementations follow GCRA (generic cell rate algorithm) semantics, which behaves like a sliding window
+// of Rate.Period allowing Rate.Burst requests at most.
+type Store interface {
+	// Allow consumes one request of key with rate
+	Allow(ctx context.Context, key string, rate Rate) (*Result, error)
+}
+
+// Rate of limiter, Limit requests are allowed per Period with burst of Burst.
+// Burst equals to Limit if it is not positive.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// Result of Store.Allow
+type Result struct {
+	// Allowed is true if request is allowed
+	Allowed bool
+	// Limit is the burst of rate
+	Limit int
+	// Remaining is the number of requests allowed right now
+	Remaining int
+	// ResetAfter is the time until limiter is fully replenished
+	ResetAfter time.Duration
+	// RetryAfter is the time until next request is allowed, zero if request is allowed
+	RetryAfter time.Duration
+}
+
+// interval returns emission interval of rate
+func (r Rate) interval() time.Duration {
+	return r.Period / time.Duration(r.Limit)
+}
+
+// burst returns burst of rate
+func (r Rate) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+
+	return r.Limit
+}
+
+// tolerance returns delay variation tolerance of rate
+func (r Rate) tolerance() time.Duration {
+	return r.interval() * time.Duration(r.burst())
+}
+
+// newResult creates Result with diff between theoretical arrival time and now,
+// theoretical arrival time is updated one if allowed.
+func newResult(rate Rate, allowed bool, diff time.Duration) *Result {
+	res := &Result{
+		Allowed:    allowed,
+		Limit:      rate.burst(),
+		ResetAfter: diff,
+	}
+
+	if allowed {
+		res.Remaining = int((rate.tolerance() - diff) / rate.interval())
+	} else {
+		res.RetryAfter = diff + rate.interval() - rate.tolerance()
+	}
+
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+
+	return res
+}
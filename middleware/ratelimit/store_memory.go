@@ -0,0 +1,67 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkecholimit
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/lru"
+	"sync"
+	"time"
+)
+
+// memoryStore is a Store keeps theoretical arrival time of each key in memory,
+// least recently used key will be evicted once max keys reached.
+type memoryStore struct {
+	tats      *rkecholru.Map[time.Time]
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// NewMemoryStore creates Store which keeps state of DefaultMaxKeys keys at most in memory of current instance
+func NewMemoryStore() Store {
+	return newMemoryStore(DefaultMaxKeys)
+}
+
+func newMemoryStore(maxKeys int) *memoryStore {
+	return &memoryStore{
+		tats:      rkecholru.New[time.Time](maxKeys),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow consumes one request of key with rate
+func (s *memoryStore) Allow(ctx context.Context, key string, rate Rate) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	tat, ok := s.tats.Get(key)
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+
+	newTat := tat.Add(rate.interval())
+	if allowAt := newTat.Add(-rate.tolerance()); now.Before(allowAt) {
+		return newResult(rate, false, tat.Sub(now)), nil
+	}
+
+	s.tats.Set(key, newTat)
+	return newResult(rate, true, newTat.Sub(now)), nil
+}
+
+// sweep removes replenished keys once per minute
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	s.tats.RemoveIf(func(tat time.Time) bool {
+		return tat.Before(now)
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkecholimit
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+// gcraScript updates theoretical arrival time atomically with clock of server, times are in microseconds.
+//
+// Returns whether request is allowed and diff between theoretical arrival time and now.
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+  tat = now
+end
+
+local new_tat = tat + interval
+if now < new_tat - tolerance then
+  return {0, tat - now}
+end
+
+redis.call("SET", KEYS[1], new_tat, "PX", math.ceil((new_tat - now) / 1000))
+return {1, new_tat - now}
+`)
+
+// redisStore is a Store keeps theoretical arrival time of each key in server which speaks Redis protocol
+type redisStore struct {
+	client    redis.Scripter
+	keyPrefix string
+}
+
+// NewRedisStore creates Store with client of Redis, keys will be prefixed with keyPrefix.
+//
+// Clock of Redis server is used, so that clocks of instances do not need to be in sync.
+func NewRedisStore(client redis.Scripter, keyPrefix string) Store {
+	return &redisStore{
+		client:    client,
+		keyPrefix: keyPrefix,
+	}
+}
+
+// Allow consumes one request of key with rate
+func (s *redisStore) Allow(ctx context.Context, key string, rate Rate) (*Result, error) {
+	raw, err := gcraScript.Run(ctx, s.client, []string{s.keyPrefix + key},
+		rate.interval().Microseconds(), rate.tolerance().Microseconds()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := raw.([]interface{})
+	if !ok || len(values) != 2 {
+		return nil, errors.New("invalid response of rate limit script")
+	}
+
+	allowed, ok1 := values[0].(int64)
+	diff, ok2 := values[1].(int64)
+	if !ok1 || !ok2 {
+		return nil, errors.New("invalid response of rate limit script")
+	}
+
+	return newResult(rate, allowed == 1, time.Duration(diff)*time.Microsecond), nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkecholimit
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewResult(t *testing.T) {
+	rate := Rate{Limit: 10, Period: time.Second}
+	assert.Equal(t, 100*time.Millisecond, rate.interval())
+	assert.Equal(t, 10, rate.burst())
+	assert.Equal(t, time.Second, rate.tolerance())
+
+	// allowed
+	res := newResult(rate, true, 300*time.Millisecond)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 10, res.Limit)
+	assert.Equal(t, 7, res.Remaining)
+	assert.Equal(t, 300*time.Millisecond, res.ResetAfter)
+	assert.Zero(t, res.RetryAfter)
+
+	// rejected
+	res = newResult(rate, false, 950*time.Millisecond)
+	assert.False(t, res.Allowed)
+	assert.Zero(t, res.Remaining)
+	assert.Equal(t, 50*time.Millisecond, res.RetryAfter)
+
+	// with burst
+	rate.Burst = 2
+	assert.Equal(t, 200*time.Millisecond, rate.tolerance())
+}
+
+func assertStore(t *testing.T, store Store) {
+	rate := Rate{Limit: 2, Period: time.Minute}
+
+	// burst is allowed
+	res, err := store.Allow(context.Background(), "ut-key", rate)
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	res, err = store.Allow(context.Background(), "ut-key", rate)
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.True(t, res.ResetAfter > 59*time.Second && res.ResetAfter <= time.Minute)
+
+	// exceeded
+	res, err = store.Allow(context.Background(), "ut-key", rate)
+	assert.Nil(t, err)
+	assert.False(t, res.Allowed)
+	assert.True(t, res.RetryAfter > 29*time.Second && res.RetryAfter <= 30*time.Second)
+
+	// other key is not affected
+	res, err = store.Allow(context.Background(), "ut-other", rate)
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	assertStore(t, store)
+
+	// replenished keys are swept
+	memory := store.(*memoryStore)
+	memory.tats.Set("ut-expired", time.Now().Add(-time.Second))
+	memory.lastSweep = time.Now().Add(-2 * time.Minute)
+	_, err := store.Allow(context.Background(), "ut-key", Rate{Limit: 1, Period: time.Second})
+	assert.Nil(t, err)
+	assert.False(t, memory.tats.Contains("ut-expired"))
+	assert.True(t, memory.tats.Contains("ut-key"))
+
+	// least recently used key is evicted once max keys reached
+	memory = newMemoryStore(2)
+	rate := Rate{Limit: 1, Period: time.Minute}
+	for _, key := range []string{"ut-key-1", "ut-key-2", "ut-key-3"} {
+		_, err = memory.Allow(context.Background(), key, rate)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, memory.tats.Len())
+	assert.False(t, memory.tats.Contains("ut-key-1"))
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	assertStore(t, NewRedisStore(client, "ut-prefix:"))
+	assert.True(t, server.Exists("ut-prefix:ut-key"))
+	assert.True(t, server.TTL("ut-prefix:ut-key") > 0)
+
+	// with unavailable server
+	server.Close()
+	_, err := NewRedisStore(client, "").Allow(context.Background(), "ut-key", Rate{Limit: 1, Period: time.Second})
+	assert.NotNil(t, err)
+}
+
+func TestTokenBucketStore(t *testing.T) {
+	store := NewTokenBucketStore()
+	assertStore(t, store)
+
+	// full buckets are swept
+	bucketStore := store.(*tokenBucketStore)
+	bucketStore.lastSweep = time.Now().Add(-2 * time.Minute)
+	bucketStore.buckets.Set("ut-full", &tokenBucket{tokens: 1, burst: 1, perToken: time.Second, last: time.Now()})
+	_, err := store.Allow(context.Background(), "ut-new", Rate{Limit: 1, Period: time.Second})
+	assert.Nil(t, err)
+	assert.False(t, bucketStore.buckets.Contains("ut-full"))
+	assert.True(t, bucketStore.buckets.Contains("ut-key"))
+
+	// least recently used bucket is evicted once max keys reached
+	bucketStore = newTokenBucketStore(2)
+	rate := Rate{Limit: 1, Period: time.Minute}
+	for _, key := range []string{"ut-key-1", "ut-key-2", "ut-key-1", "ut-key-3"} {
+		_, err = bucketStore.Allow(context.Background(), key, rate)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, bucketStore.buckets.Len())
+	assert.False(t, bucketStore.buckets.Contains("ut-key-2"))
+	assert.True(t, bucketStore.buckets.Contains("ut-key-1"))
+}
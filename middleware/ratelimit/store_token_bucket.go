@@ -0,0 +1,103 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkecholimit
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/lru"
+	"sync"
+	"time"
+)
+
+// tokenBucket state of one key
+type tokenBucket struct {
+	tokens   float64
+	burst    float64
+	perToken time.Duration
+	last     time.Time
+}
+
+// refill adds tokens since last refill
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += float64(now.Sub(b.last)) / float64(b.perToken)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// tokenBucketStore is a Store keeps token buckets of keys in memory.
+//
+// Each bucket holds Rate.Burst tokens at most and is refilled with Rate.Limit tokens per Rate.Period.
+// Least recently used bucket will be evicted once max keys reached.
+type tokenBucketStore struct {
+	buckets   *rkecholru.Map[*tokenBucket]
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// NewTokenBucketStore creates Store with token bucket algorithm which keeps state of DefaultMaxKeys keys at most
+// in memory of current instance
+func NewTokenBucketStore() Store {
+	return newTokenBucketStore(DefaultMaxKeys)
+}
+
+func newTokenBucketStore(maxKeys int) *tokenBucketStore {
+	return &tokenBucketStore{
+		buckets:   rkecholru.New[*tokenBucket](maxKeys),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow consumes one token of key with rate
+func (s *tokenBucketStore) Allow(ctx context.Context, key string, rate Rate) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	burst := float64(rate.burst())
+	perToken := rate.interval()
+
+	bucket, ok := s.buckets.Get(key)
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		s.buckets.Set(key, bucket)
+	}
+	bucket.burst = burst
+	bucket.perToken = perToken
+	bucket.refill(now)
+
+	res := &Result{
+		Limit: rate.burst(),
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - bucket.tokens) * float64(perToken))
+	}
+
+	res.Remaining = int(bucket.tokens)
+	res.ResetAfter = time.Duration((burst - bucket.tokens) * float64(perToken))
+
+	return res, nil
+}
+
+// sweep removes full buckets once per minute
+func (s *tokenBucketStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	s.buckets.RemoveIf(func(bucket *tokenBucket) bool {
+		bucket.refill(now)
+		return bucket.tokens >= bucket.burst
+	})
+}
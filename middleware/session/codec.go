@@ -0,0 +1,124 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosession
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+var errCookieInvalid = errors.New("invalid session cookie")
+
+// codec signs cookie value with HMAC-SHA256, value is encrypted with AES-GCM before signing if aead exists.
+//
+// Name of cookie is signed together with value, so that value could not be moved to another cookie.
+type codec struct {
+	name string
+	// first key signs value, all keys verify value, which allows rotation of secrets
+	keys [][]byte
+	aead cipher.AEAD
+}
+
+// newCodec creates codec, AES-256 key is derived from encryption key with SHA-256
+func newCodec(name string, secrets []string, encryptionKey string) (*codec, error) {
+	if len(secrets) < 1 {
+		return nil, errors.New("at least one secret of session middleware should be provided")
+	}
+
+	res := &codec{
+		name: name,
+	}
+
+	for i := range secrets {
+		res.keys = append(res.keys, []byte(secrets[i]))
+	}
+
+	if len(encryptionKey) > 0 {
+		key := sha256.Sum256([]byte(encryptionKey))
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, err
+		}
+
+		if res.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// encode returns value of cookie in format of base64(payload).base64(signature)
+func (c *codec) encode(payload []byte) (string, error) {
+	if c.aead != nil {
+		nonce := make([]byte, c.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+
+		payload = c.aead.Seal(nonce, nonce, payload, []byte(c.name))
+	}
+
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	return value + "." + base64.RawURLEncoding.EncodeToString(c.sign(c.keys[0], value)), nil
+}
+
+// decode verifies signature with all keys and returns payload
+func (c *codec) decode(value string) ([]byte, error) {
+	index := strings.LastIndex(value, ".")
+	if index < 0 {
+		return nil, errCookieInvalid
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(value[index+1:])
+	if err != nil {
+		return nil, errCookieInvalid
+	}
+
+	verified := false
+	for i := range c.keys {
+		if hmac.Equal(c.sign(c.keys[i], value[:index]), signature) {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		return nil, errCookieInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(value[:index])
+	if err != nil {
+		return nil, errCookieInvalid
+	}
+
+	if c.aead != nil {
+		if len(payload) < c.aead.NonceSize() {
+			return nil, errCookieInvalid
+		}
+
+		nonce := payload[:c.aead.NonceSize()]
+		if payload, err = c.aead.Open(nil, nonce, payload[c.aead.NonceSize():], []byte(c.name)); err != nil {
+			return nil, errCookieInvalid
+		}
+	}
+
+	return payload, nil
+}
+
+func (c *codec) sign(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(c.name))
+	mac.Write([]byte{'|'})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
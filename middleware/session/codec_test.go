@@ -0,0 +1,74 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosession
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestNewCodec(t *testing.T) {
+	// without secret
+	c, err := newCodec("ut-cookie", nil, "")
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+
+	// with encryption key
+	c, err = newCodec("ut-cookie", []string{"ut-secret"}, "ut-key")
+	assert.Nil(t, err)
+	assert.NotNil(t, c.aead)
+}
+
+func TestCodec(t *testing.T) {
+	// signed only
+	c, _ := newCodec("ut-cookie", []string{"ut-secret"}, "")
+	value, err := c.encode([]byte("ut-payload"))
+	assert.Nil(t, err)
+	payload, err := c.decode(value)
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-payload", string(payload))
+
+	// tampered
+	_, err = c.decode("x" + value)
+	assert.NotNil(t, err)
+	_, err = c.decode(strings.Split(value, ".")[0])
+	assert.NotNil(t, err)
+	_, err = c.decode(value + "x")
+	assert.NotNil(t, err)
+
+	// signed for another cookie
+	other, _ := newCodec("ut-other", []string{"ut-secret"}, "")
+	_, err = other.decode(value)
+	assert.NotNil(t, err)
+
+	// rotated secret
+	rotated, _ := newCodec("ut-cookie", []string{"ut-new-secret", "ut-secret"}, "")
+	payload, err = rotated.decode(value)
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-payload", string(payload))
+	_, err = c.decode(mustEncode(t, rotated, "ut-payload"))
+	assert.NotNil(t, err)
+
+	// encrypted
+	c, _ = newCodec("ut-cookie", []string{"ut-secret"}, "ut-key")
+	value = mustEncode(t, c, "ut-payload")
+	assert.NotContains(t, value, "dXQtcGF5bG9hZA")
+	payload, err = c.decode(value)
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-payload", string(payload))
+
+	// encrypted with another key
+	other, _ = newCodec("ut-cookie", []string{"ut-secret"}, "ut-other-key")
+	_, err = other.decode(value)
+	assert.NotNil(t, err)
+}
+
+func mustEncode(t *testing.T, c *codec, payload string) string {
+	value, err := c.encode([]byte(payload))
+	assert.Nil(t, err)
+	return value
+}
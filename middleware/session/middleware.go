@@ -0,0 +1,59 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkechosession is a middleware for echo framework which manages server side sessions with signed cookie
+package rkechosession
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"sync"
+)
+
+// Middleware Add session interceptors, should be placed before csrf middleware which stores token in session.
+//
+// Session is kept in Store at server side and cookie contains signed session id only,
+// or kept in signed and optionally encrypted cookie if Store is not provided.
+// Session expires once idle timeout or absolute timeout passed, and id of session is rotated
+// once authenticated principal changed.
+//
+// Session could be retrieved by rkechoctx.GetSession, it is persisted before response is written.
+func Middleware(opts ...Option) echo.MiddlewareFunc {
+	set := newOptionSet(opts...)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(rkmid.EntryNameKey.String(), set.GetEntryName())
+
+			if set.ShouldIgnore(ctx.Request().URL.Path) {
+				return next(ctx)
+			}
+
+			s, errResp := set.load(ctx)
+			if errResp != nil {
+				return ctx.JSON(errResp.Code(), errResp)
+			}
+			ctx.Set(rkechoctx.SessionKey, s)
+
+			once := sync.Once{}
+			commit := func() {
+				once.Do(func() {
+					set.commit(ctx, s)
+				})
+			}
+			ctx.Response().Before(commit)
+
+			err := next(ctx)
+
+			// response of error is written by error handler of echo which triggers commit
+			if err == nil && !ctx.Response().Committed {
+				commit()
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosession
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// failedStore returns error for all operations
+type failedStore struct{}
+
+func (s *failedStore) Load(context.Context, string) (*Data, error) {
+	return nil, errors.New("ut-error")
+}
+
+func (s *failedStore) Save(context.Context, string, *Data, time.Duration) error {
+	return errors.New("ut-error")
+}
+
+func (s *failedStore) Delete(context.Context, string) error {
+	return errors.New("ut-error")
+}
+
+func newSessionEcho(opts ...Option) *echo.Echo {
+	e := echo.New()
+	e.Use(Middleware(append([]Option{WithSecrets("ut-secret")}, opts...)...))
+
+	e.GET("/set", func(ctx echo.Context) error {
+		rkechoctx.GetSession(ctx).Set("key", ctx.QueryParam("value"))
+		return ctx.String(http.StatusOK, "")
+	})
+	e.GET("/get", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, rkechoctx.GetSession(ctx).GetString("key"))
+	})
+	e.GET("/login", func(ctx echo.Context) error {
+		ctx.Set(rkechoctx.AuthPrincipalKey, ctx.QueryParam("user"))
+		return ctx.NoContent(http.StatusOK)
+	})
+	e.GET("/renew", func(ctx echo.Context) error {
+		rkechoctx.GetSession(ctx).RenewId()
+		return ctx.String(http.StatusOK, "")
+	})
+	e.GET("/logout", func(ctx echo.Context) error {
+		rkechoctx.GetSession(ctx).Destroy()
+		return errors.New("ut-error")
+	})
+	e.GET("/id", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, rkechoctx.GetSession(ctx).Id())
+	})
+	e.GET("/healthz", func(ctx echo.Context) error {
+		if rkechoctx.GetSession(ctx) != nil {
+			return ctx.NoContent(http.StatusInternalServerError)
+		}
+		return ctx.NoContent(http.StatusOK)
+	})
+
+	return e
+}
+
+// serve sends request with cookie and returns new cookie if set
+func serve(e *echo.Echo, path string, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+
+	for _, v := range w.Result().Cookies() {
+		if v.Name == DefaultCookieName {
+			return w, v
+		}
+	}
+
+	return w, nil
+}
+
+func TestMiddleware(t *testing.T) {
+	stores := map[string]Store{
+		StoreCookie: nil,
+		StoreMemory: NewMemoryStore(0),
+	}
+	fileStore, err := NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+	stores[StoreFile] = fileStore
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			e := newSessionEcho(WithStore(store), WithPathToIgnore("/healthz"))
+
+			// new session without modification is not persisted
+			w, cookie := serve(e, "/get", nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Nil(t, cookie)
+
+			// set value
+			w, cookie = serve(e, "/set?value=ut-value", nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.NotNil(t, cookie)
+			assert.True(t, cookie.HttpOnly)
+			assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+			assert.Equal(t, "/", cookie.Path)
+
+			// get value
+			w, next := serve(e, "/get", cookie)
+			assert.Equal(t, "ut-value", w.Body.String())
+			assert.NotNil(t, next)
+			cookie = next
+
+			// tampered cookie
+			w, _ = serve(e, "/get", &http.Cookie{Name: DefaultCookieName, Value: "x" + cookie.Value})
+			assert.Empty(t, w.Body.String())
+
+			// explicit rotation
+			_, before := serve(e, "/id", cookie)
+			w, renewed := serve(e, "/renew", cookie)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.NotEqual(t, cookie.Value, renewed.Value)
+			w, _ = serve(e, "/get", renewed)
+			assert.Equal(t, "ut-value", w.Body.String())
+			if store != nil {
+				// old id is removed from store
+				w, _ = serve(e, "/get", before)
+				assert.Empty(t, w.Body.String())
+			}
+			cookie = renewed
+
+			// destroy
+			w, cleared := serve(e, "/logout", cookie)
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.NotNil(t, cleared)
+			assert.Empty(t, cleared.Value)
+			assert.True(t, cleared.MaxAge < 0)
+			if store != nil {
+				w, _ = serve(e, "/get", cookie)
+				assert.Empty(t, w.Body.String())
+			}
+
+			// ignored path
+			w, _ = serve(e, "/healthz", nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+func TestMiddleware_RotateOnPrincipalChange(t *testing.T) {
+	e := newSessionEcho(WithStore(NewMemoryStore(0)))
+
+	_, cookie := serve(e, "/set?value=ut-value", nil)
+	w, _ := serve(e, "/id", cookie)
+	id := w.Body.String()
+
+	// login rotates session id
+	_, cookie = serve(e, "/login?user=ut-user", cookie)
+	w, _ = serve(e, "/id", cookie)
+	assert.NotEqual(t, id, w.Body.String())
+	id = w.Body.String()
+
+	// same principal keeps session id
+	_, cookie = serve(e, "/login?user=ut-user", cookie)
+	w, _ = serve(e, "/id", cookie)
+	assert.Equal(t, id, w.Body.String())
+
+	// another principal rotates session id
+	_, cookie = serve(e, "/login?user=ut-other", cookie)
+	w, _ = serve(e, "/id", cookie)
+	assert.NotEqual(t, id, w.Body.String())
+
+	// values are kept
+	w, _ = serve(e, "/get", cookie)
+	assert.Equal(t, "ut-value", w.Body.String())
+
+	// new session with principal is persisted
+	_, cookie = serve(e, "/login?user=ut-user", nil)
+	assert.NotNil(t, cookie)
+}
+
+func TestMiddleware_Expiry(t *testing.T) {
+	// idle timeout
+	e := newSessionEcho(WithStore(NewMemoryStore(0)), WithIdleTimeout(20*time.Millisecond))
+	_, cookie := serve(e, "/set?value=ut-value", nil)
+	time.Sleep(10 * time.Millisecond)
+	w, cookie := serve(e, "/get", cookie)
+	assert.Equal(t, "ut-value", w.Body.String())
+	time.Sleep(30 * time.Millisecond)
+	w, _ = serve(e, "/get", cookie)
+	assert.Empty(t, w.Body.String())
+
+	// absolute timeout in cookie
+	e = newSessionEcho(WithAbsoluteTimeout(20 * time.Millisecond))
+	_, cookie = serve(e, "/set?value=ut-value", nil)
+	for i := 0; i < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+		w, next := serve(e, "/get", cookie)
+		if next != nil {
+			cookie = next
+		}
+		if i == 0 {
+			assert.Equal(t, "ut-value", w.Body.String())
+		}
+	}
+	w, _ = serve(e, "/get", cookie)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestMiddleware_Encrypted(t *testing.T) {
+	e := newSessionEcho(WithEncryptionKey("ut-key"))
+
+	_, cookie := serve(e, "/set?value=ut-value", nil)
+	assert.NotContains(t, cookie.Value, "ut-value")
+
+	w, _ := serve(e, "/get", cookie)
+	assert.Equal(t, "ut-value", w.Body.String())
+
+	// cookie encrypted with another key
+	w, _ = serve(newSessionEcho(WithEncryptionKey("ut-other-key")), "/get", cookie)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestMiddleware_StoreFailed(t *testing.T) {
+	e := newSessionEcho(WithStore(NewMemoryStore(0)))
+	_, cookie := serve(e, "/set?value=ut-value", nil)
+
+	e = newSessionEcho(WithStore(&failedStore{}))
+	w, _ := serve(e, "/get", cookie)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// failed to save
+	w, cookie = serve(e, "/set?value=ut-value", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, cookie)
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
@@ -0,0 +1,427 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosession
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/error"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// StoreCookie keeps whole session in signed or encrypted cookie
+	StoreCookie = "cookie"
+	// StoreMemory keeps session in memory of current instance, cookie contains signed session id only
+	StoreMemory = "memory"
+	// StoreFile keeps session in files of directory, cookie contains signed session id only
+	StoreFile = "file"
+	// DefaultCookieName is default name of session cookie
+	DefaultCookieName = "rk_session"
+	// DefaultIdleTimeout is default duration session expires after last access
+	DefaultIdleTimeout = 30 * time.Minute
+	// DefaultAbsoluteTimeout is default duration session expires after creation regardless of access
+	DefaultAbsoluteTimeout = 12 * time.Hour
+	// maxCookieSize is max size of cookie accepted by most browsers
+	maxCookieSize = 4096
+)
+
+var errSessionLoad = rkmid.GetErrorBuilder().New(http.StatusServiceUnavailable, "Failed to load session")
+
+// cookieSession is payload of cookie if StoreCookie is used
+type cookieSession struct {
+	Id   string `json:"id"`
+	Data *Data  `json:"data"`
+}
+
+// ***************** OptionSet Implementation *****************
+
+// optionSet which is used for middleware implementation
+type optionSet struct {
+	entryName       string
+	entryType       string
+	pathToIgnore    []string
+	secrets         []string
+	encryptionKey   string
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+	cookieName      string
+	cookieDomain    string
+	cookiePath      string
+	cookieSecure    bool
+	cookieSameSite  http.SameSite
+	// store is nil if session is kept in cookie
+	store Store
+	codec *codec
+}
+
+// Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:       "fake-entry",
+		entryType:       "",
+		pathToIgnore:    []string{},
+		secrets:         []string{},
+		idleTimeout:     DefaultIdleTimeout,
+		absoluteTimeout: DefaultAbsoluteTimeout,
+		cookieName:      DefaultCookieName,
+		cookiePath:      "/",
+		cookieSameSite:  http.SameSiteLaxMode,
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	codec, err := newCodec(set.cookieName, set.secrets, set.encryptionKey)
+	if err != nil {
+		rkentry.ShutdownWithError(err)
+	}
+	set.codec = codec
+
+	return set
+}
+
+// GetEntryName returns entry name
+func (set *optionSet) GetEntryName() string {
+	return set.entryName
+}
+
+// GetEntryType returns entry type
+func (set *optionSet) GetEntryType() string {
+	return set.entryType
+}
+
+// ShouldIgnore determine whether session should be ignored based on path
+func (set *optionSet) ShouldIgnore(path string) bool {
+	for i := range set.pathToIgnore {
+		if strings.HasPrefix(path, set.pathToIgnore[i]) {
+			return true
+		}
+	}
+
+	return rkmid.ShouldIgnoreGlobal(path)
+}
+
+// load returns session of request, new session will be created if cookie is missing, invalid or expired
+func (set *optionSet) load(ctx echo.Context) (*session, rkerror.ErrorInterface) {
+	cookie, err := ctx.Request().Cookie(set.cookieName)
+	if err != nil {
+		return newSession(), nil
+	}
+
+	payload, err := set.codec.decode(cookie.Value)
+	if err != nil {
+		rkechoctx.GetEvent(ctx).SetCounter("sessionInvalid", 1)
+		return newSession(), nil
+	}
+
+	var id string
+	var data *Data
+	if set.store == nil {
+		res := &cookieSession{}
+		if err := json.Unmarshal(payload, res); err != nil || res.Data == nil {
+			rkechoctx.GetEvent(ctx).SetCounter("sessionInvalid", 1)
+			return newSession(), nil
+		}
+		id, data = res.Id, res.Data
+	} else {
+		id = string(payload)
+		if data, err = set.store.Load(ctx.Request().Context(), id); err != nil {
+			rkechoctx.GetLogger(ctx).Warn("Failed to load session, " + err.Error())
+			return nil, errSessionLoad
+		}
+
+		if data == nil {
+			return newSession(), nil
+		}
+	}
+
+	if set.isExpired(data) {
+		rkechoctx.GetEvent(ctx).SetCounter("sessionExpired", 1)
+		res := newSession()
+		res.staleIds = append(res.staleIds, id)
+		return res, nil
+	}
+
+	if data.Values == nil {
+		data.Values = make(map[string]interface{})
+	}
+
+	return &session{
+		id:   id,
+		data: data,
+	}, nil
+}
+
+// isExpired returns true if session was idle or created longer than timeout
+func (set *optionSet) isExpired(data *Data) bool {
+	now := time.Now()
+	return now.Sub(data.AccessedAt) > set.idleTimeout || now.Sub(data.CreatedAt) > set.absoluteTimeout
+}
+
+// commit persists session and writes cookie, it should be called before response is written.
+//
+// Session id is rotated once authenticated principal changed in order to prevent session fixation.
+func (set *optionSet) commit(ctx echo.Context, s *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if principal := rkechoctx.GetAuthPrincipal(ctx); len(principal) > 0 && !s.destroyed && principal != s.data.Principal {
+		if !s.isNew {
+			s.renewId()
+		}
+		s.data.Principal = principal
+		s.modified = true
+	}
+
+	if set.store != nil {
+		for i := range s.staleIds {
+			if err := set.store.Delete(ctx.Request().Context(), s.staleIds[i]); err != nil {
+				rkechoctx.GetLogger(ctx).Warn("Failed to delete session, " + err.Error())
+			}
+		}
+	}
+	s.staleIds = nil
+
+	if s.destroyed {
+		if !s.isNew {
+			cookie := set.newCookie("")
+			cookie.MaxAge = -1
+			set.setCookie(ctx, cookie)
+		}
+		return
+	}
+
+	if s.isNew && !s.modified {
+		return
+	}
+
+	// csrf token issued by cookie before session existed is kept, so that client could keep on using it
+	if token := rkechoctx.GetCsrfToken(ctx); s.isNew && len(token) > 0 {
+		if _, ok := s.data.Values[rkechoctx.SessionCsrfTokenKey]; !ok {
+			s.data.Values[rkechoctx.SessionCsrfTokenKey] = token
+		}
+	}
+
+	now := time.Now()
+	s.data.AccessedAt = now
+	expiresAt := s.data.CreatedAt.Add(set.absoluteTimeout)
+	if idle := now.Add(set.idleTimeout); idle.Before(expiresAt) {
+		expiresAt = idle
+	}
+
+	var payload []byte
+	if set.store == nil {
+		bytes, err := json.Marshal(&cookieSession{Id: s.id, Data: s.data})
+		if err != nil {
+			rkechoctx.GetLogger(ctx).Warn("Failed to encode session, " + err.Error())
+			return
+		}
+		payload = bytes
+	} else {
+		if err := set.store.Save(ctx.Request().Context(), s.id, s.data, expiresAt.Sub(now)); err != nil {
+			rkechoctx.GetLogger(ctx).Warn("Failed to save session, " + err.Error())
+			return
+		}
+		payload = []byte(s.id)
+	}
+
+	value, err := set.codec.encode(payload)
+	if err != nil {
+		rkechoctx.GetLogger(ctx).Warn("Failed to encode session, " + err.Error())
+		return
+	}
+
+	if len(value) > maxCookieSize {
+		rkechoctx.GetLogger(ctx).Warn(fmt.Sprintf("Session cookie exceeds %d bytes, use server side store instead", maxCookieSize))
+		return
+	}
+
+	cookie := set.newCookie(value)
+	cookie.Expires = expiresAt
+	set.setCookie(ctx, cookie)
+}
+
+func (set *optionSet) newCookie(value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     set.cookieName,
+		Value:    value,
+		Path:     set.cookiePath,
+		Domain:   set.cookieDomain,
+		Secure:   set.cookieSecure || set.cookieSameSite == http.SameSiteNoneMode,
+		HttpOnly: true,
+		SameSite: set.cookieSameSite,
+	}
+}
+
+func (set *optionSet) setCookie(ctx echo.Context, cookie *http.Cookie) {
+	http.SetCookie(ctx.Response(), cookie)
+	ctx.Response().Header().Add(rkmid.HeaderVary, rkmid.HeaderCookie)
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML
+type BootConfig struct {
+	Enabled           bool     `yaml:"enabled" json:"enabled"`
+	Ignore            []string `yaml:"ignore" json:"ignore"`
+	Store             string   `yaml:"store" json:"store"`
+	Secrets           []string `yaml:"secrets" json:"-"`
+	EncryptionKey     string   `yaml:"encryptionKey" json:"-"`
+	IdleTimeoutMs     int      `yaml:"idleTimeoutMs" json:"idleTimeoutMs"`
+	AbsoluteTimeoutMs int      `yaml:"absoluteTimeoutMs" json:"absoluteTimeoutMs"`
+	Cookie            struct {
+		Name     string `yaml:"name" json:"name"`
+		Domain   string `yaml:"domain" json:"domain"`
+		Path     string `yaml:"path" json:"path"`
+		Secure   bool   `yaml:"secure" json:"secure"`
+		SameSite string `yaml:"sameSite" json:"sameSite"`
+	} `yaml:"cookie" json:"cookie"`
+	Memory struct {
+		Capacity int `yaml:"capacity" json:"capacity"`
+	} `yaml:"memory" json:"memory"`
+	File struct {
+		Path string `yaml:"path" json:"path"`
+	} `yaml:"file" json:"file"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		var sameSite http.SameSite
+		switch strings.ToLower(config.Cookie.SameSite) {
+		case "", "lax":
+			sameSite = http.SameSiteLaxMode
+		case "strict":
+			sameSite = http.SameSiteStrictMode
+		case "none":
+			sameSite = http.SameSiteNoneMode
+		default:
+			rkentry.ShutdownWithError(fmt.Errorf("invalid sameSite %s of session cookie, expect one of lax, strict and none", config.Cookie.SameSite))
+		}
+
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithSecrets(config.Secrets...),
+			WithEncryptionKey(config.EncryptionKey),
+			WithIdleTimeout(time.Duration(config.IdleTimeoutMs)*time.Millisecond),
+			WithAbsoluteTimeout(time.Duration(config.AbsoluteTimeoutMs)*time.Millisecond),
+			WithCookie(config.Cookie.Name, config.Cookie.Domain, config.Cookie.Path, config.Cookie.Secure, sameSite),
+			WithPathToIgnore(config.Ignore...))
+
+		switch config.Store {
+		case "", StoreMemory:
+			opts = append(opts, WithStore(NewMemoryStore(config.Memory.Capacity)))
+		case StoreFile:
+			store, err := NewFileStore(config.File.Path)
+			if err != nil {
+				rkentry.ShutdownWithError(err)
+			}
+			opts = append(opts, WithStore(store))
+		case StoreCookie:
+		default:
+			rkentry.ShutdownWithError(fmt.Errorf("invalid session store %s, expect one of cookie, memory and file", config.Store))
+		}
+	}
+
+	return opts
+}
+
+// ***************** Option *****************
+
+// Option if for middleware options while creating middleware
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithPathToIgnore provide paths prefix that will ignore session.
+func WithPathToIgnore(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.pathToIgnore = append(set.pathToIgnore, paths[i])
+			}
+		}
+	}
+}
+
+// WithSecrets provide secrets to sign cookie, the first one signs cookie and all of them verify cookie,
+// which allows rotation of secrets. At least one secret is required.
+func WithSecrets(secrets ...string) Option {
+	return func(set *optionSet) {
+		for i := range secrets {
+			if len(secrets[i]) > 0 {
+				set.secrets = append(set.secrets, secrets[i])
+			}
+		}
+	}
+}
+
+// WithEncryptionKey provide key to encrypt cookie with AES-GCM, cookie is signed only if empty.
+func WithEncryptionKey(key string) Option {
+	return func(set *optionSet) {
+		set.encryptionKey = key
+	}
+}
+
+// WithIdleTimeout provide duration session expires after last access.
+// Zero or negative value will be ignored.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(set *optionSet) {
+		if timeout > 0 {
+			set.idleTimeout = timeout
+		}
+	}
+}
+
+// WithAbsoluteTimeout provide duration session expires after creation regardless of access.
+// Zero or negative value will be ignored.
+func WithAbsoluteTimeout(timeout time.Duration) Option {
+	return func(set *optionSet) {
+		if timeout > 0 {
+			set.absoluteTimeout = timeout
+		}
+	}
+}
+
+// WithCookie provide attributes of session cookie, default values will be used for empty name, path and sameSite.
+func WithCookie(name, domain, path string, secure bool, sameSite http.SameSite) Option {
+	return func(set *optionSet) {
+		if len(name) > 0 {
+			set.cookieName = name
+		}
+		if len(path) > 0 {
+			set.cookiePath = path
+		}
+		if sameSite != http.SameSiteDefaultMode {
+			set.cookieSameSite = sameSite
+		}
+		set.cookieDomain = domain
+		set.cookieSecure = secure
+	}
+}
+
+// WithStore provide server side Store, session is kept in cookie if not provided.
+func WithStore(store Store) Option {
+	return func(set *optionSet) {
+		set.store = store
+	}
+}
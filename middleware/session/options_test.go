@@ -0,0 +1,107 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosession
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewOptionSet(t *testing.T) {
+	// without secret
+	assert.Panics(t, func() {
+		newOptionSet()
+	})
+
+	// with default values
+	set := newOptionSet(WithSecrets("", "ut-secret"))
+	assert.Equal(t, "fake-entry", set.GetEntryName())
+	assert.Equal(t, []string{"ut-secret"}, set.secrets)
+	assert.Equal(t, DefaultIdleTimeout, set.idleTimeout)
+	assert.Equal(t, DefaultAbsoluteTimeout, set.absoluteTimeout)
+	assert.Equal(t, DefaultCookieName, set.cookieName)
+	assert.Equal(t, "/", set.cookiePath)
+	assert.Equal(t, http.SameSiteLaxMode, set.cookieSameSite)
+	assert.Nil(t, set.store)
+	assert.Nil(t, set.codec.aead)
+
+	// with options
+	set = newOptionSet(
+		WithEntryNameAndType("ut-entry", "ut-type"),
+		WithSecrets("ut-secret"),
+		WithEncryptionKey("ut-key"),
+		WithIdleTimeout(time.Second),
+		WithAbsoluteTimeout(time.Minute),
+		WithCookie("ut-cookie", "ut-domain", "/ut", true, http.SameSiteStrictMode),
+		WithStore(NewMemoryStore(0)),
+		WithPathToIgnore("", "/ut-ignore"))
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "ut-type", set.GetEntryType())
+	assert.Equal(t, time.Second, set.idleTimeout)
+	assert.Equal(t, time.Minute, set.absoluteTimeout)
+	assert.Equal(t, "ut-cookie", set.cookieName)
+	assert.Equal(t, "ut-domain", set.cookieDomain)
+	assert.Equal(t, "/ut", set.cookiePath)
+	assert.True(t, set.cookieSecure)
+	assert.Equal(t, http.SameSiteStrictMode, set.cookieSameSite)
+	assert.NotNil(t, set.store)
+	assert.NotNil(t, set.codec.aead)
+	assert.True(t, set.ShouldIgnore("/ut-ignore"))
+	assert.False(t, set.ShouldIgnore("/ut-path"))
+}
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{
+		Enabled: false,
+	}
+
+	// with disabled
+	assert.Empty(t, ToOptions(config, "", ""))
+
+	// with default memory store
+	config.Enabled = true
+	config.Secrets = []string{"ut-secret"}
+	config.IdleTimeoutMs = 1000
+	config.Cookie.SameSite = "None"
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type")...)
+	assert.IsType(t, &memoryStore{}, set.store)
+	assert.Equal(t, time.Second, set.idleTimeout)
+	assert.Equal(t, http.SameSiteNoneMode, set.cookieSameSite)
+	assert.True(t, set.newCookie("").Secure)
+
+	// with cookie store
+	config.Store = StoreCookie
+	set = newOptionSet(ToOptions(config, "ut-entry", "ut-type")...)
+	assert.Nil(t, set.store)
+
+	// with file store
+	config.Store = StoreFile
+	config.File.Path = filepath.Join(t.TempDir(), "sessions")
+	set = newOptionSet(ToOptions(config, "ut-entry", "ut-type")...)
+	assert.IsType(t, &fileStore{}, set.store)
+
+	// with file store without path
+	config.File.Path = ""
+	assert.Panics(t, func() {
+		ToOptions(config, "", "")
+	})
+
+	// with invalid store
+	config.Store = "ut-store"
+	assert.Panics(t, func() {
+		ToOptions(config, "", "")
+	})
+
+	// with invalid sameSite
+	config.Store = ""
+	config.Cookie.SameSite = "ut-mode"
+	assert.Panics(t, func() {
+		ToOptions(config, "", "")
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosession
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"sync"
+	"time"
+)
+
+// session implements rkechoctx.Session
+type session struct {
+	mu   sync.Mutex
+	id   string
+	data *Data
+	// isNew is true if session was created by current request
+	isNew bool
+	// modified is true if values changed, new session is persisted only if modified
+	modified  bool
+	destroyed bool
+	// staleIds are ids of session which should be removed from store, like the one before rotation
+	staleIds []string
+}
+
+var _ rkechoctx.Session = (*session)(nil)
+
+// newSession creates empty session with random id
+func newSession() *session {
+	now := time.Now()
+	return &session{
+		id: newSessionId(),
+		data: &Data{
+			Values:     make(map[string]interface{}),
+			CreatedAt:  now,
+			AccessedAt: now,
+		},
+		isNew: true,
+	}
+}
+
+// Id returns id of session
+func (s *session) Id() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.id
+}
+
+// IsNew returns true if session was created by current request
+func (s *session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isNew
+}
+
+// CreatedAt returns creation time of session
+func (s *session) CreatedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.CreatedAt
+}
+
+// Get returns value of key
+func (s *session) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.data.Values[key]
+	return v, ok
+}
+
+// GetString returns value of key as string
+func (s *session) GetString(key string) string {
+	v, _ := s.Get(key)
+	res, _ := v.(string)
+	return res
+}
+
+// Set stores value of key, new session will be started if session was destroyed
+func (s *session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.destroyed {
+		fresh := newSession()
+		s.id, s.data, s.isNew, s.destroyed = fresh.id, fresh.data, true, false
+	}
+
+	s.data.Values[key] = value
+	s.modified = true
+}
+
+// Delete removes value of key
+func (s *session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data.Values[key]; ok {
+		delete(s.data.Values, key)
+		s.modified = true
+	}
+}
+
+// RenewId rotates id of session and keeps values
+func (s *session) RenewId() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.renewId()
+}
+
+// Destroy clears values and marks session as destroyed, cookie will be removed
+func (s *session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isNew {
+		s.staleIds = append(s.staleIds, s.id)
+	}
+
+	s.data.Values = make(map[string]interface{})
+	s.data.Principal = ""
+	s.destroyed = true
+}
+
+// renewId should be called with lock held
+func (s *session) renewId() {
+	if !s.isNew {
+		s.staleIds = append(s.staleIds, s.id)
+	}
+
+	s.id = newSessionId()
+	s.modified = true
+}
+
+// newSessionId returns 256 bits random id encoded with base64
+func newSessionId() string {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosession
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/rookie-ninja/rk-echo/middleware/internal/lru"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMemoryCapacity is default max number of sessions kept by memory store
+	DefaultMemoryCapacity = 10000
+)
+
+// Data is state of session persisted in Store or cookie
+type Data struct {
+	Values map[string]interface{} `json:"values"`
+	// Principal is authenticated principal of session, session id is rotated once it changed
+	Principal  string    `json:"principal,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	AccessedAt time.Time `json:"accessedAt"`
+}
+
+// Store keeps sessions at server side, cookie contains signed session id only,
+// it could be shared by all instances, like the one backed by redis.
+type Store interface {
+	// Load returns data of session, nil will be returned if session not exists or expired
+	Load(ctx context.Context, id string) (*Data, error)
+	// Save stores data of session for ttl
+	Save(ctx context.Context, id string, data *Data, ttl time.Duration) error
+	// Delete removes session, no error will be returned if session not exists
+	Delete(ctx context.Context, id string) error
+}
+
+// ***************** Memory Store *****************
+
+// memoryItem is value of LRU map, data is kept as JSON so that sessions are not shared between requests
+type memoryItem struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// memoryStore is a Store keeps sessions in memory of current instance,
+// least recently used session will be evicted once capacity reached.
+type memoryStore struct {
+	items     *rkecholru.Map[*memoryItem]
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// NewMemoryStore creates Store which keeps at most capacity sessions in memory of current instance,
+// DefaultMemoryCapacity will be used if zero or negative value provided.
+func NewMemoryStore(capacity int) Store {
+	if capacity < 1 {
+		capacity = DefaultMemoryCapacity
+	}
+
+	return &memoryStore{
+		items:     rkecholru.New[*memoryItem](capacity),
+		lastSweep: time.Now(),
+	}
+}
+
+// Load returns data of session and marks it as most recently used
+func (s *memoryStore) Load(ctx context.Context, id string) (*Data, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items.Get(id)
+	if !ok {
+		return nil, nil
+	}
+
+	if !time.Now().Before(item.expiresAt) {
+		s.items.Delete(id)
+		return nil, nil
+	}
+
+	data := &Data{}
+	if err := json.Unmarshal(item.data, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Save stores data of session, least recently used sessions will be evicted if capacity exceeded
+func (s *memoryStore) Save(ctx context.Context, id string, data *Data, ttl time.Duration) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	s.items.Set(id, &memoryItem{
+		data:      bytes,
+		expiresAt: now.Add(ttl),
+	})
+
+	return nil
+}
+
+// Delete removes session
+func (s *memoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items.Delete(id)
+	return nil
+}
+
+// sweep removes expired sessions once per minute
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+
+	s.lastSweep = now
+	s.items.RemoveIf(func(item *memoryItem) bool {
+		return !now.Before(item.expiresAt)
+	})
+}
+
+// ***************** File Store *****************
+
+// fileRecord is content of session file
+type fileRecord struct {
+	ExpiresAt time.Time `json:"expiresAt"`
+	Data      *Data     `json:"data"`
+}
+
+// fileStore is a Store keeps each session as JSON file in directory,
+// name of file is SHA-256 of session id so that ids are not exposed to file system.
+type fileStore struct {
+	dir       string
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// NewFileStore creates Store which keeps sessions as files in directory, directory will be created if missing.
+func NewFileStore(dir string) (Store, error) {
+	if len(dir) < 1 {
+		return nil, errors.New("directory of file store should not be empty")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &fileStore{
+		dir:       dir,
+		lastSweep: time.Now(),
+	}, nil
+}
+
+// Load reads session file, expired file will be removed
+func (s *fileStore) Load(ctx context.Context, id string) (*Data, error) {
+	path := s.path(id)
+
+	record, err := readFileRecord(path)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	if !time.Now().Before(record.ExpiresAt) {
+		return nil, removeFile(path)
+	}
+
+	return record.Data, nil
+}
+
+// Save writes session into temporary file then renames it, readers never see partial file
+func (s *fileStore) Save(ctx context.Context, id string, data *Data, ttl time.Duration) error {
+	s.sweep()
+
+	bytes, err := json.Marshal(&fileRecord{
+		ExpiresAt: time.Now().Add(ttl),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".session-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(bytes); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(id))
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+// Delete removes session file
+func (s *fileStore) Delete(ctx context.Context, id string) error {
+	return removeFile(s.path(id))
+}
+
+// sweep removes expired session files once per minute
+func (s *fileStore) sweep() {
+	s.mu.Lock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) < time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	for i := range entries {
+		if entries[i].IsDir() || !strings.HasSuffix(entries[i].Name(), ".json") {
+			continue
+		}
+
+		path := filepath.Join(s.dir, entries[i].Name())
+		if record, err := readFileRecord(path); err == nil && record != nil && !now.Before(record.ExpiresAt) {
+			removeFile(path)
+		}
+	}
+}
+
+func (s *fileStore) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// readFileRecord returns nil if file not exists
+func readFileRecord(path string) (*fileRecord, error) {
+	bytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record := &fileRecord{}
+	if err := json.Unmarshal(bytes, record); err != nil {
+		return nil, err
+	}
+
+	if record.Data == nil {
+		return nil, nil
+	}
+
+	return record, nil
+}
+
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosession
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newUtData(key, value string) *Data {
+	now := time.Now()
+	return &Data{
+		Values:     map[string]interface{}{key: value},
+		CreatedAt:  now,
+		AccessedAt: now,
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(2).(*memoryStore)
+
+	// missing
+	data, err := store.Load(ctx, "ut-missing")
+	assert.Nil(t, err)
+	assert.Nil(t, data)
+
+	// save and load
+	assert.Nil(t, store.Save(ctx, "ut-1", newUtData("k", "v1"), time.Minute))
+	assert.Nil(t, store.Save(ctx, "ut-2", newUtData("k", "v2"), time.Minute))
+	data, err = store.Load(ctx, "ut-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", data.Values["k"])
+
+	// loaded data is not shared with store
+	data.Values["k"] = "changed"
+	data, _ = store.Load(ctx, "ut-1")
+	assert.Equal(t, "v1", data.Values["k"])
+
+	// least recently used one is evicted
+	assert.Nil(t, store.Save(ctx, "ut-3", newUtData("k", "v3"), time.Minute))
+	data, _ = store.Load(ctx, "ut-2")
+	assert.Nil(t, data)
+	data, _ = store.Load(ctx, "ut-1")
+	assert.NotNil(t, data)
+
+	// delete
+	assert.Nil(t, store.Delete(ctx, "ut-1"))
+	assert.Nil(t, store.Delete(ctx, "ut-missing"))
+	data, _ = store.Load(ctx, "ut-1")
+	assert.Nil(t, data)
+
+	// expired
+	assert.Nil(t, store.Save(ctx, "ut-4", newUtData("k", "v4"), time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	data, _ = store.Load(ctx, "ut-4")
+	assert.Nil(t, data)
+
+	// sweep
+	assert.Nil(t, store.Save(ctx, "ut-5", newUtData("k", "v5"), time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	store.lastSweep = time.Now().Add(-time.Minute)
+	assert.Nil(t, store.Save(ctx, "ut-6", newUtData("k", "v6"), time.Minute))
+	assert.False(t, store.items.Contains("ut-5"))
+	assert.True(t, store.items.Contains("ut-6"))
+
+	// default capacity
+	assert.Equal(t, DefaultMemoryCapacity, NewMemoryStore(0).(*memoryStore).items.MaxKeys())
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "sessions")
+
+	// with empty directory
+	store, err := NewFileStore("")
+	assert.NotNil(t, err)
+	assert.Nil(t, store)
+
+	store, err = NewFileStore(dir)
+	assert.Nil(t, err)
+
+	// missing
+	data, err := store.Load(ctx, "ut-missing")
+	assert.Nil(t, err)
+	assert.Nil(t, data)
+
+	// save and load
+	assert.Nil(t, store.Save(ctx, "../ut-1", newUtData("k", "v1"), time.Minute))
+	data, err = store.Load(ctx, "../ut-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", data.Values["k"])
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+
+	// delete
+	assert.Nil(t, store.Delete(ctx, "../ut-1"))
+	assert.Nil(t, store.Delete(ctx, "ut-missing"))
+	data, _ = store.Load(ctx, "../ut-1")
+	assert.Nil(t, data)
+
+	// expired
+	assert.Nil(t, store.Save(ctx, "ut-2", newUtData("k", "v2"), time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	data, err = store.Load(ctx, "ut-2")
+	assert.Nil(t, err)
+	assert.Nil(t, data)
+	entries, _ = os.ReadDir(dir)
+	assert.Empty(t, entries)
+
+	// sweep
+	assert.Nil(t, store.Save(ctx, "ut-3", newUtData("k", "v3"), time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	store.(*fileStore).lastSweep = time.Now().Add(-time.Minute)
+	assert.Nil(t, store.Save(ctx, "ut-4", newUtData("k", "v4"), time.Minute))
+	entries, _ = os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+
+	// corrupted file
+	assert.Nil(t, os.WriteFile(store.(*fileStore).path("ut-5"), []byte("{"), os.ModePerm))
+	data, err = store.Load(ctx, "ut-5")
+	assert.NotNil(t, err)
+	assert.Nil(t, data)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoshed
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// limitAlgorithm calculates new concurrency limit with observed latency.
+//
+// inflight is the number of requests in flight including the finished one, dropped is true if request
+// failed because of overload, like timed out.
+type limitAlgorithm interface {
+	update(limit float64, rtt time.Duration, inflight int, dropped bool) float64
+}
+
+// aimdAlgorithm increases limit by one if latency is below threshold, otherwise decreases limit by backoff ratio
+type aimdAlgorithm struct {
+	latencyThreshold time.Duration
+	backoffRatio     float64
+}
+
+func (a *aimdAlgorithm) update(limit float64, rtt time.Duration, inflight int, dropped bool) float64 {
+	if dropped || rtt > a.latencyThreshold {
+		return limit * a.backoffRatio
+	}
+
+	// increase limit only if it is actually used
+	if float64(inflight)*2 >= limit {
+		return limit + 1
+	}
+
+	return limit
+}
+
+// gradientAlgorithm adjusts limit with gradient between long term and current latency.
+//
+// Limit shrinks while latency grows over the long term average, and grows with a queue of square root of limit
+// while latency is stable.
+type gradientAlgorithm struct {
+	tolerance float64
+	smoothing float64
+	alpha     float64
+	longRtt   float64
+}
+
+func newGradientAlgorithm() *gradientAlgorithm {
+	return &gradientAlgorithm{
+		tolerance: 1.5,
+		smoothing: 0.2,
+		// exponential moving average over about 600 samples
+		alpha: 2.0 / 601,
+	}
+}
+
+func (a *gradientAlgorithm) update(limit float64, rtt time.Duration, inflight int, dropped bool) float64 {
+	if dropped {
+		return limit * 0.9
+	}
+
+	sample := float64(rtt)
+	if sample <= 0 {
+		return limit
+	}
+
+	if a.longRtt <= 0 {
+		a.longRtt = sample
+	} else {
+		a.longRtt = a.longRtt*(1-a.alpha) + sample*a.alpha
+	}
+
+	// limit is not actually used, do not grow it
+	if float64(inflight) < limit/2 {
+		return limit
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, a.tolerance*a.longRtt/sample))
+	newLimit := limit*gradient + math.Sqrt(limit)
+
+	return limit*(1-a.smoothing) + newLimit*a.smoothing
+}
+
+// limiter keeps adaptive concurrency limit and number of requests in flight
+type limiter struct {
+	algorithm limitAlgorithm
+	limit     float64
+	minLimit  float64
+	maxLimit  float64
+	inflight  int
+	mu        sync.Mutex
+}
+
+// acquire admits request if requests in flight are below limit multiplied by share of priority
+func (l *limiter) acquire(share float64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if float64(l.inflight) >= math.Max(1, math.Floor(l.limit*share)) {
+		return false
+	}
+	l.inflight++
+
+	return true
+}
+
+// release finishes request and updates limit with observed latency
+func (l *limiter) release(rtt time.Duration, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, l.algorithm.update(l.limit, rtt, l.inflight, dropped)))
+	l.inflight--
+}
+
+// getLimit returns current limit
+func (l *limiter) getLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.limit)
+}
+
+// getInflight returns number of requests in flight
+func (l *limiter) getInflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.inflight
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoshed
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAimdAlgorithm(t *testing.T) {
+	algo := &aimdAlgorithm{latencyThreshold: time.Second, backoffRatio: 0.5}
+
+	// limit is used and latency is below threshold
+	assert.Equal(t, float64(11), algo.update(10, time.Millisecond, 5, false))
+
+	// limit is not used
+	assert.Equal(t, float64(10), algo.update(10, time.Millisecond, 1, false))
+
+	// latency exceeds threshold
+	assert.Equal(t, float64(5), algo.update(10, 2*time.Second, 5, false))
+
+	// dropped
+	assert.Equal(t, float64(5), algo.update(10, time.Millisecond, 5, true))
+}
+
+func TestGradientAlgorithm(t *testing.T) {
+	algo := newGradientAlgorithm()
+
+	// stable latency, limit grows
+	limit := float64(10)
+	for i := 0; i < 10; i++ {
+		limit = algo.update(limit, 10*time.Millisecond, int(limit), false)
+	}
+	assert.Greater(t, limit, float64(10))
+
+	// latency grows, limit shrinks
+	before := limit
+	for i := 0; i < 10; i++ {
+		limit = algo.update(limit, 100*time.Millisecond, int(limit), false)
+	}
+	assert.Less(t, limit, before)
+
+	// dropped
+	assert.Equal(t, float64(9), algo.update(10, 10*time.Millisecond, 10, true))
+
+	// limit is not used
+	assert.Equal(t, float64(10), algo.update(10, 10*time.Millisecond, 1, false))
+}
+
+func TestLimiter(t *testing.T) {
+	l := &limiter{
+		algorithm: &aimdAlgorithm{latencyThreshold: time.Second, backoffRatio: 0.5},
+		limit:     4,
+		minLimit:  2,
+		maxLimit:  5,
+	}
+
+	// low priority could use half of limit
+	assert.True(t, l.acquire(0.5))
+	assert.True(t, l.acquire(0.5))
+	assert.False(t, l.acquire(0.5))
+
+	// critical priority could use whole limit
+	assert.True(t, l.acquire(1))
+	assert.True(t, l.acquire(1))
+	assert.False(t, l.acquire(1))
+	assert.Equal(t, 4, l.getInflight())
+
+	// limit grows up to max limit
+	l.release(time.Millisecond, false)
+	l.release(time.Millisecond, false)
+	assert.Equal(t, 5, l.getLimit())
+	assert.Equal(t, 2, l.getInflight())
+
+	// limit shrinks down to min limit
+	l.release(time.Millisecond, true)
+	l.release(time.Millisecond, true)
+	assert.Equal(t, 2, l.getLimit())
+	assert.Equal(t, 0, l.getInflight())
+
+	// at least one request will be admitted
+	l.limit = 1
+	assert.True(t, l.acquire(0.5))
+}
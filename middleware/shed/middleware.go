@@ -0,0 +1,73 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkechoshed is a middleware for echo framework which sheds load with adaptive concurrency limit
+package rkechoshed
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"net/http"
+	"time"
+)
+
+// Middleware Add load shedding interceptors.
+//
+// Concurrency limit adapts to observed latency, requests beyond share of limit of their priority
+// will be rejected with 503, so that low priority requests are shed first.
+func Middleware(opts ...Option) echo.MiddlewareFunc {
+	set := newOptionSet(opts...)
+	set.observe()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(rkmid.EntryNameKey.String(), set.GetEntryName())
+
+			if set.ShouldIgnore(ctx.Request().URL.Path) {
+				return next(ctx)
+			}
+
+			priority := set.getPriority(ctx)
+			if !set.limiter.acquire(shares[priority]) {
+				set.incShed(priority)
+				rkechoctx.GetEvent(ctx).SetCounter("shed", 1)
+
+				resp := rkmid.GetErrorBuilder().New(http.StatusServiceUnavailable, "Server is overloaded")
+				return ctx.JSON(resp.Code(), resp)
+			}
+			set.observe()
+
+			// slot should be released even if handler panics, since panic middleware recovers outside,
+			// panic is treated as dropped request
+			start := time.Now()
+			dropped := true
+			defer func() {
+				set.limiter.release(time.Since(start), dropped)
+				set.observe()
+			}()
+
+			err := next(ctx)
+			dropped = isDropped(ctx, err)
+
+			return err
+		}
+	}
+}
+
+// isDropped returns true if request failed because of overload, like timed out
+func isDropped(ctx echo.Context, err error) bool {
+	code := ctx.Response().Status
+	if httpErr, ok := err.(*echo.HTTPError); ok && !ctx.Response().Committed {
+		code = httpErr.Code
+	}
+
+	switch code {
+	case http.StatusRequestTimeout, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoshed
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+var userHandler = func(ctx echo.Context) error {
+	return ctx.NoContent(http.StatusOK)
+}
+
+func TestMiddleware(t *testing.T) {
+	defer assertNotPanic(t)
+
+	reg := prometheus.NewRegistry()
+	inter := Middleware(
+		WithRegisterer(reg),
+		WithEntryNameAndType("ut-entry", "ut-type"),
+		WithPriorityHeader(HeaderPriority),
+		WithInitialLimit(4),
+		WithMinLimit(4),
+		WithMaxLimit(4),
+		WithPathToIgnore("/ut-ignore"))
+
+	// block handlers in order to keep requests in flight
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blockHandler := func(ctx echo.Context) error {
+		started <- struct{}{}
+		<-release
+		return ctx.NoContent(http.StatusOK)
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, _ := newCtx("/ut-path", PriorityCritical)
+			assert.Nil(t, inter(blockHandler)(ctx))
+		}()
+		<-started
+	}
+
+	// case 1: low priority is shed first
+	ctx, w := newCtx("/ut-path", PriorityLow)
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// case 2: high priority is admitted
+	ctx, w = newCtx("/ut-path", PriorityHigh)
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// case 3: ignored path
+	ctx, w = newCtx("/ut-ignore", PriorityLow)
+	assert.Nil(t, inter(userHandler)(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, float64(2), gatherValue(t, reg, "rk_shed_inflight"))
+
+	close(release)
+	wg.Wait()
+
+	// validate metrics
+	assert.Equal(t, float64(4), gatherValue(t, reg, "rk_shed_limit"))
+	assert.Equal(t, float64(0), gatherValue(t, reg, "rk_shed_inflight"))
+	assert.Equal(t, float64(1), gatherValue(t, reg, "rk_shed_shed"))
+}
+
+func TestMiddleware_Dropped(t *testing.T) {
+	defer assertNotPanic(t)
+
+	reg := prometheus.NewRegistry()
+	inter := Middleware(
+		WithRegisterer(reg),
+		WithInitialLimit(10))
+	assert.Equal(t, float64(10), gatherValue(t, reg, "rk_shed_limit"))
+
+	// response of timed out decreases limit
+	ctx, _ := newCtx("/ut-path", "")
+	assert.False(t, isDropped(ctx, nil))
+	assert.Nil(t, inter(func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusGatewayTimeout)
+	})(ctx))
+	assert.True(t, isDropped(ctx, nil))
+	assert.Equal(t, float64(9), gatherValue(t, reg, "rk_shed_limit"))
+
+	// error of timed out which is not committed yet
+	ctx, _ = newCtx("/ut-path", "")
+	assert.True(t, isDropped(ctx, echo.NewHTTPError(http.StatusServiceUnavailable)))
+	assert.False(t, isDropped(ctx, echo.NewHTTPError(http.StatusBadRequest)))
+}
+
+func TestMiddleware_Panic(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	inter := Middleware(
+		WithRegisterer(reg),
+		WithInitialLimit(10))
+
+	for i := 0; i < 3; i++ {
+		ctx, _ := newCtx("/ut-path", "")
+		assert.Panics(t, func() {
+			inter(func(ctx echo.Context) error {
+				panic("ut-panic")
+			})(ctx)
+		})
+	}
+
+	// slots are released and panics are treated as dropped requests
+	assert.Equal(t, float64(0), gatherValue(t, reg, "rk_shed_inflight"))
+	assert.True(t, gatherValue(t, reg, "rk_shed_limit") < 10)
+}
+
+func newCtx(path, priority string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if len(priority) > 0 {
+		req.Header.Set(HeaderPriority, priority)
+	}
+	resp := httptest.NewRecorder()
+	return echo.New().NewContext(req, resp), resp
+}
+
+func gatherValue(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	mfs, err := reg.Gather()
+	assert.Nil(t, err)
+
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+
+		res := float64(0)
+		for _, m := range mf.GetMetric() {
+			if m.GetGauge() != nil {
+				res += m.GetGauge().GetValue()
+			}
+			if m.GetCounter() != nil {
+				res += m.GetCounter().GetValue()
+			}
+		}
+		return res
+	}
+
+	return 0
+}
+
+func assertNotPanic(t *testing.T) {
+	if r := recover(); r != nil {
+		// Expect panic to be called with non nil error
+		assert.True(t, false)
+	} else {
+		// This should never be called in case of a bug
+		assert.True(t, true)
+	}
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
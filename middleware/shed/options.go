@@ -0,0 +1,344 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoshed
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/prom"
+	"strings"
+	"time"
+)
+
+const (
+	// AIMD algorithm, additive increase and multiplicative decrease with latency threshold
+	AIMD = "aimd"
+	// Gradient algorithm, adjusts limit with gradient between long term and current latency
+	Gradient = "gradient"
+
+	// PriorityCritical requests are admitted until limit is reached
+	PriorityCritical = "critical"
+	// PriorityHigh requests are admitted until 90% of limit is reached
+	PriorityHigh = "high"
+	// PriorityNormal requests are admitted until 75% of limit is reached, it is the default priority
+	PriorityNormal = "normal"
+	// PriorityLow requests are admitted until 50% of limit is reached
+	PriorityLow = "low"
+
+	// DefaultInitialLimit default initial concurrency limit
+	DefaultInitialLimit = 20
+	// DefaultMinLimit default min concurrency limit
+	DefaultMinLimit = 1
+	// DefaultMaxLimit default max concurrency limit
+	DefaultMaxLimit = 1000
+	// DefaultLatencyThreshold default latency threshold of AIMD
+	DefaultLatencyThreshold = time.Second
+	// HeaderPriority is conventional header of priority, priority header is not read unless configured
+	HeaderPriority = "X-Priority"
+
+	// MetricsNameLimit records current concurrency limit
+	MetricsNameLimit = "limit"
+	// MetricsNameInflight records requests in flight
+	MetricsNameInflight = "inflight"
+	// MetricsNameShed records requests shed
+	MetricsNameShed = "shed"
+)
+
+var (
+	labelKeys     = []string{"entryName", "entryType"}
+	shedLabelKeys = []string{"entryName", "entryType", "priority"}
+	// shares of limit each priority could use, lower priority is shed first
+	shares = map[string]float64{
+		PriorityCritical: 1.0,
+		PriorityHigh:     0.9,
+		PriorityNormal:   0.75,
+		PriorityLow:      0.5,
+	}
+)
+
+// ***************** OptionSet Implementation *****************
+
+// optionSet which is used for middleware implementation
+type optionSet struct {
+	entryName        string
+	entryType        string
+	pathToIgnore     []string
+	algorithm        string
+	initialLimit     int
+	minLimit         int
+	maxLimit         int
+	latencyThreshold time.Duration
+	priorityHeader   string
+	priorityByPath   map[string]string
+	limiter          *limiter
+	registerer       prometheus.Registerer
+	metricsSet       *rkmidprom.MetricsSet
+}
+
+// Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:        "fake-entry",
+		entryType:        "",
+		pathToIgnore:     []string{},
+		algorithm:        AIMD,
+		initialLimit:     DefaultInitialLimit,
+		minLimit:         DefaultMinLimit,
+		maxLimit:         DefaultMaxLimit,
+		latencyThreshold: DefaultLatencyThreshold,
+		priorityByPath:   make(map[string]string),
+		registerer:       prometheus.DefaultRegisterer,
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	if set.maxLimit < set.minLimit {
+		set.maxLimit = set.minLimit
+	}
+
+	set.limiter = &limiter{
+		limit:    float64(set.initialLimit),
+		minLimit: float64(set.minLimit),
+		maxLimit: float64(set.maxLimit),
+	}
+
+	switch set.algorithm {
+	case Gradient:
+		set.limiter.algorithm = newGradientAlgorithm()
+	default:
+		set.limiter.algorithm = &aimdAlgorithm{
+			latencyThreshold: set.latencyThreshold,
+			backoffRatio:     0.9,
+		}
+	}
+
+	set.metricsSet = rkmidprom.NewMetricsSet("rk", "shed", set.registerer)
+	set.metricsSet.RegisterGauge(MetricsNameLimit, labelKeys...)
+	set.metricsSet.RegisterGauge(MetricsNameInflight, labelKeys...)
+	set.metricsSet.RegisterCounter(MetricsNameShed, shedLabelKeys...)
+
+	return set
+}
+
+// GetEntryName returns entry name
+func (set *optionSet) GetEntryName() string {
+	return set.entryName
+}
+
+// GetEntryType returns entry type
+func (set *optionSet) GetEntryType() string {
+	return set.entryType
+}
+
+// ShouldIgnore determine whether load shedding should be ignored based on path
+func (set *optionSet) ShouldIgnore(path string) bool {
+	for i := range set.pathToIgnore {
+		if strings.HasPrefix(path, set.pathToIgnore[i]) {
+			return true
+		}
+	}
+
+	return rkmid.ShouldIgnoreGlobal(path)
+}
+
+// getPriority returns priority of request from header if configured, then from path prefix,
+// normal will be returned if not found
+func (set *optionSet) getPriority(ctx echo.Context) string {
+	if len(set.priorityHeader) > 0 {
+		priority := strings.ToLower(strings.TrimSpace(ctx.Request().Header.Get(set.priorityHeader)))
+		if _, ok := shares[priority]; ok {
+			return priority
+		}
+	}
+
+	// the longest prefix wins
+	res, matched := PriorityNormal, ""
+	for path, priority := range set.priorityByPath {
+		if strings.HasPrefix(ctx.Request().URL.Path, path) && len(path) > len(matched) {
+			res, matched = priority, path
+		}
+	}
+
+	return res
+}
+
+// Update gauges of limit and requests in flight, metrics will be ignored if it was not registered successfully
+func (set *optionSet) observe() {
+	if gauge := set.metricsSet.GetGaugeWithValues(MetricsNameLimit, set.entryName, set.entryType); gauge != nil {
+		gauge.Set(float64(set.limiter.getLimit()))
+	}
+
+	if gauge := set.metricsSet.GetGaugeWithValues(MetricsNameInflight, set.entryName, set.entryType); gauge != nil {
+		gauge.Set(float64(set.limiter.getInflight()))
+	}
+}
+
+// Increase counter of requests shed
+func (set *optionSet) incShed(priority string) {
+	if counter := set.metricsSet.GetCounterWithValues(MetricsNameShed,
+		set.entryName, set.entryType, priority); counter != nil {
+		counter.Inc()
+	}
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML
+type BootConfig struct {
+	Enabled            bool     `yaml:"enabled" json:"enabled"`
+	Ignore             []string `yaml:"ignore" json:"ignore"`
+	Algorithm          string   `yaml:"algorithm" json:"algorithm"`
+	InitialLimit       int      `yaml:"initialLimit" json:"initialLimit"`
+	MinLimit           int      `yaml:"minLimit" json:"minLimit"`
+	MaxLimit           int      `yaml:"maxLimit" json:"maxLimit"`
+	LatencyThresholdMs int      `yaml:"latencyThresholdMs" json:"latencyThresholdMs"`
+	PriorityHeader     string   `yaml:"priorityHeader" json:"priorityHeader"`
+	Paths              []struct {
+		Path     string `yaml:"path" json:"path"`
+		Priority string `yaml:"priority" json:"priority"`
+	} `yaml:"paths" json:"paths"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string, reg prometheus.Registerer) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithRegisterer(reg),
+			WithAlgorithm(config.Algorithm),
+			WithInitialLimit(config.InitialLimit),
+			WithMinLimit(config.MinLimit),
+			WithMaxLimit(config.MaxLimit),
+			WithLatencyThreshold(time.Duration(config.LatencyThresholdMs)*time.Millisecond),
+			WithPriorityHeader(config.PriorityHeader))
+
+		for i := range config.Paths {
+			e := config.Paths[i]
+			opts = append(opts, WithPriorityByPath(e.Path, e.Priority))
+		}
+
+		opts = append(opts, WithPathToIgnore(config.Ignore...))
+	}
+
+	return opts
+}
+
+// ***************** Option *****************
+
+// Option if for middleware options while creating middleware
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithRegisterer provide prometheus.Registerer.
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(set *optionSet) {
+		if registerer != nil {
+			set.registerer = registerer
+		}
+	}
+}
+
+// WithAlgorithm provide algorithm of adaptive concurrency limit, one of aimd and gradient.
+func WithAlgorithm(algorithm string) Option {
+	return func(set *optionSet) {
+		switch algorithm {
+		case "":
+		case AIMD, Gradient:
+			set.algorithm = algorithm
+		default:
+			rkentry.ShutdownWithError(fmt.Errorf("invalid algorithm of load shedding, %s", algorithm))
+		}
+	}
+}
+
+// WithInitialLimit provide initial concurrency limit, zero or negative value will be ignored.
+func WithInitialLimit(limit int) Option {
+	return func(set *optionSet) {
+		if limit > 0 {
+			set.initialLimit = limit
+		}
+	}
+}
+
+// WithMinLimit provide min concurrency limit, zero or negative value will be ignored.
+func WithMinLimit(limit int) Option {
+	return func(set *optionSet) {
+		if limit > 0 {
+			set.minLimit = limit
+		}
+	}
+}
+
+// WithMaxLimit provide max concurrency limit, zero or negative value will be ignored.
+func WithMaxLimit(limit int) Option {
+	return func(set *optionSet) {
+		if limit > 0 {
+			set.maxLimit = limit
+		}
+	}
+}
+
+// WithLatencyThreshold provide latency threshold of AIMD, limit decreases once latency exceeds it.
+// Zero or negative value will be ignored.
+func WithLatencyThreshold(threshold time.Duration) Option {
+	return func(set *optionSet) {
+		if threshold > 0 {
+			set.latencyThreshold = threshold
+		}
+	}
+}
+
+// WithPriorityHeader provide header of priority, value is one of critical, high, normal and low.
+// Header is not read if empty, which is the default.
+//
+// Header takes precedence over priority of path, so it should only be enabled if header is set by trusted gateway,
+// otherwise, any client could jump the shed order.
+func WithPriorityHeader(header string) Option {
+	return func(set *optionSet) {
+		set.priorityHeader = header
+	}
+}
+
+// WithPriorityByPath provide priority of path prefix, one of critical, high, normal and low.
+func WithPriorityByPath(path, priority string) Option {
+	return func(set *optionSet) {
+		priority = strings.ToLower(priority)
+		if _, ok := shares[priority]; !ok {
+			rkentry.ShutdownWithError(fmt.Errorf("invalid priority of load shedding, %s", priority))
+		}
+
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		set.priorityByPath[path] = priority
+	}
+}
+
+// WithPathToIgnore provide paths prefix that will ignore.
+func WithPathToIgnore(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.pathToIgnore = append(set.pathToIgnore, paths[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechoshed
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewOptionSet(t *testing.T) {
+	// without options
+	set := newOptionSet(WithRegisterer(prometheus.NewRegistry()))
+	assert.NotEmpty(t, set.GetEntryName())
+	assert.Equal(t, AIMD, set.algorithm)
+	assert.Equal(t, DefaultInitialLimit, set.limiter.getLimit())
+	assert.Empty(t, set.priorityHeader)
+	assert.IsType(t, &aimdAlgorithm{}, set.limiter.algorithm)
+	assert.False(t, set.ShouldIgnore("/ut-path"))
+
+	// with options
+	set = newOptionSet(
+		WithRegisterer(prometheus.NewRegistry()),
+		WithEntryNameAndType("ut-entry", "ut-type"),
+		WithAlgorithm(Gradient),
+		WithInitialLimit(10),
+		WithMinLimit(5),
+		WithMaxLimit(2),
+		WithLatencyThreshold(time.Millisecond),
+		WithPriorityHeader("X-ut-priority"),
+		WithPathToIgnore("/ut-ignore", ""))
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "ut-type", set.GetEntryType())
+	assert.IsType(t, &gradientAlgorithm{}, set.limiter.algorithm)
+	assert.Equal(t, 10, set.limiter.getLimit())
+	assert.Equal(t, 5, set.minLimit)
+	assert.Equal(t, 5, set.maxLimit)
+	assert.Equal(t, time.Millisecond, set.latencyThreshold)
+	assert.Equal(t, "X-ut-priority", set.priorityHeader)
+	assert.True(t, set.ShouldIgnore("/ut-ignore"))
+	assert.Len(t, set.pathToIgnore, 1)
+
+	// invalid algorithm and priority
+	assert.Panics(t, func() {
+		newOptionSet(WithRegisterer(prometheus.NewRegistry()), WithAlgorithm("ut-algorithm"))
+	})
+	assert.Panics(t, func() {
+		newOptionSet(WithRegisterer(prometheus.NewRegistry()), WithPriorityByPath("/ut-path", "ut-priority"))
+	})
+}
+
+func TestOptionSet_GetPriority(t *testing.T) {
+	set := newOptionSet(
+		WithRegisterer(prometheus.NewRegistry()),
+		WithPriorityHeader(HeaderPriority),
+		WithPriorityByPath("ut-path", PriorityLow),
+		WithPriorityByPath("/ut-path/critical", "CRITICAL"))
+
+	newCtx := func(path, priority string) echo.Context {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if len(priority) > 0 {
+			req.Header.Set(HeaderPriority, priority)
+		}
+		return echo.New().NewContext(req, httptest.NewRecorder())
+	}
+
+	// default priority
+	assert.Equal(t, PriorityNormal, set.getPriority(newCtx("/ut-other", "")))
+
+	// priority by path, the longest prefix wins
+	assert.Equal(t, PriorityLow, set.getPriority(newCtx("/ut-path", "")))
+	assert.Equal(t, PriorityCritical, set.getPriority(newCtx("/ut-path/critical/sub", "")))
+
+	// priority by header wins
+	assert.Equal(t, PriorityHigh, set.getPriority(newCtx("/ut-path", "High")))
+
+	// invalid header is ignored
+	assert.Equal(t, PriorityLow, set.getPriority(newCtx("/ut-path", "ut-priority")))
+
+	// header is not read unless configured
+	set = newOptionSet(
+		WithRegisterer(prometheus.NewRegistry()),
+		WithPriorityByPath("ut-path", PriorityLow))
+	assert.Equal(t, PriorityLow, set.getPriority(newCtx("/ut-path", PriorityCritical)))
+
+	// header is disabled by empty value
+	set = newOptionSet(
+		WithRegisterer(prometheus.NewRegistry()),
+		WithPriorityHeader(HeaderPriority),
+		WithPriorityHeader(""))
+	assert.Equal(t, PriorityNormal, set.getPriority(newCtx("/ut-other", PriorityCritical)))
+}
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{
+		Enabled:      false,
+		Algorithm:    Gradient,
+		InitialLimit: 10,
+	}
+
+	// with disabled
+	assert.Empty(t, ToOptions(config, "", "", nil))
+
+	// with enabled
+	config.Enabled = true
+	config.LatencyThresholdMs = 100
+	config.Paths = append(config.Paths, struct {
+		Path     string `yaml:"path" json:"path"`
+		Priority string `yaml:"priority" json:"priority"`
+	}{Path: "/ut-path", Priority: PriorityLow})
+
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type", prometheus.NewRegistry())...)
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, Gradient, set.algorithm)
+	assert.Equal(t, 10, set.limiter.getLimit())
+	assert.Equal(t, 100*time.Millisecond, set.latencyThreshold)
+	assert.Equal(t, PriorityLow, set.priorityByPath["/ut-path"])
+}
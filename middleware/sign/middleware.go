@@ -0,0 +1,64 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkechosign is a middleware for echo framework which verifies HMAC signature of requests
+package rkechosign
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/bodylimit"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"net/http"
+)
+
+// Middleware Add HMAC signature verification interceptors.
+//
+// Signature is verified with named secrets, then timestamp should be in range of max skew
+// and nonce should not be used before if replay protection is enabled.
+// Name of secret could be retrieved by rkechoctx.GetSignatureKeyId, it is inserted as principal
+// which could be retrieved by rkechoctx.GetAuthPrincipal only if request was not authenticated by others.
+//
+// Use Signer to sign requests at client side.
+func Middleware(opts ...Option) echo.MiddlewareFunc {
+	set := newOptionSet(opts...)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(rkmid.EntryNameKey.String(), set.GetEntryName())
+
+			if set.ShouldIgnore(ctx.Request().URL.Path) {
+				return next(ctx)
+			}
+
+			body, err := readBody(ctx.Request(), set.maxBodyBytes)
+			if errors.Is(err, errBodyTooLarge) || errors.Is(err, rkechobodylimit.ErrBodyTooLarge) {
+				resp := rkmid.GetErrorBuilder().New(http.StatusRequestEntityTooLarge, "Request body exceeds limit")
+				return ctx.JSON(resp.Code(), resp)
+			}
+			if err != nil {
+				resp := rkmid.GetErrorBuilder().New(http.StatusBadRequest, "Failed to read request body", err)
+				return ctx.JSON(resp.Code(), resp)
+			}
+
+			keyId, errResp := set.verify(ctx, body)
+			if errResp != nil {
+				rkechoctx.GetEvent(ctx).SetCounter("signatureRejected", 1)
+				return ctx.JSON(errResp.Code(), errResp)
+			}
+
+			ctx.Set(rkechoctx.SignatureKeyIdKey, keyId)
+			rkechoctx.GetEvent(ctx).AddPair("signatureKeyId", keyId)
+
+			// principal authenticated by auth or jwt middleware is kept
+			if len(rkechoctx.GetAuthPrincipal(ctx)) < 1 {
+				ctx.Set(rkechoctx.AuthPrincipalKey, keyId)
+			}
+
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosign
+
+import (
+	"encoding/hex"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/bodylimit"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSignServer(opts ...Option) *httptest.Server {
+	e := echo.New()
+	e.Use(Middleware(opts...))
+	handler := func(ctx echo.Context) error {
+		body, _ := io.ReadAll(ctx.Request().Body)
+		return ctx.String(http.StatusOK, rkechoctx.GetAuthPrincipal(ctx)+":"+string(body))
+	}
+	e.POST("/ut-path", handler)
+	e.POST("/ut-ignore", handler)
+
+	return httptest.NewServer(e)
+}
+
+func newSignedRequest(t *testing.T, signer *Signer, url, body string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	assert.Nil(t, err)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if signer != nil {
+		assert.Nil(t, signer.Sign(req))
+	}
+	return req
+}
+
+func doRequest(t *testing.T, req *http.Request) (int, string) {
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestMiddleware_KeepPrincipal(t *testing.T) {
+	e := echo.New()
+	// mock principal inserted by auth middleware
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(rkechoctx.AuthPrincipalKey, "ut-user")
+			return next(ctx)
+		}
+	})
+	e.Use(Middleware(WithSecret("partner-a", "secret-a")))
+	e.POST("/ut-path", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, rkechoctx.GetAuthPrincipal(ctx)+":"+rkechoctx.GetSignatureKeyId(ctx))
+	})
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	code, body := doRequest(t, newSignedRequest(t, NewSigner(SchemeBody, "partner-a", "secret-a"), server.URL+"/ut-path", ""))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ut-user:partner-a", body)
+}
+
+func TestMiddleware_BodyScheme(t *testing.T) {
+	server := newSignServer(
+		WithSecret("partner-a", "secret-a"),
+		WithSecret("partner-b", "secret-b"),
+		WithReplayProtection(NewMemoryNonceStore()),
+		WithPathToIgnore("/ut-ignore"))
+	defer server.Close()
+
+	// case 1: happy case, body is still readable by handler
+	code, body := doRequest(t, newSignedRequest(t, NewSigner("", "partner-b", "secret-b"), server.URL+"/ut-path", `{"k":"v"}`))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `partner-b:{"k":"v"}`, body)
+
+	// case 2: all secrets are tried without key id
+	req := newSignedRequest(t, NewSigner(SchemeBody, "partner-a", "secret-a"), server.URL+"/ut-path", "")
+	req.Header.Del(HeaderKeyId)
+	code, body = doRequest(t, req)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "partner-a:", body)
+
+	// case 3: replayed request
+	req = newSignedRequest(t, NewSigner(SchemeBody, "partner-a", "secret-a"), server.URL+"/ut-path", "ut-body")
+	code, _ = doRequest(t, req)
+	assert.Equal(t, http.StatusOK, code)
+	req.Body, _ = req.GetBody()
+	code, _ = doRequest(t, req)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// case 4: wrong secret and tampered body
+	code, _ = doRequest(t, newSignedRequest(t, NewSigner(SchemeBody, "partner-a", "secret-b"), server.URL+"/ut-path", "ut-body"))
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	req = newSignedRequest(t, NewSigner(SchemeBody, "partner-a", "secret-a"), server.URL+"/ut-path", "ut-body")
+	req.Body = io.NopCloser(strings.NewReader("ut-tampered"))
+	req.ContentLength = int64(len("ut-tampered"))
+	code, _ = doRequest(t, req)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// case 5: missing signature and nonce
+	code, _ = doRequest(t, newSignedRequest(t, nil, server.URL+"/ut-path", "ut-body"))
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	req = newSignedRequest(t, nil, server.URL+"/ut-path", "ut-body")
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, signaturePrefix+hex.EncodeToString(bodySignature([]byte("secret-a"), timestamp, "", []byte("ut-body"))))
+	code, _ = doRequest(t, req)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// case 6: expired timestamp
+	req = newSignedRequest(t, nil, server.URL+"/ut-path", "ut-body")
+	timestamp = strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, "ut-nonce")
+	req.Header.Set(HeaderSignature, signaturePrefix+hex.EncodeToString(bodySignature([]byte("secret-a"), timestamp, "ut-nonce", []byte("ut-body"))))
+	code, _ = doRequest(t, req)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// case 7: ignored path
+	code, _ = doRequest(t, newSignedRequest(t, nil, server.URL+"/ut-ignore", "ut-body"))
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestMiddleware_BodyTooLarge(t *testing.T) {
+	server := newSignServer(WithSecret("partner-a", "secret-a"), WithMaxBodyBytes(8))
+	defer server.Close()
+	signer := NewSigner(SchemeBody, "partner-a", "secret-a")
+
+	// body within limit
+	code, body := doRequest(t, newSignedRequest(t, signer, server.URL+"/ut-path", "ut-body"))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "partner-a:ut-body", body)
+
+	// body exceeds limit before verification
+	code, _ = doRequest(t, newSignedRequest(t, nil, server.URL+"/ut-path", "ut-large-body"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+
+	// body exceeds limit of bodylimit middleware
+	e := echo.New()
+	e.Use(rkechobodylimit.Middleware(rkechobodylimit.WithMaxBytes(8)))
+	e.Use(Middleware(WithSecret("partner-a", "secret-a")))
+	e.POST("/ut-path", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "")
+	})
+	req := httptest.NewRequest(http.MethodPost, "/ut-path", strings.NewReader("ut-large-body"))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestMiddleware_CanonicalScheme(t *testing.T) {
+	server := newSignServer(
+		WithScheme(SchemeCanonical),
+		WithSecret("partner-a", "secret-a"),
+		WithReplayProtection(NewMemoryNonceStore()))
+	defer server.Close()
+
+	signer := NewSigner(SchemeCanonical, "partner-a", "secret-a")
+
+	// case 1: happy case
+	code, body := doRequest(t, newSignedRequest(t, signer, server.URL+"/ut-path?b=2&a=1", `{"k":"v"}`))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `partner-a:{"k":"v"}`, body)
+
+	// case 2: tampered query
+	req := newSignedRequest(t, signer, server.URL+"/ut-path?b=2&a=1", "")
+	req.URL.RawQuery = "b=3&a=1"
+	code, _ = doRequest(t, req)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// case 3: unknown key id
+	code, _ = doRequest(t, newSignedRequest(t, NewSigner(SchemeCanonical, "partner-b", "secret-a"), server.URL+"/ut-path", ""))
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// case 4: nonce is not signed
+	req = newSignedRequest(t, nil, server.URL+"/ut-path", "")
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(time.Now().Unix(), 10))
+	assert.Nil(t, signer.Sign(req))
+	req.Header.Set(echo.HeaderAuthorization, strings.Replace(req.Header.Get(echo.HeaderAuthorization), ";x-signature-nonce", "", 1))
+	code, _ = doRequest(t, req)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// case 5: missing and malformed authorization
+	code, _ = doRequest(t, newSignedRequest(t, nil, server.URL+"/ut-path", ""))
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	req = newSignedRequest(t, nil, server.URL+"/ut-path", "")
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	code, _ = doRequest(t, req)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestSigner_Sign(t *testing.T) {
+	// invalid scheme
+	req := httptest.NewRequest(http.MethodGet, "/ut-path", nil)
+	assert.NotNil(t, NewSigner("ut-scheme", "ut-key", "ut-secret").Sign(req))
+
+	// without body
+	req = httptest.NewRequest(http.MethodGet, "/ut-path", nil)
+	assert.Nil(t, NewSigner(SchemeBody, "ut-key", "ut-secret").Sign(req))
+	assert.Equal(t, "ut-key", req.Header.Get(HeaderKeyId))
+	assert.True(t, strings.HasPrefix(req.Header.Get(HeaderSignature), signaturePrefix))
+	assert.NotEmpty(t, req.Header.Get(HeaderTimestamp))
+	assert.NotEmpty(t, req.Header.Get(HeaderNonce))
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
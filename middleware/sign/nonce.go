@@ -0,0 +1,59 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosign
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NonceStore keeps nonce of signed requests in order to reject replayed requests,
+// it could be shared by all instances, like the one backed by redis.
+type NonceStore interface {
+	// Add stores nonce for ttl, false will be returned if nonce exists already
+	Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// ***************** Memory NonceStore *****************
+
+// memoryNonceStore is a NonceStore keeps nonce in memory of current instance
+type memoryNonceStore struct {
+	nonces    map[string]time.Time
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// NewMemoryNonceStore creates NonceStore which keeps nonce in memory of current instance
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{
+		nonces:    make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// Add stores nonce until ttl passed, false will be returned if nonce exists and not expired yet
+func (s *memoryNonceStore) Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= time.Minute {
+		s.lastSweep = now
+		for k, v := range s.nonces {
+			if !now.Before(v) {
+				delete(s.nonces, k)
+			}
+		}
+	}
+
+	if expiresAt, ok := s.nonces[nonce]; ok && now.Before(expiresAt) {
+		return false, nil
+	}
+
+	s.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosign
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryNonceStore(t *testing.T) {
+	store := NewMemoryNonceStore()
+	ctx := context.Background()
+
+	added, err := store.Add(ctx, "ut-nonce", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, added)
+
+	// replayed
+	added, _ = store.Add(ctx, "ut-nonce", time.Minute)
+	assert.False(t, added)
+
+	// expired nonce could be added again
+	added, _ = store.Add(ctx, "ut-expired", -time.Second)
+	assert.True(t, added)
+	added, _ = store.Add(ctx, "ut-expired", time.Minute)
+	assert.True(t, added)
+
+	// sweep expired nonce
+	s := store.(*memoryNonceStore)
+	s.nonces["ut-swept"] = time.Now().Add(-time.Second)
+	s.lastSweep = time.Now().Add(-time.Hour)
+	store.Add(ctx, "ut-new", time.Minute)
+	assert.Len(t, s.nonces, 3)
+	assert.NotContains(t, s.nonces, "ut-swept")
+}
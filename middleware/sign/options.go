@@ -0,0 +1,337 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosign
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/error"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxSkew is default max difference between timestamp of request and server time
+	DefaultMaxSkew = 5 * time.Minute
+	// DefaultMaxBodyBytes is default limit of request body read for verification, 4MB
+	DefaultMaxBodyBytes int64 = 4 << 20
+)
+
+var (
+	errSignatureMissing = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Missing signature")
+	errSignatureInvalid = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Invalid signature")
+	errTimestampInvalid = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Missing or expired signature timestamp")
+	errNonceInvalid     = rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Missing or replayed signature nonce")
+)
+
+// ***************** OptionSet Implementation *****************
+
+// optionSet which is used for middleware implementation
+type optionSet struct {
+	entryName    string
+	entryType    string
+	pathToIgnore []string
+	scheme       string
+	secrets      map[string][]byte
+	// names of secrets in order they were provided, used if key id is missing in body scheme
+	secretNames []string
+	maxSkew     time.Duration
+	nonceStore  NonceStore
+	// request body is read before verification, so it is limited even if caller is not authenticated
+	maxBodyBytes int64
+}
+
+// Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:    "fake-entry",
+		entryType:    "",
+		pathToIgnore: []string{},
+		scheme:       SchemeBody,
+		secrets:      make(map[string][]byte),
+		secretNames:  []string{},
+		maxSkew:      DefaultMaxSkew,
+		maxBodyBytes: DefaultMaxBodyBytes,
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	return set
+}
+
+// GetEntryName returns entry name
+func (set *optionSet) GetEntryName() string {
+	return set.entryName
+}
+
+// GetEntryType returns entry type
+func (set *optionSet) GetEntryType() string {
+	return set.entryType
+}
+
+// ShouldIgnore determine whether signature verification should be ignored based on path
+func (set *optionSet) ShouldIgnore(path string) bool {
+	for i := range set.pathToIgnore {
+		if strings.HasPrefix(path, set.pathToIgnore[i]) {
+			return true
+		}
+	}
+
+	return rkmid.ShouldIgnoreGlobal(path)
+}
+
+// verify returns name of secret which signed request, error response will be returned if failed
+func (set *optionSet) verify(ctx echo.Context, body []byte) (string, rkerror.ErrorInterface) {
+	req := ctx.Request()
+
+	var keyId string
+	switch set.scheme {
+	case SchemeCanonical:
+		header := req.Header.Get(echo.HeaderAuthorization)
+		if len(header) < 1 {
+			return "", errSignatureMissing
+		}
+
+		auth, err := parseAuthorization(header)
+		if err != nil {
+			return "", rkmid.GetErrorBuilder().New(http.StatusUnauthorized, "Invalid signature, "+err.Error())
+		}
+
+		// timestamp and nonce should be signed
+		if !containsHeader(auth.signedHeaders, HeaderTimestamp) ||
+			(set.nonceStore != nil && !containsHeader(auth.signedHeaders, HeaderNonce)) {
+			return "", errSignatureInvalid
+		}
+
+		secret, ok := set.secrets[auth.keyId]
+		if !ok {
+			return "", errSignatureInvalid
+		}
+
+		expected := canonicalSignature(secret, req, req.Header.Get(HeaderTimestamp), auth.signedHeaders, body)
+		if !hmac.Equal(expected, auth.signature) {
+			return "", errSignatureInvalid
+		}
+		keyId = auth.keyId
+	default:
+		header := req.Header.Get(HeaderSignature)
+		if len(header) < 1 {
+			return "", errSignatureMissing
+		}
+
+		signature, err := hex.DecodeString(strings.TrimPrefix(header, signaturePrefix))
+		if err != nil || !strings.HasPrefix(header, signaturePrefix) {
+			return "", errSignatureInvalid
+		}
+
+		nonce := req.Header.Get(HeaderNonce)
+		if strings.Contains(nonce, ".") {
+			return "", errNonceInvalid
+		}
+
+		// all secrets are tried if key id is missing
+		names := set.secretNames
+		if id := req.Header.Get(HeaderKeyId); len(id) > 0 {
+			names = []string{id}
+		}
+
+		for _, name := range names {
+			secret, ok := set.secrets[name]
+			if ok && hmac.Equal(bodySignature(secret, req.Header.Get(HeaderTimestamp), nonce, body), signature) {
+				keyId = name
+				break
+			}
+		}
+
+		if len(keyId) < 1 {
+			return "", errSignatureInvalid
+		}
+	}
+
+	// signature is valid, then check timestamp and nonce which are covered by signature
+	if errResp := set.checkTimestamp(req.Header.Get(HeaderTimestamp)); errResp != nil {
+		return "", errResp
+	}
+
+	if errResp := set.checkNonce(ctx, keyId, req.Header.Get(HeaderNonce)); errResp != nil {
+		return "", errResp
+	}
+
+	return keyId, nil
+}
+
+// checkTimestamp returns error if timestamp is missing or out of max skew
+func (set *optionSet) checkTimestamp(timestamp string) rkerror.ErrorInterface {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errTimestampInvalid
+	}
+
+	skew := time.Since(time.Unix(unix, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+
+	if skew > set.maxSkew {
+		return errTimestampInvalid
+	}
+
+	return nil
+}
+
+// checkNonce returns error if nonce is missing or was used by the same key,
+// nonce is kept for twice of max skew which covers all timestamps accepted.
+func (set *optionSet) checkNonce(ctx echo.Context, keyId, nonce string) rkerror.ErrorInterface {
+	if set.nonceStore == nil {
+		return nil
+	}
+
+	if len(nonce) < 1 {
+		return errNonceInvalid
+	}
+
+	added, err := set.nonceStore.Add(ctx.Request().Context(), keyId+":"+nonce, 2*set.maxSkew)
+	if err != nil {
+		return rkmid.GetErrorBuilder().New(http.StatusServiceUnavailable, "Failed to check signature nonce")
+	}
+
+	if !added {
+		return errNonceInvalid
+	}
+
+	return nil
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML
+type BootConfig struct {
+	Enabled bool     `yaml:"enabled" json:"enabled"`
+	Ignore  []string `yaml:"ignore" json:"ignore"`
+	Scheme  string   `yaml:"scheme" json:"scheme"`
+	Secrets []struct {
+		Name   string `yaml:"name" json:"name"`
+		Secret string `yaml:"secret" json:"-"`
+	} `yaml:"secrets" json:"secrets"`
+	MaxSkewMs        int   `yaml:"maxSkewMs" json:"maxSkewMs"`
+	ReplayProtection bool  `yaml:"replayProtection" json:"replayProtection"`
+	MaxBodyBytes     int64 `yaml:"maxBodyBytes" json:"maxBodyBytes"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		if len(config.Secrets) < 1 {
+			rkentry.ShutdownWithError(errors.New("at least one secret of sign middleware should be provided"))
+		}
+
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithScheme(config.Scheme),
+			WithMaxSkew(time.Duration(config.MaxSkewMs)*time.Millisecond),
+			WithMaxBodyBytes(config.MaxBodyBytes),
+			WithPathToIgnore(config.Ignore...))
+
+		for i := range config.Secrets {
+			opts = append(opts, WithSecret(config.Secrets[i].Name, config.Secrets[i].Secret))
+		}
+
+		if config.ReplayProtection {
+			opts = append(opts, WithReplayProtection(NewMemoryNonceStore()))
+		}
+	}
+
+	return opts
+}
+
+// ***************** Option *****************
+
+// Option if for middleware options while creating middleware
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithPathToIgnore provide paths prefix that will ignore signature verification.
+func WithPathToIgnore(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.pathToIgnore = append(set.pathToIgnore, paths[i])
+			}
+		}
+	}
+}
+
+// WithScheme provide signature scheme, one of body and canonical, body scheme will be used if empty.
+func WithScheme(scheme string) Option {
+	return func(set *optionSet) {
+		switch scheme {
+		case "":
+		case SchemeBody, SchemeCanonical:
+			set.scheme = scheme
+		default:
+			rkentry.ShutdownWithError(fmt.Errorf("invalid signature scheme %s, expect one of body and canonical", scheme))
+		}
+	}
+}
+
+// WithSecret provide named secret, name is key id sent by client.
+func WithSecret(name, secret string) Option {
+	return func(set *optionSet) {
+		if len(name) < 1 || len(secret) < 1 {
+			rkentry.ShutdownWithError(errors.New("name and secret of signature secret should not be empty"))
+		}
+
+		if _, ok := set.secrets[name]; !ok {
+			set.secretNames = append(set.secretNames, name)
+		}
+		set.secrets[name] = []byte(secret)
+	}
+}
+
+// WithMaxSkew provide max difference between timestamp of request and server time.
+// Zero or negative value will be ignored.
+func WithMaxSkew(skew time.Duration) Option {
+	return func(set *optionSet) {
+		if skew > 0 {
+			set.maxSkew = skew
+		}
+	}
+}
+
+// WithMaxBodyBytes provide limit of request body read for verification in bytes,
+// 413 will be returned to client once exceeded. Zero or negative value will be ignored.
+func WithMaxBodyBytes(maxBytes int64) Option {
+	return func(set *optionSet) {
+		if maxBytes > 0 {
+			set.maxBodyBytes = maxBytes
+		}
+	}
+}
+
+// WithReplayProtection provide NonceStore, requests without nonce or with used nonce will be rejected.
+func WithReplayProtection(store NonceStore) Option {
+	return func(set *optionSet) {
+		set.nonceStore = store
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosign
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewOptionSet(t *testing.T) {
+	// without options
+	set := newOptionSet()
+	assert.Equal(t, SchemeBody, set.scheme)
+	assert.Equal(t, DefaultMaxSkew, set.maxSkew)
+	assert.Equal(t, DefaultMaxBodyBytes, set.maxBodyBytes)
+	assert.Nil(t, set.nonceStore)
+	assert.Empty(t, set.secrets)
+
+	// with options
+	set = newOptionSet(
+		WithEntryNameAndType("ut-entry", "ut-type"),
+		WithScheme(SchemeCanonical),
+		WithSecret("ut-key", "ut-secret"),
+		WithSecret("ut-key", "ut-new-secret"),
+		WithMaxSkew(time.Second),
+		WithMaxBodyBytes(1024),
+		WithReplayProtection(NewMemoryNonceStore()),
+		WithPathToIgnore("", "/ut-ignore"))
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, "ut-type", set.GetEntryType())
+	assert.Equal(t, SchemeCanonical, set.scheme)
+	assert.Equal(t, []byte("ut-new-secret"), set.secrets["ut-key"])
+	assert.Equal(t, []string{"ut-key"}, set.secretNames)
+	assert.Equal(t, time.Second, set.maxSkew)
+	assert.Equal(t, int64(1024), set.maxBodyBytes)
+	assert.NotNil(t, set.nonceStore)
+	assert.True(t, set.ShouldIgnore("/ut-ignore"))
+	assert.False(t, set.ShouldIgnore("/ut-path"))
+
+	// with invalid scheme and secret
+	assert.Panics(t, func() {
+		newOptionSet(WithScheme("ut-scheme"))
+	})
+	assert.Panics(t, func() {
+		newOptionSet(WithSecret("", "ut-secret"))
+	})
+}
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{
+		Enabled: false,
+	}
+
+	// with disabled
+	assert.Empty(t, ToOptions(config, "", ""))
+
+	// with enabled but without secrets
+	config.Enabled = true
+	assert.Panics(t, func() {
+		ToOptions(config, "", "")
+	})
+
+	// with enabled
+	config.Scheme = SchemeCanonical
+	config.MaxSkewMs = 1000
+	config.ReplayProtection = true
+	config.MaxBodyBytes = 1024
+	config.Secrets = append(config.Secrets, struct {
+		Name   string `yaml:"name" json:"name"`
+		Secret string `yaml:"secret" json:"-"`
+	}{Name: "ut-key", Secret: "ut-secret"})
+
+	set := newOptionSet(ToOptions(config, "ut-entry", "ut-type")...)
+	assert.Equal(t, "ut-entry", set.GetEntryName())
+	assert.Equal(t, SchemeCanonical, set.scheme)
+	assert.Equal(t, time.Second, set.maxSkew)
+	assert.Equal(t, int64(1024), set.maxBodyBytes)
+	assert.NotNil(t, set.nonceStore)
+	assert.Equal(t, []byte("ut-secret"), set.secrets["ut-key"])
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	// SchemeBody signs timestamp, nonce and body with signature in X-Signature header, like GitHub and Stripe webhooks.
+	//
+	// Signed content is <timestamp>.<nonce>.<body> where nonce could be empty,
+	// header value is sha256=<hex of HMAC-SHA256 of signed content>.
+	SchemeBody = "body"
+	// SchemeCanonical signs canonical request with signature in Authorization header, like AWS SigV4.
+	//
+	// Authorization: HMAC-SHA256 Credential=<key id>, SignedHeaders=<headers>, Signature=<hex of HMAC-SHA256 of string to sign>
+	SchemeCanonical = "canonical"
+
+	// HeaderSignature is header of signature in body scheme
+	HeaderSignature = "X-Signature"
+	// HeaderTimestamp is header of unix timestamp in seconds when request was signed
+	HeaderTimestamp = "X-Signature-Timestamp"
+	// HeaderNonce is header of random nonce which is unique for each request
+	HeaderNonce = "X-Signature-Nonce"
+	// HeaderKeyId is header of secret name in body scheme, all secrets will be tried if missing
+	HeaderKeyId = "X-Signature-Key-Id"
+
+	// AlgorithmHmacSha256 is algorithm in Authorization header of canonical scheme
+	AlgorithmHmacSha256 = "HMAC-SHA256"
+
+	signaturePrefix = "sha256="
+)
+
+// hmacSha256 returns HMAC-SHA256 of content
+func hmacSha256(secret []byte, content ...[]byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	for i := range content {
+		mac.Write(content[i])
+	}
+	return mac.Sum(nil)
+}
+
+// bodySignature returns signature of body scheme without sha256= prefix
+func bodySignature(secret []byte, timestamp, nonce string, body []byte) []byte {
+	return hmacSha256(secret, []byte(timestamp+"."+nonce+"."), body)
+}
+
+// canonicalRequest builds canonical request from method, path, query, signed headers and hash of body
+func canonicalRequest(req *http.Request, signedHeaders []string, body []byte) string {
+	headers := make([]string, 0, len(signedHeaders))
+	for _, name := range signedHeaders {
+		var value string
+		if name == "host" {
+			value = req.Host
+		} else {
+			value = strings.Join(req.Header.Values(name), ",")
+		}
+		headers = append(headers, name+":"+strings.TrimSpace(value)+"\n")
+	}
+
+	bodyHash := sha256.Sum256(body)
+
+	return strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		strings.Join(headers, ""),
+		strings.Join(signedHeaders, ";"),
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+// canonicalSignature returns signature of canonical scheme
+func canonicalSignature(secret []byte, req *http.Request, timestamp string, signedHeaders []string, body []byte) []byte {
+	canonical := sha256.Sum256([]byte(canonicalRequest(req, signedHeaders, body)))
+	stringToSign := strings.Join([]string{AlgorithmHmacSha256, timestamp, hex.EncodeToString(canonical[:])}, "\n")
+
+	return hmacSha256(secret, []byte(stringToSign))
+}
+
+// authorization is parsed Authorization header of canonical scheme
+type authorization struct {
+	keyId         string
+	signedHeaders []string
+	signature     []byte
+}
+
+// parseAuthorization parses Authorization header of canonical scheme
+func parseAuthorization(header string) (*authorization, error) {
+	tokens := strings.SplitN(header, " ", 2)
+	if len(tokens) != 2 || tokens[0] != AlgorithmHmacSha256 {
+		return nil, fmt.Errorf("expect %s authorization", AlgorithmHmacSha256)
+	}
+
+	res := &authorization{}
+	for _, part := range strings.Split(tokens[1], ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("invalid authorization")
+		}
+
+		switch kv[0] {
+		case "Credential":
+			res.keyId = kv[1]
+		case "SignedHeaders":
+			res.signedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			signature, err := hex.DecodeString(kv[1])
+			if err != nil {
+				return nil, errors.New("invalid signature")
+			}
+			res.signature = signature
+		}
+	}
+
+	if len(res.keyId) < 1 || len(res.signedHeaders) < 1 || len(res.signature) < 1 {
+		return nil, errors.New("missing credential, signed headers or signature")
+	}
+
+	if !sort.StringsAreSorted(res.signedHeaders) {
+		return nil, errors.New("signed headers should be sorted")
+	}
+
+	return res, nil
+}
+
+// signedHeadersOf returns lower case names of headers signed by canonical scheme, sorted
+func signedHeadersOf(req *http.Request) []string {
+	res := []string{"host"}
+	for _, name := range []string{HeaderTimestamp, HeaderNonce, "Content-Type"} {
+		if len(req.Header.Get(name)) > 0 {
+			res = append(res, strings.ToLower(name))
+		}
+	}
+
+	sort.Strings(res)
+	return res
+}
+
+// containsHeader returns true if header is in list of signed headers
+func containsHeader(signedHeaders []string, name string) bool {
+	name = strings.ToLower(name)
+	for i := range signedHeaders {
+		if signedHeaders[i] == name {
+			return true
+		}
+	}
+
+	return false
+}
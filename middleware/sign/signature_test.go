@@ -0,0 +1,51 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosign
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanonicalRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/ut%20path?b=2&a=1&a=0", nil)
+	req.Header.Set(HeaderTimestamp, "1700000000")
+	req.Header.Set("Content-Type", "application/json")
+
+	signedHeaders := signedHeadersOf(req)
+	assert.Equal(t, []string{"content-type", "host", "x-signature-timestamp"}, signedHeaders)
+
+	assert.Equal(t, "POST\n"+
+		"/ut%20path\n"+
+		"a=1&a=0&b=2\n"+
+		"content-type:application/json\nhost:example.com\nx-signature-timestamp:1700000000\n\n"+
+		"content-type;host;x-signature-timestamp\n"+
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		canonicalRequest(req, signedHeaders, []byte{}))
+}
+
+func TestParseAuthorization(t *testing.T) {
+	// happy case
+	auth, err := parseAuthorization("HMAC-SHA256 Credential=ut-key, SignedHeaders=host;x-signature-timestamp, Signature=abcd")
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-key", auth.keyId)
+	assert.Equal(t, []string{"host", "x-signature-timestamp"}, auth.signedHeaders)
+	assert.Equal(t, []byte{0xab, 0xcd}, auth.signature)
+
+	// invalid cases
+	for _, header := range []string{
+		"Bearer token",
+		"HMAC-SHA256 Credential",
+		"HMAC-SHA256 Credential=ut-key, SignedHeaders=host, Signature=xyz",
+		"HMAC-SHA256 Credential=ut-key, Signature=abcd",
+		"HMAC-SHA256 Credential=ut-key, SignedHeaders=x-signature-timestamp;host, Signature=abcd",
+	} {
+		_, err = parseAuthorization(header)
+		assert.NotNil(t, err, header)
+	}
+}
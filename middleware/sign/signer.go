@@ -0,0 +1,117 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechosign
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signer signs outgoing requests with named secret, it is the client side of Middleware.
+//
+// Example:
+//
+//	signer := rkechosign.NewSigner(rkechosign.SchemeBody, "partner-a", "my-secret")
+//	req, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/webhook", body)
+//	signer.Sign(req)
+type Signer struct {
+	scheme string
+	keyId  string
+	secret []byte
+}
+
+// NewSigner creates Signer with scheme, key id and secret, body scheme will be used if scheme is empty.
+func NewSigner(scheme, keyId, secret string) *Signer {
+	if len(scheme) < 1 {
+		scheme = SchemeBody
+	}
+
+	return &Signer{
+		scheme: scheme,
+		keyId:  keyId,
+		secret: []byte(secret),
+	}
+}
+
+// Sign adds timestamp, nonce and signature headers into request, body of request is read and restored.
+func (s *Signer) Sign(req *http.Request) error {
+	body, err := readBody(req, 0)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, hex.EncodeToString(nonce))
+
+	switch s.scheme {
+	case SchemeBody:
+		req.Header.Set(HeaderKeyId, s.keyId)
+		signature := bodySignature(s.secret, timestamp, req.Header.Get(HeaderNonce), body)
+		req.Header.Set(HeaderSignature, signaturePrefix+hex.EncodeToString(signature))
+	case SchemeCanonical:
+		if len(req.Host) < 1 && req.URL != nil {
+			req.Host = req.URL.Host
+		}
+
+		signedHeaders := signedHeadersOf(req)
+		signature := canonicalSignature(s.secret, req, timestamp, signedHeaders, body)
+		req.Header.Set(echo.HeaderAuthorization, fmt.Sprintf("%s Credential=%s, SignedHeaders=%s, Signature=%s",
+			AlgorithmHmacSha256, s.keyId, strings.Join(signedHeaders, ";"), hex.EncodeToString(signature)))
+	default:
+		return fmt.Errorf("invalid signature scheme %s", s.scheme)
+	}
+
+	return nil
+}
+
+// errBodyTooLarge returned by readBody once request body exceeds limit
+var errBodyTooLarge = errors.New("request body too large")
+
+// readBody reads body of request and restore it, so that it could be read again.
+//
+// errBodyTooLarge will be returned if body is larger than maxBytes, zero or negative value means no limit.
+func readBody(req *http.Request, maxBytes int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return []byte{}, nil
+	}
+
+	var reader io.Reader = req.Body
+	if maxBytes > 0 {
+		reader = io.LimitReader(req.Body, maxBytes+1)
+	}
+
+	body, err := io.ReadAll(reader)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if maxBytes > 0 && int64(len(body)) > maxBytes {
+		return nil, errBodyTooLarge
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return body, nil
+}
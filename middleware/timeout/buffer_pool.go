@@ -26,7 +26,12 @@ func (p *bufferPool) Get() *bytes.Buffer {
 	return buf.(*bytes.Buffer)
 }
 
-// Put a bytes.Buffer pointer to BufferPool
+// Put a bytes.Buffer pointer to BufferPool, buffer will be reset
 func (p *bufferPool) Put(buf *bytes.Buffer) {
+	if buf == nil {
+		return
+	}
+
+	buf.Reset()
 	p.pool.Put(buf)
 }
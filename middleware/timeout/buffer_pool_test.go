@@ -20,3 +20,16 @@ func TestGetBuffer(t *testing.T) {
 	buf2 := pool.Get()
 	assert.NotEqual(t, nil, buf2)
 }
+
+func TestPutBuffer(t *testing.T) {
+	pool := &bufferPool{}
+
+	// nil buffer
+	pool.Put(nil)
+
+	// buffer will be reset
+	buf := pool.Get()
+	buf.WriteString("ut-message")
+	pool.Put(buf)
+	assert.Zero(t, buf.Len())
+}
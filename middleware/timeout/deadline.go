@@ -0,0 +1,83 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechotimeout
+
+import (
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultDeadlineHeaders headers which carry remaining deadline of client
+var defaultDeadlineHeaders = []string{
+	rkechoctx.HeaderXRequestTimeout,
+	rkechoctx.HeaderGrpcTimeout,
+	rkechoctx.HeaderRequestTimeout,
+}
+
+// grpcTimeoutUnits units of grpc-timeout header
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseDeadlineHeader parses remaining deadline from header value.
+//
+// Value of grpc-timeout is in format of gRPC over HTTP2, like 100m.
+// Other headers accept a duration like 1500ms or a decimal number of seconds like 1.5.
+func parseDeadlineHeader(key, value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 1 {
+		return 0, false
+	}
+
+	if http.CanonicalHeaderKey(key) == http.CanonicalHeaderKey(rkechoctx.HeaderGrpcTimeout) {
+		return parseGrpcTimeout(value)
+	}
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 || seconds > float64(1<<63-1)/float64(time.Second) {
+			return 0, false
+		}
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return d, true
+	}
+
+	return 0, false
+}
+
+// parseGrpcTimeout parses value of grpc-timeout header, at most 8 digits followed by unit
+func parseGrpcTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+
+	d, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || d < 0 {
+		return 0, false
+	}
+
+	// avoid overflow of hours
+	if unit == time.Hour && d > int64(1<<63-1)/int64(time.Hour) {
+		return 0, false
+	}
+
+	return time.Duration(d) * unit, true
+}
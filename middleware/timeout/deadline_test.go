@@ -0,0 +1,47 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechotimeout
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseDeadlineHeader(t *testing.T) {
+	cases := []struct {
+		key      string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"X-Request-Timeout", "", 0, false},
+		{"X-Request-Timeout", "1500ms", 1500 * time.Millisecond, true},
+		{"X-Request-Timeout", "2", 2 * time.Second, true},
+		{"X-Request-Timeout", " 0.5 ", 500 * time.Millisecond, true},
+		{"X-Request-Timeout", "0", 0, true},
+		{"X-Request-Timeout", "-1", 0, false},
+		{"X-Request-Timeout", "-1s", 0, false},
+		{"X-Request-Timeout", "1e300", 0, false},
+		{"Request-Timeout", "invalid", 0, false},
+		{"grpc-timeout", "100m", 100 * time.Millisecond, true},
+		{"Grpc-Timeout", "3S", 3 * time.Second, true},
+		{"grpc-timeout", "2H", 2 * time.Hour, true},
+		{"grpc-timeout", "5u", 5 * time.Microsecond, true},
+		{"grpc-timeout", "0n", 0, true},
+		{"grpc-timeout", "100", 0, false},
+		{"grpc-timeout", "m", 0, false},
+		{"grpc-timeout", "123456789m", 0, false},
+		{"grpc-timeout", "1.5S", 0, false},
+		{"grpc-timeout", "99999999H", 0, false},
+	}
+
+	for _, c := range cases {
+		res, ok := parseDeadlineHeader(c.key, c.value)
+		assert.Equal(t, c.ok, ok, c.key+": "+c.value)
+		assert.Equal(t, c.expected, res, c.key+": "+c.value)
+	}
+}
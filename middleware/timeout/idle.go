@@ -0,0 +1,151 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechotimeout
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// writeDeadliner is implemented by http.ResponseWriter of net/http since go 1.20
+type writeDeadliner interface {
+	SetWriteDeadline(time.Time) error
+}
+
+// idleWatcher enforces idle and first-byte deadline of streaming response.
+//
+// Timer will be reset on each read or write, once expired, deadline of underlying connection
+// will be set to now so that blocked and further reads and writes fail.
+type idleWatcher struct {
+	rw       http.ResponseWriter
+	conn     net.Conn
+	timeout  time.Duration
+	timer    *time.Timer
+	onExpire func()
+	expired  bool
+	stopped  bool
+	mu       sync.Mutex
+}
+
+// newIdleWatcher creates and arms watcher, onExpire will be called once expired.
+func newIdleWatcher(rw http.ResponseWriter, timeout time.Duration, onExpire func()) *idleWatcher {
+	w := &idleWatcher{
+		rw:       rw,
+		timeout:  timeout,
+		onExpire: onExpire,
+	}
+	w.timer = time.AfterFunc(timeout, w.expire)
+
+	return w
+}
+
+// touch resets idle timer
+func (w *idleWatcher) touch() {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.expired && !w.stopped {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+// stop stops idle timer
+func (w *idleWatcher) stop() {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stopped = true
+	w.timer.Stop()
+}
+
+// Expired returns true if idle deadline exceeded
+func (w *idleWatcher) Expired() bool {
+	if w == nil {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.expired
+}
+
+// wrapConn returns connection which resets idle timer on each read and write
+func (w *idleWatcher) wrapConn(conn net.Conn) net.Conn {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.conn = conn
+	return &idleConn{Conn: conn, watcher: w}
+}
+
+// expire sets deadline of underlying connection to now and calls onExpire
+func (w *idleWatcher) expire() {
+	w.mu.Lock()
+	if w.expired || w.stopped {
+		w.mu.Unlock()
+		return
+	}
+	w.expired = true
+
+	now := time.Now()
+	if w.conn != nil {
+		w.conn.SetDeadline(now)
+	} else if deadliner := findWriteDeadliner(w.rw); deadliner != nil {
+		deadliner.SetWriteDeadline(now)
+	}
+	w.mu.Unlock()
+
+	// call it without lock since writer may be blocked
+	if w.onExpire != nil {
+		w.onExpire()
+	}
+}
+
+// findWriteDeadliner unwraps http.ResponseWriter until writeDeadliner found
+func findWriteDeadliner(rw http.ResponseWriter) writeDeadliner {
+	for rw != nil {
+		if res, ok := rw.(writeDeadliner); ok {
+			return res
+		}
+
+		unwrapper, ok := rw.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		rw = unwrapper.Unwrap()
+	}
+
+	return nil
+}
+
+// idleConn resets idle timer on each read and write
+type idleConn struct {
+	net.Conn
+	watcher *idleWatcher
+}
+
+// Read reads from connection and resets idle timer
+func (c *idleConn) Read(b []byte) (int, error) {
+	c.watcher.touch()
+	return c.Conn.Read(b)
+}
+
+// Write writes into connection and resets idle timer
+func (c *idleConn) Write(b []byte) (int, error) {
+	c.watcher.touch()
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechotimeout
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIdleWatcher(t *testing.T) {
+	// nil watcher
+	var watcher *idleWatcher
+	watcher.touch()
+	watcher.stop()
+	assert.False(t, watcher.Expired())
+
+	// expired
+	expired := make(chan struct{})
+	watcher = newIdleWatcher(httptest.NewRecorder(), 10*time.Millisecond, func() {
+		close(expired)
+	})
+	<-expired
+	assert.True(t, watcher.Expired())
+
+	// touch and stop
+	watcher = newIdleWatcher(httptest.NewRecorder(), 50*time.Millisecond, nil)
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		watcher.touch()
+	}
+	assert.False(t, watcher.Expired())
+	watcher.stop()
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, watcher.Expired())
+}
+
+func TestIdleConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	watcher := newIdleWatcher(httptest.NewRecorder(), 50*time.Millisecond, nil)
+	conn := watcher.wrapConn(server)
+
+	// read within deadline
+	go client.Write([]byte("ut"))
+	buf := make([]byte, 2)
+	_, err := conn.Read(buf)
+	assert.Nil(t, err)
+
+	// blocked read will be aborted once expired
+	_, err = conn.Read(buf)
+	assert.NotNil(t, err)
+	assert.True(t, watcher.Expired())
+}
@@ -13,22 +13,70 @@ import (
 	"github.com/rookie-ninja/rk-entry/v2/middleware"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/timeout"
 	"net/http"
+	"sync"
+	"time"
 )
 
 // Middleware Add timeout interceptors.
-func Middleware(opts ...rkmidtimeout.Option) echo.MiddlewareFunc {
+func Middleware(opts ...Option) echo.MiddlewareFunc {
+	return MiddlewareWithOption(opts)
+}
+
+// MiddlewareWithOption Add timeout interceptors with options of rk-echo.
+//
+// Timeouts and ignored paths of rk-echo options are provided to rk-entry as well, so that deadline of request
+// context, deadline propagated to downstream and timer of rk-entry are the same. Timeouts of rk-entry options
+// are overridden, provide them with WithTimeout and WithTimeoutByPath instead.
+//
+// Streaming responses are supported either by path or by detecting Flush() and Hijack() calls,
+// timeout becomes an idle deadline enforced on the underlying connection for them.
+func MiddlewareWithOption(echoOpts []Option, opts ...rkmidtimeout.Option) echo.MiddlewareFunc {
 	set := rkmidtimeout.NewOptionSet(opts...)
+	echoSet := newOptionSet(append([]Option{
+		WithEntryNameAndType(set.GetEntryName(), set.GetEntryType()),
+	}, echoOpts...)...)
+
+	// entry name and type of rk-entry options take precedence over the ones of rk-echo options
+	rkOpts := append([]rkmidtimeout.Option{rkmidtimeout.WithEntryNameAndType(echoSet.entryName, echoSet.entryType)}, opts...)
+	set = rkmidtimeout.NewOptionSet(append(rkOpts, echoSet.rkOptions()...)...)
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(ctx echo.Context) error {
 			ctx.Set(rkmid.EntryNameKey.String(), set.GetEntryName())
 
-			// case 1: return to user if error occur
+			path := ctx.Request().URL.Path
+			if set.ShouldIgnore(path) {
+				return next(ctx)
+			}
+
 			beforeCtx := set.BeforeCtx(ctx.Request(), rkechoctx.GetEvent(ctx))
+
+			// case 1: deadline provided by client was exhausted already
+			timeout, fromClient := echoSet.getRequestTimeout(ctx.Request(), path)
+			if fromClient && timeout <= 0 {
+				rkechoctx.GetEvent(ctx).SetCounter("deadlineExhausted", 1)
+				return echoSet.getResponse(path)(ctx, beforeCtx.Output.TimeoutErrResp)
+			}
+
+			// case 2: streaming path, response will not be buffered
+			if echoSet.isStreamingPath(path) {
+				idleTimeout := echoSet.getIdleTimeout(path)
+				if fromClient && timeout < idleTimeout {
+					idleTimeout = timeout
+				}
+				return serveStreaming(ctx, next, idleTimeout)
+			}
+
+			// case 3: return to user if error occur
 			toCtx := &timeoutCtx{
-				echoCtx:  ctx,
-				nextFunc: next,
-				before:   beforeCtx,
+				echoCtx:        ctx,
+				nextFunc:       next,
+				before:         beforeCtx,
+				echoSet:        echoSet,
+				timeout:        timeout,
+				clientDeadline: fromClient,
+				response:       echoSet.getResponse(path),
+				done:           make(chan struct{}),
 			}
 			// assign handlers
 			beforeCtx.Input.InitHandler = initHandler(toCtx)
@@ -40,29 +88,150 @@ func Middleware(opts ...rkmidtimeout.Option) echo.MiddlewareFunc {
 			// call before
 			set.Before(beforeCtx)
 
+			// path ignored
+			if beforeCtx.Output.WaitFunc == nil {
+				return next(ctx)
+			}
+
 			beforeCtx.Output.WaitFunc()
 
-			return toCtx.nextError
+			return toCtx.getError()
 		}
 	}
 }
 
+// serveStreaming calls handler without buffering, response will be aborted and request context
+// will be canceled if idle deadline exceeded
+func serveStreaming(ctx echo.Context, next echo.HandlerFunc, idleTimeout time.Duration) error {
+	reqCtx := newRequestCtx(ctx.Request().Context(), idleTimeout)
+	ctx.SetRequest(ctx.Request().WithContext(reqCtx))
+
+	oldW := ctx.Response().Writer
+	newW := newStreamingWriter(oldW, idleTimeout, reqCtx)
+	ctx.Response().Writer = newW
+
+	defer func() {
+		reqCtx.release()
+		newW.idle.stop()
+		if newW.idle.Expired() {
+			rkechoctx.GetEvent(ctx).SetCounter("timeout", 1)
+		}
+		ctx.Response().Writer = oldW
+	}()
+
+	return next(ctx)
+}
+
 type timeoutCtx struct {
 	bufPool   *bufferPool
 	buffer    *bytes.Buffer
 	oldW      http.ResponseWriter
 	newW      *writer
 	echoCtx   echo.Context
+	echoSet   *optionSet
 	before    *rkmidtimeout.BeforeCtx
 	nextFunc  echo.HandlerFunc
 	nextError error
+	done      chan struct{}
+	reqCtx    *requestCtx
+	path      string
+	timeout   time.Duration
+	// clientDeadline is true if timeout is shorter than configured one because of deadline provided by client
+	clientDeadline bool
+	timedOut       bool
+	response       ResponseFunc
+	// timedOutAt and finished are used to track handlers still running after timeout
+	timedOutAt time.Time
+	finished   bool
+	mu         sync.Mutex
+}
+
+// markTimedOut marks request as timed out, false will be returned if it was marked already
+func (ctx *timeoutCtx) markTimedOut() bool {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if ctx.timedOut {
+		return false
+	}
+	ctx.timedOut = true
+
+	return true
+}
+
+// isTimedOut returns true if request was timed out
+func (ctx *timeoutCtx) isTimedOut() bool {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	return ctx.timedOut
+}
+
+// abandon marks handler as abandoned if it is still running
+func (ctx *timeoutCtx) abandon() {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if !ctx.finished {
+		ctx.timedOutAt = time.Now()
+		ctx.echoSet.incAbandoned(ctx.path)
+	}
+}
+
+// finish marks handler as finished and records how long it kept running after timeout
+func (ctx *timeoutCtx) finish(err error) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	ctx.finished = true
+	ctx.nextError = err
+	if !ctx.timedOutAt.IsZero() {
+		ctx.echoSet.decAbandoned(ctx.path, time.Since(ctx.timedOutAt))
+	}
+}
+
+// getError returns error of handler, nil will be returned if handler is still running
+func (ctx *timeoutCtx) getError() error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	return ctx.nextError
 }
 
 func timeoutHandler(ctx *timeoutCtx) func() {
 	return func() {
+		// request may be timed out by deadline of client already
+		if !ctx.markTimedOut() {
+			return
+		}
+
 		ctx.newW.mu.Lock()
+
+		// response is streaming, timeout was replaced by idle deadline, wait for handler
+		if ctx.newW.streaming {
+			ctx.newW.mu.Unlock()
+			<-ctx.done
+			ctx.newW.idle.stop()
+			ctx.echoCtx.Response().Writer = ctx.oldW
+			return
+		}
+
+		// response was sent partially, truncate it
+		if ctx.newW.degraded {
+			ctx.newW.mu.Unlock()
+			ctx.abandon()
+			ctx.reqCtx.expire()
+			// keep new writer since user code may still want to write to it
+			ctx.newW.truncate()
+			return
+		}
+
 		defer ctx.newW.mu.Unlock()
 
+		// cancel request context, so that handler could abort as soon as possible
+		ctx.abandon()
+		ctx.reqCtx.expire()
+
 		ctx.newW.timeout = true
 
 		// free buffer
@@ -73,7 +242,7 @@ func timeoutHandler(ctx *timeoutCtx) func() {
 		ctx.echoCtx.Response().Writer = ctx.oldW
 
 		// write timed out response
-		ctx.echoCtx.JSON(ctx.before.Output.TimeoutErrResp.Code(), ctx.before.Output.TimeoutErrResp)
+		ctx.response(ctx.echoCtx, ctx.before.Output.TimeoutErrResp)
 
 		// switch back to new writer since user code may still want to write to it.
 		// Panic may occur if we ignore this step.
@@ -83,9 +252,23 @@ func timeoutHandler(ctx *timeoutCtx) func() {
 
 func finishHandler(ctx *timeoutCtx) func() {
 	return func() {
+		// timed out by deadline of client, response was handled by timeout handler
+		if ctx.isTimedOut() {
+			return
+		}
+
 		ctx.newW.mu.Lock()
 		defer ctx.newW.mu.Unlock()
 
+		// contents were sent to original writer already
+		if ctx.newW.streaming || ctx.newW.degraded {
+			ctx.newW.idle.stop()
+			ctx.newW.FreeBuffer()
+			ctx.bufPool.Put(ctx.buffer)
+			ctx.echoCtx.Response().Writer = ctx.oldW
+			return
+		}
+
 		// copy headers and code
 		dst := ctx.newW.ResponseWriter.Header()
 		for k, vv := range ctx.newW.Header() {
@@ -106,6 +289,7 @@ func finishHandler(ctx *timeoutCtx) func() {
 
 func panicHandler(ctx *timeoutCtx) func() {
 	return func() {
+		ctx.newW.idle.stop()
 		ctx.newW.FreeBuffer()
 		ctx.echoCtx.Response().Writer = ctx.oldW
 	}
@@ -113,22 +297,75 @@ func panicHandler(ctx *timeoutCtx) func() {
 
 func nextHandler(ctx *timeoutCtx) func() {
 	return func() {
-		ctx.nextError = ctx.nextFunc(ctx.echoCtx)
+		if !ctx.clientDeadline {
+			runNext(ctx)
+			return
+		}
+
+		// deadline of client is shorter than configured timeout which is watched by rk-entry,
+		// run handler in another goroutine and time out request by ourselves.
+		finishChan := make(chan struct{}, 1)
+		panicChan := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if recv := recover(); recv != nil {
+					panicChan <- recv
+				}
+			}()
+
+			runNext(ctx)
+			finishChan <- struct{}{}
+		}()
+
+		timer := time.NewTimer(ctx.timeout)
+		defer timer.Stop()
+
+		select {
+		case recv := <-panicChan:
+			panic(recv)
+		case <-finishChan:
+		case <-timer.C:
+			rkechoctx.GetEvent(ctx.echoCtx).SetCounter("timeout", 1)
+			timeoutHandler(ctx)()
+		}
 	}
 }
 
+// runNext calls handler and marks it as finished
+func runNext(ctx *timeoutCtx) {
+	var err error
+	defer func() {
+		ctx.reqCtx.release()
+		ctx.finish(err)
+		close(ctx.done)
+	}()
+
+	err = ctx.nextFunc(ctx.echoCtx)
+}
+
 func initHandler(ctx *timeoutCtx) func() {
-	// create a buffer pool and new writer
+	// get buffer from shared pool and create new writer
 	// Why?
 	//
 	// We may face the case that request timed out while user code is writing to response writer.
 	// So, we create a new writer with mutex lock and ignore contents user code writers if timed out .
-	ctx.bufPool = &bufferPool{}
+	ctx.bufPool = ctx.echoSet.bufPool
 	ctx.buffer = ctx.bufPool.Get()
 	ctx.oldW = ctx.echoCtx.Response().Writer
 	ctx.newW = newWriter(ctx.oldW, ctx.buffer)
+	ctx.newW.maxBuffer = ctx.echoSet.maxBufferBytes
+	ctx.path = ctx.echoCtx.Path()
+	req := ctx.echoCtx.Request()
+	if ctx.echoSet.autoStreaming {
+		ctx.newW.idleTimeout = ctx.echoSet.getIdleTimeout(req.URL.Path)
+	}
 
 	return func() {
+		// install request context with deadline, it will be canceled once timed out
+		ctx.reqCtx = newRequestCtx(req.Context(), ctx.timeout)
+		ctx.newW.reqCtx = ctx.reqCtx
+		ctx.echoCtx.SetRequest(req.WithContext(ctx.reqCtx))
+
 		ctx.echoCtx.Response().Writer = ctx.newW
 	}
 }
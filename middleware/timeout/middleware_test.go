@@ -6,10 +6,15 @@
 package rkechotimeout
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rookie-ninja/rk-entry/v2/middleware/timeout"
 	"github.com/stretchr/testify/assert"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -45,7 +50,7 @@ func getEcho(path string, handler echo.HandlerFunc, middleware echo.MiddlewareFu
 func TestMiddleware_WithTimeout(t *testing.T) {
 	// with global timeout response
 	e := getEcho("/", sleepH, Middleware(
-		rkmidtimeout.WithTimeout(time.Nanosecond)))
+		WithTimeout(time.Nanosecond)))
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/", nil)
@@ -54,7 +59,7 @@ func TestMiddleware_WithTimeout(t *testing.T) {
 
 	// with path
 	e = getEcho("/ut-path", sleepH, Middleware(
-		rkmidtimeout.WithTimeoutByPath("/ut-path", time.Nanosecond)))
+		WithTimeoutByPath("/ut-path", time.Nanosecond)))
 
 	w = httptest.NewRecorder()
 	req, _ = http.NewRequest("GET", "/ut-path", nil)
@@ -63,11 +68,39 @@ func TestMiddleware_WithTimeout(t *testing.T) {
 	assert.Equal(t, http.StatusRequestTimeout, w.Code)
 }
 
+func TestMiddleware_Deadline(t *testing.T) {
+	// deadline of request context is the same as timeout of rk-entry
+	var remaining time.Duration
+	e := getEcho("/ut-path", func(ctx echo.Context) error {
+		deadline, ok := ctx.Request().Context().Deadline()
+		assert.True(t, ok)
+		remaining = time.Until(deadline)
+		<-ctx.Request().Context().Done()
+		return nil
+	}, Middleware(WithTimeout(100*time.Millisecond)))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ut-path", nil)
+	start := time.Now()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	assert.True(t, remaining > 50*time.Millisecond && remaining <= 100*time.Millisecond)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// ignored path of rk-entry is kept
+	e = getEcho("/ut-ignore", returnH, MiddlewareWithOption(
+		[]Option{WithTimeout(time.Nanosecond)}, rkmidtimeout.WithPathToIgnore("/ut-ignore")))
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/ut-ignore", nil)
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
 func TestMiddleware_WithPanic(t *testing.T) {
 	defer assertPanic(t)
 
 	r := getEcho("/", panicH, Middleware(
-		rkmidtimeout.WithTimeout(time.Minute)))
+		WithTimeout(time.Minute)))
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/", nil)
@@ -79,8 +112,8 @@ func TestMiddleware_HappyCase(t *testing.T) {
 	// We expect interceptor acts as the name describes
 	r := echo.New()
 	r.Use(Middleware(
-		rkmidtimeout.WithTimeoutByPath("/timeout", time.Nanosecond),
-		rkmidtimeout.WithTimeoutByPath("/happy", time.Minute)))
+		WithTimeoutByPath("/timeout", time.Nanosecond),
+		WithTimeoutByPath("/happy", time.Minute)))
 
 	r.GET("/timeout", sleepH)
 	r.GET("/happy", returnH)
@@ -109,3 +142,339 @@ func assertPanic(t *testing.T) {
 		assert.True(t, false)
 	}
 }
+
+func TestMiddleware_AutoStreaming(t *testing.T) {
+	e := getEcho("/ut-sse", func(ctx echo.Context) error {
+		ctx.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+		ctx.Response().WriteHeader(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(ctx.Response(), "data: %d\n\n", i)
+			ctx.Response().Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	}, MiddlewareWithOption(
+		[]Option{WithIdleTimeout(time.Second), WithTimeoutByPath("/ut-sse", 10*time.Millisecond)}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ut-sse", nil)
+	e.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "data: 0\n\ndata: 1\n\ndata: 2\n\n", w.Body.String())
+
+	// with auto streaming disabled, flush will be ignored
+	e = getEcho("/ut-sse", func(ctx echo.Context) error {
+		ctx.Response().Write([]byte("ut-message"))
+		ctx.Response().Flush()
+		return nil
+	}, MiddlewareWithOption(
+		[]Option{WithAutoStreaming(false), WithTimeoutByPath("/ut-sse", time.Minute)}))
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, w.Flushed)
+	assert.Equal(t, "ut-message", w.Body.String())
+}
+
+func TestMiddleware_StreamingPath(t *testing.T) {
+	// within idle deadline
+	e := getEcho("/ut-events", func(ctx echo.Context) error {
+		for i := 0; i < 3; i++ {
+			time.Sleep(20 * time.Millisecond)
+			ctx.Response().Write([]byte("ut"))
+			ctx.Response().Flush()
+		}
+		return nil
+	}, MiddlewareWithOption([]Option{
+		WithStreamingPath("/ut-events"),
+		WithIdleTimeout(50 * time.Millisecond),
+	}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ut-events", nil)
+	e.ServeHTTP(w, req)
+	assert.Equal(t, "ututut", w.Body.String())
+
+	// first-byte deadline exceeded
+	e = getEcho("/ut-events", func(ctx echo.Context) error {
+		time.Sleep(50 * time.Millisecond)
+		ctx.Response().Write([]byte("ut"))
+		return nil
+	}, MiddlewareWithOption([]Option{
+		WithStreamingPath("/ut-events"),
+		WithIdleTimeout(10 * time.Millisecond),
+	}))
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestMiddleware_Hijack(t *testing.T) {
+	readErr := make(chan error, 1)
+
+	e := getEcho("/ut-ws", func(ctx echo.Context) error {
+		conn, rw, err := ctx.Response().Hijack()
+		if err != nil {
+			readErr <- err
+			return nil
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		rw.Flush()
+
+		// idle deadline will abort blocked read
+		_, err = rw.ReadByte()
+		readErr <- err
+		return nil
+	}, MiddlewareWithOption(
+		[]Option{WithIdleTimeout(50 * time.Millisecond), WithTimeoutByPath("/ut-ws", 10*time.Millisecond)}))
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	conn.Write([]byte("GET /ut-ws HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	status, err := bufio.NewReader(conn).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Contains(t, status, "101")
+
+	select {
+	case err := <-readErr:
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "idle deadline was not enforced")
+	}
+}
+
+func TestMiddleware_RequestContext(t *testing.T) {
+	ctxErr := make(chan error, 1)
+	hasDeadline := make(chan bool, 1)
+
+	e := getEcho("/ut-ctx", func(ctx echo.Context) error {
+		_, ok := ctx.Request().Context().Deadline()
+		hasDeadline <- ok
+
+		select {
+		case <-ctx.Request().Context().Done():
+			ctxErr <- ctx.Request().Context().Err()
+		case <-time.After(5 * time.Second):
+			ctxErr <- nil
+		}
+		return nil
+	}, MiddlewareWithOption(
+		[]Option{WithTimeoutByPath("/ut-ctx", 10*time.Millisecond)}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ut-ctx", nil)
+	e.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	assert.True(t, <-hasDeadline)
+	assert.Equal(t, context.DeadlineExceeded, <-ctxErr)
+}
+
+func TestMiddleware_Abandoned(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	release := make(chan struct{})
+	finished := make(chan struct{})
+
+	e := getEcho("/ut-abandoned", func(ctx echo.Context) error {
+		defer close(finished)
+		<-release
+		return nil
+	}, MiddlewareWithOption(
+		[]Option{WithRegisterer(registry), WithEntryNameAndType("ut-entry", "ut-type"), WithTimeoutByPath("/ut-abandoned", 10*time.Millisecond)}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ut-abandoned", nil)
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+
+	// handler is still running
+	assert.Equal(t, float64(1), gatherValue(t, registry, "rk_timeout_abandonedRunning"))
+
+	// handler finished
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	<-finished
+	assert.Eventually(t, func() bool {
+		return gatherValue(t, registry, "rk_timeout_abandonedRunning") == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, float64(1), gatherValue(t, registry, "rk_timeout_abandonedDuration"))
+}
+
+// gatherValue returns value of gauge or sample count of histogram
+func gatherValue(t *testing.T, registry *prometheus.Registry, name string) float64 {
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		metric := family.GetMetric()[0]
+		if metric.GetHistogram() != nil {
+			return float64(metric.GetHistogram().GetSampleCount())
+		}
+		return metric.GetGauge().GetValue()
+	}
+
+	return -1
+}
+
+func TestMiddleware_MaxBuffer(t *testing.T) {
+	// response exceeds buffer limit
+	e := getEcho("/ut-large", func(ctx echo.Context) error {
+		ctx.Response().Write([]byte("ut-message-1"))
+		ctx.Response().Write([]byte("ut-message-2"))
+		return nil
+	}, MiddlewareWithOption(
+		[]Option{WithMaxBufferBytes(16), WithTimeoutByPath("/ut-large", time.Minute)}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ut-large", nil)
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ut-message-1ut-message-2", w.Body.String())
+
+	// timed out after degraded, response will be truncated
+	release := make(chan struct{})
+	e = getEcho("/ut-large", func(ctx echo.Context) error {
+		ctx.Response().Write([]byte("ut-message-1"))
+		ctx.Response().Write([]byte("ut-message-2"))
+		<-release
+		ctx.Response().Write([]byte("ut-message-3"))
+		return nil
+	}, MiddlewareWithOption(
+		[]Option{WithMaxBufferBytes(16), WithTimeoutByPath("/ut-large", 10*time.Millisecond)}))
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	close(release)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ut-message-1ut-message-2", w.Body.String())
+}
+
+func BenchmarkMiddleware(b *testing.B) {
+	e := getEcho("/ut-bench", returnH, MiddlewareWithOption(
+		[]Option{WithRegisterer(prometheus.NewRegistry()), WithTimeoutByPath("/ut-bench", time.Minute)}))
+	req, _ := http.NewRequest("GET", "/ut-bench", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkMiddleware_LargeResponse(b *testing.B) {
+	body := bytes.Repeat([]byte("a"), 1<<20)
+	e := getEcho("/ut-bench", func(ctx echo.Context) error {
+		return ctx.Blob(http.StatusOK, echo.MIMEOctetStream, body)
+	}, MiddlewareWithOption(
+		[]Option{WithRegisterer(prometheus.NewRegistry()), WithTimeoutByPath("/ut-bench", time.Minute)}))
+	req, _ := http.NewRequest("GET", "/ut-bench", nil)
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Body.Reset()
+		e.ServeHTTP(w, req)
+	}
+}
+
+func TestMiddleware_ClientDeadline(t *testing.T) {
+	deadline := make(chan time.Duration, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	e := getEcho("/ut-deadline", func(ctx echo.Context) error {
+		d, _ := ctx.Request().Context().Deadline()
+		deadline <- time.Until(d)
+
+		select {
+		case <-release:
+			return ctx.String(http.StatusOK, "ut-message")
+		case <-ctx.Request().Context().Done():
+			return nil
+		}
+	}, MiddlewareWithOption(
+		[]Option{WithDeadlineHeader(), WithTimeoutByPath("/ut-deadline", 5*time.Second)}))
+
+	// timed out by deadline of client
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ut-deadline", nil)
+	req.Header.Set("grpc-timeout", "20m")
+	start := time.Now()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.LessOrEqual(t, int64(<-deadline), int64(20*time.Millisecond))
+
+	// exhausted already
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/ut-deadline", nil)
+	req.Header.Set("X-Request-Timeout", "0")
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	assert.Empty(t, deadline)
+
+	// finished before deadline of client
+	e = getEcho("/ut-return", returnH, MiddlewareWithOption(
+		[]Option{WithDeadlineHeader(), WithTimeoutByPath("/ut-return", 5*time.Second)}))
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/ut-return", nil)
+	req.Header.Set("X-Request-Timeout", "1s")
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMiddleware_ClientDeadlineWithPanic(t *testing.T) {
+	defer assertPanic(t)
+
+	e := getEcho("/ut-panic", panicH, MiddlewareWithOption(
+		[]Option{WithDeadlineHeader(), WithTimeoutByPath("/ut-panic", 5*time.Second)}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ut-panic", nil)
+	req.Header.Set("X-Request-Timeout", "1s")
+	e.ServeHTTP(w, req)
+}
+
+func TestMiddleware_WithResponse(t *testing.T) {
+	e := getEcho("/ut-response", func(ctx echo.Context) error {
+		<-ctx.Request().Context().Done()
+		return nil
+	}, MiddlewareWithOption(
+		[]Option{
+			WithDeadlineHeader(),
+			WithResponseByPath("/ut-response", NewResponse(http.StatusServiceUnavailable, "", []byte("ut-busy"), time.Second)),
+			WithTimeoutByPath("/ut-response", 10*time.Millisecond),
+		}))
+
+	// timed out
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ut-response", nil)
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get(echo.HeaderRetryAfter))
+	assert.Equal(t, "ut-busy", w.Body.String())
+
+	// deadline of client exhausted
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/ut-response", nil)
+	req.Header.Set("X-Request-Timeout", "0s")
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "ut-busy", w.Body.String())
+}
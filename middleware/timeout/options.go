@@ -0,0 +1,407 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechotimeout
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/prom"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/timeout"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	global = "rk-global"
+	// DefaultTimeout is the same as default timeout of rk-entry
+	DefaultTimeout = 10 * time.Second
+	// DefaultMaxBufferBytes default limit of buffered response, 4MB
+	DefaultMaxBufferBytes int64 = 4 << 20
+	// MetricsNameAbandonedRunning records timed out handlers which are still running
+	MetricsNameAbandonedRunning = "abandonedRunning"
+	// MetricsNameAbandonedDuration records seconds timed out handlers kept running after timeout
+	MetricsNameAbandonedDuration = "abandonedDuration"
+)
+
+var (
+	labelKeys = []string{"entryName", "entryType", "path"}
+	// durationBuckets from 10ms to about 40min
+	durationBuckets = prometheus.ExponentialBuckets(0.01, 4, 10)
+)
+
+// ***************** OptionSet Implementation *****************
+
+// optionSet extends options of rk-entry timeout middleware with features for echo framework.
+//
+// Timeouts are provided to rk-entry by rkOptions, so that both of them share the same timeouts.
+type optionSet struct {
+	entryName       string
+	entryType       string
+	pathToIgnore    []string
+	timeouts        map[string]time.Duration
+	idleTimeout     time.Duration
+	streamingPaths  []string
+	autoStreaming   bool
+	maxBufferBytes  int64
+	deadlineHeaders []string
+	responses       map[string]ResponseFunc
+	bufPool         *bufferPool
+	registerer      prometheus.Registerer
+	metricsSet      *rkmidprom.MetricsSet
+}
+
+// Create new optionSet with options.
+func newOptionSet(opts ...Option) *optionSet {
+	set := &optionSet{
+		entryName:    "fake-entry",
+		entryType:    "",
+		pathToIgnore: []string{},
+		timeouts: map[string]time.Duration{
+			global: DefaultTimeout,
+		},
+		streamingPaths: []string{},
+		autoStreaming:  true,
+		maxBufferBytes: DefaultMaxBufferBytes,
+		responses: map[string]ResponseFunc{
+			global: defaultResponse,
+		},
+		bufPool:    &bufferPool{},
+		registerer: prometheus.DefaultRegisterer,
+	}
+
+	for i := range opts {
+		opts[i](set)
+	}
+
+	set.metricsSet = rkmidprom.NewMetricsSet("rk", "timeout", set.registerer)
+	set.metricsSet.RegisterGauge(MetricsNameAbandonedRunning, labelKeys...)
+	set.metricsSet.RegisterHistogram(MetricsNameAbandonedDuration, durationBuckets, labelKeys...)
+
+	return set
+}
+
+// rkOptions returns options of rk-entry with timeouts and ignored paths of current option set
+func (set *optionSet) rkOptions() []rkmidtimeout.Option {
+	opts := []rkmidtimeout.Option{
+		rkmidtimeout.WithPathToIgnore(set.pathToIgnore...),
+	}
+
+	for path, timeout := range set.timeouts {
+		if path == global {
+			opts = append(opts, rkmidtimeout.WithTimeout(timeout))
+		} else {
+			opts = append(opts, rkmidtimeout.WithTimeoutByPath(path, timeout))
+		}
+	}
+
+	return opts
+}
+
+// Get timeout with path.
+// Global one will be returned if not found.
+func (set *optionSet) getTimeout(path string) time.Duration {
+	if v, ok := set.timeouts[path]; ok {
+		return v
+	}
+
+	return set.timeouts[global]
+}
+
+// Get timeout of request with path, remaining deadline provided by client will be used if it is shorter.
+//
+// The second return value is true if deadline was provided by client.
+func (set *optionSet) getRequestTimeout(req *http.Request, path string) (time.Duration, bool) {
+	timeout := set.getTimeout(path)
+
+	for i := range set.deadlineHeaders {
+		value := req.Header.Get(set.deadlineHeaders[i])
+		if len(value) < 1 {
+			continue
+		}
+
+		if remaining, ok := parseDeadlineHeader(set.deadlineHeaders[i], value); ok {
+			if remaining < timeout {
+				return remaining, true
+			}
+			return timeout, false
+		}
+	}
+
+	return timeout, false
+}
+
+// Get timeout response with path.
+// Global one will be returned if not found.
+func (set *optionSet) getResponse(path string) ResponseFunc {
+	if v, ok := set.responses[path]; ok {
+		return v
+	}
+
+	return set.responses[global]
+}
+
+// Get idle timeout of streaming response with path.
+// Timeout of path will be used if idle timeout was not provided.
+func (set *optionSet) getIdleTimeout(path string) time.Duration {
+	if set.idleTimeout > 0 {
+		return set.idleTimeout
+	}
+
+	return set.getTimeout(path)
+}
+
+// isStreamingPath returns true if path starts with one of streaming paths
+func (set *optionSet) isStreamingPath(path string) bool {
+	for i := range set.streamingPaths {
+		if strings.HasPrefix(path, set.streamingPaths[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Increase gauge of running timed out handlers, metrics will be ignored if it was not registered successfully
+func (set *optionSet) incAbandoned(path string) {
+	if gauge := set.metricsSet.GetGaugeWithValues(MetricsNameAbandonedRunning,
+		set.entryName, set.entryType, path); gauge != nil {
+		gauge.Inc()
+	}
+}
+
+// Decrease gauge of running timed out handlers and record how long handler kept running after timeout
+func (set *optionSet) decAbandoned(path string, elapsed time.Duration) {
+	if gauge := set.metricsSet.GetGaugeWithValues(MetricsNameAbandonedRunning,
+		set.entryName, set.entryType, path); gauge != nil {
+		gauge.Dec()
+	}
+
+	if observer := set.metricsSet.GetHistogramWithValues(MetricsNameAbandonedDuration,
+		set.entryName, set.entryType, path); observer != nil {
+		observer.Observe(elapsed.Seconds())
+	}
+}
+
+// ***************** BootConfig *****************
+
+// BootConfig for YAML, extends BootConfig of rk-entry.
+type BootConfig struct {
+	rkmidtimeout.BootConfig `yaml:",inline" mapstructure:",squash"`
+	IdleTimeoutMs           int      `yaml:"idleTimeoutMs" json:"idleTimeoutMs"`
+	StreamingPaths          []string `yaml:"streamingPaths" json:"streamingPaths"`
+	DisableAutoStreaming    bool     `yaml:"disableAutoStreaming" json:"disableAutoStreaming"`
+	MaxBufferBytes          int64    `yaml:"maxBufferBytes" json:"maxBufferBytes"`
+	EnableDeadlineHeaders   bool     `yaml:"enableDeadlineHeaders" json:"enableDeadlineHeaders"`
+	DeadlineHeaders         []string `yaml:"deadlineHeaders" json:"deadlineHeaders"`
+	Responses               []struct {
+		Path          string `yaml:"path" json:"path"`
+		Code          int    `yaml:"code" json:"code"`
+		ContentType   string `yaml:"contentType" json:"contentType"`
+		Body          string `yaml:"body" json:"body"`
+		TemplatePath  string `yaml:"templatePath" json:"templatePath"`
+		RetryAfterSec int    `yaml:"retryAfterSec" json:"retryAfterSec"`
+	} `yaml:"responses" json:"responses"`
+}
+
+// ToOptions convert BootConfig into Option list
+func ToOptions(config *BootConfig, entryName, entryType string, reg prometheus.Registerer) []Option {
+	opts := make([]Option, 0)
+
+	if config.Enabled {
+		opts = append(opts,
+			WithEntryNameAndType(entryName, entryType),
+			WithRegisterer(reg),
+			WithPathToIgnore(config.Ignore...),
+			WithTimeout(time.Duration(config.TimeoutMs)*time.Millisecond),
+			WithIdleTimeout(time.Duration(config.IdleTimeoutMs)*time.Millisecond),
+			WithStreamingPath(config.StreamingPaths...),
+			WithAutoStreaming(!config.DisableAutoStreaming),
+			WithMaxBufferBytes(config.MaxBufferBytes))
+
+		for i := range config.Responses {
+			e := config.Responses[i]
+			retryAfter := time.Duration(e.RetryAfterSec) * time.Second
+
+			var fn ResponseFunc
+			if len(e.TemplatePath) > 0 {
+				tmpl, err := template.ParseFiles(e.TemplatePath)
+				if err != nil {
+					rkentry.ShutdownWithError(err)
+				}
+				fn = NewTemplateResponse(e.Code, tmpl, retryAfter)
+			} else {
+				fn = NewResponse(e.Code, e.ContentType, []byte(e.Body), retryAfter)
+			}
+
+			if len(e.Path) < 1 {
+				opts = append(opts, WithResponse(fn))
+			} else {
+				opts = append(opts, WithResponseByPath(e.Path, fn))
+			}
+		}
+
+		if config.EnableDeadlineHeaders {
+			opts = append(opts, WithDeadlineHeader(config.DeadlineHeaders...))
+		}
+
+		for i := range config.Paths {
+			e := config.Paths[i]
+			opts = append(opts, WithTimeoutByPath(e.Path, time.Duration(e.TimeoutMs)*time.Millisecond))
+		}
+	}
+
+	return opts
+}
+
+// ***************** Option *****************
+
+// Option if for middleware options while creating middleware
+type Option func(*optionSet)
+
+// WithEntryNameAndType provide entry name and entry type.
+// Entry name and type of rk-entry option set will be used if not provided.
+func WithEntryNameAndType(entryName, entryType string) Option {
+	return func(set *optionSet) {
+		set.entryName = entryName
+		set.entryType = entryType
+	}
+}
+
+// WithRegisterer provide prometheus.Registerer.
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(set *optionSet) {
+		if registerer != nil {
+			set.registerer = registerer
+		}
+	}
+}
+
+// WithPathToIgnore provide paths prefix that will be ignored.
+func WithPathToIgnore(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.pathToIgnore = append(set.pathToIgnore, paths[i])
+			}
+		}
+	}
+}
+
+// WithTimeout provide global timeout, it overrides timeout provided to rk-entry.
+// It is used as deadline of request context, zero value will be ignored.
+func WithTimeout(timeout time.Duration) Option {
+	return func(set *optionSet) {
+		if timeout > 0 {
+			set.timeouts[global] = timeout
+		}
+	}
+}
+
+// WithTimeoutByPath provide timeout by path, it overrides timeout of the same path provided to rk-entry.
+// Zero value will be ignored.
+func WithTimeoutByPath(path string, timeout time.Duration) Option {
+	return func(set *optionSet) {
+		if timeout <= 0 {
+			return
+		}
+
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		set.timeouts[path] = timeout
+	}
+}
+
+// WithIdleTimeout provide idle and first-byte deadline of streaming response.
+// Timeout of path will be used if not provided.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(set *optionSet) {
+		if timeout > 0 {
+			set.idleTimeout = timeout
+		}
+	}
+}
+
+// WithStreamingPath provide path prefixes which serve streaming responses, like SSE, chunked download or websocket.
+//
+// Responses will not be buffered and timeout becomes an idle deadline enforced on the underlying connection.
+func WithStreamingPath(paths ...string) Option {
+	return func(set *optionSet) {
+		for i := range paths {
+			if len(paths[i]) > 0 {
+				set.streamingPaths = append(set.streamingPaths, paths[i])
+			}
+		}
+	}
+}
+
+// WithAutoStreaming enable or disable switching to streaming mode once handler calls Flush() or Hijack().
+// Enabled by default.
+func WithAutoStreaming(enabled bool) Option {
+	return func(set *optionSet) {
+		set.autoStreaming = enabled
+	}
+}
+
+// WithMaxBufferBytes provide limit of buffered response in bytes.
+//
+// Once exceeded, buffered contents will be sent to original writer and middleware degrades to deadline-only mode,
+// which means response will be truncated instead of replaced by timeout response if timed out.
+// Zero value will be ignored and negative value means no limit.
+func WithMaxBufferBytes(maxBytes int64) Option {
+	return func(set *optionSet) {
+		if maxBytes != 0 {
+			set.maxBufferBytes = maxBytes
+		}
+	}
+}
+
+// WithDeadlineHeader enable remaining deadline provided by client with headers.
+//
+// X-Request-Timeout, grpc-timeout and Request-Timeout will be used if headers were not provided.
+// Deadline is capped by configured timeout and request will be rejected if deadline was exhausted already.
+func WithDeadlineHeader(headers ...string) Option {
+	return func(set *optionSet) {
+		set.deadlineHeaders = make([]string, 0)
+		for i := range headers {
+			if len(headers[i]) > 0 {
+				set.deadlineHeaders = append(set.deadlineHeaders, headers[i])
+			}
+		}
+
+		if len(set.deadlineHeaders) < 1 {
+			set.deadlineHeaders = append(set.deadlineHeaders, defaultDeadlineHeaders...)
+		}
+	}
+}
+
+// WithResponse provide ResponseFunc which writes response of timed out request.
+// Timeout error of rk-entry will be written as JSON by default.
+func WithResponse(fn ResponseFunc) Option {
+	return func(set *optionSet) {
+		if fn != nil {
+			set.responses[global] = fn
+		}
+	}
+}
+
+// WithResponseByPath provide ResponseFunc by path, like a templated HTML page for HTML routes.
+func WithResponseByPath(path string, fn ResponseFunc) Option {
+	return func(set *optionSet) {
+		if fn == nil {
+			return
+		}
+
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		set.responses[path] = fn
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechotimeout
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/timeout"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestNewOptionSet(t *testing.T) {
+	// without options
+	set := newOptionSet()
+	assert.Equal(t, DefaultTimeout, set.getTimeout("/ut-path"))
+	assert.Equal(t, DefaultTimeout, set.getIdleTimeout("/ut-path"))
+	assert.True(t, set.autoStreaming)
+	assert.False(t, set.isStreamingPath("/ut-path"))
+	assert.Equal(t, DefaultMaxBufferBytes, set.maxBufferBytes)
+	assert.NotNil(t, set.bufPool)
+	assert.Empty(t, set.deadlineHeaders)
+
+	// with options
+	set = newOptionSet(
+		WithTimeout(time.Second),
+		WithTimeout(0),
+		WithTimeoutByPath("ut-path", time.Minute),
+		WithTimeoutByPath("/ut-zero", 0),
+		WithStreamingPath("", "/ut-events"),
+		WithAutoStreaming(false),
+		WithPathToIgnore("", "/ut-ignore"))
+	assert.Equal(t, time.Second, set.getTimeout("/ut-other"))
+	assert.Equal(t, time.Minute, set.getTimeout("/ut-path"))
+	assert.Equal(t, time.Second, set.getTimeout("/ut-zero"))
+	assert.Equal(t, time.Minute, set.getIdleTimeout("/ut-path"))
+	assert.True(t, set.isStreamingPath("/ut-events/1"))
+	assert.False(t, set.isStreamingPath("/ut-path"))
+	assert.False(t, set.autoStreaming)
+	assert.Equal(t, []string{"/ut-ignore"}, set.pathToIgnore)
+	assert.Len(t, set.rkOptions(), 3)
+
+	// with idle timeout
+	set = newOptionSet(WithIdleTimeout(time.Millisecond))
+	assert.Equal(t, time.Millisecond, set.getIdleTimeout("/ut-path"))
+}
+
+func TestToOptions(t *testing.T) {
+	config := &BootConfig{
+		BootConfig: rkmidtimeout.BootConfig{
+			Enabled:   false,
+			TimeoutMs: 1000,
+			Ignore:    []string{"/ut-ignore"},
+			Paths: []struct {
+				Path      string `yaml:"path" json:"path"`
+				TimeoutMs int    `yaml:"timeoutMs" json:"timeoutMs"`
+			}{
+				{Path: "/ut-path", TimeoutMs: 2000},
+			},
+		},
+		IdleTimeoutMs:        3000,
+		StreamingPaths:       []string{"/ut-events"},
+		DisableAutoStreaming: true,
+		MaxBufferBytes:       1024,
+		DeadlineHeaders:      []string{"X-Ut-Timeout"},
+	}
+	config.Responses = append(config.Responses, struct {
+		Path          string `yaml:"path" json:"path"`
+		Code          int    `yaml:"code" json:"code"`
+		ContentType   string `yaml:"contentType" json:"contentType"`
+		Body          string `yaml:"body" json:"body"`
+		TemplatePath  string `yaml:"templatePath" json:"templatePath"`
+		RetryAfterSec int    `yaml:"retryAfterSec" json:"retryAfterSec"`
+	}{Code: http.StatusGatewayTimeout, RetryAfterSec: 1})
+
+	// with disabled
+	assert.Empty(t, ToOptions(config, "", "", nil))
+
+	// with enabled
+	config.Enabled = true
+	set := newOptionSet(ToOptions(config, "", "", nil)...)
+	assert.Equal(t, time.Second, set.getTimeout("/ut-other"))
+	assert.Equal(t, 2*time.Second, set.getTimeout("/ut-path"))
+	assert.Equal(t, []string{"/ut-ignore"}, set.pathToIgnore)
+	assert.Equal(t, 3*time.Second, set.getIdleTimeout("/ut-path"))
+	assert.Equal(t, []string{"/ut-events"}, set.streamingPaths)
+	assert.False(t, set.autoStreaming)
+	assert.Equal(t, int64(1024), set.maxBufferBytes)
+	assert.Empty(t, set.deadlineHeaders)
+
+	ctx, w := newResponseCtx()
+	set.getResponse("/ut-path")(ctx, rkmid.GetErrorBuilder().New(http.StatusRequestTimeout, ""))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, "1", w.Header().Get(echo.HeaderRetryAfter))
+
+	// with deadline headers
+	config.EnableDeadlineHeaders = true
+	set = newOptionSet(ToOptions(config, "", "", nil)...)
+	assert.Equal(t, []string{"X-Ut-Timeout"}, set.deadlineHeaders)
+}
+
+func TestToOptions_WithTemplate(t *testing.T) {
+	tmplPath := path.Join(t.TempDir(), "timeout.html")
+	assert.Nil(t, os.WriteFile(tmplPath, []byte("<p>{{.Code}}</p>"), 0644))
+
+	config := &BootConfig{}
+	config.Enabled = true
+	config.Responses = append(config.Responses, struct {
+		Path          string `yaml:"path" json:"path"`
+		Code          int    `yaml:"code" json:"code"`
+		ContentType   string `yaml:"contentType" json:"contentType"`
+		Body          string `yaml:"body" json:"body"`
+		TemplatePath  string `yaml:"templatePath" json:"templatePath"`
+		RetryAfterSec int    `yaml:"retryAfterSec" json:"retryAfterSec"`
+	}{Path: "/ut-html", Code: http.StatusServiceUnavailable, TemplatePath: tmplPath})
+
+	set := newOptionSet(ToOptions(config, "", "", nil)...)
+	errResp := rkmid.GetErrorBuilder().New(http.StatusRequestTimeout, "")
+
+	// with path of template
+	ctx, w := newResponseCtx()
+	set.getResponse("/ut-html")(ctx, errResp)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "<p>503</p>", w.Body.String())
+
+	// with other path
+	ctx, w = newResponseCtx()
+	set.getResponse("/ut-other")(ctx, errResp)
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+}
+
+func TestOptionSet_GetResponse(t *testing.T) {
+	errResp := rkmid.GetErrorBuilder().New(http.StatusRequestTimeout, "")
+	set := newOptionSet(
+		WithResponse(nil),
+		WithResponse(NewResponse(http.StatusGatewayTimeout, "", nil, 0)),
+		WithResponseByPath("ut-path", NewResponse(http.StatusServiceUnavailable, "", nil, 0)),
+		WithResponseByPath("/ut-nil", nil))
+
+	ctx, w := newResponseCtx()
+	set.getResponse("/ut-path")(ctx, errResp)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	ctx, w = newResponseCtx()
+	set.getResponse("/ut-nil")(ctx, errResp)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
+
+func TestOptionSet_GetRequestTimeout(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ut-path", nil)
+	req.Header.Set("X-Request-Timeout", "100ms")
+
+	// without deadline headers
+	set := newOptionSet(WithTimeout(time.Second))
+	timeout, fromClient := set.getRequestTimeout(req, "/ut-path")
+	assert.Equal(t, time.Second, timeout)
+	assert.False(t, fromClient)
+
+	// with default headers
+	set = newOptionSet(WithTimeout(time.Second), WithDeadlineHeader())
+	assert.Equal(t, defaultDeadlineHeaders, set.deadlineHeaders)
+	timeout, fromClient = set.getRequestTimeout(req, "/ut-path")
+	assert.Equal(t, 100*time.Millisecond, timeout)
+	assert.True(t, fromClient)
+
+	// capped by configured timeout
+	req.Header.Set("X-Request-Timeout", "1m")
+	timeout, fromClient = set.getRequestTimeout(req, "/ut-path")
+	assert.Equal(t, time.Second, timeout)
+	assert.False(t, fromClient)
+
+	// invalid value falls back to next header
+	req.Header.Set("X-Request-Timeout", "invalid")
+	req.Header.Set("grpc-timeout", "10m")
+	timeout, fromClient = set.getRequestTimeout(req, "/ut-path")
+	assert.Equal(t, 10*time.Millisecond, timeout)
+	assert.True(t, fromClient)
+
+	// with custom header
+	set = newOptionSet(WithTimeout(time.Second), WithDeadlineHeader("", "X-Ut-Timeout"))
+	assert.Equal(t, []string{"X-Ut-Timeout"}, set.deadlineHeaders)
+	timeout, fromClient = set.getRequestTimeout(req, "/ut-path")
+	assert.Equal(t, time.Second, timeout)
+	assert.False(t, fromClient)
+}
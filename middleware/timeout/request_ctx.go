@@ -0,0 +1,99 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechotimeout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// requestCtx is installed into request of handler, it behaves like context.WithTimeout
+// except that it is canceled by middleware once timed out instead of a timer.
+//
+// Deadline will be lifted once response switches to streaming mode, since timeout becomes
+// an idle deadline which could not be reported by context.
+type requestCtx struct {
+	context.Context
+	cancel   context.CancelFunc
+	deadline time.Time
+	lifted   bool
+	err      error
+	mu       sync.Mutex
+}
+
+// newRequestCtx creates requestCtx with deadline of now plus timeout
+func newRequestCtx(parent context.Context, timeout time.Duration) *requestCtx {
+	ctx, cancel := context.WithCancel(parent)
+
+	return &requestCtx{
+		Context:  ctx,
+		cancel:   cancel,
+		deadline: time.Now().Add(timeout),
+	}
+}
+
+// Deadline returns the earlier one of parent deadline and deadline of timeout
+func (c *requestCtx) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	parent, ok := c.Context.Deadline()
+	if c.lifted || (ok && parent.Before(c.deadline)) {
+		return parent, ok
+	}
+
+	return c.deadline, true
+}
+
+// Err returns context.DeadlineExceeded if timed out
+func (c *requestCtx) Err() error {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return c.Context.Err()
+}
+
+// expire cancels context with context.DeadlineExceeded
+func (c *requestCtx) expire() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if c.err == nil && c.Context.Err() == nil {
+		c.err = context.DeadlineExceeded
+	}
+	c.mu.Unlock()
+
+	c.cancel()
+}
+
+// lift removes deadline of timeout
+func (c *requestCtx) lift() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lifted = true
+}
+
+// release cancels context after handler finished
+func (c *requestCtx) release() {
+	if c == nil {
+		return
+	}
+
+	c.cancel()
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechotimeout
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRequestCtx(t *testing.T) {
+	// nil context
+	var nilCtx *requestCtx
+	nilCtx.expire()
+	nilCtx.lift()
+	nilCtx.release()
+
+	// with deadline
+	ctx := newRequestCtx(context.Background(), time.Minute)
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.True(t, deadline.After(time.Now()))
+	assert.Nil(t, ctx.Err())
+
+	// expired
+	ctx.expire()
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+
+	// released
+	ctx = newRequestCtx(context.Background(), time.Minute)
+	ctx.release()
+	ctx.expire()
+	assert.Equal(t, context.Canceled, ctx.Err())
+
+	// lifted
+	ctx = newRequestCtx(context.Background(), time.Minute)
+	ctx.lift()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+
+	// parent deadline is earlier
+	parent, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ctx = newRequestCtx(parent, time.Minute)
+	deadline, _ = ctx.Deadline()
+	parentDeadline, _ := parent.Deadline()
+	assert.Equal(t, parentDeadline, deadline)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechotimeout
+
+import (
+	"bytes"
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-echo/middleware/context"
+	"github.com/rookie-ninja/rk-entry/v2/error"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ResponseFunc writes response of timed out request.
+//
+// It is called with original writer of echo.Context, errResp is the timeout error of rk-entry.
+type ResponseFunc func(ctx echo.Context, errResp rkerror.ErrorInterface) error
+
+// TemplateData is passed to HTML template of timeout response
+type TemplateData struct {
+	Code       int
+	Status     string
+	Message    string
+	Path       string
+	RequestId  string
+	RetryAfter int
+}
+
+// defaultResponse writes timeout error as JSON
+func defaultResponse(ctx echo.Context, errResp rkerror.ErrorInterface) error {
+	return ctx.JSON(errResp.Code(), errResp)
+}
+
+// NewResponse creates ResponseFunc with status code, content type, body and Retry-After header.
+//
+// Timeout error with status code will be written as JSON if body is empty.
+// Status code of timeout error will be used if code is zero, Retry-After will be ignored if it is not positive.
+func NewResponse(code int, contentType string, body []byte, retryAfter time.Duration) ResponseFunc {
+	return func(ctx echo.Context, errResp rkerror.ErrorInterface) error {
+		status := code
+		if status == 0 {
+			status = errResp.Code()
+		}
+
+		setRetryAfter(ctx, retryAfter)
+
+		if len(body) < 1 {
+			return ctx.JSON(status, rkmid.GetErrorBuilder().New(status, errResp.Message(), errResp.Details()...))
+		}
+
+		if len(contentType) < 1 {
+			return ctx.Blob(status, echo.MIMETextPlainCharsetUTF8, body)
+		}
+
+		return ctx.Blob(status, contentType, body)
+	}
+}
+
+// NewTemplateResponse creates ResponseFunc which renders HTML template with TemplateData.
+//
+// Status code of timeout error will be used if code is zero, Retry-After will be ignored if it is not positive.
+func NewTemplateResponse(code int, tmpl *template.Template, retryAfter time.Duration) ResponseFunc {
+	return func(ctx echo.Context, errResp rkerror.ErrorInterface) error {
+		status := code
+		if status == 0 {
+			status = errResp.Code()
+		}
+
+		data := &TemplateData{
+			Code:       status,
+			Status:     http.StatusText(status),
+			Message:    errResp.Message(),
+			Path:       ctx.Request().URL.Path,
+			RequestId:  rkechoctx.GetRequestId(ctx),
+			RetryAfter: retryAfterSeconds(retryAfter),
+		}
+
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, data); err != nil {
+			return ctx.JSON(status, rkmid.GetErrorBuilder().New(status, errResp.Message(), errResp.Details()...))
+		}
+
+		setRetryAfter(ctx, retryAfter)
+		return ctx.HTMLBlob(status, buf.Bytes())
+	}
+}
+
+// setRetryAfter sets Retry-After header in seconds
+func setRetryAfter(ctx echo.Context, retryAfter time.Duration) {
+	if seconds := retryAfterSeconds(retryAfter); seconds > 0 {
+		ctx.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(seconds))
+	}
+}
+
+// retryAfterSeconds rounds duration up to seconds
+func retryAfterSeconds(retryAfter time.Duration) int {
+	if retryAfter <= 0 {
+		return 0
+	}
+
+	return int((retryAfter + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkechotimeout
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newResponseCtx() (echo.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	return echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/ut-path", nil), w), w
+}
+
+func TestDefaultResponse(t *testing.T) {
+	ctx, w := newResponseCtx()
+	assert.Nil(t, defaultResponse(ctx, rkmid.GetErrorBuilder().New(http.StatusRequestTimeout, "")))
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	assert.Empty(t, w.Header().Get(echo.HeaderRetryAfter))
+}
+
+func TestNewResponse(t *testing.T) {
+	errResp := rkmid.GetErrorBuilder().New(http.StatusRequestTimeout, "ut-message")
+
+	// with JSON body
+	ctx, w := newResponseCtx()
+	assert.Nil(t, NewResponse(http.StatusServiceUnavailable, "", nil, 1500*time.Millisecond)(ctx, errResp))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get(echo.HeaderRetryAfter))
+	assert.Contains(t, w.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+	assert.Contains(t, w.Body.String(), "ut-message")
+	assert.Contains(t, w.Body.String(), "503")
+
+	// with body and zero code
+	ctx, w = newResponseCtx()
+	assert.Nil(t, NewResponse(0, "", []byte("ut-body"), 0)(ctx, errResp))
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	assert.Empty(t, w.Header().Get(echo.HeaderRetryAfter))
+	assert.Equal(t, echo.MIMETextPlainCharsetUTF8, w.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "ut-body", w.Body.String())
+
+	// with content type
+	ctx, w = newResponseCtx()
+	assert.Nil(t, NewResponse(http.StatusGatewayTimeout, echo.MIMETextHTML, []byte("<p>ut</p>"), time.Second)(ctx, errResp))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, "1", w.Header().Get(echo.HeaderRetryAfter))
+	assert.Equal(t, echo.MIMETextHTML, w.Header().Get(echo.HeaderContentType))
+}
+
+func TestNewTemplateResponse(t *testing.T) {
+	errResp := rkmid.GetErrorBuilder().New(http.StatusRequestTimeout, "ut-message")
+
+	// happy case
+	tmpl := template.Must(template.New("ut").Parse("{{.Code}} {{.Status}} {{.Path}} {{.RetryAfter}} {{.Message}}"))
+	ctx, w := newResponseCtx()
+	assert.Nil(t, NewTemplateResponse(http.StatusServiceUnavailable, tmpl, 3*time.Second)(ctx, errResp))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "3", w.Header().Get(echo.HeaderRetryAfter))
+	assert.Equal(t, echo.MIMETextHTMLCharsetUTF8, w.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "503 Service Unavailable /ut-path 3 ut-message", w.Body.String())
+
+	// with failed template
+	tmpl = template.Must(template.New("ut").Parse("{{.Missing}}"))
+	ctx, w = newResponseCtx()
+	assert.Nil(t, NewTemplateResponse(0, tmpl, 0)(ctx, errResp))
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	assert.Contains(t, w.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+}
@@ -6,16 +6,28 @@
 package rkechotimeout
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
-	"github.com/labstack/echo/v4/middleware"
+	"net"
 	"net/http"
 	"sync"
+	"time"
 )
 
+// ErrTimedOut returned while hijacking connection of timed out request
+var ErrTimedOut = errors.New("request timed out")
+
 // Copied from https://github.com/gin-contrib/timeout/blob/master/writer.go
 
 // writer is a writer with memory buffer
+//
+// Writer switches to streaming mode once Flush() or Hijack() called if idleTimeout was provided,
+// buffered contents will be sent to original writer and further contents will not be buffered.
+//
+// Writer degrades to deadline-only mode once buffered contents exceed maxBufferBytes, buffered contents
+// will be sent to original writer and response will be truncated if timed out.
 type writer struct {
 	http.ResponseWriter
 	body         *bytes.Buffer
@@ -24,22 +36,55 @@ type writer struct {
 	timeout      bool
 	wroteHeaders bool
 	code         int
+	streaming    bool
+	degraded     bool
+	maxBuffer    int64
+	idleTimeout  time.Duration
+	idle         *idleWatcher
+	reqCtx       *requestCtx
 }
 
 // newWriter will return a timeout.Writer pointer
 func newWriter(w http.ResponseWriter, buf *bytes.Buffer) *writer {
-	middleware.Timeout()
 	return &writer{ResponseWriter: w, body: buf, headers: make(http.Header)}
 }
 
+// newStreamingWriter will return a writer in streaming mode with idle deadline,
+// reqCtx will be canceled once idle deadline exceeded.
+func newStreamingWriter(w http.ResponseWriter, idleTimeout time.Duration, reqCtx *requestCtx) *writer {
+	res := &writer{ResponseWriter: w, headers: w.Header(), idleTimeout: idleTimeout, streaming: true, reqCtx: reqCtx}
+	res.reqCtx.lift()
+	res.idle = newIdleWatcher(w, idleTimeout, res.expire)
+	return res
+}
+
 // Write will write data to response body
 func (w *writer) Write(data []byte) (int, error) {
-	if w.timeout || w.body == nil {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timeout {
 		return 0, nil
 	}
 
-	w.mu.Lock()
-	defer w.mu.Unlock()
+	if w.streaming || w.degraded {
+		if !w.wroteHeaders {
+			w.writeHeader(http.StatusOK)
+		}
+		w.idle.touch()
+		return w.ResponseWriter.Write(data)
+	}
+
+	if w.body == nil {
+		return 0, nil
+	}
+
+	// buffer is full, send contents to original writer directly
+	if w.maxBuffer > 0 && int64(w.body.Len()+len(data)) > w.maxBuffer {
+		w.degraded = true
+		w.flushBuffer()
+		return w.ResponseWriter.Write(data)
+	}
 
 	return w.body.Write(data)
 }
@@ -47,19 +92,148 @@ func (w *writer) Write(data []byte) (int, error) {
 // WriteHeader will write http status code
 func (w *writer) WriteHeader(code int) {
 	checkWriteHeaderCode(code)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	if w.timeout || w.wroteHeaders {
 		return
 	}
 
+	w.writeHeader(code)
+}
+
+func (w *writer) writeHeader(code int) {
+	w.wroteHeaders = true
+	w.code = code
+
+	if w.streaming || w.degraded {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+// Flush will switch writer to streaming mode and flush contents to original writer
+func (w *writer) Flush() {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	w.writeHeader(code)
+	if w.timeout || (!w.startStreaming() && !w.degraded) {
+		return
+	}
+
+	w.idle.touch()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
 }
 
-func (w *writer) writeHeader(code int) {
+// Hijack will switch writer to streaming mode and hijack connection from original writer,
+// returned connection resets idle deadline on each read and write.
+func (w *writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timeout {
+		return nil, nil, ErrTimedOut
+	}
+
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok || (!w.streaming && w.idleTimeout <= 0) {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// connection was taken over by caller, nothing should be written by writer
+	w.streaming = true
+	w.wroteHeaders = true
+	w.body = nil
+	w.reqCtx.lift()
+	if w.idle == nil {
+		w.idle = newIdleWatcher(w.ResponseWriter, w.idleTimeout, w.expire)
+	}
+
+	conn = w.idle.wrapConn(conn)
+	// make buffered reader and writer use wrapped connection if nothing buffered
+	if rw != nil && rw.Reader.Buffered() == 0 && rw.Writer.Buffered() == 0 {
+		rw.Reader.Reset(conn)
+		rw.Writer.Reset(conn)
+	}
+
+	return conn, rw, nil
+}
+
+// startStreaming sends buffered headers and contents to original writer and stops buffering,
+// false will be returned if streaming is not enabled.
+func (w *writer) startStreaming() bool {
+	if w.streaming {
+		return true
+	}
+
+	if w.idleTimeout <= 0 {
+		return false
+	}
+
+	// contents were sent already if degraded
+	if !w.degraded {
+		w.flushBuffer()
+	}
+
+	w.streaming = true
+	w.reqCtx.lift()
+	w.idle = newIdleWatcher(w.ResponseWriter, w.idleTimeout, w.expire)
+
+	return true
+}
+
+// flushBuffer sends buffered headers, code and contents to original writer
+func (w *writer) flushBuffer() {
+	// copy headers and code
+	dst := w.ResponseWriter.Header()
+	for k, vv := range w.headers {
+		dst[k] = vv
+	}
+	w.headers = dst
+
+	code := w.code
+	if code == 0 {
+		code = http.StatusOK
+	}
 	w.wroteHeaders = true
 	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+
+	// copy contents
+	if w.body != nil && w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
+
+// truncate aborts response which was degraded to deadline-only mode,
+// contents written afterwards will be dropped.
+func (w *writer) truncate() {
+	// unblock pending write before acquiring lock
+	if deadliner := findWriteDeadliner(w.ResponseWriter); deadliner != nil {
+		deadliner.SetWriteDeadline(time.Now())
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timeout = true
+}
+
+// expire marks writer as timed out and cancels request context once idle deadline exceeded
+func (w *writer) expire() {
+	w.mu.Lock()
+	w.timeout = true
+	w.mu.Unlock()
+
+	w.reqCtx.expire()
 }
 
 // Header will get response headers
@@ -7,8 +7,12 @@
 package rkechotimeout
 
 import (
+	"bytes"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -27,3 +31,46 @@ func TestWriteHeader(t *testing.T) {
 		writer.WriteHeader(code2)
 	})
 }
+
+func TestWriter_Flush(t *testing.T) {
+	// without idle timeout, contents will be kept in buffer
+	recorder := httptest.NewRecorder()
+	w := newWriter(recorder, &bytes.Buffer{})
+	w.Write([]byte("ut-message"))
+	w.Flush()
+	assert.False(t, w.streaming)
+	assert.Empty(t, recorder.Body.String())
+
+	// with idle timeout, writer switches to streaming
+	recorder = httptest.NewRecorder()
+	w = newWriter(recorder, &bytes.Buffer{})
+	w.idleTimeout = time.Minute
+	w.Header().Set("ut-key", "ut-value")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("ut-message"))
+	w.Flush()
+	defer w.idle.stop()
+
+	assert.True(t, w.streaming)
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "ut-value", recorder.Header().Get("ut-key"))
+	assert.Equal(t, "ut-message", recorder.Body.String())
+
+	// further contents will be sent directly
+	w.Write([]byte("-next"))
+	assert.Equal(t, "ut-message-next", recorder.Body.String())
+}
+
+func TestWriter_Hijack(t *testing.T) {
+	// not supported by original writer
+	w := newWriter(httptest.NewRecorder(), &bytes.Buffer{})
+	w.idleTimeout = time.Minute
+	_, _, err := w.Hijack()
+	assert.Equal(t, http.ErrNotSupported, err)
+
+	// timed out
+	w.timeout = true
+	_, _, err = w.Hijack()
+	assert.Equal(t, ErrTimedOut, err)
+}